@@ -59,16 +59,16 @@ func newExportCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "export [database] [table] [filename]",
 		Short: "Export records of a table to a specified format",
-		Long:  `Export all records from a specified table in a database to a specified format (e.g., CSV, XML).`,
+		Long:  `Export all records from a specified table in a database to a specified format (e.g., CSV, XML, JSON).`,
 		Run:   exportFunc,
 	}
-	cmd.Flags().StringVarP(&format, "format", "f", "csv", "Format to export (csv, xml)")
+	cmd.Flags().StringVarP(&format, "format", "f", "csv", "Format to export (csv, xml, json)")
 	return cmd
 }
 
 func exportFunc(cmd *cobra.Command, args []string) {
 	if len(args) != 3 {
-		fmt.Println("Usage: export [database] [table] [filename] --format=[csv|xml]")
+		fmt.Println("Usage: export [database] [table] [filename] --format=[csv|xml|json]")
 		return
 	}
 	databaseName, tableName, filename := args[0], args[1], args[2]
@@ -84,6 +84,11 @@ func exportFunc(cmd *cobra.Command, args []string) {
 		color.Red("Failed to initialize server: %v", err)
 		return
 	}
+	defer func() {
+		if err := server.Close(); err != nil {
+			color.Red("Failed to close server: %v", err)
+		}
+	}()
 
 	database, exists := server.Databases[databaseName]
 	if !exists {
@@ -97,7 +102,7 @@ func exportFunc(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	records, err := table.SelectAll()
+	records, err := table.SelectAllProto()
 	if err != nil {
 		color.Red("Error retrieving records from table %s: %v", tableName, err)
 		return
@@ -114,6 +119,11 @@ func exportFunc(cmd *cobra.Command, args []string) {
 			color.Red("Error exporting records to XML: %v", err)
 			return
 		}
+	case "json":
+		if err := exportJSON(table, filename); err != nil {
+			color.Red("Error exporting records to JSON: %v", err)
+			return
+		}
 	default:
 		color.Red("Unsupported format %s", format)
 		return
@@ -122,12 +132,30 @@ func exportFunc(cmd *cobra.Command, args []string) {
 	color.Green("Records were successfully exported to %s in %s format", filename, format)
 }
 
+// exportJSON writes every record of the table to the file as a JSON array.
+func exportJSON(table *data.Table, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := table.ExportJSONWhere(file, nil); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
 func listFunc(cmd *cobra.Command, args []string) {
 	server := data.NewServer()
 	if err := server.Initialize(); err != nil {
 		color.Red("Failed to initialize server: %v", err)
 		return
 	}
+	defer func() {
+		if err := server.Close(); err != nil {
+			color.Red("Failed to close server: %v", err)
+		}
+	}()
 
 	if len(args) == 0 {
 		databases := server.ListDatabases()
@@ -159,7 +187,7 @@ func listFunc(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	records, err := table.SelectAll()
+	records, err := table.SelectAllProto()
 	if err != nil {
 		color.Red("Error retrieving records from table %s: %v", tableName, err)
 		return
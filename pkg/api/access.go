@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// FieldAccess is the kind of access to a field checked by a FieldPolicy.
+type FieldAccess int
+
+const (
+	ReadField  FieldAccess = iota // The field is returned by a select or a query, or filtered or sorted on by a query
+	WriteField                    // The field is set by an insert or an update
+)
+
+// FieldPolicy reports whether the request may access a field of a table, so one table can serve clients with different permissions,
+// for example by looking up the role of the caller authenticated by a previous middleware in the context of the request.
+type FieldPolicy func(r *http.Request, database, table, field string, access FieldAccess) bool
+
+// fieldPolicyKey is the key of the FieldPolicy in the context of a request.
+type fieldPolicyKey struct{}
+
+// FieldAccessControl is a middleware that applies the policy to the requests reading or writing the records of a table:
+//   - an insert or an update of /tableAction setting a field the policy doesn't let the request write fails with 403 Forbidden,
+//     and nothing is written; a row of /import setting such a field is reported as failed and is not inserted;
+//   - a query or an export of /tableAction, a /sql query or a join of /join or /joinTables filtering, sorting or matching
+//     on a field the policy doesn't let the request read fails with 403 Forbidden,
+//     so the values of the field can't be guessed from the records matched;
+//   - the fields the policy doesn't let the request read are removed from the records returned by select, selectAll, query
+//     and export, from the records returned by /sql, and from the rows returned by /join and /joinTables.
+//
+// The primary key is always readable, and deletes are not checked. The admin endpoints are not covered
+// and must be restricted separately. For example:
+//
+//	handler := api.FieldAccessControl(policy, api.SetupRoutes(server))
+func FieldAccessControl(policy FieldPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), fieldPolicyKey{}, policy)))
+	})
+}
+
+// fieldGuard checks the fields accessed by a table action against the FieldPolicy of the request, if any.
+type fieldGuard struct {
+	policy   FieldPolicy   // Policy of the request, nil if every field is accessible
+	request  *http.Request // Request performing the action
+	database string        // Name of the database of the table
+	table    *data.Table   // Table of the action
+	name     string        // Name of the table
+}
+
+// newFieldGuard returns the guard of the table action of the request.
+func newFieldGuard(r *http.Request, database, tableName string, table *data.Table) fieldGuard {
+	policy, _ := r.Context().Value(fieldPolicyKey{}).(FieldPolicy)
+	return fieldGuard{policy: policy, request: r, database: database, table: table, name: tableName}
+}
+
+// allowed reports whether the field can be accessed.
+func (g fieldGuard) allowed(field string, access FieldAccess) bool {
+	if g.policy == nil || (access == ReadField && field == g.table.PrimaryKey) {
+		return true
+	}
+	return g.policy(g.request, g.database, g.name, field, access)
+}
+
+// checkWrite returns an error naming the first field of the record, in sorted order, that can't be written.
+func (g fieldGuard) checkWrite(record data.Record) error {
+	if g.policy == nil {
+		return nil
+	}
+	fields := make([]string, 0, len(record))
+	for field := range record {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if !g.allowed(field, WriteField) {
+			return fmt.Errorf("writing field '%s' is forbidden", field)
+		}
+	}
+	return nil
+}
+
+// checkQuery returns an error naming a field the query filters or sorts on that can't be read.
+func (g fieldGuard) checkQuery(query data.Query) error {
+	if g.policy == nil {
+		return nil
+	}
+	fields := make([]string, 0, len(query.Filters)+1)
+	for field := range query.Filters {
+		fields = append(fields, field)
+	}
+	if query.SortBy != "" {
+		fields = append(fields, query.SortBy)
+	}
+	if query.Where != nil {
+		fields = appendFilterFields(fields, *query.Where)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if !g.allowed(field, ReadField) {
+			return fmt.Errorf("reading field '%s' is forbidden", field)
+		}
+	}
+	return nil
+}
+
+// appendFilterFields appends the fields compared by the filter and its nested filters.
+func appendFilterFields(fields []string, filter data.Filter) []string {
+	if filter.Field != "" {
+		fields = append(fields, filter.Field)
+	}
+	for _, nested := range append(filter.And, filter.Or...) {
+		fields = appendFilterFields(fields, nested)
+	}
+	return fields
+}
+
+// joinGuard checks the fields accessed by a join against the FieldPolicy of the request, if any.
+// The rows of a join hold the fields of the first table prefixed with "t1." and those of the second table prefixed with "t2.".
+type joinGuard struct {
+	left  fieldGuard // Guard of the first table
+	right fieldGuard // Guard of the second table
+}
+
+// newJoinGuard returns the guard of the join of the request.
+func newJoinGuard(r *http.Request, ref1, ref2 data.TableRef, table1, table2 *data.Table) joinGuard {
+	return joinGuard{
+		left:  newFieldGuard(r, ref1.Database, ref1.Table, table1),
+		right: newFieldGuard(r, ref2.Database, ref2.Table, table2),
+	}
+}
+
+// guardOf returns the guard of the table a prefixed field of a joined row belongs to, and the name of the field in that table.
+// It returns false if the field has neither prefix.
+func (g joinGuard) guardOf(field string) (fieldGuard, string, bool) {
+	if name, found := strings.CutPrefix(field, "t1."); found {
+		return g.left, name, true
+	}
+	if name, found := strings.CutPrefix(field, "t2."); found {
+		return g.right, name, true
+	}
+	return fieldGuard{}, "", false
+}
+
+// checkJoin returns an error naming a key field the join matches on, or a prefixed field the filter of its rows compares,
+// that can't be read.
+func (g joinGuard) checkJoin(key1, key2 string, where *data.Filter) error {
+	if !g.left.allowed(key1, ReadField) {
+		return fmt.Errorf("reading field '%s' is forbidden", "t1."+key1)
+	}
+	if !g.right.allowed(key2, ReadField) {
+		return fmt.Errorf("reading field '%s' is forbidden", "t2."+key2)
+	}
+	if where == nil {
+		return nil
+	}
+	fields := appendFilterFields(nil, *where)
+	sort.Strings(fields)
+	for _, field := range fields {
+		if guard, name, ok := g.guardOf(field); ok && !guard.allowed(name, ReadField) {
+			return fmt.Errorf("reading field '%s' is forbidden", field)
+		}
+	}
+	return nil
+}
+
+// strip removes the fields that can't be read from the joined row.
+func (g joinGuard) strip(row map[string]interface{}) {
+	if g.left.policy == nil {
+		return
+	}
+	for field := range row {
+		if guard, name, ok := g.guardOf(field); ok && !guard.allowed(name, ReadField) {
+			delete(row, field)
+		}
+	}
+}
+
+// strip removes the fields that can't be read from the record.
+func (g fieldGuard) strip(record data.Record) {
+	if g.policy == nil {
+		return
+	}
+	for field := range record {
+		if !g.allowed(field, ReadField) {
+			delete(record, field)
+		}
+	}
+}
+
+// stripRaw removes the fields that can't be read from the protobuf records, which must be copies of the records of the table.
+func (g fieldGuard) stripRaw(records *dbdata.Records) {
+	if g.policy == nil {
+		return
+	}
+	for _, record := range records.GetRecords() {
+		for field := range record.GetFields() {
+			if !g.allowed(field, ReadField) {
+				delete(record.Fields, field)
+			}
+		}
+	}
+}
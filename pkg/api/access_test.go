@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+// hideSalaries is a policy letting requests read and write every field but "salary".
+func hideSalaries(r *http.Request, database, table, field string, access FieldAccess) bool {
+	return field != "salary"
+}
+
+// newGuardedServer creates a test server with a "users" table and an "orders" table linked by "userId",
+// and returns a function serving the requests through FieldAccessControl with hideSalaries.
+func newGuardedServer(t *testing.T) func(r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	server, users := newTestServer(t, data.Config{})
+	orders, err := server.GetOrCreateTable("testdb", "orders", "id")
+	if err != nil {
+		t.Fatalf("GetOrCreateTable failed: %v", err)
+	}
+	if err := users.Insert(data.Record{"id": "u1", "name": "Ana", "salary": 1000}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := orders.Insert(data.Record{"id": "o1", "userId": "u1", "salary": 5}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	handler := FieldAccessControl(hideSalaries, SetupRoutes(server))
+	return func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+}
+
+func TestFieldAccessControlTableAction(t *testing.T) {
+	serveGuarded := newGuardedServer(t)
+	target := "/tableAction?dbName=testdb"
+
+	w := serveGuarded(httptest.NewRequest("GET", target+"&tableName=users&key=u1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("select status = %d, body %q", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "salary") || !strings.Contains(w.Body.String(), "Ana") {
+		t.Errorf("select returned %q, want the record without its salary", w.Body.String())
+	}
+
+	w = serveGuarded(postJSON(t, target, map[string]interface{}{
+		"action": "insert", "tableName": "users", "record": map[string]interface{}{"id": "u2", "salary": 1},
+	}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("insert of a forbidden field status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = serveGuarded(postJSON(t, target, map[string]interface{}{
+		"action": "query", "tableName": "users", "query": map[string]interface{}{"Filters": map[string]interface{}{"salary": 1000}},
+	}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("query filtering on a forbidden field status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestFieldAccessControlSQLAndImport(t *testing.T) {
+	serveGuarded := newGuardedServer(t)
+
+	w := serveGuarded(postJSON(t, "/sql?dbName=testdb", map[string]string{"query": "SELECT * FROM users"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/sql status = %d, body %q", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "salary") {
+		t.Errorf("/sql returned %q, want the records without their salary", w.Body.String())
+	}
+
+	w = serveGuarded(postJSON(t, "/sql?dbName=testdb", map[string]string{"query": "SELECT * FROM users ORDER BY salary"}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("/sql sorting on a forbidden field status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	body := strings.NewReader(`{"id": "u2", "name": "Bo"}` + "\n" + `{"id": "u3", "salary": 1}` + "\n")
+	w = serveGuarded(httptest.NewRequest("POST", "/import?dbName=testdb&tableName=users&onError=skip", body))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	var progress importProgress
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &progress); err != nil {
+		t.Fatalf("invalid import summary %q: %v", w.Body.String(), err)
+	}
+	if progress.Inserted != 1 || progress.Failed != 1 || len(progress.Errors) != 1 || progress.Errors[0].Line != 2 {
+		t.Errorf("import summary = %+v, want line 2 rejected and the other row inserted", progress)
+	}
+}
+
+func TestFieldAccessControlJoins(t *testing.T) {
+	serveGuarded := newGuardedServer(t)
+	join := map[string]interface{}{"db": "testdb", "table1": "users", "key1": "id", "table2": "orders", "key2": "userId"}
+
+	w := serveGuarded(postJSON(t, "/join", join))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/join status = %d, body %q", w.Code, w.Body.String())
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("invalid /join response %q: %v", w.Body.String(), err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("/join returned %d rows, want 1", len(rows))
+	}
+	for _, field := range []string{"t1.salary", "t2.salary"} {
+		if _, exists := rows[0][field]; exists {
+			t.Errorf("/join row holds the forbidden field %s", field)
+		}
+	}
+	if rows[0]["t1.name"] != "Ana" || rows[0]["t2.id"] != "o1" {
+		t.Errorf("/join row = %v, want the readable fields of both tables", rows[0])
+	}
+
+	join["where"] = map[string]interface{}{"field": "t1.salary", "op": ">", "value": 500}
+	w = serveGuarded(postJSON(t, "/join", join))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("/join filtering on a forbidden field status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	delete(join, "where")
+	join["key2"] = "salary"
+	w = serveGuarded(postJSON(t, "/join", join))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("/join matching on a forbidden field status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = serveGuarded(postJSON(t, "/joinTables?dbName=testdb", map[string]interface{}{
+		"table1": "users", "key1": "id", "table2": "orders", "key2": "userId",
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/joinTables status = %d, body %q", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "salary") || !strings.Contains(w.Body.String(), "Ana") {
+		t.Errorf("/joinTables returned %q, want the rows without the salaries", w.Body.String())
+	}
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+// compactedTable reports the compaction of a table.
+type compactedTable struct {
+	Database       string `json:"database"`       // Name of the database of the table
+	Table          string `json:"table"`          // Name of the table
+	BytesReclaimed int64  `json:"bytesReclaimed"` // Size of the file before the compaction minus its size after
+}
+
+// vacuumedTable reports the vacuum of a table.
+type vacuumedTable struct {
+	Database    string `json:"database"`    // Name of the database of the table
+	Table       string `json:"table"`       // Name of the table
+	Records     int    `json:"records"`     // Number of live records rewritten
+	BytesBefore int64  `json:"bytesBefore"` // Size of the files of the table before the vacuum
+	BytesAfter  int64  `json:"bytesAfter"`  // Size of the files of the table after the vacuum
+}
+
+// reindexedTable reports the rebuild of the indexes of a table.
+type reindexedTable struct {
+	Database   string  `json:"database"`   // Name of the database of the table
+	Table      string  `json:"table"`      // Name of the table
+	DurationMs float64 `json:"durationMs"` // Time taken to rebuild the indexes, in milliseconds
+}
+
+// adminTarget is a table selected by an admin request.
+type adminTarget struct {
+	Database string      // Name of the database of the table
+	Name     string      // Name of the table
+	Table    *data.Table // Table
+}
+
+// targetTables returns the tables selected by the database and table query parameters of an admin request,
+// sorted by database and table name: a single table, every table of a database, or every table of the server.
+// It writes an error response and returns false if the parameters are invalid or select nothing.
+func targetTables(server *data.Server, w http.ResponseWriter, r *http.Request) ([]adminTarget, bool) {
+	dbName := r.URL.Query().Get("database")
+	tableName := r.URL.Query().Get("table")
+	if dbName == "" && tableName != "" {
+		http.Error(w, "The database is required when a table is given", http.StatusBadRequest)
+		return nil, false
+	}
+
+	server.RLock()
+	databases := make(map[string]*data.Database, len(server.Databases))
+	for name, db := range server.Databases {
+		if dbName == "" || name == dbName {
+			databases[name] = db
+		}
+	}
+	server.RUnlock()
+	if dbName != "" && len(databases) == 0 {
+		http.Error(w, "Database not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	var targets []adminTarget
+	for name, db := range databases {
+		db.RLock()
+		for tName, table := range db.Tables {
+			if tableName == "" || tName == tableName {
+				targets = append(targets, adminTarget{Database: name, Name: tName, Table: table})
+			}
+		}
+		db.RUnlock()
+	}
+	if tableName != "" && len(targets) == 0 {
+		http.Error(w, "Table not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Database != targets[j].Database {
+			return targets[i].Database < targets[j].Database
+		}
+		return targets[i].Name < targets[j].Name
+	})
+	return targets, true
+}
+
+func CompactHandler(server *data.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		targets, ok := targetTables(server, w, r)
+		if !ok {
+			return
+		}
+
+		var total int64
+		compacted := make([]compactedTable, 0, len(targets))
+		for _, target := range targets {
+			reclaimed, err := target.Table.Compact()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to compact table '%s' of database '%s': %v", target.Name, target.Database, err), http.StatusInternalServerError)
+				return
+			}
+			compacted = append(compacted, compactedTable{Database: target.Database, Table: target.Name, BytesReclaimed: reclaimed})
+			total += reclaimed
+		}
+
+		response := struct {
+			BytesReclaimed int64            `json:"bytesReclaimed"`
+			Tables         []compactedTable `json:"tables"`
+		}{BytesReclaimed: total, Tables: compacted}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func VacuumHandler(server *data.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		targets, ok := targetTables(server, w, r)
+		if !ok {
+			return
+		}
+
+		var before, after int64
+		vacuumed := make([]vacuumedTable, 0, len(targets))
+		for _, target := range targets {
+			result, err := target.Table.Vacuum()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to vacuum table '%s' of database '%s': %v", target.Name, target.Database, err), http.StatusInternalServerError)
+				return
+			}
+			vacuumed = append(vacuumed, vacuumedTable{
+				Database:    target.Database,
+				Table:       target.Name,
+				Records:     result.Records,
+				BytesBefore: result.BytesBefore,
+				BytesAfter:  result.BytesAfter,
+			})
+			before += result.BytesBefore
+			after += result.BytesAfter
+		}
+
+		response := struct {
+			BytesBefore int64           `json:"bytesBefore"`
+			BytesAfter  int64           `json:"bytesAfter"`
+			Tables      []vacuumedTable `json:"tables"`
+		}{BytesBefore: before, BytesAfter: after, Tables: vacuumed}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func ReindexHandler(server *data.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		targets, ok := targetTables(server, w, r)
+		if !ok {
+			return
+		}
+
+		var total time.Duration
+		reindexed := make([]reindexedTable, 0, len(targets))
+		for _, target := range targets {
+			start := time.Now()
+			if err := target.Table.RebuildIndexes(); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to rebuild the indexes of table '%s' of database '%s': %v", target.Name, target.Database, err), http.StatusInternalServerError)
+				return
+			}
+			elapsed := time.Since(start)
+			reindexed = append(reindexed, reindexedTable{Database: target.Database, Table: target.Name, DurationMs: milliseconds(elapsed)})
+			total += elapsed
+		}
+
+		response := struct {
+			DurationMs float64          `json:"durationMs"`
+			Tables     []reindexedTable `json:"tables"`
+		}{DurationMs: milliseconds(total), Tables: reindexed}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// milliseconds returns the duration in milliseconds, with a microsecond precision.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
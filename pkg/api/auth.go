@@ -0,0 +1,49 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+// AdminTokenEnv is the environment variable holding the token required by the admin endpoints.
+const AdminTokenEnv = "PROTODB_ADMIN_TOKEN"
+
+// RequireAdminToken is a middleware that only lets through the requests sending the admin token
+// as a bearer token in the Authorization header. The token is read from the PROTODB_ADMIN_TOKEN environment variable;
+// if it is not set, every request is rejected, so the admin endpoints are disabled by default.
+func RequireAdminToken(next http.Handler) http.Handler {
+	return requireToken(func() string { return os.Getenv(AdminTokenEnv) }, next)
+}
+
+// RequireServerAdminToken is like RequireAdminToken, but the token is the one set by data.Config.AdminToken
+// for the server, if any, and is read from the PROTODB_ADMIN_TOKEN environment variable otherwise.
+func RequireServerAdminToken(server *data.Server, next http.Handler) http.Handler {
+	return requireToken(func() string {
+		if token := server.AdminToken(); token != "" {
+			return token
+		}
+		return os.Getenv(AdminTokenEnv)
+	}, next)
+}
+
+// requireToken lets through the requests sending the token returned by tokenOf as a bearer token.
+func requireToken(tokenOf func() string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := tokenOf()
+		if token == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+// collectionETag returns the ETag of the response of a selectAll or query action on the table: a digest of the version
+// of the table and of everything else the response depends on, the action, the query, the URL query and the Accept header.
+// It must be computed before the records are read, so the records are at least as recent as the ETag.
+// The ETag is weak, as the same records may be sent compressed or not by the Gzip middleware.
+func collectionETag(table *data.Table, r *http.Request, action string, query data.Query) string {
+	encodedQuery, _ := json.Marshal(query)
+	hash := sha256.New()
+	for _, part := range []string{table.FilePath, table.Version(), action, string(encodedQuery), r.URL.RawQuery, r.Header.Get("Accept")} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return `W/"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// notModified sets the ETag header of the response and reports whether the If-None-Match header of the request matches it,
+// in which case it writes 304 Not Modified, and the caller must not write a body.
+// If-None-Match uses the weak comparison, so W/ prefixes are ignored.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
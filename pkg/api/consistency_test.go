@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+func TestReadYourWritesWithWriteDebounce(t *testing.T) {
+	// The window outlasts the test, so every write stays pending in memory
+	server, users := newTestServer(t, data.Config{WriteDebounce: time.Hour})
+	target := "/tableAction?dbName=testdb"
+	fileBefore, _ := os.ReadFile(users.FilePath)
+
+	selectName := func(key string) (int, interface{}) {
+		w := serve(server, httptest.NewRequest("GET", target+"&tableName=users&key="+key, nil))
+		var record map[string]interface{}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &record); err != nil {
+				t.Fatalf("invalid select response %q: %v", w.Body.String(), err)
+			}
+		}
+		return w.Code, record["name"]
+	}
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("u%d", i)
+		w := serve(server, postJSON(t, target, map[string]interface{}{
+			"action": "insert", "tableName": "users", "record": map[string]interface{}{"id": key, "name": "inserted"},
+		}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("insert status = %d, body %q", w.Code, w.Body.String())
+		}
+		if code, name := selectName(key); code != http.StatusOK || name != "inserted" {
+			t.Fatalf("select after insert %d = %d with name %v, want the inserted record", i, code, name)
+		}
+
+		w = serve(server, postJSON(t, target, map[string]interface{}{
+			"action": "update", "tableName": "users", "key": key, "updates": map[string]interface{}{"name": "updated"},
+		}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("update status = %d, body %q", w.Code, w.Body.String())
+		}
+		if code, name := selectName(key); code != http.StatusOK || name != "updated" {
+			t.Fatalf("select after update %d = %d with name %v, want the updated record", i, code, name)
+		}
+
+		if i%2 == 0 {
+			w = serve(server, postJSON(t, target, map[string]interface{}{"action": "delete", "tableName": "users", "key": key}))
+			if w.Code != http.StatusOK {
+				t.Fatalf("delete status = %d, body %q", w.Code, w.Body.String())
+			}
+			if code, _ := selectName(key); code != http.StatusNotFound {
+				t.Fatalf("select after delete %d = %d, want %d", i, code, http.StatusNotFound)
+			}
+		}
+	}
+
+	// The reads above were served while the writes were still pending
+	if fileAfter, _ := os.ReadFile(users.FilePath); !bytes.Equal(fileAfter, fileBefore) {
+		t.Fatal("the table file changed during the debounce window, want the writes still pending")
+	}
+	if count, err := users.Count(); err != nil || count != 10 {
+		t.Errorf("Count = %d, %v, want 10", count, err)
+	}
+
+	// A backup writes the pending writes first
+	if _, err := server.BackupDatabases(); err != nil {
+		t.Fatalf("BackupDatabases failed: %v", err)
+	}
+	if fileAfter, _ := os.ReadFile(users.FilePath); bytes.Equal(fileAfter, fileBefore) {
+		t.Error("the table file is unchanged after BackupDatabases, want the pending writes flushed")
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GzipMinSize is the size in bytes from which Gzip compresses a response.
+// Smaller responses are sent as they are, since compressing them would save little and could make them larger.
+const GzipMinSize = 1024
+
+// Gzip is a middleware that compresses the responses with gzip when the client accepts it in the Accept-Encoding header.
+// The start of the response is buffered until it reaches GzipMinSize bytes, so smaller responses are sent uncompressed.
+// Responses that already have a Content-Encoding, or whose Content-Type is an already compressed format
+// such as gzip, zip or an image, are not compressed again, and neither are the responses to HEAD requests.
+func Gzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of the request accepts gzip with a non-zero quality.
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if quality, err := strconv.ParseFloat(q, 64); err == nil && quality == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter is an http.ResponseWriter that compresses the response with gzip once it is known to be large enough.
+type gzipResponseWriter struct {
+	http.ResponseWriter              // Writer of the response sent to the client
+	status              int          // Status code set by the handler
+	wroteHeader         bool         // Whether the handler set the status code
+	buffer              []byte       // Start of the response, held until the writer decides whether to compress it
+	decided             bool         // Whether the header was sent and the response is compressed or not
+	gz                  *gzip.Writer // Writer compressing the response, nil if it is sent uncompressed
+}
+
+// WriteHeader records the status code, which is sent with the header once the writer decides whether to compress the response.
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader || w.decided {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+}
+
+// Write buffers the start of the response until it reaches GzipMinSize bytes, then writes it compressed or not.
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buffer = append(w.buffer, b...)
+		if len(w.buffer) < GzipMinSize {
+			return len(b), nil
+		}
+		if err := w.decide(w.compressible()); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Close sends the buffered response if it is still too small to be compressed, or ends the compressed stream.
+func (w *gzipResponseWriter) Close() error {
+	if !w.decided {
+		return w.decide(false)
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+// Flush sends the response written so far to the client, compressed or not depending on its start,
+// so the handlers streaming a response, such as ImportHandler, can report their progress.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(w.compressible()); err != nil {
+			return
+		}
+	}
+	if w.gz != nil {
+		if err := w.gz.Flush(); err != nil {
+			return
+		}
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the writer of the response sent to the client, for http.ResponseController.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// compressible reports whether the response can be compressed, given its status and its header.
+func (w *gzipResponseWriter) compressible() bool {
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buffer)
+	}
+	for _, compressed := range []string{"application/gzip", "application/x-gzip", "application/zip", "application/zstd", "image/", "video/", "audio/"} {
+		if strings.HasPrefix(contentType, compressed) && contentType != "image/svg+xml" {
+			return false
+		}
+	}
+	return true
+}
+
+// decide sends the header, compressing the response or not, and writes the buffered start of the response.
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if compress {
+		if header.Get("Content-Type") == "" {
+			// Detect the type on the plain content, since the server would detect it on the compressed one
+			header.Set("Content-Type", http.DetectContentType(w.buffer))
+		}
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buffered := w.buffer
+	w.buffer = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buffered)
+	} else {
+		_, err = w.ResponseWriter.Write(buffered)
+	}
+	return err
+}
@@ -1,9 +1,15 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/Malpizarr/dbproto/pkg/data"
 )
@@ -23,7 +29,7 @@ func CreateDatabaseHandler(server *data.Server) http.HandlerFunc {
 			return
 		}
 		if err := server.CreateDatabase(payload.Name); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), createErrorStatus(err))
 			return
 		}
 		fmt.Fprintf(w, "Database '%s' created successfully.", payload.Name)
@@ -44,22 +50,34 @@ func CreateTableHandler(server *data.Server) http.HandlerFunc {
 		}
 
 		var payload struct {
-			TableName  string `json:"tableName"`
-			PrimaryKey string `json:"primaryKey"`
+			TableName    string `json:"tableName"`
+			PrimaryKey   string `json:"primaryKey"`
+			KeyGenerator string `json:"keyGenerator,omitempty"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
+		var opts []data.TableOption
+		switch payload.KeyGenerator {
+		case "":
+		case data.UUIDKeyGenerator:
+			opts = append(opts, data.WithUUIDKeys())
+		default:
+			http.Error(w, fmt.Sprintf("Unknown key generator '%s'", payload.KeyGenerator), http.StatusBadRequest)
+			return
+		}
 
+		server.RLock()
 		db, exists := server.Databases[dbName]
+		server.RUnlock()
 		if !exists {
 			http.Error(w, "Database not found", http.StatusNotFound)
 			return
 		}
 
-		if err := db.CreateTable(payload.TableName, payload.PrimaryKey); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := db.CreateTable(payload.TableName, payload.PrimaryKey, opts...); err != nil {
+			http.Error(w, err.Error(), createErrorStatus(err))
 			return
 		}
 		fmt.Fprintf(w, "Table '%s' created successfully in database '%s'.", payload.TableName, dbName)
@@ -83,8 +101,8 @@ func ListDatabasesHandler(server *data.Server) http.HandlerFunc {
 
 func TableActionHandler(server *data.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" {
-			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		if r.Method != "POST" && r.Method != "GET" {
+			http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
@@ -94,7 +112,9 @@ func TableActionHandler(server *data.Server) http.HandlerFunc {
 			return
 		}
 
+		server.RLock()
 		db, exists := server.Databases[dbName]
+		server.RUnlock()
 		if !exists {
 			http.Error(w, "Database not found", http.StatusNotFound)
 			return
@@ -106,46 +126,220 @@ func TableActionHandler(server *data.Server) http.HandlerFunc {
 			Record    data.Record `json:"record,omitempty"`
 			Key       string      `json:"key,omitempty"`
 			Updates   data.Record `json:"updates,omitempty"`
+			Query     data.Query  `json:"query,omitempty"`
 		}
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		// Decode numbers as json.Number so integers keep their exact value instead of being rounded to float64
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if r.Method == "GET" {
+			// A GET selects the record named by the query, such as the Location returned by an insert
+			payload.Action = "select"
+			payload.TableName = r.URL.Query().Get("tableName")
+			payload.Key = r.URL.Query().Get("key")
+		} else if err := decoder.Decode(&payload); err != nil {
+			if errors.Is(err, io.EOF) {
+				http.Error(w, "Request body is required", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, data.ErrInvalidFilter) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
+		if err := validateTableAction(payload.Action, payload.TableName, payload.Record, payload.Key, payload.Updates); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
+		db.RLock()
 		table, exists := db.Tables[payload.TableName]
+		db.RUnlock()
 		if !exists {
 			http.Error(w, "Table not found", http.StatusNotFound)
 			return
 		}
 
+		guard := newFieldGuard(r, dbName, payload.TableName, table)
+		var accessErr error
 		switch payload.Action {
 		case "insert":
-			if err := table.Insert(payload.Record); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			accessErr = guard.checkWrite(payload.Record)
+		case "update":
+			accessErr = guard.checkWrite(payload.Updates)
+		case "query", "export":
+			accessErr = guard.checkQuery(payload.Query)
+		}
+		if accessErr != nil {
+			http.Error(w, accessErr.Error(), http.StatusForbidden)
+			return
+		}
+
+		// Don't let a request wait forever for the table lock while other writers hold it
+		ctx, cancel := context.WithTimeout(r.Context(), DefaultLockTimeout)
+		defer cancel()
+
+		switch payload.Action {
+		case "insert":
+			key, err := table.InsertReturningKey(ctx, payload.Record)
+			if err != nil {
+				http.Error(w, err.Error(), writeErrorStatus(err))
+				return
+			}
+			if supplied, err := table.KeyOf(payload.Record); err != nil || supplied != key {
+				// The key was assigned by the server, so tell the client where the record is
+				location := url.URL{Path: r.URL.Path, RawQuery: url.Values{
+					"dbName":    {dbName},
+					"tableName": {payload.TableName},
+					"key":       {key},
+				}.Encode()}
+				w.Header().Set("Location", location.String())
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				if err := json.NewEncoder(w).Encode(map[string]string{"key": key}); err != nil {
+					http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+				}
 				return
 			}
 		case "update":
-			if err := table.Update(payload.Key, payload.Updates); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			var err error
+			if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+				err = table.UpdateIfMatch(ctx, payload.Key, ifMatch, payload.Updates)
+			} else {
+				err = table.UpdateContext(ctx, payload.Key, payload.Updates)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), writeErrorStatus(err))
 				return
 			}
 		case "delete":
-			if err := table.Delete(payload.Key); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			var err error
+			if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+				err = table.DeleteIfMatch(ctx, payload.Key, ifMatch)
+			} else {
+				err = table.DeleteContext(ctx, payload.Key)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), writeErrorStatus(err))
+				return
+			}
+		case "select":
+			record, etag, err := table.SelectWithETag(payload.Key)
+			if err != nil {
+				http.Error(w, err.Error(), writeErrorStatus(err))
 				return
 			}
+			record = projectFields(record, requestedFields(r))
+			guard.strip(record)
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(record); err != nil {
+				http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+			}
+			return
 		case "selectAll":
+			if maxRecords := server.MaxSelectAll(); maxRecords > 0 {
+				count, err := table.Count()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if count > maxRecords {
+					message := fmt.Sprintf("Table has %d records, more than the %d a selectAll returns; use the query action with limit and offset to read it in pages", count, maxRecords)
+					http.Error(w, message, http.StatusRequestEntityTooLarge)
+					return
+				}
+			}
+			if notModified(w, r, collectionETag(table, r, payload.Action, payload.Query)) {
+				return
+			}
+			if acceptsProtobuf(r) {
+				records, err := table.Raw()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				guard.stripRaw(records)
+				writeProtobuf(w, records)
+				return
+			}
 			records, err := table.SelectAll()
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			for _, record := range records {
+				guard.strip(record)
+			}
 			err = json.NewEncoder(w).Encode(records)
 			if err != nil {
 				http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
 				return
 			}
 			return
+		case "query":
+			if payload.Query.Where != nil {
+				if err := payload.Query.Where.Validate(); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if notModified(w, r, collectionETag(table, r, payload.Action, payload.Query)) {
+				return
+			}
+			if acceptsProtobuf(r) {
+				records, total, err := table.QueryRawWithTotal(payload.Query)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				guard.stripRaw(records)
+				w.Header().Set("X-Total-Count", strconv.Itoa(total))
+				writeProtobuf(w, records)
+				return
+			}
+			records, total, err := table.QueryWithTotal(payload.Query)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, record := range records {
+				guard.strip(record)
+			}
+			response := struct {
+				Total   int           `json:"total"`
+				Records []data.Record `json:"records"`
+			}{Total: total, Records: records}
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(response)
+			if err != nil {
+				http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+				return
+			}
+			return
+		case "export":
+			if payload.Query.Where != nil {
+				if err := payload.Query.Where.Validate(); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			matches := payload.Query.Predicate()
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", payload.TableName+".json"))
+			err := table.ExportJSONWhere(w, func(record data.Record) bool {
+				if !matches(record) {
+					return false
+				}
+				guard.strip(record)
+				return true
+			})
+			if err != nil {
+				// Once records were streamed the status is sent, so the error can only cut the response short
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
 		default:
 			http.Error(w, "Invalid action", http.StatusBadRequest)
 		}
@@ -173,6 +367,7 @@ func JoinTablesHandler(server *data.Server) http.HandlerFunc {
 			Key1     string        `json:"key1"`
 			Key2     string        `json:"key2"`
 			JoinType data.JoinType `json:"joinType"`
+			Coerce   bool          `json:"coerce"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&joinRequest); err != nil {
 			fmt.Printf("Error decoding JSON: %v\n", err)
@@ -180,25 +375,42 @@ func JoinTablesHandler(server *data.Server) http.HandlerFunc {
 			return
 		}
 
+		server.RLock()
 		db, exists := server.Databases[dbName]
+		server.RUnlock()
 		if !exists {
 			http.Error(w, "Database not found", http.StatusNotFound)
 			return
 		}
 
+		db.RLock()
 		t1, exists1 := db.Tables[joinRequest.Table1]
 		t2, exists2 := db.Tables[joinRequest.Table2]
+		db.RUnlock()
 		if !exists1 || !exists2 {
 			http.Error(w, "One or both tables not found", http.StatusNotFound)
 			return
 		}
 
-		results, err := data.JoinTables(t1, t2, joinRequest.Key1, joinRequest.Key2, joinRequest.JoinType)
+		guard := newJoinGuard(r, data.TableRef{Database: dbName, Table: joinRequest.Table1}, data.TableRef{Database: dbName, Table: joinRequest.Table2}, t1, t2)
+		if err := guard.checkJoin(joinRequest.Key1, joinRequest.Key2, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		var opts []data.JoinOption
+		if joinRequest.Coerce {
+			opts = append(opts, data.WithCoercion())
+		}
+		results, err := data.JoinTables(t1, t2, joinRequest.Key1, joinRequest.Key2, joinRequest.JoinType, opts...)
 		if err != nil {
 			fmt.Printf("Error joining tables: %v\n", err)
 			http.Error(w, "Join operation failed: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		for _, row := range results {
+			guard.strip(row)
+		}
 
 		response, err := json.Marshal(results)
 		if err != nil {
@@ -211,3 +423,86 @@ func JoinTablesHandler(server *data.Server) http.HandlerFunc {
 		w.Write(response)
 	}
 }
+
+// validateTableAction checks that the payload of a table action has the fields the action needs,
+// so malformed requests, such as a null body or an insert without a record, are rejected with 400 Bad Request.
+func validateTableAction(action, tableName string, record data.Record, key string, updates data.Record) error {
+	if action == "" {
+		return fmt.Errorf("action is required")
+	}
+	if tableName == "" {
+		return fmt.Errorf("tableName is required")
+	}
+	switch action {
+	case "insert":
+		if len(record) == 0 {
+			return fmt.Errorf("record is required and must not be empty")
+		}
+	case "update":
+		if key == "" {
+			return fmt.Errorf("key is required")
+		}
+		if len(updates) == 0 {
+			return fmt.Errorf("updates are required and must not be empty")
+		}
+	case "delete", "select":
+		if key == "" {
+			return fmt.Errorf("key is required")
+		}
+	}
+	return nil
+}
+
+// requestedFields returns the fields listed in the comma-separated fields query parameter, or nil if it is not set.
+func requestedFields(r *http.Request) []string {
+	var fields []string
+	for _, field := range strings.Split(r.URL.Query().Get("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// projectFields returns the requested fields of the record, or the whole record if no field is requested.
+func projectFields(record data.Record, fields []string) data.Record {
+	if len(fields) == 0 {
+		return record
+	}
+	projected := make(data.Record, len(fields))
+	for _, field := range fields {
+		if value, exists := record[field]; exists {
+			projected[field] = value
+		}
+	}
+	return projected
+}
+
+// createErrorStatus returns the HTTP status code for an error returned when creating a database or a table.
+// Reaching a cap on the number of databases or tables is reported as 403 Forbidden.
+func createErrorStatus(err error) int {
+	if errors.Is(err, data.ErrLimitReached) || errors.Is(err, data.ErrReadOnly) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// writeErrorStatus returns the HTTP status code for an error returned by a write on a table.
+// Errors caused by the record sent by the client, such as a missing primary key, are reported as 400 Bad Request.
+func writeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, data.ErrLockTimeout):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, data.ErrInvalidPrimaryKey), errors.Is(err, data.ErrPrimaryKeyChange), errors.Is(err, data.ErrInvalidString):
+		return http.StatusBadRequest
+	case errors.Is(err, data.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, data.ErrUniqueViolation):
+		return http.StatusConflict
+	case errors.Is(err, data.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, data.ErrReadOnly), errors.Is(err, data.ErrEncryptedField):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
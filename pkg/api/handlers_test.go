@@ -0,0 +1,415 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+func TestTableActionIntegerKeys(t *testing.T) {
+	server, _ := newTestServer(t, data.Config{})
+	target := "/tableAction?dbName=testdb"
+
+	w := serve(server, postJSON(t, target, map[string]interface{}{
+		"action": "insert", "tableName": "users", "record": map[string]interface{}{"id": 5, "name": "five"},
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("insert status = %d, body %q", w.Code, w.Body.String())
+	}
+
+	w = serve(server, httptest.NewRequest("GET", target+"&tableName=users&key=5", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("select status = %d, body %q", w.Code, w.Body.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &record); err != nil {
+		t.Fatalf("invalid select response %q: %v", w.Body.String(), err)
+	}
+	if record["name"] != "five" {
+		t.Errorf("selected name = %v, want five", record["name"])
+	}
+
+	w = serve(server, postJSON(t, target, map[string]interface{}{
+		"action": "update", "tableName": "users", "key": "5", "updates": map[string]interface{}{"name": "updated"},
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body %q", w.Code, w.Body.String())
+	}
+
+	w = serve(server, postJSON(t, target, map[string]interface{}{"action": "delete", "tableName": "users", "key": "5"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, body %q", w.Code, w.Body.String())
+	}
+
+	w = serve(server, httptest.NewRequest("GET", target+"&tableName=users&key=5", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("select after delete status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTableActionRejectsMalformedInput(t *testing.T) {
+	server, users := newTestServer(t, data.Config{})
+	target := "/tableAction?dbName=testdb"
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty body", ""},
+		{"null body", "null"},
+		{"invalid JSON", "{"},
+		{"missing action", `{"tableName": "users"}`},
+		{"missing table", `{"action": "insert", "record": {"id": "a"}}`},
+		{"null record", `{"action": "insert", "tableName": "users", "record": null}`},
+		{"empty record", `{"action": "insert", "tableName": "users", "record": {}}`},
+		{"record without primary key", `{"action": "insert", "tableName": "users", "record": {"name": "Ana"}}`},
+		{"null primary key", `{"action": "insert", "tableName": "users", "record": {"id": null, "name": "Ana"}}`},
+		{"empty primary key", `{"action": "insert", "tableName": "users", "record": {"id": "", "name": "Ana"}}`},
+		{"update without key", `{"action": "update", "tableName": "users", "updates": {"name": "Ana"}}`},
+		{"update without updates", `{"action": "update", "tableName": "users", "key": "a"}`},
+		{"delete without key", `{"action": "delete", "tableName": "users"}`},
+		{"unknown action", `{"action": "drop", "tableName": "users"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(server, httptest.NewRequest("POST", target, strings.NewReader(tt.body)))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, body %q, want %d", w.Code, w.Body.String(), http.StatusBadRequest)
+			}
+			if strings.TrimSpace(w.Body.String()) == "" {
+				t.Error("the response has no message")
+			}
+		})
+	}
+
+	// None of the requests inserted a record, such as one keyed by "<nil>"
+	count, err := users.Count()
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 0 {
+		records, _ := users.SelectAll()
+		t.Errorf("the table holds %v, want no record", records)
+	}
+}
+
+func TestTableActionIfMatch(t *testing.T) {
+	server, users := newTestServer(t, data.Config{})
+	if err := users.Insert(data.Record{"id": "u1", "name": "Ana"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	target := "/tableAction?dbName=testdb"
+	selectETag := func() string {
+		t.Helper()
+		w := serve(server, httptest.NewRequest("GET", target+"&tableName=users&key=u1", nil))
+		if w.Code != http.StatusOK || w.Header().Get("ETag") == "" {
+			t.Fatalf("select status = %d with ETag %q, want an ETag", w.Code, w.Header().Get("ETag"))
+		}
+		return w.Header().Get("ETag")
+	}
+	write := func(ifMatch string, payload map[string]interface{}) *httptest.ResponseRecorder {
+		r := postJSON(t, target, payload)
+		r.Header.Set("If-Match", ifMatch)
+		return serve(server, r)
+	}
+	update := func(name string) map[string]interface{} {
+		return map[string]interface{}{"action": "update", "tableName": "users", "key": "u1", "updates": map[string]interface{}{"name": name}}
+	}
+
+	etag := selectETag()
+	if again := selectETag(); again != etag {
+		t.Errorf("ETag of an unchanged record = %s, then %s", etag, again)
+	}
+
+	if w := write(etag, update("Bo")); w.Code != http.StatusOK {
+		t.Fatalf("update with the current ETag status = %d, body %q", w.Code, w.Body.String())
+	}
+	newETag := selectETag()
+	if newETag == etag {
+		t.Error("the ETag didn't change with the record")
+	}
+
+	// The ETag read before the update is stale
+	if w := write(etag, update("Cy")); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("update with a stale ETag status = %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+	if w := write("W/"+newETag, update("Cy")); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("update with a weak ETag status = %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+	deletion := map[string]interface{}{"action": "delete", "tableName": "users", "key": "u1"}
+	if w := write(etag, deletion); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("delete with a stale ETag status = %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+	if record, err := users.Select("u1"); err != nil || record["name"] != "Bo" {
+		t.Errorf("record after the rejected writes = %v, %v, want the name Bo", record, err)
+	}
+
+	if w := write(etag+", "+newETag, update("Di")); w.Code != http.StatusOK {
+		t.Errorf("update with a list holding the current ETag status = %d, body %q", w.Code, w.Body.String())
+	}
+	if w := write("*", deletion); w.Code != http.StatusOK {
+		t.Errorf("delete with If-Match * status = %d, body %q", w.Code, w.Body.String())
+	}
+	if _, err := users.Select("u1"); err == nil {
+		t.Error("the record still exists after the conditional delete")
+	}
+}
+
+func TestTableActionInsertGeneratesKey(t *testing.T) {
+	server, _ := newTestServer(t, data.Config{})
+	w := serve(server, postJSON(t, "/createTable?dbName=testdb", map[string]interface{}{
+		"tableName": "orders", "primaryKey": "id", "keyGenerator": "uuid",
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("createTable status = %d, body %q", w.Code, w.Body.String())
+	}
+	target := "/tableAction?dbName=testdb"
+
+	w = serve(server, postJSON(t, target, map[string]interface{}{
+		"action": "insert", "tableName": "orders", "record": map[string]interface{}{"item": "book"},
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("insert without a key status = %d, body %q, want %d", w.Code, w.Body.String(), http.StatusCreated)
+	}
+	var created map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("invalid insert response %q: %v", w.Body.String(), err)
+	}
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !uuid.MatchString(created["key"]) {
+		t.Errorf("generated key = %q, want a version 4 UUID", created["key"])
+	}
+
+	// The Location header selects the new record
+	location := w.Header().Get("Location")
+	if !strings.Contains(location, "key="+created["key"]) {
+		t.Fatalf("Location = %q, want the generated key", location)
+	}
+	w = serve(server, httptest.NewRequest("GET", location, nil))
+	var record map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &record); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("GET %s = %d, body %q", location, w.Code, w.Body.String())
+	}
+	if record["id"] != created["key"] || record["item"] != "book" {
+		t.Errorf("record at Location = %v, want the inserted record with the generated key", record)
+	}
+
+	// An insert with its own key keeps the 200 response
+	w = serve(server, postJSON(t, target, map[string]interface{}{
+		"action": "insert", "tableName": "orders", "record": map[string]interface{}{"id": "o1", "item": "pen"},
+	}))
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+		t.Errorf("insert with a key = %d with Location %q, want %d without Location", w.Code, w.Header().Get("Location"), http.StatusOK)
+	}
+
+	w = serve(server, postJSON(t, "/createTable?dbName=testdb", map[string]interface{}{
+		"tableName": "items", "primaryKey": "id", "keyGenerator": "serial",
+	}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("createTable with an unknown key generator status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestTableActionInsertWithSuppliedKeys(t *testing.T) {
+	server, _ := newTestServer(t, data.Config{})
+	for _, table := range []struct {
+		name, primaryKey string
+		opts             []data.TableOption
+	}{
+		{"nested", "meta.id", []data.TableOption{data.WithUUIDKeys()}},
+		{"pairs", "pk", []data.TableOption{data.WithCompositeKey("tenant", "id"), data.WithUUIDKeys()}},
+	} {
+		if _, err := server.GetOrCreateTable("testdb", table.name, table.primaryKey, table.opts...); err != nil {
+			t.Fatalf("GetOrCreateTable(%s) failed: %v", table.name, err)
+		}
+	}
+	target := "/tableAction?dbName=testdb"
+
+	// The records hold their keys, so no key is generated and no Location is returned
+	for _, insert := range []map[string]interface{}{
+		{"action": "insert", "tableName": "nested", "record": map[string]interface{}{"meta": map[string]interface{}{"id": "n1"}}},
+		{"action": "insert", "tableName": "pairs", "record": map[string]interface{}{"tenant": "acme", "id": "p1"}},
+	} {
+		w := serve(server, postJSON(t, target, insert))
+		if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+			t.Errorf("insert into %s = %d with Location %q, body %q, want %d without Location",
+				insert["tableName"], w.Code, w.Header().Get("Location"), w.Body.String(), http.StatusOK)
+		}
+	}
+}
+
+func TestTableActionExportWithFilter(t *testing.T) {
+	server, users := newTestServer(t, data.Config{})
+	for _, record := range []data.Record{
+		{"id": "a", "tenant": "acme", "age": 30},
+		{"id": "b", "tenant": "globex", "age": 40},
+		{"id": "c", "tenant": "acme", "age": 50},
+	} {
+		if err := users.Insert(record); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	w := serve(server, httptest.NewRequest("POST", "/tableAction?dbName=testdb", strings.NewReader(
+		`{"action": "export", "tableName": "users", "query": {"Filters": {"tenant": "acme"}, "Where": {"Field": "age", "Op": ">", "Value": 35}}}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("export status = %d, body %q", w.Code, w.Body.String())
+	}
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename="users.json"` {
+		t.Errorf("Content-Disposition = %q, want an attachment named users.json", disposition)
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil {
+		t.Fatalf("invalid export %q: %v", w.Body.String(), err)
+	}
+	if len(records) != 1 || records[0]["id"] != "c" {
+		t.Errorf("exported records = %v, want only c", records)
+	}
+
+	w = serve(server, httptest.NewRequest("POST", "/tableAction?dbName=testdb", strings.NewReader(
+		`{"action": "export", "tableName": "users", "query": {"Where": {"Field": "age", "Op": "~", "Value": 1}}}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("export with an invalid Where status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestTableActionIfNoneMatch(t *testing.T) {
+	server, users := newTestServer(t, data.Config{})
+	if err := users.Insert(data.Record{"id": "a", "name": "Ana"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	target := "/tableAction?dbName=testdb"
+	read := func(body, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", target, strings.NewReader(body))
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return serve(server, r)
+	}
+
+	for _, body := range []string{
+		`{"action": "selectAll", "tableName": "users"}`,
+		`{"action": "query", "tableName": "users", "query": {"Filters": {"name": "Ana"}}}`,
+	} {
+		w := read(body, "")
+		etag := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+			t.Fatalf("%s = %d with ETag %q, want 200 with a weak ETag", body, w.Code, etag)
+		}
+
+		// Unchanged data is not sent again, with or without the weak prefix
+		for _, ifNoneMatch := range []string{etag, strings.TrimPrefix(etag, "W/"), `"other", ` + etag, "*"} {
+			w = read(body, ifNoneMatch)
+			if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+				t.Errorf("%s with If-None-Match %s = %d with %d bytes, want 304 without a body", body, ifNoneMatch, w.Code, w.Body.Len())
+			}
+		}
+		if w = read(body, `W/"stale"`); w.Code != http.StatusOK {
+			t.Errorf("%s with a stale If-None-Match = %d, want 200", body, w.Code)
+		}
+	}
+
+	// The ETag depends on the query
+	all := read(`{"action": "selectAll", "tableName": "users"}`, "").Header().Get("ETag")
+	query := read(`{"action": "query", "tableName": "users", "query": {"Filters": {"name": "Bo"}}}`, "").Header().Get("ETag")
+	if all == query {
+		t.Errorf("selectAll and query share the ETag %s, want distinct ETags", all)
+	}
+
+	// A write changes the ETag, so the new data is sent
+	if err := users.Update("a", data.Record{"name": "Anna"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	w := read(`{"action": "selectAll", "tableName": "users"}`, all)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == all {
+		t.Fatalf("selectAll after a write = %d with ETag %q, want 200 with a new ETag", w.Code, w.Header().Get("ETag"))
+	}
+	if !strings.Contains(w.Body.String(), "Anna") {
+		t.Errorf("selectAll after a write = %q, want the updated record", w.Body.String())
+	}
+}
+
+func TestTableActionSelectAllCap(t *testing.T) {
+	selectAll := `{"action": "selectAll", "tableName": "users"}`
+	insert := func(users *data.Table, from, to int) {
+		for i := from; i < to; i++ {
+			if err := users.Insert(data.Record{"id": i}); err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+		}
+	}
+
+	server, users := newTestServer(t, data.Config{MaxSelectAll: 3})
+	insert(users, 0, 3)
+	w := serve(server, httptest.NewRequest("POST", "/tableAction?dbName=testdb", strings.NewReader(selectAll)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("selectAll at the cap status = %d, body %q", w.Code, w.Body.String())
+	}
+
+	insert(users, 3, 4)
+	w = serve(server, httptest.NewRequest("POST", "/tableAction?dbName=testdb", strings.NewReader(selectAll)))
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "limit and offset") {
+		t.Errorf("selectAll above the cap = %d, body %q, want %d pointing to pagination", w.Code, w.Body.String(), http.StatusRequestEntityTooLarge)
+	}
+
+	// Paginated queries are not capped
+	w = serve(server, httptest.NewRequest("POST", "/tableAction?dbName=testdb", strings.NewReader(
+		`{"action": "query", "tableName": "users", "query": {"Limit": 2, "Offset": 2}}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("paginated query status = %d, body %q", w.Code, w.Body.String())
+	}
+
+	// A negative cap removes it
+	server, users = newTestServer(t, data.Config{MaxSelectAll: -1})
+	insert(users, 0, 5)
+	w = serve(server, httptest.NewRequest("POST", "/tableAction?dbName=testdb", strings.NewReader(selectAll)))
+	if w.Code != http.StatusOK {
+		t.Errorf("selectAll without a cap status = %d, body %q", w.Code, w.Body.String())
+	}
+
+	if got := data.NewServer().MaxSelectAll(); got != data.DefaultMaxSelectAll {
+		t.Errorf("default MaxSelectAll = %d, want %d", got, data.DefaultMaxSelectAll)
+	}
+}
+
+func TestHandlersWithConcurrentTableCreation(t *testing.T) {
+	server, _ := newTestServer(t, data.Config{})
+
+	// Tables and databases created while the handlers look them up, which the race detector checks
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if _, err := server.GetOrCreateTable("testdb", fmt.Sprintf("t%d", i), "id"); err != nil {
+				t.Errorf("GetOrCreateTable failed: %v", err)
+			}
+			if _, err := server.GetOrCreateTable(fmt.Sprintf("db%d", i), "items", "id"); err != nil {
+				t.Errorf("GetOrCreateTable failed: %v", err)
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("u%d", i)
+		w := serve(server, postJSON(t, "/tableAction?dbName=testdb", map[string]interface{}{
+			"action": "insert", "tableName": "users", "record": map[string]interface{}{"id": key},
+		}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("insert status = %d, body %q", w.Code, w.Body.String())
+		}
+		w = serve(server, postJSON(t, "/joinTables?dbName=testdb", map[string]interface{}{
+			"table1": "users", "table2": "users", "key1": "id", "key2": "id",
+		}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("join status = %d, body %q", w.Code, w.Body.String())
+		}
+	}
+	wg.Wait()
+}
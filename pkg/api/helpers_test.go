@@ -0,0 +1,60 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+// testAESKey is the key encrypting the files of the servers created by the tests.
+var testAESKey = []byte("0123456789abcdef0123456789abcdef")
+
+// newTestServer creates a server storing its databases in a temporary directory, with the given database
+// holding a table named "users" keyed by "id".
+func newTestServer(t *testing.T, cfg data.Config) (*data.Server, *data.Table) {
+	t.Helper()
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	if cfg.BackupDir == "" {
+		cfg.BackupDir = t.TempDir()
+	}
+	cfg.AESKey = testAESKey
+	server, err := data.NewServerWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewServerWithConfig failed: %v", err)
+	}
+	if err := server.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	table, err := server.GetOrCreateTable("testdb", "users", "id")
+	if err != nil {
+		t.Fatalf("GetOrCreateTable failed: %v", err)
+	}
+	return server, table
+}
+
+// serve sends the request to the routes of the server and returns the recorded response.
+func serve(server *data.Server, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	SetupRoutes(server).ServeHTTP(w, r)
+	return w
+}
+
+// postJSON builds a POST request to the target with the value encoded as its JSON body.
+func postJSON(t *testing.T, target string, value interface{}) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	r := httptest.NewRequest("POST", target, bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
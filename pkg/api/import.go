@@ -0,0 +1,235 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+// DefaultImportBatchSize is the number of records the import endpoint inserts at once, unless the request sets batchSize.
+const DefaultImportBatchSize = 500
+
+// maxImportErrors is the number of failed rows the summary of an import lists. Later failures are only counted.
+const maxImportErrors = 100
+
+// importError reports a row of an import that was not inserted.
+type importError struct {
+	Line  int    `json:"line"`  // Line of the row in the request body, starting at 1
+	Error string `json:"error"` // Reason the row was not inserted
+}
+
+// importProgress is a line of the response of an import, sent after each batch and at the end.
+type importProgress struct {
+	Inserted int           `json:"inserted"`          // Number of records inserted so far
+	Failed   int           `json:"failed"`            // Number of rows not inserted so far
+	Done     bool          `json:"done,omitempty"`    // Whether the import is over, set on the last line only
+	Aborted  bool          `json:"aborted,omitempty"` // Whether the import stopped at the first failed row
+	Errors   []importError `json:"errors,omitempty"`  // First failed rows, on the last line only
+}
+
+// importRow is a record of an import waiting to be inserted.
+type importRow struct {
+	line   int         // Line of the row in the request body
+	record data.Record // Decoded record
+}
+
+// importer inserts the rows of an import into a table in batches and keeps the summary of the import.
+type importer struct {
+	table    *data.Table    // Table the records are inserted into
+	guard    fieldGuard     // Guard checking the fields written by each record
+	skip     bool           // Whether failed rows are skipped instead of aborting the import
+	batch    []importRow    // Rows read since the last batch was inserted
+	progress importProgress // Summary of the import so far
+}
+
+// fail records a failed row, and reports whether the import goes on.
+func (im *importer) fail(line int, err error) bool {
+	im.progress.Failed++
+	if len(im.progress.Errors) < maxImportErrors {
+		im.progress.Errors = append(im.progress.Errors, importError{Line: line, Error: err.Error()})
+	}
+	if !im.skip {
+		im.progress.Aborted = true
+	}
+	return im.skip
+}
+
+// add checks the record of a row and adds it to the current batch, and reports whether the import goes on.
+func (im *importer) add(line int, content []byte) bool {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	// Decode numbers as json.Number so integers keep their exact value instead of being rounded to float64
+	decoder.UseNumber()
+	var record data.Record
+	if err := decoder.Decode(&record); err != nil {
+		return im.fail(line, fmt.Errorf("invalid JSON record: %v", err))
+	}
+	if decoder.More() {
+		return im.fail(line, fmt.Errorf("invalid JSON record: unexpected data after the record"))
+	}
+	if record == nil {
+		return im.fail(line, fmt.Errorf("invalid JSON record: the record must be an object"))
+	}
+	if err := im.guard.checkWrite(record); err != nil {
+		return im.fail(line, err)
+	}
+	im.batch = append(im.batch, importRow{line: line, record: record})
+	return true
+}
+
+// flush inserts the current batch, and reports whether the import goes on.
+// The batch is inserted with a single write. If that fails, its records are inserted one by one,
+// so the failed rows are known and, when they are skipped, the other rows are still inserted.
+func (im *importer) flush(ctx context.Context) bool {
+	batch := im.batch
+	im.batch = im.batch[:0]
+	if len(batch) == 0 {
+		return true
+	}
+
+	records := make([]data.Record, len(batch))
+	for i, row := range batch {
+		records[i] = row.record
+	}
+	if err := im.table.InsertMany(records); err == nil {
+		im.progress.Inserted += len(batch)
+		return true
+	}
+
+	for _, row := range batch {
+		insertCtx, cancel := context.WithTimeout(ctx, DefaultLockTimeout)
+		_, err := im.table.InsertReturningKey(insertCtx, row.record)
+		cancel()
+		if err != nil {
+			if errors.Is(err, data.ErrReadOnly) || errors.Is(err, context.Canceled) {
+				// Every other row would fail the same way
+				im.skip = false
+			}
+			if !im.fail(row.line, err) {
+				return false
+			}
+			continue
+		}
+		im.progress.Inserted++
+	}
+	return true
+}
+
+func ImportHandler(server *data.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dbName := r.URL.Query().Get("dbName")
+		tableName := r.URL.Query().Get("tableName")
+		if dbName == "" || tableName == "" {
+			http.Error(w, "Database and table names are required", http.StatusBadRequest)
+			return
+		}
+
+		skip := false
+		switch onError := r.URL.Query().Get("onError"); onError {
+		case "", "abort":
+		case "skip":
+			skip = true
+		default:
+			http.Error(w, "onError must be abort or skip", http.StatusBadRequest)
+			return
+		}
+
+		batchSize := DefaultImportBatchSize
+		if value := r.URL.Query().Get("batchSize"); value != "" {
+			size, err := strconv.Atoi(value)
+			if err != nil || size < 1 {
+				http.Error(w, "batchSize must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			batchSize = size
+		}
+
+		server.RLock()
+		db, exists := server.Databases[dbName]
+		server.RUnlock()
+		if !exists {
+			http.Error(w, "Database not found", http.StatusNotFound)
+			return
+		}
+
+		db.RLock()
+		table, exists := db.Tables[tableName]
+		db.RUnlock()
+		if !exists {
+			http.Error(w, "Table not found", http.StatusNotFound)
+			return
+		}
+
+		im := &importer{
+			table: table,
+			guard: newFieldGuard(r, dbName, tableName, table),
+			skip:  skip,
+			batch: make([]importRow, 0, batchSize),
+		}
+
+		// Progress is sent while the body is still being read, and each batch gets the timeouts of a whole request,
+		// so an import is not cut off by the timeouts of the server as long as the client keeps sending rows
+		controller := http.NewResponseController(w)
+		controller.EnableFullDuplex()
+		extendDeadlines := func() {
+			deadline := time.Now().Add(DefaultReadTimeout)
+			controller.SetReadDeadline(deadline)
+			controller.SetWriteDeadline(deadline)
+		}
+		extendDeadlines()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		report := func(progress importProgress) {
+			encoder.Encode(progress)
+			controller.Flush()
+		}
+
+		reader := bufio.NewReader(r.Body)
+		line := 0
+		for {
+			content, err := reader.ReadBytes('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				im.fail(line+1, fmt.Errorf("failed to read request body: %v", err))
+				im.progress.Aborted = true
+				break
+			}
+			if len(content) > 0 {
+				line++
+			}
+			if len(bytes.TrimSpace(content)) > 0 {
+				if !im.add(line, content) {
+					break
+				}
+				if len(im.batch) == batchSize {
+					if !im.flush(r.Context()) {
+						break
+					}
+					report(importProgress{Inserted: im.progress.Inserted, Failed: im.progress.Failed})
+					extendDeadlines()
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		// The rows read before the end of the body, or before the row that aborted the import, are still inserted
+		im.flush(r.Context())
+
+		im.progress.Done = true
+		report(im.progress)
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+// joinRequest is the body of a request to the /join endpoint.
+type joinRequest struct {
+	Database  string       `json:"db"`        // Name of the database of the tables
+	Database1 string       `json:"db1"`       // Name of the database of the first table, if it is not db
+	Table1    string       `json:"table1"`    // Name of the first table
+	Key1      string       `json:"key1"`      // Key field of the first table
+	Database2 string       `json:"db2"`       // Name of the database of the second table, if it is not db
+	Table2    string       `json:"table2"`    // Name of the second table
+	Key2      string       `json:"key2"`      // Key field of the second table
+	JoinType  interface{}  `json:"joinType"`  // Join type, by name ("inner", "left", "right" or "full") or by number, inner by default
+	Coerce    bool         `json:"coerce"`    // Whether the key values are compared with coercion, see data.WithCoercion
+	NullFill  bool         `json:"nullFill"`  // Whether the fields of the unmatched side are filled with nulls, see data.WithNullFill
+	Normalize []string     `json:"normalize"` // Names of the normalizers applied to the key values, in order, see joinNormalizers
+	Fields    []string     `json:"fields"`    // Fields of the rows to return, such as "t1.name", all of them if empty
+	Where     *data.Filter `json:"where"`     // Filter the rows must match, on their prefixed fields, if any
+}
+
+// joinNormalizers maps the names of the normalizers accepted by the /join endpoint to the transforms applied to the key values,
+// see data.WithKeyNormalizer.
+var joinNormalizers = map[string]data.Transform{
+	"trimSpace": data.TrimSpace,
+	"lowercase": data.Lowercase,
+}
+
+// parseJoinType returns the join type of a request, given by name or by number.
+func parseJoinType(value interface{}) (data.JoinType, error) {
+	switch v := value.(type) {
+	case nil:
+		return data.InnerJoin, nil
+	case string:
+		return data.ParseJoinType(v)
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil || n < int64(data.InnerJoin) || n > int64(data.FullOuterJoin) {
+			return data.InnerJoin, fmt.Errorf("unknown join type %s", v)
+		}
+		return data.JoinType(n), nil
+	}
+	return data.InnerJoin, fmt.Errorf("joinType must be a name or a number")
+}
+
+// projectRow returns the given fields of a joined row, omitting the fields the row doesn't have.
+func projectRow(row map[string]interface{}, fields []string) map[string]interface{} {
+	projected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, exists := row[field]; exists {
+			projected[field] = value
+		}
+	}
+	return projected
+}
+
+func JoinHandler(server *data.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var payload joinRequest
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&payload); err != nil {
+			if errors.Is(err, io.EOF) {
+				http.Error(w, "Request body is required", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, data.ErrInvalidFilter) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		ref1 := data.TableRef{Database: payload.Database1, Table: payload.Table1}
+		if ref1.Database == "" {
+			ref1.Database = payload.Database
+		}
+		ref2 := data.TableRef{Database: payload.Database2, Table: payload.Table2}
+		if ref2.Database == "" {
+			ref2.Database = payload.Database
+		}
+		if ref1.Database == "" || ref2.Database == "" || payload.Table1 == "" || payload.Table2 == "" || payload.Key1 == "" || payload.Key2 == "" {
+			http.Error(w, "db (or db1 and db2), table1, key1, table2 and key2 are required", http.StatusBadRequest)
+			return
+		}
+		joinType, err := parseJoinType(payload.JoinType)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if payload.Where != nil {
+			if err := payload.Where.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		var opts []data.JoinOption
+		if payload.Coerce {
+			opts = append(opts, data.WithCoercion())
+		}
+		if payload.NullFill {
+			opts = append(opts, data.WithNullFill())
+		}
+		for _, name := range payload.Normalize {
+			normalizer, exists := joinNormalizers[name]
+			if !exists {
+				http.Error(w, fmt.Sprintf("unknown normalizer %q, expected trimSpace or lowercase", name), http.StatusBadRequest)
+				return
+			}
+			opts = append(opts, data.WithKeyNormalizer(normalizer))
+		}
+
+		table1, err := server.Table(ref1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		table2, err := server.Table(ref2)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		guard := newJoinGuard(r, ref1, ref2, table1, table2)
+		if err := guard.checkJoin(payload.Key1, payload.Key2, payload.Where); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		rows, err := server.JoinTables(ref1, ref2, payload.Key1, payload.Key2, joinType, opts...)
+		if errors.Is(err, data.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Join operation failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		results := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			if payload.Where != nil && !payload.Where.Match(data.Record(row)) {
+				continue
+			}
+			if len(payload.Fields) > 0 {
+				row = projectRow(row, payload.Fields)
+			}
+			guard.strip(row)
+			results = append(results, row)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+		}
+	}
+}
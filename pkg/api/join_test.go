@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+func TestJoinAcrossDatabases(t *testing.T) {
+	server, users := newTestServer(t, data.Config{})
+	countries, err := server.GetOrCreateTable("shared", "countries", "code")
+	if err != nil {
+		t.Fatalf("GetOrCreateTable failed: %v", err)
+	}
+	if err := users.Insert(data.Record{"id": "u1", "country": "PE"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := countries.Insert(data.Record{"code": "PE", "name": "Peru"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	join := map[string]interface{}{"db": "testdb", "table1": "users", "key1": "country", "db2": "shared", "table2": "countries", "key2": "code"}
+	w := serve(server, postJSON(t, "/join", join))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/join status = %d, body %q", w.Code, w.Body.String())
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("invalid /join response %q: %v", w.Body.String(), err)
+	}
+	if len(rows) != 1 || rows[0]["t1.id"] != "u1" || rows[0]["t2.name"] != "Peru" {
+		t.Errorf("/join rows = %v, want u1 joined with Peru", rows)
+	}
+
+	join["db2"] = "missing"
+	if w := serve(server, postJSON(t, "/join", join)); w.Code != http.StatusNotFound {
+		t.Errorf("/join with a missing database status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestJoinNormalize(t *testing.T) {
+	server, users := newTestServer(t, data.Config{})
+	orders, err := server.GetOrCreateTable("testdb", "orders", "id")
+	if err != nil {
+		t.Fatalf("GetOrCreateTable failed: %v", err)
+	}
+	if err := users.Insert(data.Record{"id": "u1", "email": "Alice@X.com"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := orders.Insert(data.Record{"id": "o1", "email": " alice@x.com "}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	join := map[string]interface{}{"db": "testdb", "table1": "users", "key1": "email", "table2": "orders", "key2": "email"}
+	for _, tt := range []struct {
+		normalize []string
+		wantRows  int
+	}{
+		{nil, 0},
+		{[]string{"lowercase"}, 0},
+		{[]string{"trimSpace", "lowercase"}, 1},
+	} {
+		join["normalize"] = tt.normalize
+		w := serve(server, postJSON(t, "/join", join))
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &rows); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("/join with normalize %v = %d, body %q", tt.normalize, w.Code, w.Body.String())
+		}
+		if len(rows) != tt.wantRows {
+			t.Errorf("/join with normalize %v returned %d rows, want %d", tt.normalize, len(rows), tt.wantRows)
+		}
+	}
+
+	join["normalize"] = []string{"uppercase"}
+	if w := serve(server, postJSON(t, "/join", join)); w.Code != http.StatusBadRequest {
+		t.Errorf("/join with an unknown normalizer status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
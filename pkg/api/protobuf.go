@@ -0,0 +1,38 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtobufContentType is the media type of the responses serialized as protobuf messages.
+// Clients that send it in the Accept header receive the records as a serialized dbdata.Records message instead of JSON.
+const ProtobufContentType = "application/x-protobuf"
+
+// acceptsProtobuf reports whether the Accept header of the request asks for a protobuf response.
+// JSON remains the default when the header is missing or lists other media types only.
+func acceptsProtobuf(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err == nil && mediaType == ProtobufContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeProtobuf writes the message serialized as protobuf to the response.
+func writeProtobuf(w http.ResponseWriter, message proto.Message) {
+	body, err := proto.Marshal(message)
+	if err != nil {
+		http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ProtobufContentType)
+	w.Write(body)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"google.golang.org/protobuf/proto"
+)
+
+// decodeRecords unmarshals a protobuf response into a dbdata.Records message.
+func decodeRecords(t *testing.T, w *httptest.ResponseRecorder) *dbdata.Records {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != ProtobufContentType {
+		t.Fatalf("Content-Type = %q, want %s", got, ProtobufContentType)
+	}
+	var records dbdata.Records
+	if err := proto.Unmarshal(w.Body.Bytes(), &records); err != nil {
+		t.Fatalf("the response is not a dbdata.Records message: %v", err)
+	}
+	return &records
+}
+
+func TestTableActionProtobuf(t *testing.T) {
+	server, users := newTestServer(t, data.Config{})
+	const bigID = int64(1<<53 + 1)
+	for _, record := range []data.Record{{"id": "a", "visits": bigID}, {"id": "b", "visits": 1}} {
+		if err := users.Insert(record); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	target := "/tableAction?dbName=testdb"
+
+	r := postJSON(t, target, map[string]interface{}{"action": "selectAll", "tableName": "users"})
+	r.Header.Set("Accept", "application/json;q=0.5, "+ProtobufContentType)
+	records := decodeRecords(t, serve(server, r))
+	if len(records.GetRecords()) != 2 {
+		t.Fatalf("selectAll returned %d records, want 2", len(records.GetRecords()))
+	}
+	// The integer is sent as stored, without a lossy conversion to a float
+	if got := records.GetRecords()["a"].GetFields()["visits"].GetStringValue(); got != "num:9007199254740993" {
+		t.Errorf("visits = %q, want num:9007199254740993", got)
+	}
+
+	r = postJSON(t, target, map[string]interface{}{
+		"action": "query", "tableName": "users", "query": map[string]interface{}{"Filters": map[string]interface{}{"visits": 1}},
+	})
+	r.Header.Set("Accept", ProtobufContentType)
+	w := serve(server, r)
+	records = decodeRecords(t, w)
+	if _, exists := records.GetRecords()["b"]; len(records.GetRecords()) != 1 || !exists {
+		t.Errorf("query returned %v, want record b", records.GetRecords())
+	}
+	if got := w.Header().Get("X-Total-Count"); got != "1" {
+		t.Errorf("X-Total-Count = %q, want 1", got)
+	}
+
+	// JSON remains the default
+	w = serve(server, postJSON(t, target, map[string]interface{}{"action": "selectAll", "tableName": "users"}))
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil || len(decoded) != 2 {
+		t.Errorf("selectAll without Accept returned %q, want a JSON list of 2 records", w.Body.String())
+	}
+}
+
+func TestAcceptsProtobuf(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{ProtobufContentType, true},
+		{"application/json, application/x-protobuf; q=0.9", true},
+		{"application/x-protobuffer", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := acceptsProtobuf(r); got != tt.want {
+			t.Errorf("acceptsProtobuf(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
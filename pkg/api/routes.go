@@ -1,15 +1,86 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/Malpizarr/dbproto/pkg/data"
 )
 
-func SetupRoutes(server *data.Server) {
-	http.HandleFunc("/createDatabase", CreateDatabaseHandler(server))
-	http.HandleFunc("/createTable", CreateTableHandler(server))
-	http.HandleFunc("/listDatabases", ListDatabasesHandler(server))
-	http.HandleFunc("/tableAction", TableActionHandler(server))
-	http.HandleFunc("/joinTables", JoinTablesHandler(server))
+// Default timeouts of the HTTP server built by NewHTTPServer.
+const (
+	DefaultReadHeaderTimeout = 5 * time.Second  // Maximum time to read the request headers
+	DefaultReadTimeout       = 30 * time.Second // Maximum time to read the whole request, including the body
+	DefaultWriteTimeout      = 30 * time.Second // Maximum time to write the response
+	DefaultIdleTimeout       = 2 * time.Minute  // Maximum time to keep an idle keep-alive connection open
+	DefaultShutdownTimeout   = 10 * time.Second // Maximum time to wait for in-flight requests on shutdown
+)
+
+// DefaultLockTimeout is the maximum time a request waits for the lock of a table before failing with 503 Service Unavailable.
+const DefaultLockTimeout = 5 * time.Second
+
+// SetupRoutes registers the handlers of the API on a new ServeMux and returns it.
+// The mux is not registered globally, so several servers can run in the same process,
+// and callers can wrap it with middleware or serve it from their own http.Server.
+func SetupRoutes(server *data.Server) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/createDatabase", CreateDatabaseHandler(server))
+	mux.HandleFunc("/createTable", CreateTableHandler(server))
+	mux.HandleFunc("/listDatabases", ListDatabasesHandler(server))
+	mux.HandleFunc("/tableAction", TableActionHandler(server))
+	mux.HandleFunc("/import", ImportHandler(server))
+	mux.HandleFunc("/joinTables", JoinTablesHandler(server))
+	mux.HandleFunc("/join", JoinHandler(server))
+	mux.HandleFunc("/sql", SQLHandler(server))
+	mux.HandleFunc("/stats", StatsHandler(server))
+	mux.HandleFunc("/schema", SchemaHandler(server))
+	mux.HandleFunc("/version", VersionHandler())
+	mux.Handle("/admin/compact", RequireServerAdminToken(server, CompactHandler(server)))
+	mux.Handle("/admin/vacuum", RequireServerAdminToken(server, VacuumHandler(server)))
+	mux.Handle("/admin/reindex", RequireServerAdminToken(server, ReindexHandler(server)))
+	return mux
+}
+
+// NewHTTPServer returns an http.Server listening on addr that serves the API of the server with the default timeouts.
+// The responses are compressed with the Gzip middleware for the clients that accept it.
+// The timeouts can be changed on the returned server before it is started.
+func NewHTTPServer(addr string, server *data.Server) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           Gzip(SetupRoutes(server)),
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+		ReadTimeout:       DefaultReadTimeout,
+		WriteTimeout:      DefaultWriteTimeout,
+		IdleTimeout:       DefaultIdleTimeout,
+	}
+}
+
+// ListenAndServe serves the API of the server on addr with the default timeouts until the context is done.
+// When the context is done, it stops accepting connections and waits up to DefaultShutdownTimeout
+// for the in-flight requests to finish.
+// It returns nil after a graceful shutdown, or the error that stopped the server otherwise.
+func ListenAndServe(ctx context.Context, addr string, server *data.Server) error {
+	httpServer := NewHTTPServer(addr, server)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+		if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
 }
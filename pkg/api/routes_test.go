@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+func TestSetupRoutesIsolatesServers(t *testing.T) {
+	server1, _ := newTestServer(t, data.Config{})
+	server2, _ := newTestServer(t, data.Config{})
+	if err := server1.CreateDatabase("only1"); err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+
+	// Each mux serves its own server, so both can run in the same process
+	w1 := serve(server1, httptest.NewRequest("GET", "/listDatabases", nil))
+	w2 := serve(server2, httptest.NewRequest("GET", "/listDatabases", nil))
+	if w1.Code != http.StatusOK || w2.Code != http.StatusOK {
+		t.Fatalf("listDatabases statuses = %d and %d, want 200", w1.Code, w2.Code)
+	}
+	if w1.Body.String() == w2.Body.String() {
+		t.Errorf("both servers listed %q, want their own databases", w1.Body.String())
+	}
+
+	// Nothing is registered on the default mux
+	if _, pattern := http.DefaultServeMux.Handler(httptest.NewRequest("GET", "/tableAction", nil)); pattern != "" {
+		t.Errorf("the default mux serves /tableAction with pattern %q", pattern)
+	}
+}
+
+func TestNewHTTPServerTimeouts(t *testing.T) {
+	server, _ := newTestServer(t, data.Config{})
+	httpServer := NewHTTPServer("127.0.0.1:0", server)
+
+	if httpServer.ReadHeaderTimeout != DefaultReadHeaderTimeout || httpServer.ReadTimeout != DefaultReadTimeout ||
+		httpServer.WriteTimeout != DefaultWriteTimeout || httpServer.IdleTimeout != DefaultIdleTimeout {
+		t.Errorf("timeouts = %v, %v, %v, %v, want the defaults", httpServer.ReadHeaderTimeout, httpServer.ReadTimeout,
+			httpServer.WriteTimeout, httpServer.IdleTimeout)
+	}
+	if httpServer.Handler == nil {
+		t.Error("the server has no handler")
+	}
+}
+
+func TestListenAndServeShutsDown(t *testing.T) {
+	server, _ := newTestServer(t, data.Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ListenAndServe(ctx, "127.0.0.1:0", server)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("ListenAndServe returned %v after the context was canceled, want nil", err)
+		}
+	case <-time.After(DefaultShutdownTimeout):
+		t.Fatal("ListenAndServe did not return after the context was canceled")
+	}
+}
+
+func TestListenAndServeReportsErrors(t *testing.T) {
+	server, _ := newTestServer(t, data.Config{})
+	if err := ListenAndServe(context.Background(), "invalid address", server); err == nil {
+		t.Error("ListenAndServe on an invalid address returned nil, want an error")
+	}
+}
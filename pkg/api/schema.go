@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+// tableSchema is the response of the schema endpoint.
+type tableSchema struct {
+	Database string `json:"database"` // Name of the database
+	Table    string `json:"table"`    // Name of the table
+	data.TableDescription
+}
+
+func SchemaHandler(server *data.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dbName := r.URL.Query().Get("database")
+		tableName := r.URL.Query().Get("table")
+		if dbName == "" || tableName == "" {
+			http.Error(w, "Database and table names are required", http.StatusBadRequest)
+			return
+		}
+
+		server.RLock()
+		db, exists := server.Databases[dbName]
+		server.RUnlock()
+		if !exists {
+			http.Error(w, "Database not found", http.StatusNotFound)
+			return
+		}
+
+		db.RLock()
+		table, exists := db.Tables[tableName]
+		db.RUnlock()
+		if !exists {
+			http.Error(w, "Table not found", http.StatusNotFound)
+			return
+		}
+
+		response := tableSchema{Database: dbName, Table: tableName, TableDescription: table.Describe()}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+		}
+	}
+}
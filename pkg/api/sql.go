@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+func SQLHandler(server *data.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dbName := r.URL.Query().Get("dbName")
+		if dbName == "" {
+			http.Error(w, "Database name is required", http.StatusBadRequest)
+			return
+		}
+
+		server.RLock()
+		db, exists := server.Databases[dbName]
+		server.RUnlock()
+		if !exists {
+			http.Error(w, "Database not found", http.StatusNotFound)
+			return
+		}
+
+		var payload struct {
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		query, err := data.ParseSQL(payload.Query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		db.RLock()
+		table, exists := db.Tables[query.Table]
+		db.RUnlock()
+		if !exists {
+			http.Error(w, "Table not found", http.StatusNotFound)
+			return
+		}
+
+		guard := newFieldGuard(r, dbName, query.Table, table)
+		if err := guard.checkQuery(data.Query{SortBy: query.OrderBy, Where: query.Where}); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		records, err := table.QuerySQL(query)
+		if err != nil {
+			if errors.Is(err, data.ErrInvalidFilter) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, record := range records {
+			guard.strip(record)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(records); err != nil {
+			http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+func TestSQLHandler(t *testing.T) {
+	server, users := newTestServer(t, data.Config{})
+	for _, record := range []data.Record{{"id": "a", "age": 30}, {"id": "b", "age": 17}, {"id": "c", "age": 45}} {
+		if err := users.Insert(record); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	w := serve(server, postJSON(t, "/sql?dbName=testdb", map[string]string{"query": "SELECT id FROM users WHERE age > 18 ORDER BY age DESC"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/sql status = %d, body %q", w.Code, w.Body.String())
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil {
+		t.Fatalf("invalid /sql response %q: %v", w.Body.String(), err)
+	}
+	if len(records) != 2 || records[0]["id"] != "c" || records[1]["id"] != "a" || len(records[0]) != 1 {
+		t.Errorf("/sql returned %v, want the ids c and a", records)
+	}
+
+	tests := []struct {
+		name string
+		r    *http.Request
+		want int
+	}{
+		{"GET", httptest.NewRequest("GET", "/sql?dbName=testdb", nil), http.StatusMethodNotAllowed},
+		{"missing database name", postJSON(t, "/sql", map[string]string{"query": "SELECT * FROM users"}), http.StatusBadRequest},
+		{"unknown database", postJSON(t, "/sql?dbName=nope", map[string]string{"query": "SELECT * FROM users"}), http.StatusNotFound},
+		{"unknown table", postJSON(t, "/sql?dbName=testdb", map[string]string{"query": "SELECT * FROM orders"}), http.StatusNotFound},
+		{"invalid statement", postJSON(t, "/sql?dbName=testdb", map[string]string{"query": "DELETE FROM users"}), http.StatusBadRequest},
+		{"invalid body", httptest.NewRequest("POST", "/sql?dbName=testdb", nil), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serve(server, tt.r); w.Code != tt.want {
+			t.Errorf("%s: /sql status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
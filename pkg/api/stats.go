@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+// tableStats reports the stats of a table of a database.
+type tableStats struct {
+	Table string `json:"table"` // Name of the table
+	data.TableStats
+}
+
+func StatsHandler(server *data.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dbName := r.URL.Query().Get("database")
+		if dbName == "" {
+			http.Error(w, "Database name is required", http.StatusBadRequest)
+			return
+		}
+
+		server.RLock()
+		db, exists := server.Databases[dbName]
+		server.RUnlock()
+		if !exists {
+			http.Error(w, "Database not found", http.StatusNotFound)
+			return
+		}
+
+		db.RLock()
+		names := make([]string, 0, len(db.Tables))
+		tables := make(map[string]*data.Table, len(db.Tables))
+		for name, table := range db.Tables {
+			names = append(names, name)
+			tables[name] = table
+		}
+		db.RUnlock()
+		sort.Strings(names)
+
+		var total data.TableStats
+		stats := make([]tableStats, 0, len(names))
+		for _, name := range names {
+			tableStat, err := tables[name].Stats()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to read the stats of table '%s': %v", name, err), http.StatusInternalServerError)
+				return
+			}
+			stats = append(stats, tableStats{Table: name, TableStats: tableStat})
+			total = total.Add(tableStat)
+		}
+
+		response := struct {
+			Database string          `json:"database"`
+			Total    data.TableStats `json:"total"`
+			Tables   []tableStats    `json:"tables"`
+		}{Database: dbName, Total: total, Tables: stats}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
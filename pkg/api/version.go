@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Version is the protodb version reported by the /version endpoint.
+// It is set at build time, for example:
+//
+//	go build -ldflags "-X github.com/Malpizarr/dbproto/pkg/api.Version=v1.2.0"
+var Version = "dev"
+
+// Features lists the capabilities of the server reported by the /version endpoint,
+// so clients can check for compatibility before relying on them.
+var Features = []string{
+	"transactions",
+	"joins",
+	"secondary-indexes",
+	"composite-keys",
+	"query",
+	"export-csv",
+	"export-xml",
+}
+
+// Ciphers lists the encryption algorithms supported for the table files.
+var Ciphers = []string{"AES-256-CTR"}
+
+// versionInfo is the response of the /version endpoint.
+type versionInfo struct {
+	Version   string   `json:"version"`             // Version of protodb, set at build time
+	GoVersion string   `json:"goVersion"`           // Version of Go the server was built with
+	Revision  string   `json:"revision,omitempty"`  // VCS revision the server was built from, if known
+	BuildTime string   `json:"buildTime,omitempty"` // Time of the VCS revision, if known
+	Modified  bool     `json:"modified,omitempty"`  // Whether the working tree had uncommitted changes at build time
+	Features  []string `json:"features"`            // Capabilities supported by the server
+	Ciphers   []string `json:"ciphers"`             // Encryption algorithms supported for the table files
+}
+
+// buildVersionInfo collects the version of the server and the build information embedded in the binary.
+func buildVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+		Features:  Features,
+		Ciphers:   Ciphers,
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Revision = setting.Value
+			case "vcs.time":
+				info.BuildTime = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+func VersionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(buildVersionInfo()); err != nil {
+			http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
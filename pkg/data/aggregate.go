@@ -0,0 +1,153 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// AggFunc is an aggregate function applied to a field over a set of rows.
+type AggFunc int
+
+const (
+	AggCount AggFunc = iota // Number of rows where the field is present and not nil
+	AggSum                  // Sum of the numeric values of the field
+	AggAvg                  // Average of the numeric values of the field
+	AggMin                  // Minimum of the numeric values of the field
+	AggMax                  // Maximum of the numeric values of the field
+)
+
+// Aggregate is a function that applies an aggregate function to a field over a set of rows,
+// such as the merged rows returned by JoinTables (where fields are prefixed with "t1." or "t2.").
+// Rows where the field is missing or nil are skipped, which makes it safe to use on outer join results.
+// The values of the field must be numeric, except for AggCount which counts values of any type.
+//
+// Parameters:
+// - rows: A slice of maps, where each map represents a row. The keys are field names and the values are the field values.
+// - field: The name of the field to aggregate.
+// - fn: The aggregate function to apply, represented as an AggFunc value.
+//
+// Returns:
+// - The aggregated value.
+// - An error if a value of the field is not numeric, if the aggregate function is unknown,
+// or if AggAvg, AggMin or AggMax are applied to a field without values.
+func Aggregate(rows []map[string]interface{}, field string, fn AggFunc) (float64, error) {
+	if fn < AggCount || fn > AggMax {
+		return 0, fmt.Errorf("unknown aggregate function: %d", fn)
+	}
+	count := 0
+	sum := 0.0
+	minValue := math.Inf(1)
+	maxValue := math.Inf(-1)
+
+	for _, row := range rows {
+		value, exists := row[field]
+		if !exists || value == nil {
+			continue
+		}
+		count++
+		if fn == AggCount {
+			continue
+		}
+
+		number, err := toFloat(value)
+		if err != nil {
+			return 0, fmt.Errorf("cannot aggregate field %s: %v", field, err)
+		}
+		sum += number
+		minValue = math.Min(minValue, number)
+		maxValue = math.Max(maxValue, number)
+	}
+
+	switch fn {
+	case AggCount:
+		return float64(count), nil
+	case AggSum:
+		return sum, nil
+	}
+
+	if count == 0 {
+		return 0, fmt.Errorf("no values to aggregate for field %s", field)
+	}
+	switch fn {
+	case AggAvg:
+		return sum / float64(count), nil
+	case AggMin:
+		return minValue, nil
+	case AggMax:
+		return maxValue, nil
+	default:
+		return 0, fmt.Errorf("unknown aggregate function: %d", fn)
+	}
+}
+
+// GroupBy is a function that groups a set of rows by the value of a field and applies an aggregate function
+// to another field within each group. It completes the join pipeline: the rows returned by JoinTables can be
+// grouped by a column of one table and aggregated over a column of the other.
+// Rows where the group field is missing or nil are grouped under the "<nil>" key.
+//
+// Parameters:
+// - rows: A slice of maps, where each map represents a row. The keys are field names and the values are the field values.
+// - groupField: The name of the field to group the rows by. Its values are converted to strings to be used as group keys.
+// - field: The name of the field to aggregate within each group.
+// - fn: The aggregate function to apply, represented as an AggFunc value.
+//
+// Returns:
+// - A map where the keys are the values of the group field and the values are the aggregated values of each group.
+// - An error, if the aggregation of any group fails.
+func GroupBy(rows []map[string]interface{}, groupField, field string, fn AggFunc) (map[string]float64, error) {
+	groups := make(map[string][]map[string]interface{})
+	for _, row := range rows {
+		groupKey := fmt.Sprintf("%v", row[groupField])
+		groups[groupKey] = append(groups[groupKey], row)
+	}
+
+	results := make(map[string]float64, len(groups))
+	for groupKey, groupRows := range groups {
+		value, err := Aggregate(groupRows, field, fn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to aggregate group %s: %v", groupKey, err)
+		}
+		results[groupKey] = value
+	}
+	return results, nil
+}
+
+// toFloat converts a numeric Go value to a float64, including the json.Number values of records decoded with UseNumber.
+// Integers beyond 2^53 are rounded to the nearest float64.
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case json.Number:
+		number, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("value %q is not a valid number", v)
+		}
+		return number, nil
+	default:
+		return 0, fmt.Errorf("value %v of type %T is not numeric", value, value)
+	}
+}
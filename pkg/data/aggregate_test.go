@@ -0,0 +1,102 @@
+package data
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"qty": 4},
+		{"qty": int64(10)},
+		{"qty": json.Number("2.5")},
+		{"qty": uint8(1)},
+		{"qty": nil},
+		{"other": 100},
+	}
+	tests := []struct {
+		fn   AggFunc
+		want float64
+	}{
+		{AggCount, 4},
+		{AggSum, 17.5},
+		{AggAvg, 4.375},
+		{AggMin, 1},
+		{AggMax, 10},
+	}
+	for _, tt := range tests {
+		if got, err := Aggregate(rows, "qty", tt.fn); err != nil || got != tt.want {
+			t.Errorf("Aggregate(qty, %d) = %v, %v, want %v", tt.fn, got, err, tt.want)
+		}
+	}
+
+	// Every integer type is numeric
+	for _, value := range []interface{}{int8(3), int16(3), int32(3), uint(3), uint16(3), uint32(3), uint64(3), float32(3)} {
+		if got, err := Aggregate([]map[string]interface{}{{"qty": value}}, "qty", AggSum); err != nil || got != 3 {
+			t.Errorf("Aggregate of %T = %v, %v, want 3", value, got, err)
+		}
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	for _, value := range []interface{}{"3", json.Number("abc"), true, []interface{}{1}} {
+		rows := []map[string]interface{}{{"qty": 1}, {"qty": value}}
+		if _, err := Aggregate(rows, "qty", AggSum); err == nil {
+			t.Errorf("Aggregate with the value %#v succeeded, want an error", value)
+		}
+		// Count doesn't read the values, so it counts values of any type
+		if count, err := Aggregate(rows, "qty", AggCount); err != nil || count != 2 {
+			t.Errorf("Aggregate(AggCount) with the value %#v = %v, %v, want 2", value, count, err)
+		}
+	}
+
+	// Sum and count are 0 without values, while the others have nothing to return
+	empty := []map[string]interface{}{{"qty": nil}}
+	for _, fn := range []AggFunc{AggCount, AggSum} {
+		if got, err := Aggregate(empty, "qty", fn); err != nil || got != 0 {
+			t.Errorf("Aggregate(%d) without values = %v, %v, want 0", fn, got, err)
+		}
+	}
+	for _, fn := range []AggFunc{AggAvg, AggMin, AggMax} {
+		if _, err := Aggregate(empty, "qty", fn); err == nil {
+			t.Errorf("Aggregate(%d) without values succeeded, want an error", fn)
+		}
+	}
+	if _, err := Aggregate(empty, "qty", AggFunc(42)); err == nil {
+		t.Error("Aggregate with an unknown function succeeded, want an error")
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"city": "Lima", "total": 10},
+		{"city": "Lima", "total": json.Number("5")},
+		{"city": "Cusco", "total": 7},
+		{"total": 1},
+		{"city": "Cusco"},
+	}
+	got, err := GroupBy(rows, "city", "total", AggSum)
+	if err != nil {
+		t.Fatalf("GroupBy failed: %v", err)
+	}
+	want := map[string]float64{"Lima": 15, "Cusco": 7, "<nil>": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupBy(city, total, AggSum) = %v, want %v", got, want)
+	}
+
+	got, err = GroupBy(rows, "city", "total", AggCount)
+	if err != nil {
+		t.Fatalf("GroupBy failed: %v", err)
+	}
+	want = map[string]float64{"Lima": 2, "Cusco": 1, "<nil>": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupBy(city, total, AggCount) = %v, want %v", got, want)
+	}
+
+	// A group that fails to aggregate fails the whole grouping
+	rows = append(rows, map[string]interface{}{"city": "Puno", "total": "many"})
+	if got, err := GroupBy(rows, "city", "total", AggMax); err == nil {
+		t.Errorf("GroupBy with a non-numeric value = %v, want an error", got)
+	}
+}
@@ -0,0 +1,256 @@
+package data
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// DefaultAppendLogEntries is the number of records WithAppendLog appends to the log by default before the log is consolidated.
+const DefaultAppendLogEntries = 1000
+
+// appendLogExt is the extension of the append log of a table, stored next to its data file.
+const appendLogExt = ".append"
+
+// appendLogHeaderPrefix starts the header line of an append log. It is followed by the hex SHA-256 digest
+// of the content of the data file the log extends.
+const appendLogHeaderPrefix = "protodb-append:"
+
+// WithAppendLog makes the inserts of new records append the record to a log next to the data file, named after the table
+// with the ".append" extension, instead of rewriting the whole file. Duplicate keys are still detected against the records
+// in memory, so only the new record is encoded, encrypted and written.
+// Each entry of the log is encoded and encrypted like a data file holding a single record.
+//
+// Loading the table reads the data file, then applies the entries of the log. The log is consolidated into the data file,
+// and removed, by the first write that rewrites the file: an update, a delete, an insert replacing a record,
+// an insert once the log holds maxEntries records, or Compact. A non-positive maxEntries uses DefaultAppendLogEntries.
+// The longer the log, the cheaper the inserts, but the slower loading the table.
+//
+// The log records the digest of the data file it extends, so a log left behind by a crash after its records were consolidated
+// is ignored, and an entry cut short by a crash while it was appended, whose insert never returned, is dropped.
+// The mode is saved in the metadata file of the table by Database.CreateTable. It is ignored by tables stored in memory,
+// tables with one file per record and tables with a write debounce window, which already avoid rewriting the file on each insert.
+func WithAppendLog(maxEntries int) TableOption {
+	return func(t *Table) {
+		if maxEntries <= 0 {
+			maxEntries = DefaultAppendLogEntries
+		}
+		t.appendMax = maxEntries
+	}
+}
+
+// appendLogState is the state of the append log of a table, replaced as a whole so it can be read without the write lock.
+type appendLogState struct {
+	base    string // Hex SHA-256 digest of the content of the data file, the base the log extends
+	entries int    // Number of records in the log extending the base, zero if there is no valid log
+	size    int64  // Size of the header and the complete entries of the log
+	dead    int64  // Bytes of the header and the entries that a consolidated data file doesn't need, see Fragmentation
+	dataLen int64  // Size of the data file the log extends
+	onDisk  bool   // Whether a log file exists, valid or not
+}
+
+// appendLogPath returns the path of the append log of the table stored at the given file path.
+func appendLogPath(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + appendLogExt
+}
+
+// dataDigest returns the hex SHA-256 digest of the content of a data file.
+func dataDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// replayAppendLog applies the entries of the append log of the table to the records read from the data file with the given content,
+// and records the state of the log for the next inserts.
+func (t *Table) replayAppendLog(records *dbdata.Records, data []byte) error {
+	if t.isMemory() {
+		return nil
+	}
+	var content []byte
+	err := t.retryIO(func() error {
+		var err error
+		content, err = t.fs().ReadFile(appendLogPath(t.FilePath))
+		return err
+	})
+	if isNotExist(err) {
+		if t.appendMax > 0 {
+			t.appendLog.Store(&appendLogState{base: dataDigest(data), dataLen: int64(len(data))})
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read append log: %v", err)
+	}
+
+	state := &appendLogState{base: dataDigest(data), dataLen: int64(len(data)), onDisk: true}
+	defer t.appendLog.Store(state)
+	header, entries, complete := bytes.Cut(content, []byte("\n"))
+	if !complete {
+		// The log was being created when the process stopped, before any entry was written
+		return nil
+	}
+	if !bytes.HasPrefix(header, []byte(appendLogHeaderPrefix)) {
+		return fmt.Errorf("invalid append log header")
+	}
+	if string(header[len(appendLogHeaderPrefix):]) != state.base {
+		// The log extends a previous content of the data file, which already holds its records
+		return nil
+	}
+	state.size = int64(len(header) + 1)
+	state.dead = state.size
+	overhead, err := t.entryOverhead()
+	if err != nil {
+		return err
+	}
+	for len(entries) >= 4 {
+		size := binary.BigEndian.Uint32(entries)
+		if uint64(len(entries)-4) < uint64(size) {
+			break
+		}
+		entry, err := t.decodeRecords(entries[4 : 4+size])
+		if err != nil {
+			return fmt.Errorf("failed to read append log entry: %v", err)
+		}
+		for key, record := range entry.GetRecords() {
+			records.Records[key] = record
+		}
+		state.entries++
+		state.size += int64(4 + size)
+		state.dead += overhead
+		entries = entries[4+size:]
+	}
+	return nil
+}
+
+// canAppend reports whether the insert of a new record can be appended to the log instead of rewriting the data file.
+func (t *Table) canAppend() bool {
+	if t.appendMax <= 0 || t.debounce > 0 || t.perRecord || t.isMemory() {
+		return false
+	}
+	state := t.appendLog.Load()
+	return state != nil && state.entries < t.appendMax && !t.needsCompaction(state)
+}
+
+// writeInserted writes the records after the insert of the new record with the given key and publishes them,
+// by appending the record to the log if the table has one with room left, or by writing the records to the file otherwise.
+// Like writeChanges, it fires the triggers of the insert first, and neither writes nor publishes the records if one fails.
+func (t *Table) writeInserted(records *dbdata.Records, key string, record *dbdata.Record) error {
+	if err := t.fireChanges(); err != nil {
+		return err
+	}
+	if !t.canAppend() {
+		return t.writeRecordsToFile(records)
+	}
+	if err := t.appendToLog(key, record); err != nil {
+		return err
+	}
+	t.Records = records.Records
+	t.publishSnapshot(records)
+	return nil
+}
+
+// appendToLog appends the record with the given key to the append log, applying the fsync policy of the table.
+// The first entry replaces any previous log with a new log extending the current content of the data file.
+func (t *Table) appendToLog(key string, record *dbdata.Record) error {
+	data, err := t.encodeRecords(&dbdata.Records{Records: map[string]*dbdata.Record{key: record}})
+	if err != nil {
+		return err
+	}
+	entry := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	entry = append(entry, data...)
+	overhead, err := t.entryOverhead()
+	if err != nil {
+		return err
+	}
+
+	state := t.appendLog.Load()
+	offset := state.size
+	if state.entries == 0 {
+		entry = append([]byte(appendLogHeaderPrefix+state.base+"\n"), entry...)
+		offset = 0
+	}
+	if err := t.retryIO(func() error {
+		return t.appendLogOnce(entry, offset)
+	}); err != nil {
+		return err
+	}
+
+	dead := state.dead + overhead
+	if state.entries == 0 {
+		// The entry starts a new log with its header line
+		dead = int64(len(appendLogHeaderPrefix)+len(state.base)+1) + overhead
+	}
+	t.appendLog.Store(&appendLogState{
+		base:    state.base,
+		entries: state.entries + 1,
+		size:    offset + int64(len(entry)),
+		dead:    dead,
+		dataLen: state.dataLen,
+		onDisk:  true,
+	})
+	t.sizesKnown.Store(false)
+	if t.fsyncPolicy.mode == fsyncInterval {
+		t.dirty.Store(true)
+	}
+	return nil
+}
+
+// appendLogOnce makes a single attempt of writing the entry to the append log at the given offset, the end of its complete entries.
+// Anything after the offset, such as an entry cut short by a crash, is dropped first, and dropped again if the write fails,
+// so an attempt can be retried without leaving a partial entry in the middle of the log.
+func (t *Table) appendLogOnce(entry []byte, offset int64) error {
+	logPath := appendLogPath(t.FilePath)
+	flags := os.O_WRONLY | os.O_CREATE
+	if t.syncWrites {
+		flags |= os.O_SYNC
+	}
+	file, err := t.fs().OpenFile(logPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening append log '%s': %w", logPath, err)
+	}
+	defer file.Close()
+
+	if err := file.Truncate(offset); err != nil {
+		return fmt.Errorf("error truncating append log '%s': %w", logPath, err)
+	}
+	if _, err := file.WriteAt(entry, offset); err != nil {
+		file.Truncate(offset)
+		return fmt.Errorf("error appending to '%s': %w", logPath, err)
+	}
+	if t.fsyncPolicy.mode == fsyncAlways {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("error syncing append log '%s': %w", logPath, err)
+		}
+	}
+	return nil
+}
+
+// resetAppendLog removes the append log of the table once the data file was written with the given content,
+// which holds the records of the log.
+func (t *Table) resetAppendLog(data []byte) {
+	state := t.appendLog.Load()
+	if state == nil && t.appendMax <= 0 {
+		return
+	}
+	next := &appendLogState{base: dataDigest(data), dataLen: int64(len(data))}
+	if state != nil && state.onDisk {
+		// A log that can't be removed extends the previous content of the data file, so it is ignored when the table is read
+		if err := t.fs().Remove(appendLogPath(t.FilePath)); err != nil && !isNotExist(err) {
+			next.onDisk = true
+		}
+	}
+	t.appendLog.Store(next)
+}
+
+// appendLogOnDisk reports whether the table may have an append log file.
+func (t *Table) appendLogOnDisk() bool {
+	state := t.appendLog.Load()
+	return state != nil && state.onDisk
+}
@@ -0,0 +1,29 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+)
+
+// BenchmarkInsert compares the inserts of new records into a table of 1,000 records that rewrite the whole file
+// with the inserts appending one entry to the log of WithAppendLog, consolidated every DefaultAppendLogEntries records.
+func BenchmarkInsert(b *testing.B) {
+	modes := []struct {
+		name string
+		opts []TableOption
+	}{
+		{"rewrite", nil},
+		{"append-log", []TableOption{WithAppendLog(0)}},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			table := newBenchmarkTable(b, 1000, mode.opts...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := table.Insert(Record{"id": fmt.Sprintf("new%d", i), "name": "new"}); err != nil {
+					b.Fatalf("Insert failed: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Malpizarr/dbproto/pkg/utils"
+)
+
+// Operations recorded in the audit log.
+const (
+	AuditInsert  = "insert"  // A record was inserted
+	AuditReplace = "replace" // A record was replaced by an insert with InsertReplace or by Replace
+	AuditUpdate  = "update"  // Fields of a record were updated
+	AuditDelete  = "delete"  // A record was deleted
+)
+
+// auditFileName is the name of the audit log file in the directory of a database.
+const auditFileName = "audit.log"
+
+// auditQueueSize is the number of entries buffered before a mutation waits for the audit log to be written.
+const auditQueueSize = 1024
+
+// AuditEntry is an entry of the audit log of a database, describing a mutation of a record.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`            // When the mutation was applied, in UTC
+	Actor     string    `json:"actor,omitempty"` // Who applied the mutation, if known, see WithActor
+	Operation string    `json:"operation"`       // Operation applied, one of AuditInsert, AuditReplace, AuditUpdate and AuditDelete
+	Table     string    `json:"table"`           // Name of the table of the record
+	Key       string    `json:"key"`             // Primary key of the record
+}
+
+// actorKey is the context key of the actor set by WithActor.
+type actorKey struct{}
+
+// WithActor returns a copy of the context carrying the identity of who performs the operations, such as an authenticated user.
+// The mutations performed with InsertContext, UpdateContext and DeleteContext record it in the audit log.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set on the context by WithActor, or an empty string if there is none.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// auditLog is the append-only audit log of a database. Each entry is encrypted like the data files
+// and written as a line of the log file by a background goroutine, so mutations only wait for the log
+// when more than auditQueueSize entries are pending.
+type auditLog struct {
+	sync.RWMutex                    // Mutex guarding closed against concurrent sends
+	storage      Storage            // Storage of the log file
+	filePath     string             // Path of the log file
+	utils        *utils.Utils       // Utils used to encrypt and decrypt the entries
+	entries      chan AuditEntry    // Entries waiting to be written
+	flushes      chan chan struct{} // Requests to be notified once the pending entries are written
+	done         chan struct{}      // Channel closed when the background goroutine exits
+	closed       bool               // Whether the log was closed
+}
+
+// openAuditLog opens the audit log file at the given path of the storage for appending and starts its background goroutine.
+// The entries are encrypted with the given AES key, or the key of the AES_KEY environment variable if it is nil.
+func openAuditLog(storage Storage, filePath string, aesKey []byte) (*auditLog, error) {
+	var u *utils.Utils
+	var err error
+	if aesKey != nil {
+		u, err = utils.NewUtilsWithKey(aesKey)
+	} else {
+		u, err = utils.NewUtils()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %v", err)
+	}
+	file, err := storage.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+
+	l := &auditLog{
+		storage:  storage,
+		filePath: filePath,
+		utils:    u,
+		entries:  make(chan AuditEntry, auditQueueSize),
+		flushes:  make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go l.run(file)
+	return l, nil
+}
+
+// run writes the entries to the file until the entries channel is closed.
+func (l *auditLog) run(file File) {
+	defer close(l.done)
+	defer file.Close()
+
+	for {
+		select {
+		case entry, ok := <-l.entries:
+			if !ok {
+				return
+			}
+			l.write(file, entry)
+		case flushed := <-l.flushes:
+			// Write the entries queued before the flush request
+			for pending := len(l.entries); pending > 0; pending-- {
+				l.write(file, <-l.entries)
+			}
+			close(flushed)
+		}
+	}
+}
+
+// write encrypts the entry and appends it to the file as a line.
+func (l *auditLog) write(file File, entry AuditEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to serialize audit entry: %v", err)
+		return
+	}
+	encrypted, err := l.utils.Encrypt(data)
+	if err != nil {
+		log.Printf("Failed to encrypt audit entry: %v", err)
+		return
+	}
+	if _, err := io.WriteString(file, encrypted+"\n"); err != nil {
+		log.Printf("Failed to write audit entry to %s: %v", l.filePath, err)
+	}
+}
+
+// record queues the entries to be written. It waits only if the queue is full.
+func (l *auditLog) record(entries ...AuditEntry) {
+	l.RLock()
+	defer l.RUnlock()
+	if l.closed {
+		return
+	}
+	for _, entry := range entries {
+		l.entries <- entry
+	}
+}
+
+// flush waits until the entries recorded so far are written.
+func (l *auditLog) flush() {
+	l.RLock()
+	if l.closed {
+		l.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	l.flushes <- flushed
+	l.RUnlock()
+	<-flushed
+}
+
+// close writes the pending entries and closes the log file.
+func (l *auditLog) close() {
+	l.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.entries)
+	}
+	l.Unlock()
+	<-l.done
+}
+
+// readAll decrypts and returns every entry of the log file, oldest first.
+func (l *auditLog) readAll() ([]AuditEntry, error) {
+	file, err := l.storage.OpenFile(l.filePath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	entries := make([]AuditEntry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		data, err := l.utils.Decrypt(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt audit entry: %v", err)
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("failed to deserialize audit entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	return entries, nil
+}
+
+// WithAuditLog enables the audit log of every database of the server, see Database.EnableAuditLog.
+func WithAuditLog() ServerOption {
+	return func(s *Server) {
+		s.auditLog = true
+	}
+}
+
+// EnableAuditLog is a method of the Database struct that starts recording every mutation of the records of its tables
+// in an append-only audit log, stored encrypted in the audit.log file of the database directory.
+// Each entry holds the time, the operation, the table, the key of the record and, for the mutations performed
+// with a context carrying an actor set by WithActor, who performed it. Entries are written by a background goroutine,
+// so mutations are not slowed down by the log unless it falls behind. The writes of a DBTxn are recorded only if it commits.
+// Enabling the audit log of a database whose audit log is already enabled has no effect.
+//
+// Returns:
+// - If the audit log is enabled, it returns nil.
+// - If the log file can't be opened, it returns an error.
+func (db *Database) EnableAuditLog() error {
+	db.Lock()
+	defer db.Unlock()
+
+	if db.audit != nil {
+		return nil
+	}
+	audit, err := openAuditLog(db.fs(), filepath.Join(db.dir(), auditFileName), db.aesKey)
+	if err != nil {
+		return err
+	}
+	db.audit = audit
+	for _, table := range db.Tables {
+		table.setAuditLog(audit)
+	}
+	return nil
+}
+
+// AuditLog is a method of the Database struct that reads back the entries of the audit log of the database.
+// It waits for the entries recorded so far to be written, then decrypts the whole log.
+//
+// Returns:
+// - A slice of AuditEntry, oldest first.
+// - An error, if the audit log is not enabled or can't be read.
+func (db *Database) AuditLog() ([]AuditEntry, error) {
+	db.RLock()
+	audit := db.audit
+	db.RUnlock()
+	if audit == nil {
+		return nil, fmt.Errorf("audit log of database %s is not enabled", db.Name)
+	}
+
+	audit.flush()
+	return audit.readAll()
+}
+
+// setAuditLog sets the audit log the mutations of the table are recorded in.
+func (t *Table) setAuditLog(audit *auditLog) {
+	t.Lock()
+	defer t.Unlock()
+	t.audit = audit
+}
+
+// tableName returns the name of the table, the name of its file without extension.
+func (t *Table) tableName() string {
+	base := filepath.Base(t.FilePath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// recordAudit records the mutation of the records with the given keys in the audit log, if enabled.
+// While a DBTxn commits, the entries are held until the commit succeeds. The table must be locked for writing.
+func (t *Table) recordAudit(operation string, keys ...string) {
+	if t.audit == nil {
+		return
+	}
+	now := t.now().UTC()
+	entries := make([]AuditEntry, len(keys))
+	for i, key := range keys {
+		entries[i] = AuditEntry{Time: now, Actor: t.actor, Operation: operation, Table: t.tableName(), Key: key}
+	}
+	if t.holdAudit {
+		t.heldAudit = append(t.heldAudit, entries...)
+		return
+	}
+	t.audit.record(entries...)
+}
+
+// holdAuditEntries starts holding the audit entries of the table instead of recording them.
+// The table must be locked for writing.
+func (t *Table) holdAuditEntries() {
+	t.holdAudit = true
+	t.heldAudit = nil
+}
+
+// releaseAuditEntries stops holding the audit entries of the table, recording the held entries if commit is true
+// and discarding them otherwise. The table must be locked for writing.
+func (t *Table) releaseAuditEntries(commit bool) {
+	if commit && t.audit != nil && len(t.heldAudit) > 0 {
+		t.audit.record(t.heldAudit...)
+	}
+	t.holdAudit = false
+	t.heldAudit = nil
+}
+
+// withActor sets the actor of the context as the actor of the mutations recorded in the audit log
+// until the returned function is called. The table must be locked for writing.
+func (t *Table) withActor(ctx context.Context) func() {
+	t.actor = ActorFromContext(ctx)
+	return func() {
+		t.actor = ""
+	}
+}
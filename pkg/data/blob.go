@@ -0,0 +1,85 @@
+package data
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Blobs
+//
+// A []byte field value is stored as a blob: protobuf struct values can't hold raw bytes, so the bytes are
+// base64-encoded into a string value with the "b64:" prefix and decoded back into a []byte when the record is read.
+// Insert, Update and the other writes accept []byte values directly, and SelectBlob reads a single blob field.
+// Strings that start with "b64:" are escaped when they are stored, so they are never mistaken for blobs.
+// Files written before blobs were introduced, which have no file header, hold such strings unescaped:
+// their values are escaped by escapeLegacyValues when they are read, and stored escaped by the next write.
+//
+// Every write rewrites the whole table file, and base64 makes blobs a third larger, so blobs should stay small,
+// such as thumbnails, signatures or hashes of a few kilobytes. Larger content is better kept in files or an
+// object store, with only its path or URL stored in the table.
+
+// blobPrefix is the prefix of the string values holding a base64-encoded blob.
+const blobPrefix = "b64:"
+
+// encodeBlob encodes the bytes as a string value with the blob prefix.
+func encodeBlob(blob []byte) string {
+	return blobPrefix + base64.StdEncoding.EncodeToString(blob)
+}
+
+// escapeLegacyValues escapes the string values of records read from a file without a file header, which was written
+// before blobs and encrypted fields were introduced, so its strings starting with their prefixes are read as plain strings.
+func escapeLegacyValues(records *dbdata.Records) {
+	for _, record := range records.GetRecords() {
+		for field, value := range record.GetFields() {
+			s, ok := value.GetKind().(*structpb.Value_StringValue)
+			if ok && (strings.HasPrefix(s.StringValue, blobPrefix) || strings.HasPrefix(s.StringValue, encryptedPrefix)) {
+				record.Fields[field] = structpb.NewStringValue("str:" + s.StringValue)
+			}
+		}
+	}
+}
+
+// decodeBlob decodes a string value with the blob prefix back into bytes.
+func decodeBlob(value string) ([]byte, error) {
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, blobPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob value: %v", err)
+	}
+	return blob, nil
+}
+
+// SelectBlob is a method of the Table struct that returns the bytes of a blob field of a record.
+// It reads the current snapshot of the records without locking the table.
+//
+// Parameters:
+// - key: A string representing the primary key of the record.
+// - field: The name of the blob field.
+//
+// Returns:
+// - The bytes stored in the field.
+// - An error, if the record or the field does not exist, the field does not hold a blob, or an error occurs while reading the records.
+func (t *Table) SelectBlob(key, field string) ([]byte, error) {
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	record, exists := allRecords.Records[key]
+	if !exists {
+		return nil, fmt.Errorf("record with key %s %w", key, ErrNotFound)
+	}
+	value, exists := record.Fields[field]
+	if !exists {
+		return nil, fmt.Errorf("field %s not found in record with key %s", field, key)
+	}
+	if !strings.HasPrefix(value.GetStringValue(), blobPrefix) {
+		return nil, fmt.Errorf("field %s of record with key %s is not a blob", field, key)
+	}
+
+	t.metrics.IncrementQueryCount()
+	return decodeBlob(value.GetStringValue())
+}
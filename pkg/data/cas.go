@@ -0,0 +1,66 @@
+package data
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// CompareAndSwap is a method of the Table struct that sets a field of a record to a new value only if its current value
+// equals the expected one, and reports whether it did. The comparison and the update happen under the table lock,
+// so no other write can change the field between them, which makes it a building block for locks and state machines:
+// for example CompareAndSwap("job-1", "state", "pending", "running") starts a job only once.
+// The current value is compared by its string form, so "42" matches the integer 42, and a missing or nil field
+// matches an empty expected value. The update is applied like Update, so the indexes and constraints are maintained
+// and the update triggers fire; if one of them fails, the field is left unchanged and its error returned.
+//
+// Parameters:
+// - key: The key of the record, matched like the primary key of an inserted record.
+// - field: The field to compare and set. It can't be the primary key.
+// - expected: The string form of the value the field must hold for the swap to happen.
+// - new: The new value of the field.
+//
+// Returns:
+// - true if the field held the expected value and was set to the new one, false if it held another value.
+// - An error wrapping ErrNotFound if no record has the key, or an error if the field is the primary key
+// or the update fails. No swap happened in that case.
+func (t *Table) CompareAndSwap(key, field, expected, new string) (bool, error) {
+	if field == t.PrimaryKey {
+		return false, fmt.Errorf("%w: field '%s' can't be swapped", ErrPrimaryKeyChange, field)
+	}
+
+	unlockRecord, _ := t.lockRecord(context.Background(), key)
+	t.Lock()
+	swapped := false
+	err := t.withRecordTriggers(context.Background(), unlockRecord, func() error {
+		allRecords, err := t.loadForWrite()
+		if err != nil {
+			return err
+		}
+		keyStr := t.resolveKey(allRecords.Records, key)
+		record, exists := allRecords.Records[keyStr]
+		if !exists {
+			return fmt.Errorf("record with key %s %w", keyStr, ErrNotFound)
+		}
+
+		current := ""
+		if value := record.Fields[field]; value != nil {
+			if _, isNull := value.GetKind().(*structpb.Value_NullValue); !isNull {
+				current = indexValue(value)
+			}
+		}
+		if current != expected {
+			return nil
+		}
+		if err := t.updateLocked(keyStr, Record{field: new}); err != nil {
+			return err
+		}
+		swapped = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return swapped, nil
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	table := newTestTable(t, "id")
+	if err := table.CreateIndex("state"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	mustInsert(t, table, Record{"id": "job-1", "state": "pending", "attempts": 3})
+
+	swapped, err := table.CompareAndSwap("job-1", "state", "pending", "running")
+	if err != nil || !swapped {
+		t.Fatalf("CompareAndSwap of the current value = %v, %v, want true", swapped, err)
+	}
+	swapped, err = table.CompareAndSwap("job-1", "state", "pending", "running")
+	if err != nil || swapped {
+		t.Errorf("CompareAndSwap of a stale value = %v, %v, want false", swapped, err)
+	}
+
+	record, err := table.Select("job-1")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["state"] != "running" || record["attempts"] != int64(3) {
+		t.Errorf("record = %v, want state running and the other fields unchanged", record)
+	}
+
+	// The index follows the swap
+	if pending, err := table.SelectByIndex("state", "pending"); err != nil || len(pending) != 0 {
+		t.Errorf("SelectByIndex(state, pending) = %v, %v, want none", pending, err)
+	}
+	if running, err := table.SelectByIndex("state", "running"); err != nil || len(running) != 1 {
+		t.Errorf("SelectByIndex(state, running) = %v, %v, want job-1", running, err)
+	}
+
+	// Values are compared by their string form, and a missing field matches an empty expected value
+	if swapped, err := table.CompareAndSwap("job-1", "attempts", "3", "4"); err != nil || !swapped {
+		t.Errorf("CompareAndSwap of the integer 3 with \"3\" = %v, %v, want true", swapped, err)
+	}
+	if swapped, err := table.CompareAndSwap("job-1", "owner", "", "worker-1"); err != nil || !swapped {
+		t.Errorf("CompareAndSwap of a missing field = %v, %v, want true", swapped, err)
+	}
+}
+
+func TestCompareAndSwapErrors(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "job-1", "state": "pending"})
+
+	if _, err := table.CompareAndSwap("job-9", "state", "pending", "running"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CompareAndSwap of a missing record = %v, want ErrNotFound", err)
+	}
+	if _, err := table.CompareAndSwap("job-1", "id", "job-1", "job-2"); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("CompareAndSwap of the primary key = %v, want ErrPrimaryKeyChange", err)
+	}
+}
@@ -0,0 +1,43 @@
+package data
+
+import (
+	"time"
+)
+
+// Clock tells the time to a table, for the timestamps it records: the times of the audit entries
+// and the times of the last operations in its Metrics.
+// Tests can inject a Clock with WithClock to control the time and make these timestamps deterministic.
+type Clock interface {
+	Now() time.Time // Returns the current time
+}
+
+// SystemClock is the Clock of the tables created without WithClock, which returns the wall-clock time from time.Now.
+var SystemClock Clock = systemClock{}
+
+// systemClock is a Clock that returns the wall-clock time.
+type systemClock struct{}
+
+// Now returns the current wall-clock time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithClock makes the table read the time from the given clock instead of SystemClock.
+// A nil clock keeps SystemClock.
+func WithClock(clock Clock) TableOption {
+	return func(t *Table) {
+		if clock == nil {
+			return
+		}
+		t.clock = clock
+		t.metrics.clock = clock
+	}
+}
+
+// now returns the current time of the clock of the table.
+func (t *Table) now() time.Time {
+	if t.clock == nil {
+		return SystemClock.Now()
+	}
+	return t.clock.Now()
+}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only changes when the test advances it.
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+// Now returns the time set by the test.
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+// Advance moves the time of the clock forward.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.Lock()
+	c.now = c.now.Add(d)
+	c.Unlock()
+}
+
+func TestClockDrivesMetricsTimestamps(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	table := newTestTable(t, "id", WithClock(clock))
+
+	mustInsert(t, table, Record{"id": "a"})
+	clock.Advance(time.Hour)
+	if _, err := table.SelectAll(); err != nil {
+		t.Fatalf("SelectAll failed: %v", err)
+	}
+
+	table.metrics.Lock()
+	lastInsert, lastQuery := table.metrics.LastInsert, table.metrics.LastQuery
+	table.metrics.Unlock()
+	if !lastInsert.Equal(start) {
+		t.Errorf("LastInsert = %v, want %v", lastInsert, start)
+	}
+	if want := start.Add(time.Hour); !lastQuery.Equal(want) {
+		t.Errorf("LastQuery = %v, want %v", lastQuery, want)
+	}
+
+	// A nil clock keeps the system clock
+	if table := newTestTable(t, "id", WithClock(nil)); table.now().IsZero() {
+		t.Error("now of a table with a nil clock is zero, want the wall-clock time")
+	}
+}
+
+func TestClockDrivesAuditTimes(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	db := newTestDatabase(t)
+	if err := db.EnableAuditLog(); err != nil {
+		t.Fatalf("EnableAuditLog failed: %v", err)
+	}
+	if err := db.CreateTable("users", "id", WithClock(clock)); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+
+	mustInsert(t, db.Tables["users"], Record{"id": "a"})
+	clock.Advance(24 * time.Hour)
+	if err := db.Tables["users"].Delete("a"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	entries, err := db.AuditLog()
+	if err != nil {
+		t.Fatalf("AuditLog failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("AuditLog returned %d entries, want 2", len(entries))
+	}
+	if !entries[0].Time.Equal(start) || !entries[1].Time.Equal(start.Add(24*time.Hour)) {
+		t.Errorf("audit times = %v and %v, want the times of the clock", entries[0].Time, entries[1].Time)
+	}
+}
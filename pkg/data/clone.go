@@ -0,0 +1,104 @@
+package data
+
+import (
+	"reflect"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Clone is a method of the Record type that returns a deep copy of the record, so the copy can be modified without
+// changing the record, and the other way around. The nested maps and slices of the values, such as the lists
+// of list fields, the nested objects and the bytes of blob fields, are copied too; the other values are copied by value.
+// It is useful to keep a record handed to code that may modify it, such as a trigger or a resolver of UpsertBatch.
+//
+// Returns:
+// - A deep copy of the record, or nil if the record is nil.
+func (r Record) Clone() Record {
+	if r == nil {
+		return nil
+	}
+	cloned := make(Record, len(r))
+	for field, value := range r {
+		cloned[field] = cloneValue(value)
+	}
+	return cloned
+}
+
+// cloneValue returns a deep copy of a value of a record.
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case Record:
+		return v.Clone()
+	case map[string]interface{}:
+		return map[string]interface{}(Record(v).Clone())
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		cloned := make([]interface{}, len(v))
+		for i, element := range v {
+			cloned[i] = cloneValue(element)
+		}
+		return cloned
+	case []byte:
+		if v == nil {
+			return v
+		}
+		return append([]byte{}, v...)
+	}
+
+	// Other slices and maps, such as []string, are copied through reflection
+	original := reflect.ValueOf(value)
+	switch original.Kind() {
+	case reflect.Slice:
+		if original.IsNil() {
+			return value
+		}
+		cloned := reflect.MakeSlice(original.Type(), original.Len(), original.Len())
+		for i := 0; i < original.Len(); i++ {
+			cloned.Index(i).Set(cloneReflected(original.Index(i)))
+		}
+		return cloned.Interface()
+	case reflect.Map:
+		if original.IsNil() {
+			return value
+		}
+		cloned := reflect.MakeMapWithSize(original.Type(), original.Len())
+		iter := original.MapRange()
+		for iter.Next() {
+			cloned.SetMapIndex(iter.Key(), cloneReflected(iter.Value()))
+		}
+		return cloned.Interface()
+	}
+	return value
+}
+
+// cloneReflected returns a deep copy of an element of a slice or a map copied by cloneValue, as a value of the same type.
+func cloneReflected(element reflect.Value) reflect.Value {
+	if !element.CanInterface() || (element.Kind() == reflect.Interface && element.IsNil()) {
+		return element
+	}
+	cloned := cloneValue(element.Interface())
+	if cloned == nil {
+		return reflect.Zero(element.Type())
+	}
+	return reflect.ValueOf(cloned).Convert(element.Type())
+}
+
+// CloneRecord returns a deep copy of the stored record, including its protobuf values,
+// to be modified in place of a record that may be shared, such as a record of the current snapshot of a table.
+//
+// Parameters:
+// - record: The record to copy, which may be nil.
+//
+// Returns:
+// - A deep copy of the record, or nil if the record is nil.
+func CloneRecord(record *dbdata.Record) *dbdata.Record {
+	if record == nil {
+		return nil
+	}
+	return proto.Clone(record).(*dbdata.Record)
+}
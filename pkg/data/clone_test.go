@@ -0,0 +1,92 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestRecordCloneIsIndependent(t *testing.T) {
+	original := Record{
+		"name":   "Ana",
+		"age":    int64(30),
+		"tags":   []interface{}{"a", map[string]interface{}{"k": "v"}},
+		"meta":   map[string]interface{}{"nested": []interface{}{1.5}},
+		"sub":    Record{"x": "y"},
+		"blob":   []byte{1, 2, 3},
+		"names":  []string{"a", "b"},
+		"scores": map[string][]int{"math": {1, 2}},
+		"null":   nil,
+	}
+	want := Record{
+		"name":   "Ana",
+		"age":    int64(30),
+		"tags":   []interface{}{"a", map[string]interface{}{"k": "v"}},
+		"meta":   map[string]interface{}{"nested": []interface{}{1.5}},
+		"sub":    Record{"x": "y"},
+		"blob":   []byte{1, 2, 3},
+		"names":  []string{"a", "b"},
+		"scores": map[string][]int{"math": {1, 2}},
+		"null":   nil,
+	}
+
+	cloned := original.Clone()
+	if !reflect.DeepEqual(cloned, original) {
+		t.Fatalf("Clone = %v, want %v", cloned, original)
+	}
+
+	// Modifying every level of the copy leaves the original unchanged
+	cloned["name"] = "Bo"
+	cloned["tags"].([]interface{})[0] = "changed"
+	cloned["tags"].([]interface{})[1].(map[string]interface{})["k"] = "changed"
+	cloned["meta"].(map[string]interface{})["nested"].([]interface{})[0] = 0.0
+	cloned["sub"].(Record)["x"] = "changed"
+	cloned["blob"].([]byte)[0] = 9
+	cloned["names"].([]string)[0] = "changed"
+	cloned["scores"].(map[string][]int)["math"][0] = 9
+	delete(cloned, "age")
+	if !reflect.DeepEqual(original, want) {
+		t.Errorf("original after modifying the copy = %v, want %v", original, want)
+	}
+
+	// And the other way around
+	cloned = original.Clone()
+	original["sub"].(Record)["x"] = "changed"
+	if cloned["sub"].(Record)["x"] != "y" {
+		t.Errorf("copy after modifying the original = %v, want it unchanged", cloned)
+	}
+
+	if Record(nil).Clone() != nil {
+		t.Error("Clone of a nil record is not nil")
+	}
+}
+
+func TestCloneRecordIsIndependent(t *testing.T) {
+	tags, err := structpb.NewList([]interface{}{"a", "b"})
+	if err != nil {
+		t.Fatalf("NewList failed: %v", err)
+	}
+	original := &dbdata.Record{Fields: map[string]*structpb.Value{
+		"name": structpb.NewStringValue("Ana"),
+		"tags": structpb.NewListValue(tags),
+	}}
+	want := proto.Clone(original).(*dbdata.Record)
+
+	cloned := CloneRecord(original)
+	if !proto.Equal(cloned, original) {
+		t.Fatalf("CloneRecord = %v, want %v", cloned, original)
+	}
+	cloned.Fields["name"] = structpb.NewStringValue("Bo")
+	cloned.Fields["tags"].GetListValue().Values[0] = structpb.NewStringValue("changed")
+	cloned.Fields["new"] = structpb.NewBoolValue(true)
+	if !proto.Equal(original, want) {
+		t.Errorf("original after modifying the copy = %v, want %v", original, want)
+	}
+
+	if CloneRecord(nil) != nil {
+		t.Error("CloneRecord of nil is not nil")
+	}
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes the records of a table to bytes before they are encrypted and written to the file, and decodes them back.
+// The name of the codec is stored in the header of the file, so a file is always read with the codec it was written with,
+// whatever the codec of the table is. Custom codecs must be registered with RegisterCodec to be able to read their files.
+type Codec interface {
+	Name() string                                    // Unique name of the codec, stored in the file header
+	Marshal(records *dbdata.Records) ([]byte, error) // Encodes the records
+	Unmarshal(data []byte, records *dbdata.Records) error
+}
+
+// ProtobufCodec encodes the records in the protobuf binary format. It is the default codec, the most compact and the fastest.
+var ProtobufCodec Codec = protobufCodec{}
+
+// JSONCodec encodes the records in the protobuf JSON format, which is larger and slower but readable once decrypted.
+var JSONCodec Codec = jsonCodec{}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) Marshal(records *dbdata.Records) ([]byte, error) {
+	return proto.Marshal(records)
+}
+
+func (protobufCodec) Unmarshal(data []byte, records *dbdata.Records) error {
+	return proto.Unmarshal(data, records)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(records *dbdata.Records) ([]byte, error) {
+	return protojson.Marshal(records)
+}
+
+func (jsonCodec) Unmarshal(data []byte, records *dbdata.Records) error {
+	return protojson.Unmarshal(data, records)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		ProtobufCodec.Name(): ProtobufCodec,
+		JSONCodec.Name():     JSONCodec,
+	}
+)
+
+// RegisterCodec registers a codec so the files written with it can be read.
+// It returns an error if the name of the codec is empty, contains a newline or a semicolon, or is already registered.
+func RegisterCodec(codec Codec) error {
+	name := codec.Name()
+	if name == "" || bytes.ContainsAny([]byte(name), "\r\n;") {
+		return fmt.Errorf("invalid codec name %q", name)
+	}
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, exists := codecs[name]; exists {
+		return fmt.Errorf("codec %s is already registered", name)
+	}
+	codecs[name] = codec
+	return nil
+}
+
+// lookupCodec returns the registered codec with the given name.
+func lookupCodec(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, exists := codecs[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return codec, nil
+}
+
+// WithCodec sets the codec used to encode the records of the table when they are written to the file.
+// It defaults to ProtobufCodec. Existing files are still read with the codec named in their header,
+// and are converted to the new codec on the next write. The codec is registered if it isn't already.
+func WithCodec(codec Codec) TableOption {
+	return func(t *Table) {
+		if codec == nil {
+			return
+		}
+		if registered, err := lookupCodec(codec.Name()); err != nil {
+			RegisterCodec(codec)
+		} else {
+			codec = registered
+		}
+		t.codec = codec
+	}
+}
+
+// File header
+//
+// A table file starts with a plain text header line naming the codec of its content, followed by the
+// base64-encoded encrypted records:
+//
+//	protodb:protobuf
+//	<base64 ciphertext>
+//
+// The colon is not part of the base64 alphabet, so files written before the header was introduced,
+// which hold the base64 ciphertext only, are recognized and read with ProtobufCodec. Those files also predate blobs
+// and encrypted fields, so their strings starting with "b64:" or "enc:" are plain strings, see escapeLegacyValues.
+// Flags follow the name of the codec, separated by semicolons; "gzip" marks records compressed before they
+// were encrypted, see WithCompression, and "written=" and "writes=" record the last write, see WithHeaderTimestamps:
+//
+//	protodb:protobuf;gzip;written=1718000000000000000;writes=42
+
+// fileHeaderPrefix starts the header line of a table file.
+const fileHeaderPrefix = "protodb:"
+
+// encodeFileHeader returns the header line of a file written with the given codec, compressed or not.
+func encodeFileHeader(codec Codec, compressed bool) []byte {
+	if compressed {
+		return []byte(fileHeaderPrefix + codec.Name() + ";" + compressionFlag + "\n")
+	}
+	return []byte(fileHeaderPrefix + codec.Name() + "\n")
+}
+
+// decodeFileHeader splits the content of a table file into the codec named in its header and the encrypted records,
+// and reports whether the header marks the records as compressed.
+func decodeFileHeader(content []byte) (Codec, bool, []byte, error) {
+	if !bytes.HasPrefix(content, []byte(fileHeaderPrefix)) {
+		return ProtobufCodec, false, content, nil
+	}
+	end := bytes.IndexByte(content, '\n')
+	if end < 0 {
+		return nil, false, nil, fmt.Errorf("invalid file header")
+	}
+	name, flags, _ := strings.Cut(string(content[len(fileHeaderPrefix):end]), ";")
+	compressed := false
+	if flags != "" {
+		for _, flag := range strings.Split(flags, ";") {
+			if isStampFlag(flag) {
+				// Read by parseFileStamp
+				continue
+			}
+			if flag != compressionFlag {
+				return nil, false, nil, fmt.Errorf("unknown file header flag %q", flag)
+			}
+			compressed = true
+		}
+	}
+	codec, err := lookupCodec(name)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	return codec, compressed, content[end+1:], nil
+}
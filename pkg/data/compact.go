@@ -0,0 +1,127 @@
+package data
+
+import (
+	"fmt"
+)
+
+// Compact is a method of the Table struct that rewrites the file of the table from its current records.
+// It first writes the pending coalesced writes, if any, then re-encodes every record with the codec of the table
+// and replaces the file, which converts files written with another codec and drops any space left by previous formats.
+// It locks the table for writing while the file is rewritten.
+//
+// Returns:
+// - The number of bytes reclaimed, the size of the file before the compaction minus its size after. It is negative if the file grew.
+// - An error, if an error occurs while reading or writing the file.
+func (t *Table) Compact() (int64, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if err := t.flushLocked(); err != nil {
+		return 0, err
+	}
+	sizeBefore, err := t.dataSize()
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := t.loadForWrite()
+	if err != nil {
+		return 0, err
+	}
+	if sizeBefore == 0 && len(records.GetRecords()) == 0 {
+		// An empty file is already as small as it gets
+		return 0, nil
+	}
+	// Rewrite every record file, not only the records that changed
+	t.resetRecordFiles(false)
+	if err := t.writeFile(records); err != nil {
+		return 0, err
+	}
+	t.Records = records.Records
+	t.publishSnapshot(records)
+
+	sizeAfter, err := t.dataSize()
+	if err != nil {
+		return 0, err
+	}
+	return sizeBefore - sizeAfter, nil
+}
+
+// fileSize returns the size of the file at the given path, or 0 if it does not exist.
+func fileSize(storage Storage, filePath string) (int64, error) {
+	info, err := storage.Stat(filePath)
+	if isNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file '%s': %v", filePath, err)
+	}
+	return info.Size(), nil
+}
+
+// VacuumResult reports the rewrite of a table by Vacuum.
+type VacuumResult struct {
+	Records     int   // Number of live records rewritten
+	BytesBefore int64 // Size of the files of the table before the vacuum, including the append log and leftover temporary files
+	BytesAfter  int64 // Size of the files of the table after the vacuum
+}
+
+// Vacuum is a method of the Table struct that rewrites the table as a single clean base file holding only its live records.
+// Like Compact, it writes the pending coalesced writes, then re-encodes every record with the codec of the table,
+// encrypts it again under the current keys of the table with fresh nonces, and atomically replaces the file,
+// rewriting every record file of a table with one file per record. Unlike Compact, it guarantees that nothing else is left:
+// the inserts of the append log are folded into the base file and the log is removed, and the temporary file left
+// by an interrupted write is removed too. It fails instead of leaving any of them behind.
+// It locks the table for writing while the file is rewritten.
+//
+// Returns:
+// - A VacuumResult with the number of records rewritten and the size of the files before and after.
+// - An error, if an error occurs while reading or writing the files, or a leftover file can't be removed.
+// The records are preserved either way, since the file is only replaced by a complete new one.
+func (t *Table) Vacuum() (VacuumResult, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if err := t.flushLocked(); err != nil {
+		return VacuumResult{}, err
+	}
+	sizeBefore, err := t.dataSize()
+	if err != nil {
+		return VacuumResult{}, err
+	}
+	tempPath := t.FilePath + tempFileSuffix
+	if !t.isMemory() {
+		tempSize, err := fileSize(t.fs(), tempPath)
+		if err != nil {
+			return VacuumResult{}, err
+		}
+		sizeBefore += tempSize
+	}
+
+	records, err := t.loadForWrite()
+	if err != nil {
+		return VacuumResult{}, err
+	}
+	// Rewrite every record file, not only the records that changed
+	t.resetRecordFiles(false)
+	if err := t.writeFile(records); err != nil {
+		return VacuumResult{}, err
+	}
+	t.Records = records.Records
+	t.publishSnapshot(records)
+
+	if !t.isMemory() {
+		if err := t.fs().Remove(tempPath); err != nil && !isNotExist(err) {
+			return VacuumResult{}, fmt.Errorf("failed to remove temporary file '%s': %v", tempPath, err)
+		}
+		if t.appendLogOnDisk() {
+			return VacuumResult{}, fmt.Errorf("failed to remove append log '%s'", appendLogPath(t.FilePath))
+		}
+	}
+
+	sizeAfter, err := t.dataSize()
+	if err != nil {
+		return VacuumResult{}, err
+	}
+	return VacuumResult{Records: len(records.GetRecords()), BytesBefore: sizeBefore, BytesAfter: sizeAfter}, nil
+}
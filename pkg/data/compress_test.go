@@ -0,0 +1,39 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+)
+
+// BenchmarkCompressionThreshold measures an update of tables of growing size written without compression,
+// always compressed and compressed from DefaultCompressionThreshold, and reports the size of their file.
+// The default is where compressing starts to pay for itself.
+func BenchmarkCompressionThreshold(b *testing.B) {
+	modes := []struct {
+		name string
+		opts []TableOption
+	}{
+		{"none", nil},
+		{"always", []TableOption{WithCompression(1)}},
+		{"default", []TableOption{WithCompression(0)}},
+	}
+	for _, size := range []int{1, 10, 100, 1000} {
+		for _, mode := range modes {
+			b.Run(fmt.Sprintf("records=%d/%s", size, mode.name), func(b *testing.B) {
+				table := newBenchmarkTable(b, size, mode.opts...)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := table.Update(fmt.Sprintf("r%06d", i%size), Record{"name": fmt.Sprint(i)}); err != nil {
+						b.Fatalf("Update failed: %v", err)
+					}
+				}
+				b.StopTimer()
+				stats, err := table.Stats()
+				if err != nil {
+					b.Fatalf("Stats failed: %v", err)
+				}
+				b.ReportMetric(float64(stats.SizeBytes), "file-bytes")
+			})
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Malpizarr/dbproto/pkg/utils"
+)
+
+// Config gathers the settings of a Server in one place, for NewServerWithConfig.
+// Every field is optional: the zero value of a field keeps the default of NewServer,
+// so the zero Config is a server storing its databases in the default server directory,
+// encrypted with the key of the AES_KEY environment variable, without limits.
+// The server logs through the standard log package, whose output is set with log.SetOutput.
+type Config struct {
+	Dir                  string        // Directory of the databases, the DBPROTO/databases directory of the home directory if empty
+	BackupDir            string        // Directory holding the backups directory, the DBPROTO_backups directory of the home directory if empty
+	AESKey               []byte        // 32-byte AES key encrypting the files of the tables and the audit logs, the AES_KEY environment variable if empty
+	AdminToken           string        // Token of the admin endpoints of the HTTP API, the PROTODB_ADMIN_TOKEN environment variable if empty
+	MaxDatabases         int           // Maximum number of databases, unlimited if zero, see WithMaxDatabases
+	MaxTablesPerDatabase int           // Maximum number of tables per database, unlimited if zero, see WithMaxTablesPerDatabase
+	MaxHotTables         int           // Maximum number of tables resident in memory, unlimited if zero, see WithMaxHotTables
+	MaxSelectAll         int           // Maximum number of records of a selectAll request, DefaultMaxSelectAll if zero, see WithMaxSelectAll
+	AuditLog             bool          // Whether the audit log of every database is enabled, see WithAuditLog
+	Replica              bool          // Whether the server is a read-only replica, see WithReplica
+	ReplicaInterval      time.Duration // Interval at which a replica checks the table files, DefaultReplicaPollInterval if zero
+	Storage              Storage       // Storage of the files of the server, LocalStorage if nil, see WithServerStorage
+	WriteDebounce        time.Duration // Write debounce window of the tables of the server, none if zero, see WithServerWriteDebounce
+}
+
+// NewServerWithConfig creates a new Server with the settings of the given Config.
+// Like NewServer, it doesn't touch the disk: Initialize creates the directory of the server and loads its databases.
+//
+// Parameters:
+// - cfg: The settings of the server. Zero fields keep their default.
+//
+// Returns:
+// - A pointer to the new Server instance.
+// - An error, if the AES key of the config is not 32 bytes long.
+func NewServerWithConfig(cfg Config) (*Server, error) {
+	if len(cfg.AESKey) > 0 {
+		if _, err := utils.NewUtilsWithKey(cfg.AESKey); err != nil {
+			return nil, fmt.Errorf("invalid config: %v", err)
+		}
+	}
+
+	opts := []ServerOption{
+		WithMaxDatabases(cfg.MaxDatabases),
+		WithMaxTablesPerDatabase(cfg.MaxTablesPerDatabase),
+		WithMaxHotTables(cfg.MaxHotTables),
+		WithMaxSelectAll(cfg.MaxSelectAll),
+		WithServerStorage(cfg.Storage),
+		WithServerWriteDebounce(cfg.WriteDebounce),
+	}
+	if cfg.AuditLog {
+		opts = append(opts, WithAuditLog())
+	}
+	if cfg.Replica {
+		opts = append(opts, WithReplica(cfg.ReplicaInterval))
+	}
+	server := NewServer(opts...)
+	server.dir = cfg.Dir
+	server.backupDir = cfg.BackupDir
+	if len(cfg.AESKey) > 0 {
+		server.aesKey = append([]byte(nil), cfg.AESKey...)
+	}
+	server.adminToken = cfg.AdminToken
+	return server, nil
+}
+
+// AdminToken is a method of the Server struct that returns the token of the admin endpoints set by Config.AdminToken,
+// or an empty string if the server was created without one.
+func (s *Server) AdminToken() string {
+	return s.adminToken
+}
+
+// withAESKey makes the table encrypt its file with the given AES key instead of the key of the AES_KEY environment variable.
+func withAESKey(key []byte) TableOption {
+	return func(t *Table) {
+		u, err := utils.NewUtilsWithKey(key)
+		if err != nil {
+			log.Fatalf("Failed to create utils: %v", err)
+		}
+		t.utils = u
+	}
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// elementIndexSuffix is appended to the name of a list field to name its element index, so it doesn't clash with
+// a regular index over the same field.
+const elementIndexSuffix = "[]"
+
+// newElementIndex creates an empty element index over the given list field.
+func newElementIndex(field string) *Index {
+	return &Index{
+		Name:     field + elementIndexSuffix,
+		Fields:   []string{field},
+		Elements: true,
+		entries:  make(map[string]map[string]struct{}),
+	}
+}
+
+// elementLookupKeys returns the distinct string forms of the elements of a list value, as stored in an element index.
+// It returns no key if the value is not a list.
+func elementLookupKeys(value *structpb.Value) []string {
+	list := value.GetListValue()
+	if list == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(list.Values))
+	lookupKeys := make([]string, 0, len(list.Values))
+	for _, element := range list.Values {
+		if _, isNull := element.GetKind().(*structpb.Value_NullValue); element == nil || isNull {
+			continue
+		}
+		lookupKey := indexValue(element)
+		if !seen[lookupKey] {
+			seen[lookupKey] = true
+			lookupKeys = append(lookupKeys, lookupKey)
+		}
+	}
+	return lookupKeys
+}
+
+// listContains reports whether the value is a list with an element whose string form is the given one.
+func listContains(value *structpb.Value, element string) bool {
+	for _, lookupKey := range elementLookupKeys(value) {
+		if lookupKey == element {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateElementIndex is a method of the Table struct that creates an index over the elements of a list field,
+// such as the tags of a record. Each element is indexed on its own, so SelectContains finds the records whose list
+// holds a value without scanning the table. The index is named after the field followed by "[]", such as "tags[]",
+// and can also be queried with SelectByIndex and dropped with DropIndex.
+// Like CreateIndex, it builds the index from the records stored in the file and saves its declaration
+// in the metadata file of the table. Records whose field is missing or is not a list are not indexed.
+//
+// Parameters:
+// - field: The name of the list field whose elements are indexed.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the field is empty, the index already exists or an error occurs while reading the records or saving the metadata,
+// it returns an error.
+func (t *Table) CreateElementIndex(field string) error {
+	if field == "" {
+		return fmt.Errorf("an element index needs a field")
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	idx := newElementIndex(field)
+	if _, exists := t.indexes[idx.Name]; exists {
+		return fmt.Errorf("index %s already exists", idx.Name)
+	}
+	if err := t.checkIndexable(field); err != nil {
+		return err
+	}
+
+	allRecords, err := t.loadForWrite()
+	if err != nil {
+		return err
+	}
+
+	t.indexes[idx.Name] = idx
+	if err := t.saveMetadata(); err != nil {
+		delete(t.indexes, idx.Name)
+		return err
+	}
+	t.rebuildIndexes(allRecords.GetRecords())
+	return nil
+}
+
+// SelectContains is a method of the Table struct that selects the records whose list field contains the given value,
+// for example SelectContains("tags", "go") to filter records by tag.
+// The value is compared with the string form of the elements, so SelectContains("scores", "42") matches the number 42.
+// If the field has an element index created by CreateElementIndex, the records are looked up in the index;
+// otherwise the current snapshot of the records is scanned.
+//
+// Parameters:
+// - field: The name of the list field to search.
+// - value: The string form of the element to find.
+//
+// Returns:
+// - A slice of Record objects whose list contains the value, sorted by primary key. If no records match, it returns an empty slice.
+// - An error, if an error occurs while reading the records from the file or converting them.
+func (t *Table) SelectContains(field, value string) ([]Record, error) {
+	allRecords, err := t.rlockLoaded()
+	if err != nil {
+		return nil, err
+	}
+	idx, indexed := t.indexes[field+elementIndexSuffix]
+	var keys []string
+	if indexed {
+		keys = idx.keys([]string{value})
+	}
+	t.RUnlock()
+
+	if !indexed {
+		for key, record := range allRecords.GetRecords() {
+			if listContains(record.Fields[field], value) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+	}
+
+	results := make([]Record, 0, len(keys))
+	for _, key := range keys {
+		protoRecord, exists := allRecords.Records[key]
+		if !exists {
+			continue
+		}
+		record, err := t.fromStoredRecord(protoRecord)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, record)
+	}
+
+	t.metrics.IncrementQueryCount()
+	return results, nil
+}
+
+// stringListValue converts a slice of strings to a protobuf list value, which structpb.NewValue doesn't accept directly.
+func stringListValue(values []string) *structpb.Value {
+	elements := make([]*structpb.Value, len(values))
+	for i, value := range values {
+		elements[i] = structpb.NewStringValue(value)
+	}
+	return structpb.NewListValue(&structpb.ListValue{Values: elements})
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// containsKeys returns the primary keys of the records whose tags contain the value.
+func containsKeys(t *testing.T, table *Table, value string) []interface{} {
+	t.Helper()
+	records, err := table.SelectContains("tags", value)
+	if err != nil {
+		t.Fatalf("SelectContains(%q) failed: %v", value, err)
+	}
+	keys := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		keys = append(keys, record["id"])
+	}
+	return keys
+}
+
+func TestSelectContains(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		table := newTestTable(t, "id")
+		if indexed {
+			if err := table.CreateElementIndex("tags"); err != nil {
+				t.Fatalf("CreateElementIndex failed: %v", err)
+			}
+		}
+		mustInsert(t, table,
+			Record{"id": "p1", "tags": []interface{}{"go", "db"}},
+			Record{"id": "p2", "tags": []interface{}{"db", "web", "db"}},
+			Record{"id": "p3", "tags": []interface{}{"web", 42}},
+			Record{"id": "p4", "tags": "db"},
+			Record{"id": "p5"},
+		)
+
+		tests := []struct {
+			value string
+			want  []interface{}
+		}{
+			{"db", []interface{}{"p1", "p2"}},
+			{"web", []interface{}{"p2", "p3"}},
+			{"go", []interface{}{"p1"}},
+			{"42", []interface{}{"p3"}},
+			{"rust", []interface{}{}},
+		}
+		for _, tt := range tests {
+			if got := containsKeys(t, table, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("indexed %v: SelectContains(%q) = %v, want %v", indexed, tt.value, got, tt.want)
+			}
+		}
+
+		// The element index follows the updates and deletes
+		if err := table.Update("p1", Record{"tags": []interface{}{"rust"}}); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if err := table.Delete("p2"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if got := containsKeys(t, table, "db"); len(got) != 0 {
+			t.Errorf("indexed %v: SelectContains(\"db\") after the writes = %v, want none", indexed, got)
+		}
+		if got := containsKeys(t, table, "rust"); !reflect.DeepEqual(got, []interface{}{"p1"}) {
+			t.Errorf("indexed %v: SelectContains(\"rust\") after the writes = %v, want [p1]", indexed, got)
+		}
+	}
+}
+
+func TestElementIndexIsRebuiltOnReopen(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "posts.bin")
+	table := openTestTable(t, "id", filePath)
+	mustInsert(t, table, Record{"id": "p1", "tags": []interface{}{"go"}})
+	if err := table.CreateElementIndex("tags"); err != nil {
+		t.Fatalf("CreateElementIndex failed: %v", err)
+	}
+	if err := table.CreateElementIndex("tags"); err == nil {
+		t.Error("CreateElementIndex of an existing index succeeded, want an error")
+	}
+	if err := table.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened := openTestTable(t, "id", filePath)
+	if err := reopened.LoadIndexes(); err != nil {
+		t.Fatalf("LoadIndexes failed: %v", err)
+	}
+	records, err := reopened.SelectByIndex("tags[]", "go")
+	if err != nil {
+		t.Fatalf("SelectByIndex failed: %v", err)
+	}
+	if len(records) != 1 || records[0]["id"] != "p1" {
+		t.Errorf("SelectByIndex(\"tags[]\", \"go\") = %v, want p1", records)
+	}
+}
@@ -0,0 +1,77 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TableRef identifies a table of a server by the name of its database and its own name.
+type TableRef struct {
+	Database string // Name of the database of the table
+	Table    string // Name of the table
+}
+
+// String returns the reference as database.table.
+func (ref TableRef) String() string {
+	return ref.Database + "." + ref.Table
+}
+
+// Table is a method of the Server struct that returns the table with the given reference.
+// It read-locks the server, then the database, and releases each lock before returning.
+//
+// Parameters:
+// - ref: The database and the name of the table.
+//
+// Returns:
+// - A pointer to the table.
+// - An error wrapping ErrNotFound, if the database or the table does not exist.
+func (s *Server) Table(ref TableRef) (*Table, error) {
+	s.RLock()
+	db, exists := s.Databases[ref.Database]
+	s.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("database %s %w", ref.Database, ErrNotFound)
+	}
+	db.RLock()
+	table, exists := db.Tables[ref.Table]
+	db.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("table %s %w", ref, ErrNotFound)
+	}
+	return table, nil
+}
+
+// JoinTables is a method of the Server struct that joins two tables that may belong to different databases,
+// such as a table of orders with reference data kept in a shared database. It behaves like the JoinTables function
+// once the tables are resolved.
+// The tables are resolved in the order of their database and table names, whatever the order of the arguments,
+// taking the lock of a single database at a time, and the join reads the snapshots of the tables without locking them,
+// so concurrent joins across the same databases can't deadlock. Each table is read as of a different instant.
+//
+// Parameters:
+// - ref1, ref2: The references of the first and second tables to be joined.
+// - key1, key2: The key fields for the first and second tables, respectively.
+// - joinType: The type of join to be performed, represented as a JoinType value.
+// - opts: Optional JoinOption values that configure the join, such as WithNullFill, WithCoercion or WithKeyNormalizer.
+//
+// Returns:
+// - A slice of maps, where each map represents a joined record, with the fields prefixed like the JoinTables function.
+// - An error wrapping ErrNotFound if a database or a table does not exist, or any error of the join.
+func (s *Server) JoinTables(ref1, ref2 TableRef, key1, key2 string, joinType JoinType, opts ...JoinOption) ([]map[string]interface{}, error) {
+	refs := []TableRef{ref1, ref2}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Database != refs[j].Database {
+			return refs[i].Database < refs[j].Database
+		}
+		return refs[i].Table < refs[j].Table
+	})
+	tables := make(map[TableRef]*Table, len(refs))
+	for _, ref := range refs {
+		table, err := s.Table(ref)
+		if err != nil {
+			return nil, err
+		}
+		tables[ref] = table
+	}
+	return JoinTables(tables[ref1], tables[ref2], key1, key2, joinType, opts...)
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestServerJoinTablesAcrossDatabases(t *testing.T) {
+	server, err := NewServerWithConfig(Config{Dir: t.TempDir(), BackupDir: t.TempDir(), AESKey: testAESKey})
+	if err != nil {
+		t.Fatalf("NewServerWithConfig failed: %v", err)
+	}
+	if err := server.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer server.Close()
+
+	orders, err := server.GetOrCreateTable("shop", "orders", "id")
+	if err != nil {
+		t.Fatalf("GetOrCreateTable failed: %v", err)
+	}
+	countries, err := server.GetOrCreateTable("shared", "countries", "code")
+	if err != nil {
+		t.Fatalf("GetOrCreateTable failed: %v", err)
+	}
+	mustInsert(t, orders, Record{"id": "o1", "country": "PE"}, Record{"id": "o2", "country": "CL"})
+	mustInsert(t, countries, Record{"code": "PE", "name": "Peru"})
+
+	ordersRef := TableRef{Database: "shop", Table: "orders"}
+	countriesRef := TableRef{Database: "shared", Table: "countries"}
+	rows, err := server.JoinTables(ordersRef, countriesRef, "country", "code", LeftJoin)
+	if err != nil {
+		t.Fatalf("JoinTables failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["t1.id"] != "o1" || rows[0]["t2.name"] != "Peru" || rows[1]["t1.id"] != "o2" {
+		t.Errorf("JoinTables = %v, want o1 joined with Peru and o2 alone", rows)
+	}
+
+	// The arguments keep their sides whatever the order the tables are resolved in
+	rows, err = server.JoinTables(countriesRef, ordersRef, "code", "country", InnerJoin)
+	if err != nil {
+		t.Fatalf("JoinTables failed: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["t1.name"] != "Peru" || rows[0]["t2.id"] != "o1" {
+		t.Errorf("JoinTables with swapped tables = %v, want Peru as t1 and o1 as t2", rows)
+	}
+
+	// Joins in opposite directions run concurrently without deadlocking
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			server.JoinTables(ordersRef, countriesRef, "country", "code", InnerJoin)
+		}()
+		go func() {
+			defer wg.Done()
+			server.JoinTables(countriesRef, ordersRef, "code", "country", InnerJoin)
+		}()
+	}
+	wg.Wait()
+
+	for _, missing := range []TableRef{{Database: "nope", Table: "orders"}, {Database: "shop", Table: "nope"}} {
+		if _, err := server.JoinTables(ordersRef, missing, "country", "code", InnerJoin); !errors.Is(err, ErrNotFound) {
+			t.Errorf("JoinTables with %s = %v, want ErrNotFound", missing, err)
+		}
+	}
+}
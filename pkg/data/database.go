@@ -1,14 +1,15 @@
 package data
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 type DatabaseReader interface {
@@ -20,6 +21,16 @@ type Database struct {
 	sync.RWMutex                   // Mutex to ensure the database is thread safe
 	Name         string            // Name of the database
 	Tables       map[string]*Table // Map of Tables in the database
+	lru          *tableLRU         // LRU of hot tables the tables of the database belong to, if any
+	audit        *auditLog         // Audit log of the mutations of the tables, if enabled
+	maxTables    int               // Maximum number of tables, unlimited if zero, see WithMaxTablesPerDatabase
+	readOnly     bool              // Whether the database belongs to a read-only replica, see WithReplica
+	migrateMu    sync.Mutex        // Mutex serializing the calls to Migrate
+	registry     *tableRegistry    // Registry of the tables opened by the server of the database, if any
+	serverDir    string            // Directory of the databases of the server, the default server directory if empty
+	aesKey       []byte            // AES key of the files, the AES_KEY environment variable if nil
+	storage      Storage           // Storage of the files of the database, LocalStorage if nil
+	debounce     time.Duration     // Write debounce window of the tables of the database, none if zero
 }
 
 func NewDatabase(name string) *Database {
@@ -29,6 +40,30 @@ func NewDatabase(name string) *Database {
 	}
 }
 
+// dir returns the directory of the files of the database.
+func (db *Database) dir() string {
+	serverDir := db.serverDir
+	if serverDir == "" {
+		serverDir = getDefaultServerDir()
+	}
+	return filepath.Join(serverDir, db.Name)
+}
+
+// tableOptions returns the options applying the settings of the server of the database to its tables.
+func (db *Database) tableOptions() []TableOption {
+	var opts []TableOption
+	if db.aesKey != nil {
+		opts = append(opts, withAESKey(db.aesKey))
+	}
+	if db.storage != nil {
+		opts = append(opts, WithStorage(db.storage))
+	}
+	if db.debounce > 0 {
+		opts = append(opts, WithWriteDebounce(db.debounce))
+	}
+	return opts
+}
+
 func ValidFilename(name string) bool {
 	validName := regexp.MustCompile(`^[a-zA-Z0-9-_]+$`).MatchString
 	return validName(name)
@@ -39,25 +74,27 @@ func ValidFilename(name string) bool {
 // The table name and primary key must match the regex `^[a-zA-Z0-9-_]+$`, meaning they can only contain
 // alphanumeric characters, hyphens, and underscores. They cannot contain spaces, punctuation (except for hyphens and underscores),
 // or special characters.
-// It first checks if the table name and the primary key are valid using the ValidFilename function.
+// It first checks if the table name is valid using the ValidFilename function, and the primary key using the ValidKeyPath function,
+// which also accepts a dotted path such as "meta.id" for a primary key held by a nested object.
 // If either the table name or the primary key is not valid, it returns an error.
 // It then acquires a lock on the Database struct and defers the unlocking of the lock.
 // It checks if a table with the same name already exists in the database.
 // If a table with the same name already exists, it returns an error.
+// If the database already has the maximum number of tables set by WithMaxTablesPerDatabase, it returns an error wrapping ErrLimitReached.
 // It then creates the database directory if it does not exist.
 // If there is an error creating the database directory, the error is returned.
-// It creates a new Table instance with the primary key and the file path of the table.
+// It creates a new Table instance with the primary key, the file path of the table and the given table options.
 // It adds the table to the Tables field of the Database struct.
 // It then saves the primary key in a metadata file.
 // If there is an error serializing the metadata or writing the metadata file, the error is returned.
 // It then creates the initial file for the table.
 // If there is an error creating the initial file, the error is returned.
 // If the table is successfully created, the method returns nil.
-func (db *Database) CreateTable(tableName, primaryKey string) error {
+func (db *Database) CreateTable(tableName, primaryKey string, opts ...TableOption) error {
 	if !ValidFilename(tableName) {
 		return fmt.Errorf("invalid table name: %s", tableName)
 	}
-	if !ValidFilename(primaryKey) {
+	if !ValidKeyPath(primaryKey) {
 		return fmt.Errorf("invalid primary key: %s", primaryKey)
 	}
 	db.Lock()
@@ -65,39 +102,62 @@ func (db *Database) CreateTable(tableName, primaryKey string) error {
 	if _, exists := db.Tables[tableName]; exists {
 		return fmt.Errorf("table %s already exists", tableName)
 	}
+	_, err := db.createTableLocked(tableName, primaryKey, opts...)
+	return err
+}
 
-	serverDir := getDefaultServerDir()
-	dbDir := filepath.Join(serverDir, db.Name)
+// createTableLocked creates the table like CreateTable once the names were validated and the table was checked not to exist,
+// and returns it. The database must be locked for writing.
+func (db *Database) createTableLocked(tableName, primaryKey string, opts ...TableOption) (*Table, error) {
+	if db.readOnly {
+		return nil, fmt.Errorf("%w: can't create table %s", ErrReadOnly, tableName)
+	}
+	if db.maxTables > 0 && len(db.Tables) >= db.maxTables {
+		return nil, fmt.Errorf("%w: database %s already has the maximum of %d tables", ErrLimitReached, db.Name, db.maxTables)
+	}
+	dbDir := db.dir()
 	filePath := filepath.Join(dbDir, tableName+".dat")
-	metaFilePath := filepath.Join(dbDir, tableName+".meta")
 
-	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		return fmt.Errorf("failed to create database directory: %v", err)
+	if err := db.fs().MkdirAll(dbDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %v", err)
 	}
 
-	table := NewTable(primaryKey, filePath)
+	opts = append(db.tableOptions(), opts...)
+	table, opened := db.registry.open(filePath, func() *Table {
+		return NewTable(primaryKey, filePath, opts...)
+	})
+	if opened {
+		// The file is already backed by a table of the server, which must not be truncated
+		if table.PrimaryKey != primaryKey {
+			return nil, fmt.Errorf("table %s is already open with primary key %s, not %s", tableName, table.PrimaryKey, primaryKey)
+		}
+		db.Tables[tableName] = table
+		return table, nil
+	}
+	table.lru = db.lru
+	table.audit = db.audit
+	table.touch()
 	db.Tables[tableName] = table
 
 	// Save the primary key in a metadata file
-	metaData := map[string]string{"PrimaryKey": primaryKey}
-	metaDataBytes, err := json.Marshal(metaData)
-	if err != nil {
-		return fmt.Errorf("failed to serialize metadata: %v", err)
-	}
-	if err := os.WriteFile(metaFilePath, metaDataBytes, 0644); err != nil {
-		return fmt.Errorf("failed to write metadata file: %v", err)
+	if err := table.saveMetadata(); err != nil {
+		return nil, err
 	}
 
-	if _, err := os.Create(filePath); err != nil {
-		return fmt.Errorf("failed to create initial file for table '%s': %v", tableName, err)
+	if table.isMemory() {
+		return table, nil
+	}
+	if err := writeStorageFile(db.fs(), filePath, nil, 0666); err != nil {
+		return nil, fmt.Errorf("failed to create initial file for table '%s': %v", tableName, err)
 	}
 
-	return nil
+	return table, nil
 }
 
 // LoadTables loads the tables from the database directory.
+// Within a server, a table whose file is already open is reused and reloaded instead of being opened again.
 func (db *Database) LoadTables(dbDir string) error {
-	files, err := os.ReadDir(dbDir)
+	files, err := db.fs().ReadDir(dbDir)
 	if err != nil {
 		return fmt.Errorf("failed to read database directory: %v", err)
 	}
@@ -109,29 +169,93 @@ func (db *Database) LoadTables(dbDir string) error {
 
 			// Load the primary key from the metadata file
 			metaFilePath := filepath.Join(dbDir, tableName+".meta")
-			metaDataBytes, err := os.ReadFile(metaFilePath)
+			metaData, err := readMetadataFile(db.fs(), metaFilePath)
 			if err != nil {
 				return fmt.Errorf("failed to read metadata file for table %s: %v", tableName, err)
 			}
-			var metaData map[string]string
-			if err := json.Unmarshal(metaDataBytes, &metaData); err != nil {
-				return fmt.Errorf("failed to deserialize metadata for table %s: %v", tableName, err)
-			}
-			primaryKey := metaData["PrimaryKey"]
+			primaryKey := metaData.PrimaryKey
 
-			table := NewTable(primaryKey, tablePath)
-			records, err := table.readRecordsFromFile()
-			if err != nil {
-				return fmt.Errorf("failed to load table %s: %v", tableName, err)
+			opts := db.tableOptions()
+			if db.readOnly {
+				opts = append(opts, withReadOnly())
 			}
-
-			table.Records = records.Records
+			table, opened := db.registry.open(tablePath, func() *Table {
+				return NewTable(primaryKey, tablePath, opts...)
+			})
+			if opened {
+				// Keep the table already open for the file, with the records of the file, which may have been restored
+				if err := table.reload(); err != nil {
+					return fmt.Errorf("failed to load table %s: %v", tableName, err)
+				}
+			} else {
+				records, err := table.readRecordsFromFile()
+				if err != nil {
+					return fmt.Errorf("failed to load table %s: %v", tableName, err)
+				}
+				table.Records = records.Records
+			}
+			table.lru = db.lru
+			table.audit = db.audit
+			table.touch()
 			db.Tables[tableName] = table
 		}
 	}
 	return nil
 }
 
+// Close is a method of the Database struct that flushes and closes every table of the database.
+// Each table writes its coalesced writes, stops its background fsync goroutine and syncs its file,
+// and stops being tracked by the LRU of hot tables, so no eviction runs on it afterwards.
+// The tables are closed in name order, and every table is closed even if closing another one fails,
+// so as much data as possible is persisted.
+//
+// Returns:
+// - If every table is closed successfully, it returns nil.
+// - Otherwise, it returns the errors of the tables that failed to close joined with errors.Join, in name order.
+// Each of them wraps the error of its table, so it can be tested with errors.Is.
+func (db *Database) Close() error {
+	db.Lock()
+	defer db.Unlock()
+
+	names := make([]string, 0, len(db.Tables))
+	for name := range db.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		table := db.Tables[name]
+		if table.lru != nil {
+			table.lru.remove(table)
+		}
+		if err := table.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close table %s: %w", name, err))
+		}
+	}
+	if db.audit != nil {
+		db.audit.close()
+		db.audit = nil
+		for _, table := range db.Tables {
+			table.setAuditLog(nil)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flushTables writes the pending coalesced writes of every table of the database to their files.
+func (db *Database) flushTables() error {
+	db.RLock()
+	defer db.RUnlock()
+
+	for name, table := range db.Tables {
+		if err := table.Flush(); err != nil {
+			return fmt.Errorf("failed to flush table %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
 // ListTables returns a list of tables in the database
 func (db *Database) ListTables() ([]string, error) {
 	db.RLock()
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDatabaseCloseFlushesAndReleasesTables(t *testing.T) {
+	db := newTestDatabase(t)
+	db.lru = newTableLRU(4)
+	for _, name := range []string{"a", "b"} {
+		// The debounce window outlives the test, so only Close writes the records
+		if err := db.CreateTable(name, "id", WithWriteDebounce(time.Hour)); err != nil {
+			t.Fatalf("CreateTable(%s) failed: %v", name, err)
+		}
+		mustInsert(t, db.Tables[name], Record{"id": "1", "table": name})
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for name, table := range db.Tables {
+		if !table.TryLock() {
+			t.Errorf("the lock of table %s is still held after Close", name)
+			continue
+		}
+		table.Unlock()
+		if db.lru.tracked(table) {
+			t.Errorf("table %s is still tracked by the LRU after Close", name)
+		}
+	}
+
+	reopened := NewDatabase(db.Name)
+	reopened.serverDir = db.serverDir
+	reopened.aesKey = db.aesKey
+	if err := reopened.LoadTables(db.dir()); err != nil {
+		t.Fatalf("LoadTables failed: %v", err)
+	}
+	defer reopened.Close()
+	for _, name := range []string{"a", "b"} {
+		table, exists := reopened.Tables[name]
+		if !exists {
+			t.Fatalf("table %s was not loaded", name)
+		}
+		record, err := table.Select("1")
+		if err != nil {
+			t.Fatalf("Select on table %s failed: %v", name, err)
+		}
+		if record["table"] != name {
+			t.Errorf("record of table %s = %v", name, record)
+		}
+	}
+}
+
+func TestServerCloseClosesDatabases(t *testing.T) {
+	dir := t.TempDir()
+	open := func() *Server {
+		server, err := NewServerWithConfig(Config{Dir: dir, BackupDir: t.TempDir(), AESKey: testAESKey})
+		if err != nil {
+			t.Fatalf("NewServerWithConfig failed: %v", err)
+		}
+		if err := server.Initialize(); err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+		return server
+	}
+
+	server := open()
+	table, err := server.GetOrCreateTable("shop", "orders", "id", WithWriteDebounce(time.Hour))
+	if err != nil {
+		t.Fatalf("GetOrCreateTable failed: %v", err)
+	}
+	mustInsert(t, table, Record{"id": "o1"})
+	if err := server.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	server = open()
+	defer server.Close()
+	table, err = server.Table(TableRef{Database: "shop", Table: "orders"})
+	if err != nil {
+		t.Fatalf("Table failed: %v", err)
+	}
+	if _, err := table.Select("o1"); err != nil {
+		t.Errorf("the debounced write was lost by Server.Close: %v", err)
+	}
+}
+
+func TestDatabaseCloseFlushesEveryTableWhenOneFails(t *testing.T) {
+	db := newTestDatabase(t)
+	paths := make(map[string]string)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := db.CreateTable(name, "id", WithWriteDebounce(time.Hour)); err != nil {
+			t.Fatalf("CreateTable(%s) failed: %v", name, err)
+		}
+		mustInsert(t, db.Tables[name], Record{"id": "1", "table": name})
+		paths[name] = db.Tables[name].FilePath
+	}
+	// The flush of b fails, since its file can't be created in a missing directory
+	db.Tables["b"].FilePath = filepath.Join(t.TempDir(), "missing", "b.bin")
+
+	err := db.Close()
+	if err == nil || !strings.Contains(err.Error(), "failed to close table b") {
+		t.Fatalf("Close = %v, want the error of table b", err)
+	}
+	if strings.Contains(err.Error(), "table a") || strings.Contains(err.Error(), "table c") {
+		t.Errorf("Close = %v, want only the error of table b", err)
+	}
+	for _, name := range []string{"a", "c"} {
+		table := openTestTable(t, "id", paths[name])
+		if record, err := table.Select("1"); err != nil || record["table"] != name {
+			t.Errorf("record of table %s = %v, %v, want it flushed despite the failure of b", name, record, err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// txnOpKind is the kind of a write buffered by a DBTxn.
+type txnOpKind int
+
+const (
+	txnInsert txnOpKind = iota
+	txnUpdate
+	txnDelete
+)
+
+// txnOp is a write buffered by a DBTxn until it is committed.
+type txnOp struct {
+	kind    txnOpKind   // Kind of the write
+	table   string      // Name of the table written to
+	record  Record      // Record to insert, for inserts
+	key     interface{} // Key of the record to update or delete
+	updates Record      // Fields to update, for updates
+}
+
+// DBTxn is a transaction spanning several tables of a database.
+// Its writes are buffered until Commit, which applies all of them or none of them.
+//
+// Consistency guarantees:
+//   - Commit locks every table written by the transaction, in table name order so concurrent commits can't deadlock,
+//     and holds the locks until all the writes are applied or rolled back, so no other writer interleaves with them.
+//   - If a write fails, for example because a key already exists or is not found, the tables already written
+//     are restored to their records before the commit, and Commit returns the error of the failed write.
+//   - Each table is stored in its own file, so a commit writes several files one after another. Readers, which
+//     don't take the table locks, can see the writes of a commit in progress on some tables and not yet on others,
+//     and a crash during a commit can leave some files written and others not. Each file on its own is always
+//     a complete set of records. If restoring a table after a failed write fails too, the error reports the tables
+//     that could not be restored.
+type DBTxn struct {
+	sync.Mutex           // Mutex to ensure the transaction is thread safe
+	db         *Database // Database the transaction belongs to
+	ops        []txnOp   // Writes buffered until Commit, in order
+	done       bool      // Whether the transaction was committed or rolled back
+}
+
+// Begin is a method of the Database struct that starts a transaction spanning several tables of the database.
+// The writes of the transaction are buffered and applied together by Commit, or discarded by Rollback.
+//
+// Returns:
+// - A pointer to a new DBTxn.
+func (db *Database) Begin() *DBTxn {
+	return &DBTxn{db: db}
+}
+
+// Insert buffers the insertion of a record into the table with the given name.
+func (tx *DBTxn) Insert(tableName string, record Record) error {
+	return tx.add(txnOp{kind: txnInsert, table: tableName, record: record})
+}
+
+// Update buffers the update of the record with the given key in the table with the given name.
+func (tx *DBTxn) Update(tableName string, key interface{}, updates Record) error {
+	return tx.add(txnOp{kind: txnUpdate, table: tableName, key: key, updates: updates})
+}
+
+// Delete buffers the deletion of the record with the given key from the table with the given name.
+func (tx *DBTxn) Delete(tableName string, key interface{}) error {
+	return tx.add(txnOp{kind: txnDelete, table: tableName, key: key})
+}
+
+// add buffers a write, checking that the transaction is still open and the table exists.
+func (tx *DBTxn) add(op txnOp) error {
+	tx.Lock()
+	defer tx.Unlock()
+
+	if tx.done {
+		return fmt.Errorf("transaction is already finished")
+	}
+	tx.db.RLock()
+	_, exists := tx.db.Tables[op.table]
+	tx.db.RUnlock()
+	if !exists {
+		return fmt.Errorf("table %s not found", op.table)
+	}
+	tx.ops = append(tx.ops, op)
+	return nil
+}
+
+// Rollback discards the buffered writes of the transaction. Nothing was written yet, so the tables are untouched.
+func (tx *DBTxn) Rollback() error {
+	tx.Lock()
+	defer tx.Unlock()
+
+	if tx.done {
+		return fmt.Errorf("transaction is already finished")
+	}
+	tx.done = true
+	tx.ops = nil
+	return nil
+}
+
+// Commit applies the buffered writes of the transaction in order, all of them or none of them.
+// It locks the tables written by the transaction, saves their records, and applies the writes.
+// The triggers of each write fire like for a write of the table, before the write is published, while every table
+// of the transaction is locked. If a write fails or a trigger rejects it, every table written so far is restored
+// to its saved records and the error is returned.
+//
+// Returns:
+// - If all the writes are applied, it returns nil.
+// - If a write or a trigger fails, it returns its error after restoring the tables.
+func (tx *DBTxn) Commit() error {
+	tx.Lock()
+	defer tx.Unlock()
+
+	if tx.done {
+		return fmt.Errorf("transaction is already finished")
+	}
+	tx.done = true
+
+	tables := make(map[string]*Table)
+	tx.db.RLock()
+	for _, op := range tx.ops {
+		table, exists := tx.db.Tables[op.table]
+		if !exists {
+			tx.db.RUnlock()
+			return fmt.Errorf("table %s not found", op.table)
+		}
+		tables[op.table] = table
+	}
+	tx.db.RUnlock()
+
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seqs, err := tx.apply(tables, names)
+	for _, name := range names {
+		// With record locks, the writes published their changes for a group commit
+		if seqs[name] > 0 {
+			if commitErr := tables[name].awaitCommit(seqs[name]); commitErr != nil && err == nil {
+				err = commitErr
+			}
+		}
+	}
+	return err
+}
+
+// apply locks the tables and applies the buffered writes of the transaction, restoring the tables if one fails.
+// It returns the sequence number of the change each table published for a group commit, if any.
+// The tables are unlocked when it returns.
+func (tx *DBTxn) apply(tables map[string]*Table, names []string) (map[string]uint64, error) {
+	// Lock the tables in name order, so two commits writing the same tables can't deadlock
+	for _, name := range names {
+		tables[name].Lock()
+		defer tables[name].Unlock()
+	}
+
+	// Record the writes in the audit log only if they all succeed
+	committed := false
+	for _, name := range names {
+		tables[name].holdAuditEntries()
+		defer func(table *Table) {
+			table.releaseAuditEntries(committed)
+		}(tables[name])
+	}
+
+	// Capture the changes of the writes, so their triggers fire before each write is published.
+	// The triggers can't write to any table of the transaction, which are all locked
+	locked := make([]*Table, 0, len(names))
+	for _, name := range names {
+		locked = append(locked, tables[name])
+	}
+	ctx := withTriggerTables(context.Background(), locked...)
+	seqs := make(map[string]uint64, len(names))
+	for _, name := range names {
+		tables[name].capturing, tables[name].triggerCtx = true, ctx
+		defer func(name string, table *Table) {
+			if committed {
+				seqs[name] = table.pendingSeq
+			}
+			table.capturing, table.triggerCtx, table.changes, table.pendingSeq = false, nil, nil, 0
+		}(name, tables[name])
+	}
+
+	originals := make(map[string]*dbdata.Records, len(tables))
+	for _, name := range names {
+		records, err := tables[name].loadForWrite()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read table %s: %v", name, err)
+		}
+		originals[name] = records
+	}
+
+	for i, op := range tx.ops {
+		table := tables[op.table]
+		var err error
+		switch op.kind {
+		case txnInsert:
+			_, _, err = table.insertLocked(op.record, InsertError)
+		case txnUpdate:
+			err = table.updateLocked(op.key, op.updates)
+		case txnDelete:
+			err = table.deleteLocked(op.key)
+		}
+		if err != nil {
+			if restoreErr := tx.restore(tables, originals); restoreErr != nil {
+				return nil, fmt.Errorf("write %d on table %s failed: %v; %v", i, op.table, err, restoreErr)
+			}
+			return nil, fmt.Errorf("write %d on table %s failed, transaction rolled back: %w", i, op.table, err)
+		}
+	}
+	committed = true
+	return seqs, nil
+}
+
+// restore writes the saved records back to the tables and rebuilds their indexes and caches.
+// The tables must be locked for writing.
+func (tx *DBTxn) restore(tables map[string]*Table, originals map[string]*dbdata.Records) error {
+	var failed []string
+	for name, table := range tables {
+		if err := table.restoreLocked(originals[name]); err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("failed to restore tables %v", failed)
+	}
+	return nil
+}
+
+// restoreLocked writes the given records back to the table and rebuilds its indexes and cache from them.
+// The table must be locked for writing.
+func (t *Table) restoreLocked(records *dbdata.Records) error {
+	t.resetRecordFiles(false)
+	if err := t.writeRecordsToFile(records); err != nil {
+		return err
+	}
+	t.Cache = make(map[string]*dbdata.Record)
+	t.rebuildIndexes(records.GetRecords())
+	return nil
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"log"
+	"time"
+)
+
+// WithWriteDebounce makes the table coalesce bursts of writes into a single file write.
+// Every write still updates the records in memory immediately, so a read after a write always sees it,
+// but the file is only written once the window has elapsed since the first write not yet written,
+// however many writes happen during the window. Flush and Close write the pending writes immediately.
+//
+// Durability: the writes of the current window are only in memory. If the process crashes before they are
+// flushed, they are lost even though the write calls returned successfully; at most the last window of writes
+// is lost. The fsync policy applies to the coalesced file writes. A non-positive window disables debouncing,
+// which is the default: every write is written to the file before it returns.
+func WithWriteDebounce(window time.Duration) TableOption {
+	return func(t *Table) {
+		t.debounce = window
+	}
+}
+
+// WithServerWriteDebounce applies WithWriteDebounce with the given window to every table the server creates or loads,
+// including the tables written through the HTTP API. As with WithWriteDebounce, a read after a write that returned,
+// such as a select request following an insert request, always sees the write: reads are served from the records
+// in memory, never from a file behind them. BackupDatabases and Close write the pending writes first.
+// A non-positive window disables debouncing, which is the default.
+func WithServerWriteDebounce(window time.Duration) ServerOption {
+	return func(s *Server) {
+		s.debounce = max(window, 0)
+	}
+}
+
+// scheduleFlush schedules the write of the records to the file at the end of the debounce window,
+// unless a write is already scheduled. The table must be locked for writing.
+func (t *Table) scheduleFlush() {
+	if t.flushTimer != nil {
+		return
+	}
+	t.flushTimer = time.AfterFunc(t.debounce, func() {
+		t.Lock()
+		defer t.Unlock()
+		if err := t.flushLocked(); err != nil {
+			log.Printf("Failed to flush file %s: %v", t.FilePath, err)
+		}
+	})
+}
+
+// Flush is a method of the Table struct that writes the pending coalesced writes to the file immediately.
+// It does nothing if the table has no write debounce window or no pending writes.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If an error occurs while writing the file, it returns the error. The writes stay pending and are retried by the next flush.
+func (t *Table) Flush() error {
+	t.Lock()
+	defer t.Unlock()
+	return t.flushLocked()
+}
+
+// flushLocked writes the current records to the file if writes are pending, coalesced or waiting for a group commit.
+// The table must be locked for writing.
+func (t *Table) flushLocked() error {
+	if err := t.commitPending(); err != nil {
+		return err
+	}
+	if t.flushTimer == nil {
+		return nil
+	}
+	t.flushTimer.Stop()
+	if err := t.writeFile(t.snapshot.Load()); err != nil {
+		// Keep the writes pending and retry at the end of the next window
+		t.flushTimer = nil
+		t.scheduleFlush()
+		return err
+	}
+	t.flushTimer = nil
+	return nil
+}
@@ -0,0 +1,61 @@
+package data
+
+import "sort"
+
+// TableDescription describes the shape of a table: its primary key, its declared schema, its indexes and its constraints.
+// Every list is sorted, or in declaration order where the order matters, and empty lists are encoded as empty JSON arrays,
+// so the JSON encoding of a description only changes when the table does.
+type TableDescription struct {
+	PrimaryKey      string             `json:"primaryKey"`             // Field name used as the primary key
+	KeyFields       []string           `json:"keyFields,omitempty"`    // Fields whose values build a composite primary key, in order, if any
+	KeySeparator    string             `json:"keySeparator,omitempty"` // Separator joining the values of a composite primary key, if any
+	Schema          Schema             `json:"schema"`                 // Declared schema of the fields, empty if the table has none
+	Indexes         []IndexDescription `json:"indexes"`                // Secondary indexes created by CreateIndex or CreateElementIndex, sorted by name
+	Uniques         []UniqueConstraint `json:"uniqueConstraints"`      // Unique constraints, in declaration order
+	ForeignKeys     []ForeignKey       `json:"foreignKeys"`            // Foreign keys, sorted by field
+	EncryptedFields []string           `json:"encryptedFields"`        // Fields encrypted individually, sorted by name
+}
+
+// IndexDescription describes a secondary index of a table.
+type IndexDescription struct {
+	Name     string   `json:"name"`     // Name of the index, the names of its fields joined by commas
+	Fields   []string `json:"fields"`   // Fields covered by the index, in order
+	Elements bool     `json:"elements"` // Whether each element of the list field is indexed on its own
+	Partial  bool     `json:"partial"`  // Whether only the records matching a predicate are indexed
+}
+
+// Describe is a method of the Table struct that returns the description of the table, for tools discovering its shape.
+// The primary key is always indexed, so it is not listed among the indexes.
+//
+// Returns:
+// - A TableDescription of the table. It shares nothing with the table, so it can be modified freely.
+func (t *Table) Describe() TableDescription {
+	t.RLock()
+	defer t.RUnlock()
+
+	description := TableDescription{
+		PrimaryKey:      t.PrimaryKey,
+		Schema:          make(Schema, len(t.schema)),
+		Indexes:         make([]IndexDescription, 0, len(t.indexes)),
+		Uniques:         make([]UniqueConstraint, 0, len(t.uniques)),
+		ForeignKeys:     append([]ForeignKey{}, t.foreignKeys...),
+		EncryptedFields: append([]string{}, t.encryptedFields...),
+	}
+	if t.hasCompositeKey() {
+		description.KeyFields = append([]string(nil), t.keyFields...)
+		description.KeySeparator = t.keySeparator
+	}
+	for field, fieldSchema := range t.schema {
+		description.Schema[field] = fieldSchema
+	}
+	for _, name := range t.sortedIndexNames() {
+		idx := t.indexes[name]
+		description.Indexes = append(description.Indexes, IndexDescription{Name: idx.Name, Fields: append([]string(nil), idx.Fields...), Elements: idx.Elements, Partial: idx.Partial})
+	}
+	for _, unique := range t.uniques {
+		description.Uniques = append(description.Uniques, unique.UniqueConstraint)
+	}
+	sort.SliceStable(description.ForeignKeys, func(i, j int) bool { return description.ForeignKeys[i].Field < description.ForeignKeys[j].Field })
+	sort.Strings(description.EncryptedFields)
+	return description
+}
@@ -0,0 +1,145 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"google.golang.org/protobuf/proto"
+)
+
+// RecordDiff is a record that differs between two snapshots of a table, as reported by DiffRecords.
+type RecordDiff struct {
+	Key    string      // Primary key of the record, in the stored form of ChangeEvent.Key
+	Old    Record      // Record in the first snapshot, nil if the record was added
+	New    Record      // Record in the second snapshot, nil if the record was removed
+	Fields []FieldDiff // Fields whose values differ, sorted by name; every field of an added or removed record
+}
+
+// FieldDiff is a field whose value differs between two versions of a record.
+// A null field is present with a nil value, which is different from a missing field.
+type FieldDiff struct {
+	Field  string      // Name of the field
+	Old    interface{} // Value of the field in the first snapshot, nil if it is null or missing
+	New    interface{} // Value of the field in the second snapshot, nil if it is null or missing
+	OldSet bool        // Whether the field is present in the first snapshot
+	NewSet bool        // Whether the field is present in the second snapshot
+}
+
+// DiffRecords compares two snapshots of the records of a table, such as the records of a table and of its backup
+// returned by Raw, and reports the records added, removed and changed from the first to the second, matched by primary key.
+// Values are compared with their types, as they are stored: the integer 1, the float 1.5, the string "1" and the boolean true
+// all differ from each other, and list and nested values are compared element by element.
+// Fields encrypted with WithFieldEncryption are compared by their ciphertext, so they differ whenever they were written again.
+//
+// Parameters:
+// - primaryKey: The field holding the primary key of the records, the PrimaryKey of their table.
+// - a: The records of the first snapshot.
+// - b: The records of the second snapshot.
+//
+// Returns:
+// - The records of b whose key is not in a, sorted by key.
+// - The records of a whose key is not in b, sorted by key.
+// - The records whose key is in both snapshots but whose fields differ, sorted by key, with the fields that differ.
+// - An error wrapping ErrInvalidPrimaryKey, if a record has no valid primary key or a key appears twice in a snapshot.
+func DiffRecords(primaryKey string, a, b []*dbdata.Record) (added, removed, changed []RecordDiff, err error) {
+	before, err := recordsByKey(primaryKey, a)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("first snapshot: %w", err)
+	}
+	after, err := recordsByKey(primaryKey, b)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("second snapshot: %w", err)
+	}
+
+	for key, oldRecord := range before {
+		newRecord, exists := after[key]
+		if !exists {
+			diff, err := newRecordDiff(key, oldRecord, nil)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			removed = append(removed, diff)
+			continue
+		}
+		diff, err := newRecordDiff(key, oldRecord, newRecord)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(diff.Fields) > 0 {
+			changed = append(changed, diff)
+		}
+	}
+	for key, newRecord := range after {
+		if _, exists := before[key]; !exists {
+			diff, err := newRecordDiff(key, nil, newRecord)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			added = append(added, diff)
+		}
+	}
+
+	for _, diffs := range [][]RecordDiff{added, removed, changed} {
+		sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key < diffs[j].Key })
+	}
+	return added, removed, changed, nil
+}
+
+// recordsByKey returns the records keyed by the stored form of their primary key.
+func recordsByKey(primaryKey string, records []*dbdata.Record) (map[string]*dbdata.Record, error) {
+	byKey := make(map[string]*dbdata.Record, len(records))
+	for _, record := range records {
+		value, exists := record.GetFields()[primaryKey]
+		if !exists {
+			return nil, fmt.Errorf("%w: primary key '%s' not found in record", ErrInvalidPrimaryKey, primaryKey)
+		}
+		decoded, err := fromProtoValue(value)
+		if err != nil {
+			return nil, err
+		}
+		key, err := keyString(decoded)
+		if err != nil {
+			return nil, err
+		}
+		if _, duplicate := byKey[key]; duplicate {
+			return nil, fmt.Errorf("%w: primary key %s appears twice", ErrInvalidPrimaryKey, key)
+		}
+		byKey[key] = record
+	}
+	return byKey, nil
+}
+
+// newRecordDiff compares the two versions of the record with the given key, either of which may be nil.
+func newRecordDiff(key string, oldRecord, newRecord *dbdata.Record) (RecordDiff, error) {
+	diff := RecordDiff{Key: key}
+	var err error
+	if oldRecord != nil {
+		if diff.Old, err = fromProtoRecord(oldRecord); err != nil {
+			return RecordDiff{}, err
+		}
+	}
+	if newRecord != nil {
+		if diff.New, err = fromProtoRecord(newRecord); err != nil {
+			return RecordDiff{}, err
+		}
+	}
+
+	fields := make(map[string]struct{})
+	for field := range oldRecord.GetFields() {
+		fields[field] = struct{}{}
+	}
+	for field := range newRecord.GetFields() {
+		fields[field] = struct{}{}
+	}
+	for field := range fields {
+		oldValue, oldSet := oldRecord.GetFields()[field]
+		newValue, newSet := newRecord.GetFields()[field]
+		if oldSet == newSet && proto.Equal(oldValue, newValue) {
+			continue
+		}
+		diff.Fields = append(diff.Fields, FieldDiff{Field: field, Old: diff.Old[field], New: diff.New[field], OldSet: oldSet, NewSet: newSet})
+	}
+	sort.Slice(diff.Fields, func(i, j int) bool { return diff.Fields[i].Field < diff.Fields[j].Field })
+	return diff, nil
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// snapshot returns the records of the table as protobuf messages, failing the test on error.
+func snapshot(t *testing.T, table *Table) []*dbdata.Record {
+	t.Helper()
+	records, err := table.SelectAllProto()
+	if err != nil {
+		t.Fatalf("SelectAllProto failed: %v", err)
+	}
+	return records
+}
+
+func TestDiffRecords(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "same", "n": 1},
+		Record{"id": "typed", "n": 1, "tags": []interface{}{"a", "b"}},
+		Record{"id": "nulled", "note": "x", "gone": true},
+		Record{"id": "removed", "n": 2},
+	)
+	before := snapshot(t, table)
+
+	if err := table.Replace("typed", Record{"id": "typed", "n": "1", "tags": []interface{}{"b", "a"}}); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	if err := table.Replace("nulled", Record{"id": "nulled", "note": nil}); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	if err := table.Delete("removed"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	mustInsert(t, table, Record{"id": "added", "n": 3})
+	after := snapshot(t, table)
+
+	added, removed, changed, err := DiffRecords("id", before, after)
+	if err != nil {
+		t.Fatalf("DiffRecords failed: %v", err)
+	}
+	wantAdded := []RecordDiff{{
+		Key: "added", New: Record{"id": "added", "n": int64(3)},
+		Fields: []FieldDiff{
+			{Field: "id", New: "added", NewSet: true},
+			{Field: "n", New: int64(3), NewSet: true},
+		},
+	}}
+	if !reflect.DeepEqual(added, wantAdded) {
+		t.Errorf("added = %+v, want %+v", added, wantAdded)
+	}
+	if len(removed) != 1 || removed[0].Key != "removed" || removed[0].New != nil || removed[0].Old["n"] != int64(2) {
+		t.Errorf("removed = %+v, want the record removed", removed)
+	}
+
+	// The integer 1 and the string "1" differ, and so do lists in another order, and null and missing fields
+	if len(changed) != 2 {
+		t.Fatalf("changed = %+v, want the records nulled and typed", changed)
+	}
+	wantNulled := []FieldDiff{
+		{Field: "gone", Old: true, OldSet: true},
+		{Field: "note", Old: "x", OldSet: true, NewSet: true},
+	}
+	if changed[0].Key != "nulled" || !reflect.DeepEqual(changed[0].Fields, wantNulled) {
+		t.Errorf("changed[0] = %+v, want the fields %+v", changed[0], wantNulled)
+	}
+	wantTyped := []FieldDiff{
+		{Field: "n", Old: int64(1), New: "1", OldSet: true, NewSet: true},
+		{Field: "tags", Old: []interface{}{"a", "b"}, New: []interface{}{"b", "a"}, OldSet: true, NewSet: true},
+	}
+	if changed[1].Key != "typed" || !reflect.DeepEqual(changed[1].Fields, wantTyped) {
+		t.Errorf("changed[1] = %+v, want the fields %+v", changed[1], wantTyped)
+	}
+
+	added, removed, changed, err = DiffRecords("id", after, after)
+	if err != nil || len(added)+len(removed)+len(changed) != 0 {
+		t.Errorf("DiffRecords of a snapshot with itself = %v, %v, %v, %v, want no difference", added, removed, changed, err)
+	}
+}
+
+func TestDiffRecordsInvalidKeys(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a"})
+	records := snapshot(t, table)
+
+	if _, _, _, err := DiffRecords("missing", records, records); !errors.Is(err, ErrInvalidPrimaryKey) {
+		t.Errorf("DiffRecords with a missing primary key = %v, want ErrInvalidPrimaryKey", err)
+	}
+	duplicated := append(records, records[0])
+	if _, _, _, err := DiffRecords("id", records, duplicated); !errors.Is(err, ErrInvalidPrimaryKey) {
+		t.Errorf("DiffRecords with a duplicated key = %v, want ErrInvalidPrimaryKey", err)
+	}
+}
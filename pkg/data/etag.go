@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrPreconditionFailed is returned by UpdateIfMatch and DeleteIfMatch when the record changed since its ETag was read.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// recordETag returns the ETag of the stored record: the quoted hex of the first 16 bytes of the SHA-256 digest
+// of its deterministic protobuf encoding, so it changes whenever a field of the record changes.
+func recordETag(record *dbdata.Record) (string, error) {
+	encoded, err := proto.MarshalOptions{Deterministic: true}.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode record: %v", err)
+	}
+	sum := sha256.Sum256(encoded)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// etagMatches reports whether the ETag matches the If-Match condition, a comma-separated list of ETags or "*".
+// Weak ETags never match, as If-Match uses the strong comparison.
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectWithETag is a method of the Table struct that selects a record like Select and also returns its ETag,
+// an opaque string that changes whenever the record changes. Passing the ETag back to UpdateIfMatch or DeleteIfMatch
+// makes the write fail if another writer changed the record in the meantime, which is optimistic concurrency control
+// without a version field. The ETag is quoted, so it can be used as the value of an HTTP ETag header.
+//
+// Parameters:
+// - key: An interface{} representing the key of the record to be selected.
+//
+// Returns:
+// - The Record with the given key.
+// - The ETag of the record.
+// - An error wrapping ErrNotFound if no record has the key, or an error if the record can't be read.
+func (t *Table) SelectWithETag(key interface{}) (Record, string, error) {
+	records, err := t.snapshotRecords()
+	if err != nil {
+		return nil, "", err
+	}
+	keyStr := t.resolveKey(records.Records, key)
+	record, exists := records.Records[keyStr]
+	if !exists {
+		return nil, "", fmt.Errorf("record with key %s %w", keyStr, ErrNotFound)
+	}
+	etag, err := recordETag(record)
+	if err != nil {
+		return nil, "", err
+	}
+	result, err := t.fromStoredRecord(record)
+	if err != nil {
+		return nil, "", err
+	}
+	t.metrics.IncrementQueryCount()
+	return result, etag, nil
+}
+
+// checkETag returns an error wrapping ErrPreconditionFailed unless the record with the given key exists
+// and its ETag matches the If-Match condition. The table must be locked for writing.
+func (t *Table) checkETag(key interface{}, ifMatch string) error {
+	allRecords, err := t.loadForWrite()
+	if err != nil {
+		return err
+	}
+	keyStr := t.resolveKey(allRecords.Records, key)
+	record, exists := allRecords.Records[keyStr]
+	if !exists {
+		return fmt.Errorf("record with key %s %w", keyStr, ErrNotFound)
+	}
+	etag, err := recordETag(record)
+	if err != nil {
+		return err
+	}
+	if !etagMatches(ifMatch, etag) {
+		return fmt.Errorf("%w: record with key %s has ETag %s", ErrPreconditionFailed, keyStr, etag)
+	}
+	return nil
+}
+
+// UpdateIfMatch is a method of the Table struct that updates a record like UpdateContext, but only if its current ETag,
+// as returned by SelectWithETag, matches the If-Match condition. The check and the update happen under the table lock,
+// so no other write can change the record between them.
+//
+// Parameters:
+// - ctx: A context whose deadline or cancellation bounds the wait for the table lock.
+// - key: An interface{} representing the key of the record to be updated.
+// - ifMatch: A comma-separated list of ETags the record may have, or "*" to match any existing record, like an HTTP If-Match header.
+// - updates: A Record representing the fields to be updated.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the ETag of the record doesn't match, it returns an error wrapping ErrPreconditionFailed and the record is unchanged.
+// - If no record has the key, it returns an error wrapping ErrNotFound.
+// - If another error occurs, it returns the error.
+func (t *Table) UpdateIfMatch(ctx context.Context, key interface{}, ifMatch string, updates Record) error {
+	unlockRecord, err := t.lockRecord(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := t.lockContext(ctx); err != nil {
+		unlockRecord()
+		return err
+	}
+	return t.withRecordTriggers(ctx, unlockRecord, func() error {
+		if err := t.checkETag(key, ifMatch); err != nil {
+			return err
+		}
+		defer t.withActor(ctx)()
+		return t.updateLocked(key, updates)
+	})
+}
+
+// DeleteIfMatch is a method of the Table struct that deletes a record like DeleteContext, but only if its current ETag,
+// as returned by SelectWithETag, matches the If-Match condition. The check and the delete happen under the table lock.
+//
+// Parameters:
+// - ctx: A context whose deadline or cancellation bounds the wait for the table lock.
+// - key: An interface{} representing the key of the record to be deleted.
+// - ifMatch: A comma-separated list of ETags the record may have, or "*" to match any existing record, like an HTTP If-Match header.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the ETag of the record doesn't match, it returns an error wrapping ErrPreconditionFailed and the record is kept.
+// - If no record has the key, it returns an error wrapping ErrNotFound.
+// - If another error occurs, it returns the error.
+func (t *Table) DeleteIfMatch(ctx context.Context, key interface{}, ifMatch string) error {
+	unlockRecord, err := t.lockRecord(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := t.lockContext(ctx); err != nil {
+		unlockRecord()
+		return err
+	}
+	return t.withRecordTriggers(ctx, unlockRecord, func() error {
+		if err := t.checkETag(key, ifMatch); err != nil {
+			return err
+		}
+		defer t.withActor(ctx)()
+		return t.deleteLocked(key)
+	})
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ExportJSONWhere is a method of the Table struct that writes the records of the table matching the predicate to the writer
+// as a JSON array, such as the records of a tenant or of a date range. The records are written in ascending primary key order,
+// one per line, from a point-in-time snapshot of the table, like an Iterator. Each record is decoded, encoded and written
+// before the next one, so memory doesn't grow with the number of records exported, apart from the sorted keys.
+// The read transforms of the table apply to the records, and the predicate sees the records as they are written:
+// each is a copy the predicate may modify, for example to remove fields that must not be exported.
+//
+// Parameters:
+// - w: The writer the JSON array is written to.
+// - pred: The function reporting whether a record is exported, or nil to export every record. Query.Predicate builds one from a Query.
+//
+// Returns:
+// - If the operation is successful, it returns nil. An empty result is written as an empty array.
+// - If an error occurs while reading the records, encoding a record or writing to the writer, it returns the error.
+// The records written before the error are not removed from the writer.
+func (t *Table) ExportJSONWhere(w io.Writer, pred func(Record) bool) error {
+	it := t.Iterator()
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	if _, err := out.WriteString("["); err != nil {
+		return fmt.Errorf("failed to write export: %v", err)
+	}
+	first := true
+	for it.Next() {
+		record, err := it.Record()
+		if err != nil {
+			return err
+		}
+		if pred != nil && !pred(record) {
+			continue
+		}
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode record %s: %v", it.Key(), err)
+		}
+		separator := ",\n"
+		if first {
+			separator = "\n"
+			first = false
+		}
+		if _, err := out.WriteString(separator); err != nil {
+			return fmt.Errorf("failed to write export: %v", err)
+		}
+		if _, err := out.Write(encoded); err != nil {
+			return fmt.Errorf("failed to write export: %v", err)
+		}
+	}
+	closing := "]\n"
+	if !first {
+		closing = "\n]\n"
+	}
+	if _, err := out.WriteString(closing); err != nil {
+		return fmt.Errorf("failed to write export: %v", err)
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write export: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// exportedKeys exports the records of the table matching the predicate and returns their primary keys.
+func exportedKeys(t *testing.T, table *Table, pred func(Record) bool) []interface{} {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := table.ExportJSONWhere(&buf, pred); err != nil {
+		t.Fatalf("ExportJSONWhere failed: %v", err)
+	}
+	var records []Record
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("the export %q is not a JSON array: %v", buf.String(), err)
+	}
+	keys := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		keys = append(keys, record["id"])
+	}
+	return keys
+}
+
+func TestExportJSONWhere(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "o3", "tenant": "acme", "day": "2024-03-02"},
+		Record{"id": "o1", "tenant": "acme", "day": "2024-01-15"},
+		Record{"id": "o2", "tenant": "globex", "day": "2024-02-01"},
+		Record{"id": "o4", "tenant": "acme", "day": "2024-04-20"},
+	)
+
+	tests := []struct {
+		name string
+		pred func(Record) bool
+		want []interface{}
+	}{
+		{"every record", nil, []interface{}{"o1", "o2", "o3", "o4"}},
+		{"tenant", func(r Record) bool { return r["tenant"] == "acme" }, []interface{}{"o1", "o3", "o4"}},
+		{"date range", func(r Record) bool {
+			day := r["day"].(string)
+			return day >= "2024-02-01" && day < "2024-04-01"
+		}, []interface{}{"o2", "o3"}},
+		{"query", Query{Filters: map[string]interface{}{"tenant": "globex"}}.Predicate(), []interface{}{"o2"}},
+		{"no match", func(Record) bool { return false }, []interface{}{}},
+	}
+	for _, tt := range tests {
+		if got := exportedKeys(t, table, tt.pred); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: exported %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// The predicate may strip fields from the exported records without changing the table
+	var buf bytes.Buffer
+	err := table.ExportJSONWhere(&buf, func(r Record) bool {
+		delete(r, "tenant")
+		return r["id"] == "o1"
+	})
+	if err != nil {
+		t.Fatalf("ExportJSONWhere failed: %v", err)
+	}
+	if want := "[\n{\"day\":\"2024-01-15\",\"id\":\"o1\"}\n]\n"; buf.String() != want {
+		t.Errorf("export = %q, want %q", buf.String(), want)
+	}
+	if record, err := table.Select("o1"); err != nil || record["tenant"] != "acme" {
+		t.Errorf("Select after the export = %v, %v, want the tenant kept", record, err)
+	}
+}
@@ -0,0 +1,253 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// encryptedPrefix is the prefix of the stored values of encrypted fields, followed by the base64 encoded ciphertext.
+const encryptedPrefix = "enc:"
+
+// ErrEncryptedField is returned when an encrypted field is used in a way that needs its plaintext,
+// such as indexing it, or writing it without the field encryption key.
+var ErrEncryptedField = errors.New("encrypted field")
+
+// WithFieldEncryption encrypts the values of the given fields individually with AES-GCM under the given key,
+// which must be 16, 24 or 32 bytes long. The values are encrypted when the records are written to the file,
+// on top of the encryption of the whole file, and decrypted when they are read, so the records returned
+// by the table hold the plaintext values.
+//
+// The encrypted fields are saved in the metadata file of the table by Database.CreateTable. A table opened without
+// the key, such as a table loaded by Server.Initialize, returns the stored "enc:" ciphertext of the fields instead,
+// until the key is given with SetFieldKey, and fails to write new plaintext values for them.
+// The primary key and the fields of a composite key can't be encrypted, and encrypted fields can't be indexed,
+// see CreateIndex.
+func WithFieldEncryption(key []byte, fields ...string) TableOption {
+	return func(t *Table) {
+		aead, err := newFieldCipher(key)
+		if err != nil {
+			log.Fatalf("Invalid field encryption key: %v", err)
+		}
+		t.fieldCipher = aead
+		t.encryptedFields = mergeFields(t.encryptedFields, fields)
+	}
+}
+
+// newFieldCipher returns the AES-GCM cipher used to encrypt the fields with the given key.
+func newFieldCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// mergeFields returns the fields followed by the extra fields that are not already in them.
+func mergeFields(fields, extra []string) []string {
+	for _, field := range extra {
+		if !containsString(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// containsString reports whether the string is one of the values.
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+// EncryptedFields is a method of the Table struct that returns the fields whose values are encrypted individually.
+//
+// Returns:
+// - A slice with the names of the encrypted fields, in the order they were declared.
+func (t *Table) EncryptedFields() []string {
+	return append([]string(nil), t.encryptedFields...)
+}
+
+// SetFieldKey is a method of the Table struct that gives the key of the encrypted fields to a table opened without it,
+// for example after Server.Initialize. The records are read again from the file, so they hold the plaintext values.
+//
+// Parameters:
+// - key: The key the fields were encrypted with, as given to WithFieldEncryption.
+//
+// Returns:
+// - An error, if the key is invalid, or if the records can't be decrypted with it.
+func (t *Table) SetFieldKey(key []byte) error {
+	aead, err := newFieldCipher(key)
+	if err != nil {
+		return fmt.Errorf("invalid field encryption key: %v", err)
+	}
+
+	t.Lock()
+	// Write the coalesced writes first, so they are not lost by reloading the file
+	if err := t.flushLocked(); err != nil {
+		t.Unlock()
+		return err
+	}
+	previous := t.fieldCipher
+	t.fieldCipher = aead
+	t.Unlock()
+
+	if err := t.reload(); err != nil {
+		t.Lock()
+		t.fieldCipher = previous
+		t.Unlock()
+		return err
+	}
+	return nil
+}
+
+// checkEncryptedFields returns an error if an encrypted field of the table is part of its primary key or is indexed.
+func (t *Table) checkEncryptedFields() error {
+	for _, field := range t.encryptedFields {
+		if field == t.PrimaryKey || field == t.keyRoot() || containsString(t.keyFields, field) {
+			return fmt.Errorf("%w: field %s is part of the primary key, which can't be encrypted", ErrEncryptedField, field)
+		}
+	}
+	for _, idx := range t.indexes {
+		for _, field := range idx.Fields {
+			if err := t.checkIndexable(field); err != nil {
+				return err
+			}
+		}
+	}
+	for _, unique := range t.uniques {
+		if err := t.checkIndexable(unique.Field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkIndexable returns an error wrapping ErrEncryptedField if the field is encrypted.
+// The stored values of an encrypted field are encrypted with a random nonce, so equal values don't have
+// equal ciphertexts, and an index on the field could only be built from its plaintext values.
+func (t *Table) checkIndexable(field string) error {
+	if containsString(t.encryptedFields, field) {
+		return fmt.Errorf("%w: field %s is encrypted and can't be indexed", ErrEncryptedField, field)
+	}
+	return nil
+}
+
+// encryptFields returns the records with the values of the encrypted fields replaced by their ciphertext.
+// The given records are not modified; the records without an encrypted field are shared with the result.
+// Values that are already ciphertext, such as those read by a table opened without the key, are kept as they are.
+func (t *Table) encryptFields(records *dbdata.Records) (*dbdata.Records, error) {
+	if len(t.encryptedFields) == 0 {
+		return records, nil
+	}
+	encrypted := &dbdata.Records{Records: make(map[string]*dbdata.Record, len(records.Records))}
+	for key, record := range records.Records {
+		var clone *dbdata.Record
+		for _, field := range t.encryptedFields {
+			value, ok := record.Fields[field]
+			if !ok || isEncryptedValue(value) {
+				continue
+			}
+			if _, isNull := value.GetKind().(*structpb.Value_NullValue); isNull {
+				continue
+			}
+			if t.fieldCipher == nil {
+				return nil, fmt.Errorf("%w: field %s of record %s can't be written without the field encryption key", ErrEncryptedField, field, key)
+			}
+			ciphertext, err := t.encryptValue(field, value)
+			if err != nil {
+				return nil, fmt.Errorf("error encrypting field %s of record %s: %v", field, key, err)
+			}
+			if clone == nil {
+				clone = &dbdata.Record{Fields: make(map[string]*structpb.Value, len(record.Fields))}
+				for name, fieldValue := range record.Fields {
+					clone.Fields[name] = fieldValue
+				}
+			}
+			clone.Fields[field] = ciphertext
+		}
+		if clone != nil {
+			record = clone
+		}
+		encrypted.Records[key] = record
+	}
+	return encrypted, nil
+}
+
+// decryptFields replaces the ciphertext of the encrypted fields of the decoded records by their plaintext values.
+// Without the key, the ciphertext is kept.
+func (t *Table) decryptFields(records *dbdata.Records) error {
+	if t.fieldCipher == nil || len(t.encryptedFields) == 0 {
+		return nil
+	}
+	for key, record := range records.Records {
+		for _, field := range t.encryptedFields {
+			value, ok := record.Fields[field]
+			if !ok || !isEncryptedValue(value) {
+				continue
+			}
+			plaintext, err := t.decryptValue(field, value.GetStringValue())
+			if err != nil {
+				return fmt.Errorf("failed to decrypt field %s of record %s: %v", field, key, err)
+			}
+			record.Fields[field] = plaintext
+		}
+	}
+	return nil
+}
+
+// isEncryptedValue reports whether the stored value is the ciphertext of an encrypted field.
+// Strings starting with the prefix are escaped by toStoredValue, so a stored string with the prefix is always a ciphertext.
+func isEncryptedValue(value *structpb.Value) bool {
+	s, ok := value.GetKind().(*structpb.Value_StringValue)
+	return ok && strings.HasPrefix(s.StringValue, encryptedPrefix)
+}
+
+// encryptValue encrypts the stored value of the field. The name of the field is authenticated with the value,
+// so the ciphertext of a field can't be copied into another field.
+func (t *Table) encryptValue(field string, value *structpb.Value) (*structpb.Value, error) {
+	plaintext, err := proto.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, t.fieldCipher.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := t.fieldCipher.Seal(nonce, nonce, plaintext, []byte(field))
+	return structpb.NewStringValue(encryptedPrefix + base64.StdEncoding.EncodeToString(ciphertext)), nil
+}
+
+// decryptValue decrypts the ciphertext stored in the field, with its prefix, into the stored value.
+func (t *Table) decryptValue(field, stored string) (*structpb.Value, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := t.fieldCipher.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	plaintext, err := t.fieldCipher.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], []byte(field))
+	if err != nil {
+		return nil, err
+	}
+	var value structpb.Value
+	if err := proto.Unmarshal(plaintext, &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
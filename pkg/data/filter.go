@@ -0,0 +1,202 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrInvalidFilter is returned when a Filter is malformed, for example because it uses an unknown operator.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter is a serializable predicate over the records of a table, so remote clients can express
+// the conditions that Go callers would write as closures. A filter is either a comparison of a field with a value,
+// or the combination of other filters with "and" or "or":
+//
+//	{"and": [
+//		{"field": "age", "op": ">", "value": 18},
+//		{"or": [{"field": "country", "op": "=", "value": "US"}, {"field": "country", "op": "=", "value": "CA"}]}
+//	]}
+//
+// The supported operators are = != < <= > >= and contains. Numbers are compared numerically, integers exactly,
+// and strings lexicographically; ordering a number against a string never matches.
+// contains matches strings containing the value as a substring and lists containing the value as an element.
+// A comparison on a field missing from a record never matches, whatever the operator.
+type Filter struct {
+	And   []Filter    `json:"and,omitempty"`   // Filters that must all match
+	Or    []Filter    `json:"or,omitempty"`    // Filters of which at least one must match
+	Field string      `json:"field,omitempty"` // Field compared by a comparison filter
+	Op    string      `json:"op,omitempty"`    // Operator of a comparison filter
+	Value interface{} `json:"value,omitempty"` // Value compared with the field by a comparison filter
+}
+
+// filterOperators are the operators supported by the comparison filters.
+var filterOperators = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "contains": true}
+
+// UnmarshalJSON decodes a filter, rejecting unknown keys so typos such as "feild" are reported instead of ignored.
+// Numbers are decoded as json.Number, so integers are compared exactly.
+func (f *Filter) UnmarshalJSON(data []byte) error {
+	type plainFilter Filter
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	var decoded plainFilter
+	if err := decoder.Decode(&decoded); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	*f = Filter(decoded)
+	return nil
+}
+
+// Validate checks that the filter and all its nested filters are well formed:
+// each filter is exactly one of an "and", an "or" or a comparison, and comparisons have a field and a supported operator.
+func (f Filter) Validate() error {
+	kinds := 0
+	if f.And != nil {
+		kinds++
+	}
+	if f.Or != nil {
+		kinds++
+	}
+	if f.Field != "" || f.Op != "" {
+		kinds++
+	}
+	if kinds != 1 {
+		return fmt.Errorf("%w: a filter must be exactly one of an \"and\", an \"or\" or a comparison", ErrInvalidFilter)
+	}
+
+	for _, nested := range append(f.And, f.Or...) {
+		if err := nested.Validate(); err != nil {
+			return err
+		}
+	}
+	if f.And != nil || f.Or != nil {
+		return nil
+	}
+
+	if f.Field == "" {
+		return fmt.Errorf("%w: a comparison needs a field", ErrInvalidFilter)
+	}
+	if !filterOperators[f.Op] {
+		return fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, f.Op)
+	}
+	if f.Value == nil {
+		return fmt.Errorf("%w: comparison on field %s needs a value", ErrInvalidFilter, f.Field)
+	}
+	return nil
+}
+
+// Match reports whether the record matches the filter. The filter should be validated first; an invalid filter matches nothing.
+func (f Filter) Match(record Record) bool {
+	switch {
+	case f.And != nil:
+		for _, nested := range f.And {
+			if !nested.Match(record) {
+				return false
+			}
+		}
+		return true
+	case f.Or != nil:
+		for _, nested := range f.Or {
+			if nested.Match(record) {
+				return true
+			}
+		}
+		return false
+	}
+
+	value, exists := record[f.Field]
+	if !exists || value == nil {
+		return false
+	}
+	if f.Op == "contains" {
+		return filterContains(value, f.Value)
+	}
+
+	cmp, ok := compareFilterValues(value, f.Value)
+	if !ok {
+		// Values of different kinds are only ever different
+		return f.Op == "!="
+	}
+	switch f.Op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// filterNumber converts a numeric value to a big.Float, which holds int64 and float64 values exactly.
+func filterNumber(value interface{}) (*big.Float, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		number, ok := new(big.Float).SetString(v.String())
+		return number, ok
+	case int:
+		return new(big.Float).SetInt64(int64(v)), true
+	case int32:
+		return new(big.Float).SetInt64(int64(v)), true
+	case int64:
+		return new(big.Float).SetInt64(v), true
+	case float32:
+		return new(big.Float).SetFloat64(float64(v)), true
+	case float64:
+		return new(big.Float).SetFloat64(v), true
+	}
+	return nil, false
+}
+
+// compareFilterValues compares a field value with a filter value, returning -1, 0 or 1.
+// It returns false if the values are not of comparable kinds.
+func compareFilterValues(value, filterValue interface{}) (int, bool) {
+	if number, ok := filterNumber(value); ok {
+		filterNum, ok := filterNumber(filterValue)
+		if !ok {
+			return 0, false
+		}
+		return number.Cmp(filterNum), true
+	}
+	switch v := value.(type) {
+	case string:
+		s, ok := filterValue.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(v, s), true
+	case bool:
+		b, ok := filterValue.(bool)
+		if !ok || v != b {
+			return 1, ok
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// filterContains reports whether a string contains the filter value as a substring, or a list contains it as an element.
+func filterContains(value, filterValue interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		s, ok := filterValue.(string)
+		return ok && strings.Contains(v, s)
+	case []interface{}:
+		for _, element := range v {
+			if cmp, ok := compareFilterValues(element, filterValue); ok && cmp == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
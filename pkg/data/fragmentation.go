@@ -0,0 +1,83 @@
+package data
+
+import "github.com/Malpizarr/dbproto/pkg/dbdata"
+
+// WithAutoCompact makes a table with an append log consolidate the log into the data file as soon as the dead space
+// reported by Fragmentation exceeds the given ratio of the stored size, instead of waiting for the log to hold
+// the maximum number of records of WithAppendLog. For example, 0.5 consolidates the log once half of the stored bytes
+// are dead. The consolidation is made by the insert that would append to the log, which rewrites the data file instead.
+// A non-positive ratio disables it. The ratio is saved in the metadata file of the table by Database.CreateTable.
+func WithAutoCompact(deadRatio float64) TableOption {
+	return func(t *Table) {
+		if deadRatio < 0 {
+			deadRatio = 0
+		}
+		t.compactRatio = deadRatio
+	}
+}
+
+// Fragmentation is a method of the Table struct that reports how much of the stored data of the table is dead space,
+// so operators know when Compact is worth running.
+// The dead space is the part of the append log, see WithAppendLog, that a consolidated data file doesn't need:
+// the header of the log, and the length prefix, file header and encryption overhead of each of its entries,
+// which are encoded and encrypted one record at a time, plus a log left behind by a crash or an entry cut short by one.
+// It grows with each record appended to the log and drops to zero once the log is consolidated, by Compact
+// or by any write rewriting the data file. Tables without an append log have no dead space.
+// The overhead of an entry is measured as the size of an encoded empty set of records, so the dead space is an estimate
+// within a few bytes per entry, and less accurate with compression, which compresses the records of a consolidated file together.
+//
+// Returns:
+// - The number of bytes of the stored data that hold live records, the stored size the table would have once compacted.
+// - The stored size of the table, the data file and the append log, in bytes, as reported in TableStats.SizeBytes.
+// - An error, if the size of the files can't be read.
+func (t *Table) Fragmentation() (liveBytes, totalBytes int64, err error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	totalBytes, err = t.dataSize()
+	if err != nil {
+		return 0, 0, err
+	}
+	dead, err := t.deadBytes()
+	if err != nil {
+		return 0, 0, err
+	}
+	return totalBytes - dead, totalBytes, nil
+}
+
+// deadBytes returns the dead space of the append log of the table, including the bytes of the log file
+// after its complete entries, or the whole log file if it extends a previous content of the data file.
+func (t *Table) deadBytes() (int64, error) {
+	state := t.appendLog.Load()
+	if state == nil || !state.onDisk || t.isMemory() || t.perRecord {
+		return 0, nil
+	}
+	logSize, err := fileSize(t.fs(), appendLogPath(t.FilePath))
+	if err != nil {
+		return 0, err
+	}
+	if logSize < state.size {
+		// The log was removed or replaced behind the table
+		return logSize, nil
+	}
+	return state.dead + logSize - state.size, nil
+}
+
+// entryOverhead returns the number of bytes an entry of the append log takes beyond the space its record takes
+// in a consolidated data file: its length prefix, and the file header and encryption overhead of its encoding,
+// measured as the size of an encoded empty set of records.
+func (t *Table) entryOverhead() (int64, error) {
+	empty, err := t.encodeRecords(&dbdata.Records{})
+	if err != nil {
+		return 0, err
+	}
+	return int64(4 + len(empty)), nil
+}
+
+// needsCompaction reports whether the dead space of the append log with the given state exceeds the ratio of WithAutoCompact.
+func (t *Table) needsCompaction(state *appendLogState) bool {
+	if t.compactRatio <= 0 || state.entries == 0 {
+		return false
+	}
+	return float64(state.dead) > t.compactRatio*float64(state.dataLen+state.size)
+}
@@ -0,0 +1,103 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+)
+
+// deadSpace returns the dead bytes reported by Fragmentation, checking they match the ones reported by Stats.
+func deadSpace(t *testing.T, table *Table) int64 {
+	t.Helper()
+	live, total, err := table.Fragmentation()
+	if err != nil {
+		t.Fatalf("Fragmentation failed: %v", err)
+	}
+	if live < 0 || live > total {
+		t.Fatalf("Fragmentation = %d live of %d bytes, want 0 <= live <= total", live, total)
+	}
+	stats, err := table.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.SizeBytes != total || stats.DeadBytes != total-live {
+		t.Errorf("Stats = %d bytes with %d dead, want %d with %d dead", stats.SizeBytes, stats.DeadBytes, total, total-live)
+	}
+	return total - live
+}
+
+func TestFragmentationGrowsThenResetsOnCompact(t *testing.T) {
+	table := newTestTable(t, "id", WithAppendLog(100))
+	if dead := deadSpace(t, table); dead != 0 {
+		t.Errorf("dead space of an empty table = %d, want 0", dead)
+	}
+
+	var previous int64
+	for i := 0; i < 5; i++ {
+		mustInsert(t, table, Record{"id": fmt.Sprintf("r%d", i), "name": "record"})
+		dead := deadSpace(t, table)
+		if dead <= previous {
+			t.Errorf("dead space after %d inserts = %d, want more than %d", i+1, dead, previous)
+		}
+		previous = dead
+	}
+
+	if _, err := table.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if dead := deadSpace(t, table); dead != 0 {
+		t.Errorf("dead space after Compact = %d, want 0", dead)
+	}
+	if count, err := table.Count(); err != nil || count != 5 {
+		t.Errorf("Count after Compact = %d, %v, want 5", count, err)
+	}
+
+	// An update consolidates the log too
+	mustInsert(t, table, Record{"id": "r5"})
+	if deadSpace(t, table) == 0 {
+		t.Fatal("dead space after an appended insert = 0, want more")
+	}
+	if err := table.Update("r0", Record{"name": "updated"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if dead := deadSpace(t, table); dead != 0 {
+		t.Errorf("dead space after an update = %d, want 0", dead)
+	}
+}
+
+func TestAutoCompactOnDeadSpaceRatio(t *testing.T) {
+	const ratio = 0.3
+	table := newTestTable(t, "id", WithAppendLog(100), WithAutoCompact(ratio))
+	consolidations := 0
+	aboveRatio := false
+	for i := 0; i < 30; i++ {
+		mustInsert(t, table, Record{"id": fmt.Sprintf("r%02d", i)})
+		dead := deadSpace(t, table)
+		_, total, err := table.Fragmentation()
+		if err != nil {
+			t.Fatalf("Fragmentation failed: %v", err)
+		}
+		// The insert following the one that crossed the ratio rewrites the data file instead of appending
+		if aboveRatio {
+			if dead != 0 {
+				t.Errorf("insert %d: %d dead bytes after crossing the ratio, want the log consolidated", i+1, dead)
+			}
+			consolidations++
+		}
+		aboveRatio = float64(dead) > ratio*float64(total)
+	}
+	if consolidations == 0 {
+		t.Error("the dead space never exceeded the ratio, want the log consolidated at least once")
+	}
+	if count, err := table.Count(); err != nil || count != 30 {
+		t.Errorf("Count = %d, %v, want 30", count, err)
+	}
+
+	// Without the ratio, the log keeps growing up to its maximum number of records
+	table = newTestTable(t, "id", WithAppendLog(100))
+	for i := 0; i < 30; i++ {
+		mustInsert(t, table, Record{"id": fmt.Sprintf("r%02d", i)})
+	}
+	if live, total, err := table.Fragmentation(); err != nil || float64(total-live) <= ratio*float64(total) {
+		t.Errorf("Fragmentation without auto-compaction = %d live of %d bytes, %v, want more than the ratio dead", live, total, err)
+	}
+}
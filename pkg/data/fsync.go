@@ -0,0 +1,221 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+type fsyncMode int
+
+const (
+	fsyncNever fsyncMode = iota
+	fsyncAlways
+	fsyncInterval
+)
+
+// FsyncPolicy controls when the table file is flushed to stable storage with fsync.
+// It lets users trade durability for throughput:
+//   - FsyncAlways syncs the file, and the directory entry it is renamed to, after every write. A write that returned successfully survives a crash
+//     of the process or the machine, at the cost of one fsync per operation.
+//   - FsyncInterval(d) marks the file as dirty on every write and syncs it at most once every d on a timer.
+//     A machine crash can lose the writes performed during the last d (plus the time the sync takes).
+//   - FsyncNever leaves flushing to the operating system. A process crash loses nothing, since the data has
+//     been handed to the kernel, but a machine crash can lose every write the kernel has not flushed yet
+//     (usually up to 30 seconds on Linux). This is the default.
+type FsyncPolicy struct {
+	mode     fsyncMode
+	interval time.Duration
+}
+
+var (
+	FsyncNever  = FsyncPolicy{mode: fsyncNever}  // Never fsync, leave flushing to the operating system
+	FsyncAlways = FsyncPolicy{mode: fsyncAlways} // Fsync after every write
+)
+
+// FsyncInterval returns a policy that batches fsyncs, syncing the file at most once every interval.
+// A non-positive interval falls back to FsyncAlways.
+func FsyncInterval(interval time.Duration) FsyncPolicy {
+	if interval <= 0 {
+		return FsyncAlways
+	}
+	return FsyncPolicy{mode: fsyncInterval, interval: interval}
+}
+
+// WithFsyncPolicy sets the fsync policy used by the table when writing its file.
+func WithFsyncPolicy(policy FsyncPolicy) TableOption {
+	return func(t *Table) {
+		t.fsyncPolicy = policy
+	}
+}
+
+// WithSyncWrites opens the table file with O_SYNC, so every write call returns only once its data reached stable storage.
+// Unlike FsyncAlways, which syncs once after the whole file was written, the data is synced as it is written,
+// so a slow disk or network file system is waited on for every chunk of the write buffer.
+// This gives the strongest durability at the lowest throughput. It has no effect on in-memory tables.
+func WithSyncWrites() TableOption {
+	return func(t *Table) {
+		t.syncWrites = true
+	}
+}
+
+// WithWriteBuffer sets the size in bytes of the buffer the table file is written through.
+// The file is handed to the operating system one buffer at a time, so larger buffers make fewer write calls,
+// which raises the throughput on network file systems, while smaller buffers make each call, and each O_SYNC wait
+// of WithSyncWrites, shorter. A non-positive size keeps the default size of bufio.Writer.
+func WithWriteBuffer(size int) TableOption {
+	return func(t *Table) {
+		t.writeBufferSize = size
+	}
+}
+
+// syncFile flushes the table file to stable storage.
+func (t *Table) syncFile() error {
+	if t.isMemory() {
+		return nil
+	}
+	if t.perRecord {
+		return t.syncRecordFiles()
+	}
+	if t.appendLogOnDisk() {
+		if err := syncPath(t.fs(), appendLogPath(t.FilePath)); err != nil && !isNotExist(err) {
+			return err
+		}
+	}
+	return syncPath(t.fs(), t.FilePath)
+}
+
+// syncPath flushes the file at the given path of the storage to stable storage.
+func syncPath(storage Storage, filePath string) error {
+	file, err := storage.OpenFile(filePath, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// syncDir flushes the directory at the given path of the storage to stable storage, so the files created or renamed in it survive a crash.
+// Directories can't be synced on Windows, where the metadata of a rename is persisted by the file system itself.
+func syncDir(storage Storage, dirPath string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	dir, err := storage.OpenFile(dirPath, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// Sync is a method of the Table struct that writes the coalesced writes that were not written to the file yet,
+// and flushes the file and its directory entry to stable storage, whatever the fsync policy of the table.
+// Once it returns, every write that completed before the call survives a crash of the process or the machine.
+// It holds the write lock of the table while syncing, so writes wait for it. It has no effect on in-memory tables.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If an error occurs while writing or syncing the file or its directory, it returns the error.
+func (t *Table) Sync() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if err := t.flushLocked(); err != nil {
+		return err
+	}
+	if t.isMemory() {
+		return nil
+	}
+	if err := t.syncFile(); err != nil {
+		return fmt.Errorf("error syncing file '%s': %v", t.FilePath, err)
+	}
+	if t.perRecord {
+		if err := syncDir(t.fs(), recordsDirPath(t.FilePath)); err != nil {
+			return fmt.Errorf("error syncing directory of file '%s': %v", t.FilePath, err)
+		}
+	}
+	if err := syncDir(t.fs(), filepath.Dir(t.FilePath)); err != nil {
+		return fmt.Errorf("error syncing directory of file '%s': %v", t.FilePath, err)
+	}
+	t.dirty.Store(false)
+	return nil
+}
+
+// InsertSync is a method of the Table struct that inserts a record like Insert and then syncs the table like Sync,
+// so the record survives a crash once it returns, even with the default FsyncNever policy.
+// It is meant for the few writes that must be durable, such as payments, in tables tuned for throughput:
+// each call costs two fsyncs on top of the insert, for the file and its directory, which takes from a
+// fraction of a millisecond on an SSD with a power-loss protected cache to tens of milliseconds on a hard disk.
+// Tables whose every write must be durable are better served by FsyncAlways or WithSyncWrites.
+//
+// Parameters:
+// - record: The record to insert.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the insert fails, it returns its error. If the sync fails, it returns its error, and the record is inserted
+// but may not survive a crash.
+func (t *Table) InsertSync(record Record) error {
+	if err := t.Insert(record); err != nil {
+		return err
+	}
+	return t.Sync()
+}
+
+// startFsyncLoop starts the background goroutine that syncs the file on a timer when the policy is FsyncInterval.
+func (t *Table) startFsyncLoop() {
+	if t.fsyncPolicy.mode != fsyncInterval {
+		return
+	}
+	t.stopFsync = make(chan struct{})
+	go t.runFsyncLoop(t.fsyncPolicy.interval, t.stopFsync)
+}
+
+// runFsyncLoop syncs the file every interval if it was written since the last sync, until stop is closed.
+func (t *Table) runFsyncLoop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.syncIfDirty(); err != nil {
+				log.Printf("Failed to sync file %s: %v", t.FilePath, err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// syncIfDirty syncs the file if it was written since the last sync.
+// The read lock is held so no write can truncate the file while it is being synced.
+func (t *Table) syncIfDirty() error {
+	if !t.dirty.Swap(false) {
+		return nil
+	}
+	t.RLock()
+	defer t.RUnlock()
+	if err := t.syncFile(); err != nil {
+		t.dirty.Store(true)
+		return err
+	}
+	return nil
+}
+
+// Close writes the coalesced writes that were not written to the file yet, stops the background fsync goroutine, if any,
+// and syncs the writes that were not synced yet. The goroutine is stopped and the file synced even if the flush fails,
+// and the errors of both steps are joined.
+func (t *Table) Close() error {
+	flushErr := t.Flush()
+	t.closeOnce.Do(func() {
+		if t.stopFsync != nil {
+			close(t.stopFsync)
+		}
+	})
+	return errors.Join(flushErr, t.syncIfDirty())
+}
@@ -0,0 +1,185 @@
+package data
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncRecorder is a Storage on the local disk recording the renames and the syncs of files and directories, in order.
+type syncRecorder struct {
+	localStorage
+	mu  sync.Mutex
+	ops []string
+}
+
+func (s *syncRecorder) record(op string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = append(s.ops, op)
+}
+
+func (s *syncRecorder) Rename(oldPath, newPath string) error {
+	s.record("rename " + newPath)
+	return s.localStorage.Rename(oldPath, newPath)
+}
+
+func (s *syncRecorder) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := s.localStorage.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(name); err == nil && info.IsDir() {
+		return &syncedFile{File: file, op: "syncdir " + name, recorder: s}, nil
+	}
+	return &syncedFile{File: file, op: "sync " + name, recorder: s}, nil
+}
+
+// syncedFile is a file or a directory opened by a syncRecorder, recording its syncs.
+type syncedFile struct {
+	File
+	op       string
+	recorder *syncRecorder
+}
+
+func (f *syncedFile) Sync() error {
+	f.recorder.record(f.op)
+	return f.File.Sync()
+}
+
+func TestFsyncAlwaysSyncsDirectoryAfterRename(t *testing.T) {
+	recorder := &syncRecorder{}
+	table := newTestTable(t, "id", WithStorage(recorder), WithFsyncPolicy(FsyncAlways))
+	recorder.mu.Lock()
+	recorder.ops = nil
+	recorder.mu.Unlock()
+
+	mustInsert(t, table, Record{"id": "a"})
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	want := []string{"rename " + table.FilePath, "syncdir " + filepath.Dir(table.FilePath)}
+	if len(recorder.ops) < 2 || recorder.ops[len(recorder.ops)-2] != want[0] || recorder.ops[len(recorder.ops)-1] != want[1] {
+		t.Errorf("operations = %v, want them to end with %v", recorder.ops, want)
+	}
+}
+
+func TestFsyncNeverDoesNotSyncDirectory(t *testing.T) {
+	recorder := &syncRecorder{}
+	table := newTestTable(t, "id", WithStorage(recorder))
+	mustInsert(t, table, Record{"id": "a"})
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, op := range recorder.ops {
+		if op == "syncdir "+filepath.Dir(table.FilePath) {
+			t.Errorf("directory synced with FsyncNever: %v", recorder.ops)
+		}
+	}
+}
+
+// shortWriter accepts half of each write without reporting an error.
+type shortWriter struct {
+	File
+}
+
+func (w shortWriter) Write(p []byte) (int, error) {
+	n, err := w.File.Write(p[:len(p)/2])
+	return n, err
+}
+
+// shortWriteStorage is a Storage on the local disk whose temporary files accept half of each write once enabled.
+type shortWriteStorage struct {
+	localStorage
+	enabled bool
+}
+
+func (s *shortWriteStorage) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := s.localStorage.OpenFile(name, flag, perm)
+	if err != nil || !s.enabled || filepath.Ext(name) != tempFileSuffix {
+		return file, err
+	}
+	return shortWriter{File: file}, nil
+}
+
+func TestWriteBufferedShortWrite(t *testing.T) {
+	table := &Table{}
+	file, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	err = table.writeBuffered(shortWriter{File: file}, []byte("0123456789"))
+	if !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("writeBuffered error = %v, want %v", err, io.ErrShortWrite)
+	}
+}
+
+func TestShortWriteLeavesFileIntact(t *testing.T) {
+	storage := &shortWriteStorage{}
+	table := newTestTable(t, "id", WithStorage(storage))
+	mustInsert(t, table, Record{"id": "a"})
+	before, err := os.ReadFile(table.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage.enabled = true
+	if err := table.Insert(Record{"id": "b"}); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("Insert error = %v, want %v", err, io.ErrShortWrite)
+	}
+
+	after, err := os.ReadFile(table.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("a short write changed the file of the table")
+	}
+	if _, err := os.Stat(table.FilePath + tempFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestInsertSyncSyncsFileAndDirectory(t *testing.T) {
+	recorder := &syncRecorder{}
+	// The debounce window outlives the test, so only the sync writes the record
+	table := newTestTable(t, "id", WithStorage(recorder), WithWriteDebounce(time.Hour))
+
+	mustInsert(t, table, Record{"id": "a"})
+	recorder.mu.Lock()
+	for _, op := range recorder.ops {
+		if strings.HasPrefix(op, "sync") {
+			t.Errorf("Insert synced with FsyncNever: %v", recorder.ops)
+		}
+	}
+	recorder.ops = nil
+	recorder.mu.Unlock()
+
+	if err := table.InsertSync(Record{"id": "b"}); err != nil {
+		t.Fatalf("InsertSync failed: %v", err)
+	}
+	recorder.mu.Lock()
+	want := []string{"rename " + table.FilePath, "sync " + table.FilePath, "syncdir " + filepath.Dir(table.FilePath)}
+	if !reflect.DeepEqual(recorder.ops, want) {
+		t.Errorf("operations of InsertSync = %v, want %v", recorder.ops, want)
+	}
+	recorder.mu.Unlock()
+
+	reopened := openTestTable(t, "id", table.FilePath)
+	if count, err := reopened.Count(); err != nil || count != 2 {
+		t.Errorf("Count of the file = %d, %v, want both records written", count, err)
+	}
+
+	if err := table.InsertSync(Record{"id": "a"}); err == nil {
+		t.Error("InsertSync of a duplicate key succeeded, want the error of the insert")
+	}
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// testAESKey is the key encrypting the files of the tables created by the tests.
+var testAESKey = []byte("0123456789abcdef0123456789abcdef")
+
+// newTestTable creates a table stored in a temporary directory removed at the end of the test.
+func newTestTable(t testing.TB, primaryKey string, opts ...TableOption) *Table {
+	t.Helper()
+	return openTestTable(t, primaryKey, filepath.Join(t.TempDir(), "table.bin"), opts...)
+}
+
+// openTestTable opens the table stored at the given path, creating it if needed, and closes it at the end of the test.
+func openTestTable(t testing.TB, primaryKey, filePath string, opts ...TableOption) *Table {
+	t.Helper()
+	table := NewTable(primaryKey, filePath, append([]TableOption{withAESKey(testAESKey)}, opts...)...)
+	t.Cleanup(func() { table.Close() })
+	return table
+}
+
+// mustInsert inserts the records into the table and fails the test on the first error.
+func mustInsert(t testing.TB, table *Table, records ...Record) {
+	t.Helper()
+	for _, record := range records {
+		if err := table.Insert(record); err != nil {
+			t.Fatalf("Insert(%v) failed: %v", record, err)
+		}
+	}
+}
+
+// newTestDatabase creates a database stored in a temporary directory, with a table keyed by "id" for each name.
+func newTestDatabase(t testing.TB, tableNames ...string) *Database {
+	t.Helper()
+	db := NewDatabase("testdb")
+	db.serverDir = t.TempDir()
+	db.aesKey = testAESKey
+	t.Cleanup(func() { db.Close() })
+	for _, name := range tableNames {
+		if err := db.CreateTable(name, "id"); err != nil {
+			t.Fatalf("CreateTable(%s) failed: %v", name, err)
+		}
+	}
+	return db
+}
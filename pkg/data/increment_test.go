@@ -0,0 +1,93 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentIncrement(t *testing.T) {
+	for name, opts := range map[string][]TableOption{
+		"table lock":   nil,
+		"record locks": {WithRecordLocks()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			table := newTestTable(t, "id", opts...)
+			mustInsert(t, table, Record{"id": "page", "views": 0})
+
+			const goroutines, increments = 8, 25
+			var wg sync.WaitGroup
+			errs := make(chan error, goroutines*increments)
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < increments; i++ {
+						if _, err := table.Increment("page", "views", 1); err != nil {
+							errs <- err
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Fatalf("Increment failed: %v", err)
+			}
+
+			record, err := table.Select("page")
+			if err != nil {
+				t.Fatalf("Select failed: %v", err)
+			}
+			if record["views"] != int64(goroutines*increments) {
+				t.Errorf("views = %v, want %d", record["views"], goroutines*increments)
+			}
+		})
+	}
+}
+
+func TestIncrementTypes(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "count": 1, "ratio": 0.5, "name": "x"})
+
+	if got, err := table.Increment("a", "count", 2); err != nil || got != 3 {
+		t.Errorf("Increment(count, 2) = %v, %v, want 3", got, err)
+	}
+	if got, err := table.Increment("a", "ratio", 0.25); err != nil || got != 0.75 {
+		t.Errorf("Increment(ratio, 0.25) = %v, %v, want 0.75", got, err)
+	}
+	if got, err := table.Increment("a", "missing", 4); err != nil || got != 4 {
+		t.Errorf("Increment(missing, 4) = %v, %v, want 4", got, err)
+	}
+	if _, err := table.Increment("a", "name", 1); err == nil {
+		t.Error("Increment of a string field succeeded, want an error")
+	}
+	if _, err := table.Increment("b", "count", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Increment of a missing record error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestIncrementFiresTriggers(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "count": 1})
+
+	table.AddTrigger(OpUpdate, func(event ChangeEvent) error {
+		if event.New["count"] == int64(3) {
+			return errors.New("too many")
+		}
+		return nil
+	})
+	if _, err := table.Increment("a", "count", 1); err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	if _, err := table.Increment("a", "count", 1); err == nil {
+		t.Fatal("Increment succeeded, want the error of the trigger")
+	}
+	record, err := table.Select("a")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["count"] != int64(2) {
+		t.Errorf("count = %v, want 2 after the rollback", record["count"])
+	}
+}
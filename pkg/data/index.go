@@ -0,0 +1,494 @@
+package data
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// indexValueSeparator separates the values of the fields of a composite index in its lookup keys.
+const indexValueSeparator = "\x00"
+
+// Index is a secondary index over one or more fields of a table.
+// It maps the values of its fields to the primary keys of the records holding those values,
+// so lookups on those fields don't need to scan the whole table.
+// An index over several fields (a composite index) only matches records where all its fields are present.
+type Index struct {
+	Name     string                         // Name of the index, the names of its fields joined by commas
+	Fields   []string                       // Fields covered by the index, in order
+	Elements bool                           // Whether each element of the list field is indexed on its own, see CreateElementIndex
+	Partial  bool                           // Whether only the records matching a predicate are indexed, see CreatePartialIndex
+	filter   func(Record) bool              // Predicate of a partial index, nil for the other indexes
+	entries  map[string]map[string]struct{} // Map of joined field values to the set of primary keys holding them
+}
+
+// newIndex creates an empty index over the given fields.
+func newIndex(fields []string) *Index {
+	return &Index{
+		Name:    strings.Join(fields, ","),
+		Fields:  fields,
+		entries: make(map[string]map[string]struct{}),
+	}
+}
+
+// lookupKeys returns the keys under which the record is stored in the index:
+// one key for a regular index, or one key per distinct element of the list field for an element index.
+// It returns no key if any of the fields of the index is missing from the record.
+func (idx *Index) lookupKeys(record *dbdata.Record) []string {
+	if idx.Elements {
+		return elementLookupKeys(record.Fields[idx.Fields[0]])
+	}
+	if lookupKey, ok := idx.lookupKey(record); ok {
+		return []string{lookupKey}
+	}
+	return nil
+}
+
+// lookupKey returns the key under which the record is stored in a regular index.
+// It returns false if any of the fields of the index is missing from the record.
+func (idx *Index) lookupKey(record *dbdata.Record) (string, bool) {
+	values := make([]string, len(idx.Fields))
+	for i, field := range idx.Fields {
+		value, exists := record.Fields[field]
+		if !exists || value == nil {
+			return "", false
+		}
+		values[i] = indexValue(value)
+	}
+	return strings.Join(values, indexValueSeparator), true
+}
+
+// add adds the record stored under the given primary key to the index.
+func (idx *Index) add(key string, record *dbdata.Record) {
+	if !idx.covers(record) {
+		return
+	}
+	for _, lookupKey := range idx.lookupKeys(record) {
+		if idx.entries[lookupKey] == nil {
+			idx.entries[lookupKey] = make(map[string]struct{})
+		}
+		idx.entries[lookupKey][key] = struct{}{}
+	}
+}
+
+// remove removes the record stored under the given primary key from the index.
+// The predicate of a partial index is not checked, so the record is removed even if it no longer matches it.
+func (idx *Index) remove(key string, record *dbdata.Record) {
+	for _, lookupKey := range idx.lookupKeys(record) {
+		delete(idx.entries[lookupKey], key)
+		if len(idx.entries[lookupKey]) == 0 {
+			delete(idx.entries, lookupKey)
+		}
+	}
+}
+
+// keys returns the sorted primary keys of the records holding the given values.
+func (idx *Index) keys(values []string) []string {
+	keySet := idx.entries[strings.Join(values, indexValueSeparator)]
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// indexValue returns the string form of a value as stored in an index.
+// Values are decoded first, so the "num:" and "str:" prefixes used internally don't leak into lookups.
+func indexValue(value *structpb.Value) string {
+	decoded, err := fromProtoValue(value)
+	if err != nil {
+		return value.GetStringValue()
+	}
+	return fmt.Sprint(decoded)
+}
+
+// CreateIndex is a method of the Table struct that creates a secondary index over one or more fields.
+// Only the primary key and the fields with an index created by this method are indexed, so indexes
+// are only maintained for the fields that are actually queried.
+// An index over a single field, such as CreateIndex("email"), is used by Query to look up the records matching a filter on that field.
+// An index over several fields, such as CreateIndex("lastName", "firstName"), is a composite index that
+// accelerates lookups on the combination of those fields.
+// It locks the table for writing, builds the index from the records stored in the file and saves the
+// declaration of the index in the metadata file of the table, so the index is rebuilt when the table is loaded again.
+// The index is then maintained by every insert, update and delete on the table.
+//
+// Parameters:
+// - fields: The names of the fields covered by the index, in order.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If no field is given, a field is repeated, the index already exists or an error occurs while reading
+// the records or saving the metadata, it returns an error.
+// - If a field is encrypted with WithFieldEncryption, it returns an error wrapping ErrEncryptedField.
+func (t *Table) CreateIndex(fields ...string) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("an index needs at least one field")
+	}
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if field == "" || seen[field] {
+			return fmt.Errorf("invalid index fields: %v", fields)
+		}
+		seen[field] = true
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	idx := newIndex(append([]string(nil), fields...))
+	if _, exists := t.indexes[idx.Name]; exists {
+		return fmt.Errorf("index %s already exists", idx.Name)
+	}
+	for _, field := range fields {
+		if err := t.checkIndexable(field); err != nil {
+			return err
+		}
+	}
+
+	allRecords, err := t.loadForWrite()
+	if err != nil {
+		return err
+	}
+
+	t.indexes[idx.Name] = idx
+	if err := t.saveMetadata(); err != nil {
+		delete(t.indexes, idx.Name)
+		return err
+	}
+	t.rebuildIndexes(allRecords.GetRecords())
+	return nil
+}
+
+// DropIndex is a method of the Table struct that drops a secondary index created by CreateIndex, CreateElementIndex or CreatePartialIndex.
+// It locks the table for writing, discards the index and removes its declaration from the metadata file of the table,
+// so the index is no longer maintained by the writes on the table.
+// The primary key is always indexed, so its index can't be dropped.
+//
+// Parameters:
+// - name: The name of the index, which is the names of its fields joined by commas.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the index does not exist, it is the primary key index or an error occurs while saving the metadata, it returns an error.
+func (t *Table) DropIndex(name string) error {
+	t.Lock()
+	defer t.Unlock()
+
+	if name == t.PrimaryKey {
+		return fmt.Errorf("the primary key index can't be dropped")
+	}
+	idx, exists := t.indexes[name]
+	if !exists {
+		return fmt.Errorf("index %s not found", name)
+	}
+
+	delete(t.indexes, name)
+	if err := t.saveMetadata(); err != nil {
+		t.indexes[name] = idx
+		return err
+	}
+	return nil
+}
+
+// ListIndexes is a method of the Table struct that returns the names of the indexes of the table.
+// The first name is always the primary key, which is always indexed, followed by the indexes created by CreateIndex in sorted order.
+func (t *Table) ListIndexes() []string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return append([]string{t.PrimaryKey}, t.sortedIndexNames()...)
+}
+
+// SelectByIndex is a method of the Table struct that selects the records matching the given values using a secondary index.
+// The values are matched against the fields of the index in order, so an index created with
+// CreateIndex("lastName", "firstName") is queried with SelectByIndex("lastName,firstName", "Doe", "John").
+// It locks the table for reading, looks up the primary keys in the index and takes the matching records from the current snapshot.
+//
+// Parameters:
+// - indexName: The name of the index, which is the names of its fields joined by commas.
+// - values: The values to match, one for each field of the index, in the same order as the fields.
+//
+// Returns:
+// - A slice of Record objects matching the values, sorted by primary key. If no records match, it returns an empty slice.
+// For a partial index created by CreatePartialIndex, only the matching records held by the index are returned.
+// - An error, if the index does not exist, the number of values doesn't match the number of fields of the index,
+// or an error occurs while reading the records from the file.
+func (t *Table) SelectByIndex(indexName string, values ...string) ([]Record, error) {
+	allRecords, err := t.rlockLoaded()
+	if err != nil {
+		return nil, err
+	}
+	defer t.RUnlock()
+
+	idx, exists := t.indexes[indexName]
+	if !exists {
+		return nil, fmt.Errorf("index %s not found", indexName)
+	}
+	if len(values) != len(idx.Fields) {
+		return nil, fmt.Errorf("index %s expects %d values, got %d", indexName, len(idx.Fields), len(values))
+	}
+
+	results := make([]Record, 0)
+	for _, key := range idx.keys(values) {
+		protoRecord, exists := allRecords.Records[key]
+		if !exists {
+			continue
+		}
+		record, err := t.fromStoredRecord(protoRecord)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, record)
+	}
+
+	t.metrics.IncrementQueryCount()
+	return results, nil
+}
+
+// KeysByField is a method of the Table struct that returns the primary keys of the records whose field holds the given value.
+// It is lighter than selecting the records when only the keys are needed, for example to follow links between tables.
+// The value is compared with the string form of the field values, so KeysByField("age", "42") matches the integer 42.
+// If the field has a single-field index created by CreateIndex, the keys are taken from the index;
+// otherwise the current snapshot of the records is scanned.
+//
+// Parameters:
+// - field: The name of the field to match.
+// - value: The string form of the value to match.
+//
+// Returns:
+// - A slice of the primary keys of the matching records, sorted. If no records match, it returns an empty slice.
+// - An error, if an error occurs while reading the records from the file.
+func (t *Table) KeysByField(field, value string) ([]string, error) {
+	allRecords, err := t.rlockLoaded()
+	if err != nil {
+		return nil, err
+	}
+	idx, indexed := t.indexes[field]
+	var keys []string
+	if indexed {
+		keys = idx.keys([]string{value})
+	}
+	t.RUnlock()
+
+	t.metrics.IncrementQueryCount()
+	if indexed {
+		return keys, nil
+	}
+
+	keys = make([]string, 0)
+	for key, record := range allRecords.GetRecords() {
+		if fieldValue, exists := record.Fields[field]; exists && fieldValue != nil && indexValue(fieldValue) == value {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// isIndexed reports whether the field is indexed on its own, either because it is the primary key
+// or because a single-field index was created for it.
+func (t *Table) isIndexed(field string) bool {
+	if field == t.PrimaryKey {
+		return true
+	}
+	_, exists := t.indexes[field]
+	return exists
+}
+
+// IndexedRecords is a method of the Table struct that returns the records of the table holding each indexed field,
+// which are the primary key and the fields with a single-field index created by CreateIndex, keyed by field name.
+// It replaces the deprecated Indexes field, which is no longer maintained: the map is built from the current snapshot
+// of the records on each call, so it costs a scan of the table and should not be called on every request.
+// Records holding a nil value for a field are left out of its slice, and fields no record holds are left out of the map.
+//
+// Returns:
+// - A map of the indexed field names to the records holding them, in no particular order.
+// - An error, if an error occurs while reading the records from the file.
+func (t *Table) IndexedRecords() (map[string][]*dbdata.Record, error) {
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+	indexed := make(map[string][]*dbdata.Record)
+	for _, record := range allRecords.GetRecords() {
+		for field, value := range record.Fields {
+			if value != nil && t.isIndexed(field) {
+				indexed[field] = append(indexed[field], record)
+			}
+		}
+	}
+	return indexed, nil
+}
+
+// indexRecord adds the record stored under the given primary key to every index of the table.
+func (t *Table) indexRecord(key string, record *dbdata.Record) {
+	t.markChanged(key)
+	t.addToIndexes(key, record)
+	for _, unique := range t.uniques {
+		unique.add(key, record)
+	}
+}
+
+// addToIndexes adds the record to every index of the table like indexRecord, without marking it as changed.
+func (t *Table) addToIndexes(key string, record *dbdata.Record) {
+	for _, idx := range t.indexes {
+		idx.add(key, record)
+	}
+}
+
+// unindexRecord removes the record stored under the given primary key from every index of the table.
+func (t *Table) unindexRecord(key string, record *dbdata.Record) {
+	t.markChanged(key)
+	for _, unique := range t.uniques {
+		unique.remove(key, record)
+	}
+	for _, idx := range t.indexes {
+		idx.remove(key, record)
+	}
+}
+
+// minRecordsPerIndexWorker is the minimum number of records given to each worker rebuilding the indexes,
+// so small tables are indexed serially instead of paying for goroutines they don't need.
+const minRecordsPerIndexWorker = 1024
+
+// WithIndexWorkers sets the number of goroutines that rebuild the indexes of the table when it is loaded
+// or an index is created. The records are split into one shard per worker, each worker indexes its shard
+// and the partial indexes are merged at the end. It defaults to runtime.GOMAXPROCS(0); 1 rebuilds the indexes serially.
+// Values lower than 1 are ignored.
+func WithIndexWorkers(workers int) TableOption {
+	return func(t *Table) {
+		if workers > 0 {
+			t.indexWorkers = workers
+		}
+	}
+}
+
+// rebuildIndexes clears every index of the table and fills it again from the given records.
+// Large tables are indexed in parallel by up to indexWorkers goroutines.
+func (t *Table) rebuildIndexes(records map[string]*dbdata.Record) {
+	t.rebuildUniques(records)
+	for _, idx := range t.indexes {
+		idx.entries = make(map[string]map[string]struct{})
+	}
+
+	workers := t.indexWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if maxWorkers := len(records) / minRecordsPerIndexWorker; workers > maxWorkers {
+		workers = maxWorkers
+	}
+	if workers <= 1 {
+		for key, record := range records {
+			t.addToIndexes(key, record)
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	shardSize := (len(keys) + workers - 1) / workers
+	for start := 0; start < len(keys); start += shardSize {
+		end := start + shardSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		wg.Add(1)
+		go func(shard []string) {
+			defer wg.Done()
+
+			// Build the indexes of the shard on their own, then merge them into the indexes of the table
+			entries := make(map[string]map[string]map[string]struct{}, len(t.indexes))
+			for name := range t.indexes {
+				entries[name] = make(map[string]map[string]struct{})
+			}
+			for _, key := range shard {
+				record := records[key]
+				for name, idx := range t.indexes {
+					if !idx.covers(record) {
+						continue
+					}
+					for _, lookupKey := range idx.lookupKeys(record) {
+						if entries[name][lookupKey] == nil {
+							entries[name][lookupKey] = make(map[string]struct{})
+						}
+						entries[name][lookupKey][key] = struct{}{}
+					}
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for name, idx := range t.indexes {
+				for lookupKey, keySet := range entries[name] {
+					existing := idx.entries[lookupKey]
+					if existing == nil {
+						idx.entries[lookupKey] = keySet
+						continue
+					}
+					for key := range keySet {
+						existing[key] = struct{}{}
+					}
+				}
+			}
+		}(keys[start:end])
+	}
+	wg.Wait()
+}
+
+// RebuildIndexes is a method of the Table struct that discards the records held in memory and every index of the table,
+// and rebuilds them from the file. It is a repair tool for indexes that went out of sync with the records,
+// for example after the file was edited or restored by hand.
+// It holds the write lock of the table for the whole rebuild, so no read of the cache or write races with it,
+// and writes the coalesced writes first, so they are not lost by reloading the file.
+// The secondary indexes, the field indexes and the unique constraints are rebuilt; their definitions are kept.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If an error occurs while writing the pending writes or reading the file, it returns the error and the table is unchanged.
+func (t *Table) RebuildIndexes() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if err := t.flushLocked(); err != nil {
+		return err
+	}
+	records, err := t.readRecordsFromFile()
+	if err != nil {
+		return fmt.Errorf("failed to read records from file: %v", err)
+	}
+
+	t.Records = records.GetRecords()
+	t.Cache = make(map[string]*dbdata.Record)
+	t.sizesKnown.Store(false)
+	t.publishSnapshot(records)
+	t.rebuildIndexes(records.GetRecords())
+	t.resetRecordFiles(true)
+	t.loaded.Store(true)
+	return nil
+}
+
+// sortedIndexNames returns the names of the secondary indexes of the table in sorted order.
+func (t *Table) sortedIndexNames() []string {
+	names := make([]string, 0, len(t.indexes))
+	for name := range t.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
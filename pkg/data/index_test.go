@@ -0,0 +1,125 @@
+package data
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIndexLifecycle(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "a", "email": "a@example.com", "city": "Lima"},
+		Record{"id": "b", "email": "b@example.com", "city": "Lima"},
+	)
+
+	if got := table.ListIndexes(); !reflect.DeepEqual(got, []string{"id"}) {
+		t.Errorf("ListIndexes = %v, want only the primary key", got)
+	}
+	if err := table.CreateIndex("city"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	if err := table.CreateIndex("city"); err == nil {
+		t.Error("CreateIndex of an existing index succeeded, want an error")
+	}
+	if got := table.ListIndexes(); !reflect.DeepEqual(got, []string{"id", "city"}) {
+		t.Errorf("ListIndexes = %v, want id and city", got)
+	}
+
+	// The index follows the writes
+	mustInsert(t, table, Record{"id": "c", "city": "Cusco"})
+	if err := table.Update("a", Record{"city": "Cusco"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := table.Delete("b"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	records, err := table.SelectByIndex("city", "Cusco")
+	if err != nil {
+		t.Fatalf("SelectByIndex failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("SelectByIndex(Cusco) = %v, want a and c", records)
+	}
+	if records, _ := table.SelectByIndex("city", "Lima"); len(records) != 0 {
+		t.Errorf("SelectByIndex(Lima) = %v, want no records", records)
+	}
+
+	// The declaration is saved and the index rebuilt when the table is opened again
+	reopened := openTestTable(t, "id", table.FilePath)
+	if records, err := reopened.SelectByIndex("city", "Cusco"); err != nil || len(records) != 2 {
+		t.Errorf("SelectByIndex after reopening = %v, %v, want 2 records", records, err)
+	}
+
+	if err := table.DropIndex("city"); err != nil {
+		t.Fatalf("DropIndex failed: %v", err)
+	}
+	if _, err := table.SelectByIndex("city", "Cusco"); err == nil {
+		t.Error("SelectByIndex of a dropped index succeeded, want an error")
+	}
+	if err := table.DropIndex("city"); err == nil {
+		t.Error("DropIndex of a missing index succeeded, want an error")
+	}
+}
+
+func TestIndexedRecords(t *testing.T) {
+	table := newTestTable(t, "id")
+	if err := table.CreateIndex("city"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	mustInsert(t, table,
+		Record{"id": "a", "city": "Lima", "name": "x"},
+		Record{"id": "b", "name": "y"},
+	)
+
+	indexed, err := table.IndexedRecords()
+	if err != nil {
+		t.Fatalf("IndexedRecords failed: %v", err)
+	}
+	if len(indexed["id"]) != 2 || len(indexed["city"]) != 1 {
+		t.Errorf("IndexedRecords = %v, want 2 records for id and 1 for city", indexed)
+	}
+	if _, ok := indexed["name"]; ok {
+		t.Error("IndexedRecords holds the unindexed field name")
+	}
+	if len(table.Indexes) != 0 {
+		t.Errorf("the deprecated Indexes field holds %d fields, want none", len(table.Indexes))
+	}
+}
+
+// BenchmarkLoadIndexes measures the startup of a table of 50,000 records with two indexes,
+// rebuilding its indexes serially and with several workers, which only help with as many CPUs.
+func BenchmarkLoadIndexes(b *testing.B) {
+	filePath := filepath.Join(b.TempDir(), "users.bin")
+	table := openTestTable(b, "id", filePath)
+	records := make([]Record, 50000)
+	for i := range records {
+		records[i] = Record{"id": i, "email": fmt.Sprintf("user%d@example.com", i), "city": fmt.Sprintf("city%d", i%100)}
+	}
+	if err := table.InsertMany(records); err != nil {
+		b.Fatalf("InsertMany failed: %v", err)
+	}
+	for _, field := range []string{"email", "city"} {
+		if err := table.CreateIndex(field); err != nil {
+			b.Fatalf("CreateIndex failed: %v", err)
+		}
+	}
+	if err := table.Close(); err != nil {
+		b.Fatalf("Close failed: %v", err)
+	}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				reopened := NewTable("id", filePath, withAESKey(testAESKey), WithIndexWorkers(workers))
+				if err := reopened.LoadIndexes(); err != nil {
+					b.Fatalf("LoadIndexes failed: %v", err)
+				}
+				if err := reopened.Close(); err != nil {
+					b.Fatalf("Close failed: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ForeignKey declares that a field of a table references the primary key of another table of the same database.
+type ForeignKey struct {
+	Field    string `json:"Field"`    // Field of the table holding the referenced primary key
+	RefTable string `json:"RefTable"` // Name of the referenced table
+}
+
+// IntegrityViolation describes a record whose foreign key does not reference an existing record.
+type IntegrityViolation struct {
+	Table    string      // Name of the table holding the record
+	Key      string      // Primary key of the record
+	Field    string      // Foreign key field of the record
+	Value    interface{} // Value of the foreign key field
+	RefTable string      // Name of the referenced table
+	Reason   string      // Description of the violation
+}
+
+// AddForeignKey is a method of the Table struct that declares that a field of the table references
+// the primary key of another table of the same database.
+// The declaration is saved in the metadata file of the table. Foreign keys are not enforced by the writes
+// on the table, so bulk imports can load the tables in any order; Database.CheckIntegrity reports the records
+// whose foreign key does not reference an existing record.
+//
+// Parameters:
+// - field: The field of the table holding the referenced primary key.
+// - refTable: The name of the referenced table.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the field or the referenced table is empty, the foreign key is already declared or an error occurs while saving the metadata, it returns an error.
+func (t *Table) AddForeignKey(field, refTable string) error {
+	if field == "" || refTable == "" {
+		return fmt.Errorf("a foreign key needs a field and a referenced table")
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	foreignKey := ForeignKey{Field: field, RefTable: refTable}
+	for _, existing := range t.foreignKeys {
+		if existing == foreignKey {
+			return fmt.Errorf("foreign key %s -> %s already exists", field, refTable)
+		}
+	}
+
+	t.foreignKeys = append(t.foreignKeys, foreignKey)
+	if err := t.saveMetadata(); err != nil {
+		t.foreignKeys = t.foreignKeys[:len(t.foreignKeys)-1]
+		return err
+	}
+	return nil
+}
+
+// ForeignKeys is a method of the Table struct that returns the foreign keys declared on the table.
+func (t *Table) ForeignKeys() []ForeignKey {
+	t.RLock()
+	defer t.RUnlock()
+
+	return append([]ForeignKey(nil), t.foreignKeys...)
+}
+
+// keyForValue returns the primary key under which a record referenced by the given value is stored.
+func (t *Table) keyForValue(value interface{}) (string, error) {
+	if t.hasCompositeKey() {
+		return fmt.Sprintf("%v", value), nil
+	}
+	return keyString(value)
+}
+
+// CheckIntegrity is a method of the Database struct that scans the tables for foreign keys that don't reference an existing record.
+// For every foreign key declared with AddForeignKey, it checks that the referenced table exists and that the value of the
+// foreign key field of each record is the primary key of a record of the referenced table.
+// Records without the foreign key field, or with a nil value, reference nothing and are not violations.
+// It works on the current snapshots of the tables and doesn't modify any data, which makes it suitable as a maintenance
+// or CI check after bulk imports.
+//
+// Returns:
+// - A slice of IntegrityViolation, one for each dangling reference, sorted by table, key and field. It is empty if the data is consistent.
+// - An error, if an error occurs while reading the records of a table.
+func (db *Database) CheckIntegrity() ([]IntegrityViolation, error) {
+	db.RLock()
+	tables := make(map[string]*Table, len(db.Tables))
+	for name, table := range db.Tables {
+		tables[name] = table
+	}
+	db.RUnlock()
+
+	violations := make([]IntegrityViolation, 0)
+	for tableName, table := range tables {
+		foreignKeys := table.ForeignKeys()
+		if len(foreignKeys) == 0 {
+			continue
+		}
+		allRecords, err := table.snapshotRecords()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read table %s: %v", tableName, err)
+		}
+
+		for _, foreignKey := range foreignKeys {
+			refTable, exists := tables[foreignKey.RefTable]
+			var refRecords map[string]bool
+			if exists {
+				refSnapshot, err := refTable.snapshotRecords()
+				if err != nil {
+					return nil, fmt.Errorf("failed to read table %s: %v", foreignKey.RefTable, err)
+				}
+				refRecords = make(map[string]bool, len(refSnapshot.GetRecords()))
+				for key := range refSnapshot.GetRecords() {
+					refRecords[key] = true
+				}
+			}
+
+			for key, record := range allRecords.GetRecords() {
+				protoValue, ok := record.Fields[foreignKey.Field]
+				if !ok || protoValue == nil {
+					continue
+				}
+				value, err := fromProtoValue(protoValue)
+				if err != nil || value == nil {
+					continue
+				}
+
+				violation := IntegrityViolation{
+					Table:    tableName,
+					Key:      key,
+					Field:    foreignKey.Field,
+					Value:    value,
+					RefTable: foreignKey.RefTable,
+				}
+				if !exists {
+					violation.Reason = fmt.Sprintf("referenced table %s does not exist", foreignKey.RefTable)
+					violations = append(violations, violation)
+					continue
+				}
+				refKey, err := refTable.keyForValue(value)
+				if err != nil {
+					violation.Reason = fmt.Sprintf("invalid reference: %v", err)
+					violations = append(violations, violation)
+					continue
+				}
+				if !refRecords[refKey] {
+					violation.Reason = fmt.Sprintf("no record with key %s in table %s", refKey, foreignKey.RefTable)
+					violations = append(violations, violation)
+				}
+			}
+		}
+	}
+
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Table != violations[j].Table {
+			return violations[i].Table < violations[j].Table
+		}
+		if violations[i].Key != violations[j].Key {
+			return violations[i].Key < violations[j].Key
+		}
+		return violations[i].Field < violations[j].Field
+	})
+	return violations, nil
+}
@@ -0,0 +1,107 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// Iterator walks the records of a table in ascending primary key order.
+// Keys are ordered by the values they hold, like the values sorted by Query: integer keys in numeric order,
+// so 9 comes before 10, then string keys, then boolean keys.
+// It works over a point-in-time snapshot of the table taken when the iterator is created:
+// records inserted, updated or deleted afterwards are not seen by the iterator.
+//
+// A new iterator is positioned before the first key, so Next must be called before Key or Record:
+//
+//	it := table.Iterator()
+//	for it.Seek(100); it.Next(); {
+//		record, err := it.Record()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	keys    []string                  // Stored primary keys of the snapshot, sorted by the keys they hold
+	records map[string]*dbdata.Record // Records of the snapshot keyed by primary key
+	table   *Table                    // Table iterated over, whose read transforms apply to the records
+	pos     int                       // Position of the current key in keys
+	err     error                     // Error that occurred while taking the snapshot
+}
+
+// Iterator is a method of the Table struct that returns an iterator over the records of the table sorted by primary key.
+// It takes the current snapshot of the records and sorts their keys, so the iterator sees a consistent
+// point-in-time view of the table without holding the table lock while it is used.
+// If an error occurs while reading the records, the iterator is empty and the error is returned by its Err method.
+//
+// Returns:
+// - A pointer to an Iterator positioned before the first key.
+func (t *Table) Iterator() *Iterator {
+	it := &Iterator{pos: -1, table: t}
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		it.err = err
+		return it
+	}
+
+	it.records = allRecords.GetRecords()
+	it.keys = make([]string, 0, len(it.records))
+	for key := range it.records {
+		it.keys = append(it.keys, key)
+	}
+	sort.Slice(it.keys, func(i, j int) bool { return t.compareKeys(it.keys[i], it.keys[j]) < 0 })
+
+	t.metrics.IncrementQueryCount()
+	return it
+}
+
+// Seek positions the iterator just before the first key that is greater than or equal to the given key,
+// so the next call to Next moves to that key. The key is given like to Select, so Seek(10) seeks the integer key 10
+// and Seek("10") the string key "10", which comes after every integer key. A stored key returned by Key,
+// such as "num:10", is also accepted, so an iteration can be resumed from the last key it returned.
+// A key that is not a valid primary key positions the iterator past the last key.
+func (it *Iterator) Seek(key interface{}) {
+	target, ok := key.(string)
+	if !ok {
+		keyStr, err := keyString(key)
+		if err != nil {
+			it.pos = len(it.keys)
+			return
+		}
+		target = keyStr
+	}
+	it.pos = sort.Search(len(it.keys), func(i int) bool { return it.table.compareKeys(it.keys[i], target) >= 0 }) - 1
+}
+
+// Next advances the iterator to the next key.
+// It returns false when there are no more keys.
+func (it *Iterator) Next() bool {
+	if it.pos < len(it.keys) {
+		it.pos++
+	}
+	return it.pos < len(it.keys)
+}
+
+// Key returns the primary key at the current position of the iterator, or an empty string if the iterator is not positioned on a key.
+func (it *Iterator) Key() string {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return ""
+	}
+	return it.keys[it.pos]
+}
+
+// Record returns the record at the current position of the iterator.
+// It returns an error if the iterator is not positioned on a key.
+func (it *Iterator) Record() (Record, error) {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil, fmt.Errorf("iterator is not positioned on a record")
+	}
+	return it.table.fromStoredRecord(it.records[it.keys[it.pos]])
+}
+
+// Err returns the error that occurred while taking the snapshot of the table, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
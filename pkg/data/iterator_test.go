@@ -0,0 +1,99 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// iterate returns the keys the iterator moves to from its current position.
+func iterate(t *testing.T, it *Iterator) []string {
+	t.Helper()
+	var keys []string
+	for it.Next() {
+		if _, err := it.Record(); err != nil {
+			t.Fatalf("Record of %s failed: %v", it.Key(), err)
+		}
+		keys = append(keys, it.Key())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err = %v", err)
+	}
+	return keys
+}
+
+func TestIteratorOrdersKeysByValue(t *testing.T) {
+	table := newTestTable(t, "id")
+	for _, id := range []interface{}{10, "b", 9, true, -3, "10", 2.5, "a", 100} {
+		mustInsert(t, table, Record{"id": id})
+	}
+	it := table.Iterator()
+
+	// Numbers in numeric order, then strings, then booleans
+	want := []string{"num:-3", "flt:2.5", "num:9", "num:10", "num:100", "str:10", "a", "b", "bool:true"}
+	if keys := iterate(t, it); !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+	if it.Next() || it.Key() != "" {
+		t.Errorf("Next past the last key = true with key %q, want false", it.Key())
+	}
+
+	// The snapshot doesn't see the writes made after the iterator is created
+	mustInsert(t, table, Record{"id": 5})
+	it.Seek(-10)
+	if keys := iterate(t, it); len(keys) != len(want) {
+		t.Errorf("keys after an insert = %v, want the %d keys of the snapshot", keys, len(want))
+	}
+}
+
+func TestIteratorSeek(t *testing.T) {
+	table := newTestTable(t, "id")
+	for _, id := range []interface{}{1, 2, 9, 10, 11, "10", "x"} {
+		mustInsert(t, table, Record{"id": id})
+	}
+	it := table.Iterator()
+
+	tests := []struct {
+		key  interface{}
+		want []string
+	}{
+		{9, []string{"num:9", "num:10", "num:11", "str:10", "x"}},
+		{int64(10), []string{"num:10", "num:11", "str:10", "x"}},
+		{9.5, []string{"num:10", "num:11", "str:10", "x"}},
+		{"num:11", []string{"num:11", "str:10", "x"}}, // A stored key returned by Key
+		{"10", []string{"str:10", "x"}},
+		{"", []string{"str:10", "x"}},
+		{"y", nil},
+		{false, nil},
+	}
+	for _, tt := range tests {
+		it.Seek(tt.key)
+		if keys := iterate(t, it); !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("Seek(%#v) = %v, want %v", tt.key, keys, tt.want)
+		}
+	}
+
+	it.Seek(struct{}{})
+	if it.Next() {
+		t.Errorf("Next after seeking an invalid key moved to %s, want no key", it.Key())
+	}
+}
+
+func TestIteratorOrdersCompositeKeysByComponent(t *testing.T) {
+	table := newTestTable(t, "pk", WithCompositeKey("tenant", "id"))
+	for _, id := range []interface{}{10, 9, "9"} {
+		for _, tenant := range []string{"b", "a"} {
+			mustInsert(t, table, Record{"tenant": tenant, "id": id})
+		}
+	}
+	it := table.Iterator()
+	want := []string{"a|num:9", "a|num:10", "a|str:9", "b|num:9", "b|num:10", "b|str:9"}
+	if keys := iterate(t, it); !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+
+	it.Seek(fmt.Sprintf("b%snum:10", DefaultKeySeparator))
+	if keys := iterate(t, it); !reflect.DeepEqual(keys, want[4:]) {
+		t.Errorf("keys after Seek = %v, want %v", keys, want[4:])
+	}
+}
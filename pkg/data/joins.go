@@ -2,7 +2,10 @@ package data
 
 import (
 	"fmt"
+	"math/big"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/Malpizarr/dbproto/pkg/dbdata"
 	"google.golang.org/protobuf/types/known/structpb"
@@ -17,10 +20,75 @@ const (
 	FullOuterJoin
 )
 
+// joinTypeNames maps the names accepted by ParseJoinType to join types.
+var joinTypeNames = map[string]JoinType{
+	"inner": InnerJoin,
+	"left":  LeftJoin,
+	"right": RightJoin,
+	"full":  FullOuterJoin,
+}
+
+// ParseJoinType returns the join type with the given name: "inner", "left", "right" or "full", in any case.
+// It returns an error if the name is not recognized.
+func ParseJoinType(name string) (JoinType, error) {
+	joinType, exists := joinTypeNames[strings.ToLower(name)]
+	if !exists {
+		return InnerJoin, fmt.Errorf("unknown join type %q", name)
+	}
+	return joinType, nil
+}
+
+// joinOptions holds the optional settings of a join operation.
+type joinOptions struct {
+	nullFill  bool        // Whether to emit nil values for the fields of the unmatched side
+	coerce    bool        // Whether the key values are compared with coercion instead of strictly
+	normalize []Transform // Normalizers applied to the key values of both tables before they are compared, in order
+}
+
+// JoinOption is a function that configures optional settings of a join operation.
+type JoinOption func(*joinOptions)
+
+// WithNullFill makes outer joins emit every field of both tables in every result row.
+// By default, a row for a record without a match only contains the fields of the matched side,
+// so the "t1." or "t2." keys of the unmatched side are missing entirely.
+// With this option, those keys are present with a nil value, so every result row has the same key set.
+func WithNullFill() JoinOption {
+	return func(o *joinOptions) {
+		o.nullFill = true
+	}
+}
+
+// WithCoercion makes the join compare the key values with coercion instead of strictly.
+// By default, two key values match only if they have the same type and value, so the string "5" doesn't match the integer 5.
+// With this option, key values of different types are converted before being compared:
+//   - Integers and floating point numbers are compared by numeric value, so 5 matches 5.0.
+//   - A string and a number match if the string, with surrounding spaces removed, parses as a number equal to it,
+//     so "5" and " 5.0" match 5.
+//   - A string and a boolean match if the string parses as that boolean with strconv.ParseBool, so "true" and "1" match true.
+//   - Other values, such as lists, objects and nulls, never match, like in strict mode.
+func WithCoercion() JoinOption {
+	return func(o *joinOptions) {
+		o.coerce = true
+	}
+}
+
+// WithKeyNormalizer makes the join apply the normalizer to the key values of both tables before comparing them,
+// so values differing only by their formatting match, for example Lowercase to match emails case-insensitively
+// or TrimSpace to ignore surrounding spaces. Any Transform can be used. The option can be given several times,
+// and the normalizers run in the order given. By default the key values are compared as they are stored.
+// Only the comparison is affected: the rows of the join hold the stored values. Null keys are not normalized and
+// still match no key. The normalized values are compared strictly, or with coercion if WithCoercion is given too.
+// If a normalizer returns an error for a key value, the join fails with it.
+func WithKeyNormalizer(normalizer Transform) JoinOption {
+	return func(o *joinOptions) {
+		o.normalize = append(o.normalize, normalizer)
+	}
+}
+
 // JoinTables is a function that performs a join operation between two tables.
 // It supports different types of joins: inner join, left join, right join, and full outer join.
 // The join operation is based on the key fields provided for each table.
-// The function first resets and loads the indexes for both tables.
+// The function first reads the records of both tables that have their key field, sorted by primary key.
 // It then processes the records from the first table, attempting to find matching records in the second table based on the key fields.
 // If a match is found, the records are merged and added to the results.
 // If no match is found and the join type is a left join or full outer join, the record from the first table is added to the results alone.
@@ -32,30 +100,45 @@ const (
 // - t1, t2: Pointers to the first and second Table objects to be joined.
 // - key1, key2: The key fields for the first and second tables, respectively.
 // - joinType: The type of join to be performed, represented as a JoinType value.
+// - opts: Optional JoinOption values that configure the join, such as WithNullFill, WithCoercion or WithKeyNormalizer.
 //
 // Returns:
 // - A slice of maps, where each map represents a joined record. The keys in the map are field names and the values are the corresponding field values.
 // - An error, if any error occurs during the join operation. If the operation is successful, the error is nil.
-func JoinTables(t1, t2 *Table, key1, key2 string, joinType JoinType) ([]map[string]interface{}, error) {
+func JoinTables(t1, t2 *Table, key1, key2 string, joinType JoinType, opts ...JoinOption) ([]map[string]interface{}, error) {
+	options := &joinOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
 	results := make([]map[string]interface{}, 0)
 
-	if err := t1.ResetAndLoadIndexes(); err != nil {
-		return nil, fmt.Errorf("failed to load indexes for table 1: %v", err)
+	records1, err := joinRecords(t1, key1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load records for table 1: %v", err)
+	}
+	records2, err := joinRecords(t2, key2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load records for table 2: %v", err)
+	}
+	keys1, err := options.joinKeys(records1, key1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize keys of table 1: %w", err)
 	}
-	if err := t2.ResetAndLoadIndexes(); err != nil {
-		return nil, fmt.Errorf("failed to load indexes for table 2: %v", err)
+	keys2, err := options.joinKeys(records2, key2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize keys of table 2: %w", err)
 	}
 
 	// Process records from t1
-	for _, rec1 := range t1.Indexes[key1] {
+	for i, rec1 := range records1 {
 		if rec1 == nil {
 			continue
 		}
 
 		// Attempt to find matching records in t2
 		matched := false
-		for _, rec2 := range t2.Indexes[key2] {
-			if rec2 != nil && Equal(rec1.Fields[key1], rec2.Fields[key2]) {
+		for j, rec2 := range records2 {
+			if rec2 != nil && options.keysEqual(keys1[i], keys2[j]) {
 				results = append(results, mergeRecords(rec1, rec2))
 				matched = true
 			}
@@ -69,15 +152,15 @@ func JoinTables(t1, t2 *Table, key1, key2 string, joinType JoinType) ([]map[stri
 
 	// Process records from t2 if it's a right join or full outer join
 	if joinType == RightJoin || joinType == FullOuterJoin {
-		for _, rec2 := range t2.Indexes[key2] {
+		for j, rec2 := range records2 {
 			if rec2 == nil {
 				continue
 			}
 
 			// Check if rec2 was matched
 			matched := false
-			for _, rec1 := range t1.Indexes[key1] {
-				if rec1 != nil && Equal(rec1.Fields[key1], rec2.Fields[key2]) {
+			for i, rec1 := range records1 {
+				if rec1 != nil && options.keysEqual(keys1[i], keys2[j]) {
 					matched = true
 					break
 				}
@@ -90,9 +173,135 @@ func JoinTables(t1, t2 *Table, key1, key2 string, joinType JoinType) ([]map[stri
 		}
 	}
 
+	if options.nullFill {
+		fillNulls(results, "t1.", records1)
+		fillNulls(results, "t2.", records2)
+	}
+
 	return results, nil
 }
 
+// joinKeys returns the key values of the records compared by the join, in the order of the records:
+// the stored values, or the values normalized by the normalizers of the options.
+// Each key is normalized once, instead of once per comparison.
+func (o *joinOptions) joinKeys(records []*dbdata.Record, key string) ([]*structpb.Value, error) {
+	keys := make([]*structpb.Value, len(records))
+	for i, record := range records {
+		value := record.GetFields()[key]
+		keys[i] = value
+		if len(o.normalize) == 0 || value == nil {
+			continue
+		}
+		if _, isNull := value.GetKind().(*structpb.Value_NullValue); isNull {
+			continue
+		}
+		stored, err := fromProtoValue(value)
+		if err != nil {
+			return nil, err
+		}
+		normalized := stored
+		for _, normalize := range o.normalize {
+			if normalized, err = normalize(normalized); err != nil {
+				return nil, fmt.Errorf("normalizer of key %v failed: %w", stored, err)
+			}
+		}
+		if keys[i], err = toProtoValue(normalized); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// keysEqual reports whether two key values match, strictly or with coercion depending on the options.
+// Like in SQL, null keys match no key, not even another null, and list and object keys match no key either.
+func (o *joinOptions) keysEqual(value1, value2 *structpb.Value) bool {
+	switch value1.GetKind().(type) {
+	case *structpb.Value_NullValue, *structpb.Value_ListValue, *structpb.Value_StructValue:
+		return false
+	}
+	if Equal(value1, value2) {
+		return true
+	}
+	if !o.coerce {
+		return false
+	}
+
+	decoded1, err := fromProtoValue(value1)
+	if err != nil {
+		return false
+	}
+	decoded2, err := fromProtoValue(value2)
+	if err != nil {
+		return false
+	}
+	return coercedEqual(decoded1, decoded2) || coercedEqual(decoded2, decoded1)
+}
+
+// coercedEqual reports whether two decoded values are equal with the coercion rules of WithCoercion,
+// converting the second value to the type of the first one.
+func coercedEqual(value1, value2 interface{}) bool {
+	switch v1 := value1.(type) {
+	case int64, float64:
+		number1, _ := filterNumber(v1)
+		if number2, ok := filterNumber(value2); ok {
+			return number1.Cmp(number2) == 0
+		}
+		if s, ok := value2.(string); ok {
+			number2, ok := new(big.Float).SetString(strings.TrimSpace(s))
+			return ok && number1.Cmp(number2) == 0
+		}
+	case bool:
+		if s, ok := value2.(string); ok {
+			b, err := strconv.ParseBool(strings.TrimSpace(s))
+			return err == nil && b == v1
+		}
+	}
+	return false
+}
+
+// joinRecords reads the records of the table that have the given key field, sorted by primary key.
+func joinRecords(t *Table, key string) ([]*dbdata.Record, error) {
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKeys := make([]string, 0, len(allRecords.GetRecords()))
+	for primaryKey, record := range allRecords.GetRecords() {
+		if _, exists := record.Fields[key]; exists {
+			primaryKeys = append(primaryKeys, primaryKey)
+		}
+	}
+	sort.Strings(primaryKeys)
+
+	records := make([]*dbdata.Record, len(primaryKeys))
+	for i, primaryKey := range primaryKeys {
+		records[i] = allRecords.Records[primaryKey]
+	}
+	return records, nil
+}
+
+// fillNulls adds the prefixed name of every field found in the given records to each result row that lacks it, with a nil value.
+func fillNulls(results []map[string]interface{}, prefix string, records []*dbdata.Record) {
+	fields := make(map[string]struct{})
+	for _, rec := range records {
+		if rec == nil {
+			continue
+		}
+		for k := range rec.Fields {
+			fields[prefix+k] = struct{}{}
+		}
+	}
+
+	for _, row := range results {
+		for field := range fields {
+			if _, exists := row[field]; !exists {
+				row[field] = nil
+			}
+		}
+	}
+}
+
 // mergeRecords merges two dbdata.Record objects and returns a map of field names to their corresponding values.
 // The function extracts the values from the input records and prefixes the field names with "t1." or "t2."
 // depending on the record they belong to.
@@ -113,6 +322,13 @@ func mergeRecords(rec1, rec2 *dbdata.Record) map[string]interface{} {
 			if len(x.StringValue) > 4 && x.StringValue[:4] == "str:" {
 				return x.StringValue[4:]
 			}
+			if strings.HasPrefix(x.StringValue, blobPrefix) {
+				blob, err := decodeBlob(x.StringValue)
+				if err != nil {
+					return x.StringValue // fallback to the original string if decoding fails
+				}
+				return blob
+			}
 			return x.StringValue
 		case *structpb.Value_NumberValue:
 			return x.NumberValue
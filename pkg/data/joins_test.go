@@ -0,0 +1,220 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newJoinTables creates a table of users and a table of orders, where order o1 belongs to user u1,
+// user u2 has no order and order o2 belongs to a missing user.
+func newJoinTables(t *testing.T) (*Table, *Table) {
+	t.Helper()
+	db := newTestDatabase(t, "users", "orders")
+	users, orders := db.Tables["users"], db.Tables["orders"]
+	mustInsert(t, users,
+		Record{"id": "u1", "name": "Ana"},
+		Record{"id": "u2", "name": "Bo"},
+	)
+	mustInsert(t, orders,
+		Record{"id": "o1", "userId": "u1"},
+		Record{"id": "o2", "userId": "u9"},
+	)
+	return users, orders
+}
+
+// rowKeys returns the sorted keys of a joined row.
+func rowKeys(row map[string]interface{}) []string {
+	keys := make([]string, 0, len(row))
+	for key := range row {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestJoinTypesWithNullFill(t *testing.T) {
+	users, orders := newJoinTables(t)
+	allKeys := []string{"t1.id", "t1.name", "t2.id", "t2.userId"}
+
+	tests := []struct {
+		joinType JoinType
+		want     int
+	}{
+		{InnerJoin, 1},
+		{LeftJoin, 2},
+		{RightJoin, 2},
+		{FullOuterJoin, 3},
+	}
+	for _, tt := range tests {
+		rows, err := JoinTables(users, orders, "id", "userId", tt.joinType, WithNullFill())
+		if err != nil {
+			t.Fatalf("JoinTables(%d) failed: %v", tt.joinType, err)
+		}
+		if len(rows) != tt.want {
+			t.Errorf("JoinTables(%d) returned %d rows, want %d", tt.joinType, len(rows), tt.want)
+		}
+		for _, row := range rows {
+			if got := rowKeys(row); !reflect.DeepEqual(got, allKeys) {
+				t.Errorf("JoinTables(%d) row keys = %v, want %v", tt.joinType, got, allKeys)
+			}
+		}
+	}
+}
+
+func TestOuterJoinWithoutNullFill(t *testing.T) {
+	users, orders := newJoinTables(t)
+
+	rows, err := JoinTables(users, orders, "id", "userId", FullOuterJoin)
+	if err != nil {
+		t.Fatalf("JoinTables failed: %v", err)
+	}
+	var unmatchedUser, unmatchedOrder bool
+	for _, row := range rows {
+		switch {
+		case row["t1.id"] == "u2":
+			unmatchedUser = true
+			if _, exists := row["t2.id"]; exists {
+				t.Errorf("row of the unmatched user holds t2.id: %v", row)
+			}
+		case row["t2.id"] == "o2":
+			unmatchedOrder = true
+			if _, exists := row["t1.id"]; exists {
+				t.Errorf("row of the unmatched order holds t1.id: %v", row)
+			}
+		}
+	}
+	if !unmatchedUser || !unmatchedOrder {
+		t.Errorf("FullOuterJoin rows = %v, want the unmatched user and the unmatched order", rows)
+	}
+}
+
+func TestJoinCoercion(t *testing.T) {
+	db := newTestDatabase(t, "a", "b")
+	mustInsert(t, db.Tables["a"], Record{"id": "a1", "ref": 5})
+	mustInsert(t, db.Tables["b"], Record{"id": "b1", "ref": "5"})
+
+	rows, err := JoinTables(db.Tables["a"], db.Tables["b"], "ref", "ref", InnerJoin)
+	if err != nil {
+		t.Fatalf("JoinTables failed: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("strict join matched the integer 5 with the string \"5\": %v", rows)
+	}
+
+	rows, err = JoinTables(db.Tables["a"], db.Tables["b"], "ref", "ref", InnerJoin, WithCoercion())
+	if err != nil {
+		t.Fatalf("JoinTables failed: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("join with coercion returned %d rows, want 1", len(rows))
+	}
+}
+
+func TestParseJoinType(t *testing.T) {
+	for name, want := range map[string]JoinType{"inner": InnerJoin, "LEFT": LeftJoin, "Right": RightJoin, "full": FullOuterJoin} {
+		if got, err := ParseJoinType(name); err != nil || got != want {
+			t.Errorf("ParseJoinType(%q) = %d, %v, want %d", name, got, err, want)
+		}
+	}
+	if _, err := ParseJoinType("cross"); err == nil {
+		t.Error("ParseJoinType(\"cross\") succeeded, want an error")
+	}
+}
+
+func TestJoinCoercionRules(t *testing.T) {
+	tests := []struct {
+		left, right interface{}
+		strict      bool
+		coerced     bool
+	}{
+		{5, 5, true, true},
+		{5, 5.0, false, true},
+		{2.5, 2.5, true, true},
+		{5, "5", false, true},
+		{5, " 5.0 ", false, true},
+		{2.5, "2.5", false, true},
+		{5, "five", false, false},
+		{true, "true", false, true},
+		{true, "1", false, true},
+		{false, "true", false, false},
+		{"abc", "abc", true, true},
+		{[]interface{}{"a"}, []interface{}{"a"}, false, false},
+		{map[string]interface{}{"a": 1}, map[string]interface{}{"a": 1}, false, false},
+		{nil, nil, false, false},
+	}
+	for _, tt := range tests {
+		db := newTestDatabase(t, "a", "b")
+		mustInsert(t, db.Tables["a"], Record{"id": "a1", "ref": tt.left})
+		mustInsert(t, db.Tables["b"], Record{"id": "b1", "ref": tt.right})
+
+		for _, mode := range []struct {
+			opts []JoinOption
+			want bool
+		}{{nil, tt.strict}, {[]JoinOption{WithCoercion()}, tt.coerced}} {
+			rows, err := JoinTables(db.Tables["a"], db.Tables["b"], "ref", "ref", InnerJoin, mode.opts...)
+			if err != nil {
+				t.Fatalf("JoinTables failed: %v", err)
+			}
+			if matched := len(rows) == 1; matched != mode.want {
+				t.Errorf("joining %#v with %#v, coercion %v: matched = %v, want %v", tt.left, tt.right, mode.opts != nil, matched, mode.want)
+			}
+		}
+	}
+}
+
+func TestJoinKeyNormalizers(t *testing.T) {
+	db := newTestDatabase(t, "users", "orders")
+	users, orders := db.Tables["users"], db.Tables["orders"]
+	mustInsert(t, users,
+		Record{"id": "u1", "email": "Alice@X.com"},
+		Record{"id": "u2", "email": "bo@x.com"},
+		Record{"id": "u3", "email": nil},
+	)
+	mustInsert(t, orders,
+		Record{"id": "o1", "email": " alice@x.com "},
+		Record{"id": "o2", "email": "BO@X.COM"},
+		Record{"id": "o3", "email": nil},
+	)
+
+	rows, err := JoinTables(users, orders, "email", "email", InnerJoin)
+	if err != nil {
+		t.Fatalf("JoinTables failed: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("join without normalizers = %v, want no match", rows)
+	}
+
+	// Lowercasing alone leaves the spaces, so only bo matches
+	rows, err = JoinTables(users, orders, "email", "email", InnerJoin, WithKeyNormalizer(Lowercase))
+	if err != nil {
+		t.Fatalf("JoinTables failed: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["t1.id"] != "u2" {
+		t.Errorf("join with Lowercase = %v, want u2 only", rows)
+	}
+
+	rows, err = JoinTables(users, orders, "email", "email", InnerJoin, WithKeyNormalizer(TrimSpace), WithKeyNormalizer(Lowercase))
+	if err != nil {
+		t.Fatalf("JoinTables failed: %v", err)
+	}
+	matches := map[interface{}]interface{}{}
+	for _, row := range rows {
+		matches[row["t1.id"]] = row["t2.id"]
+	}
+	if !reflect.DeepEqual(matches, map[interface{}]interface{}{"u1": "o1", "u2": "o2"}) {
+		t.Errorf("join with TrimSpace and Lowercase matched %v, want u1 with o1 and u2 with o2, and no null keys", matches)
+	}
+	// The rows hold the stored values, not the normalized ones
+	for _, row := range rows {
+		if row["t1.id"] == "u1" && (row["t1.email"] != "Alice@X.com" || row["t2.email"] != " alice@x.com ") {
+			t.Errorf("joined row = %v, want the stored emails", row)
+		}
+	}
+
+	failing := func(interface{}) (interface{}, error) { return nil, errors.New("cannot normalize") }
+	if _, err := JoinTables(users, orders, "email", "email", InnerJoin, WithKeyNormalizer(failing)); err == nil {
+		t.Error("join with a failing normalizer succeeded, want an error")
+	}
+}
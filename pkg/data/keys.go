@@ -0,0 +1,533 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// DefaultKeySeparator is the separator used to join the values of a composite primary key.
+const DefaultKeySeparator = "|"
+
+// ErrInvalidPrimaryKey is returned by the inserts when the primary key of a record is missing, nil, empty or otherwise invalid.
+var ErrInvalidPrimaryKey = errors.New("invalid primary key")
+
+// ErrPrimaryKeyChange is returned by Update and UpdateMany when the updates would change the primary key of a record.
+// Records are stored under their primary key, so the key of a record is immutable once it is inserted.
+// To change it, delete the record and insert it again under the new key.
+var ErrPrimaryKeyChange = errors.New("primary key of a record cannot be changed")
+
+// WithCompositeKey makes the primary key of the table a composite key built from the values of several fields.
+// The values are converted like a single primary key, so the integer 5 and the string "5" are distinct components,
+// then joined with the key separator, in the order of the fields, and the resulting key is
+// written into the primary key field of the stored record.
+// At least two fields are required; a single field is just a regular primary key.
+func WithCompositeKey(fields ...string) TableOption {
+	return func(t *Table) {
+		t.keyFields = append([]string(nil), fields...)
+	}
+}
+
+// WithKeySeparator sets the separator used to join the values of a composite primary key.
+// It defaults to DefaultKeySeparator. A value containing the separator would make the key ambiguous,
+// for example ("a|b", "c") and ("a", "b|c") would both produce "a|b|c", so such values are rejected by Insert.
+// An empty separator is ignored.
+func WithKeySeparator(separator string) TableOption {
+	return func(t *Table) {
+		if separator != "" {
+			t.keySeparator = separator
+		}
+	}
+}
+
+// KeyGenerator generates a new primary key, for example a UUID or a ULID.
+type KeyGenerator func() string
+
+// UUIDKeyGenerator is the name of the UUIDKey generator, saved in the metadata of the tables created with WithUUIDKeys.
+const UUIDKeyGenerator = "uuid"
+
+// UUIDKey is a KeyGenerator returning random version 4 UUIDs in their canonical form, such as "9b2c8e1a-4f0d-4c6e-8a5b-3f7d2e9c1b40".
+func UUIDKey() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// maxKeyGenerationAttempts is the number of keys generated for a record before giving up on collisions.
+const maxKeyGenerationAttempts = 3
+
+// WithKeyGenerator makes the table generate the primary key of records inserted without one.
+// When the primary key field of a record is missing, nil or an empty string, Insert, InsertWithMode and InsertMany
+// call the generator and write the generated key into the stored record.
+// By default there is no generator, and inserting a record without a primary key fails.
+// The generator is ignored for tables with a composite key, whose key is built from the values of their key fields,
+// and for tables whose primary key is a nested path.
+func WithKeyGenerator(generator KeyGenerator) TableOption {
+	return func(t *Table) {
+		t.keyGenerator = generator
+		t.keyGenName = ""
+	}
+}
+
+// WithUUIDKeys makes the table generate a UUIDKey for the records inserted without a primary key, like WithKeyGenerator.
+// Unlike a custom generator, it is saved in the metadata file of the table by Database.CreateTable,
+// so the tables loaded by a server, and the inserts of the HTTP API, keep generating keys.
+func WithUUIDKeys() TableOption {
+	return func(t *Table) {
+		t.keyGenerator = UUIDKey
+		t.keyGenName = UUIDKeyGenerator
+	}
+}
+
+// withGeneratedKey returns the record with a generated primary key if the table has a key generator and the record has no primary key.
+// A generated key for which exists reports true collides with an existing record, so another key is generated,
+// up to maxKeyGenerationAttempts times. The given record is not modified.
+func (t *Table) withGeneratedKey(record Record, exists func(key string) bool) (Record, error) {
+	if t.keyGenerator == nil || t.hasCompositeKey() || t.keyPath() != nil {
+		return record, nil
+	}
+	if value, ok := record[t.PrimaryKey]; ok && value != nil && value != "" {
+		return record, nil
+	}
+
+	keyed := make(Record, len(record)+1)
+	for field, value := range record {
+		keyed[field] = value
+	}
+	for attempt := 0; attempt < maxKeyGenerationAttempts; attempt++ {
+		keyed[t.PrimaryKey] = t.keyGenerator()
+		key, err := t.primaryKeyOf(keyed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid generated primary key: %v", err)
+		}
+		if !exists(key) {
+			return keyed, nil
+		}
+	}
+	return nil, fmt.Errorf("generated primary key collided with an existing record %d times", maxKeyGenerationAttempts)
+}
+
+// hasCompositeKey reports whether the primary key of the table is built from several fields.
+func (t *Table) hasCompositeKey() bool {
+	return len(t.keyFields) > 1
+}
+
+// ValidKeyPath reports whether the name is a valid primary key: a field name accepted by ValidFilename,
+// or a dotted path of such names, such as "meta.id", for a primary key held by a nested object.
+func ValidKeyPath(name string) bool {
+	for _, field := range strings.Split(name, ".") {
+		if !ValidFilename(field) {
+			return false
+		}
+	}
+	return true
+}
+
+// keyPath returns the fields leading to the primary key if the primary key is a dotted path such as "meta.id",
+// for records holding their key in a nested object, or nil if the primary key is a top-level field.
+func (t *Table) keyPath() []string {
+	if t.hasCompositeKey() || !strings.Contains(t.PrimaryKey, ".") {
+		return nil
+	}
+	return strings.Split(t.PrimaryKey, ".")
+}
+
+// keyRoot returns the top-level field holding the primary key, which is the first field of its path if it is nested.
+func (t *Table) keyRoot() string {
+	if path := t.keyPath(); path != nil {
+		return path[0]
+	}
+	return t.PrimaryKey
+}
+
+// lookupPath returns the value at the given path of fields in the record, going down the nested objects.
+// It returns an error naming the first field of the path that is missing or isn't an object.
+func lookupPath(record Record, path []string) (interface{}, error) {
+	var current interface{} = map[string]interface{}(record)
+	for i, field := range path {
+		var object map[string]interface{}
+		switch v := current.(type) {
+		case map[string]interface{}:
+			object = v
+		case Record:
+			object = v
+		default:
+			return nil, fmt.Errorf("field '%s' is a %T, not an object", strings.Join(path[:i], "."), current)
+		}
+		value, ok := object[field]
+		if !ok {
+			return nil, fmt.Errorf("field '%s' not found in record", strings.Join(path[:i+1], "."))
+		}
+		current = value
+	}
+	return current, nil
+}
+
+// KeyOf is a method of the Table struct that returns the key the record would be stored under, in the stored form
+// returned by InsertReturningKey, without inserting it. It resolves composite keys and keys nested in objects
+// like Insert, so comparing it with the key returned by InsertReturningKey tells whether the key was generated.
+//
+// Parameters:
+// - record: The record whose key is returned.
+//
+// Returns:
+// - The stored key of the record.
+// - An error wrapping ErrInvalidPrimaryKey if the record has no valid primary key.
+func (t *Table) KeyOf(record Record) (string, error) {
+	return t.primaryKeyOf(record)
+}
+
+// primaryKeyOf returns the primary key under which the record is stored.
+// For a composite key, it converts the values of the key fields with keyString, so the integer 5 and the string "5"
+// are distinct components, and joins them with the key separator. It returns an error if a value is missing,
+// invalid or contains the separator.
+// Otherwise, it converts the value of the primary key field with keyString, which tags the key with its type
+// so keys of different types don't collide. A primary key given as a dotted path is looked up in the nested objects
+// of the record, and an error wrapping ErrInvalidPrimaryKey names the part of the path that is missing.
+func (t *Table) primaryKeyOf(record Record) (string, error) {
+	if t.hasCompositeKey() {
+		values := make([]string, len(t.keyFields))
+		for i, field := range t.keyFields {
+			value, ok := record[field]
+			if !ok || value == nil {
+				return "", fmt.Errorf("%w: primary key field '%s' not found in record", ErrInvalidPrimaryKey, field)
+			}
+			valueStr, err := keyString(value)
+			if err != nil {
+				return "", fmt.Errorf("primary key field '%s': %w", field, err)
+			}
+			if strings.Contains(valueStr, t.keySeparator) {
+				return "", fmt.Errorf("%w: value %q of primary key field '%s' contains the key separator %q, which would make the key ambiguous", ErrInvalidPrimaryKey, valueStr, field, t.keySeparator)
+			}
+			values[i] = valueStr
+		}
+		return strings.Join(values, t.keySeparator), nil
+	}
+
+	if path := t.keyPath(); path != nil {
+		primaryKeyValue, err := lookupPath(record, path)
+		if err != nil {
+			return "", fmt.Errorf("%w: primary key '%s': %v", ErrInvalidPrimaryKey, t.PrimaryKey, err)
+		}
+		return keyString(primaryKeyValue)
+	}
+	primaryKeyValue, ok := record[t.PrimaryKey]
+	if !ok {
+		return "", fmt.Errorf("%w: primary key '%s' not found in record", ErrInvalidPrimaryKey, t.PrimaryKey)
+	}
+	return keyString(primaryKeyValue)
+}
+
+// Type tags of the keys of the records, so keys of different types never collide.
+const (
+	intKeyTag    = "num:"  // Tag of integer keys, and of floats holding an integer
+	floatKeyTag  = "flt:"  // Tag of keys that are floats with a fractional part
+	boolKeyTag   = "bool:" // Tag of boolean keys
+	stringKeyTag = "str:"  // Tag of string keys that would otherwise look like an integer or a tagged key
+)
+
+// keyString returns the canonical string under which a record whose primary key has the given value is stored.
+// The string is tagged with the type of the value, so the integer 1 ("num:1"), the string "1" ("str:1")
+// and the float 1.5 ("flt:1.5") are distinct keys. Floats holding an integer, such as 2.0, are the same key
+// as the integer, since JSON decodes every number as a float. Other strings are stored as they are,
+// unless they start with a tag, so "num:1" is stored as "str:num:1" and doesn't collide with the integer 1.
+// It returns an error wrapping ErrInvalidPrimaryKey if the value is nil, empty or not a string, number or boolean.
+func keyString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", fmt.Errorf("%w: primary key is nil", ErrInvalidPrimaryKey)
+	case string:
+		if v == "" {
+			return "", fmt.Errorf("%w: primary key is empty", ErrInvalidPrimaryKey)
+		}
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil || hasKeyTag(v) {
+			return stringKeyTag + v, nil
+		}
+		return v, nil
+	case bool:
+		return boolKeyTag + strconv.FormatBool(v), nil
+	case float32:
+		return keyString(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("%w: primary key %v is not a finite number", ErrInvalidPrimaryKey, v)
+		}
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return intKeyTag + strconv.FormatInt(int64(v), 10), nil
+		}
+		return floatKeyTag + strconv.FormatFloat(v, 'g', -1, 64), nil
+	case json.Number:
+		if intValue, err := v.Int64(); err == nil {
+			return intKeyTag + strconv.FormatInt(intValue, 10), nil
+		}
+		floatValue, err := v.Float64()
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid number %q", ErrInvalidPrimaryKey, v)
+		}
+		return keyString(floatValue)
+	}
+
+	// Integers of every size are encoded by toProtoValue with the integer tag
+	protoValue, err := toProtoValue(value)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPrimaryKey, err)
+	}
+	if keyStr := protoValue.GetStringValue(); strings.HasPrefix(keyStr, intKeyTag) {
+		return keyStr, nil
+	}
+	return "", fmt.Errorf("%w: primary key of type %T is not a string, number or boolean", ErrInvalidPrimaryKey, value)
+}
+
+// storedKeyValue returns the primary key held by a key in the form returned by keyString, for comparing keys by value:
+// the tagged numbers as a json.Number, the tagged booleans as a bool, and the strings without their tag.
+func storedKeyValue(keyStr string) interface{} {
+	switch {
+	case strings.HasPrefix(keyStr, intKeyTag):
+		return json.Number(strings.TrimPrefix(keyStr, intKeyTag))
+	case strings.HasPrefix(keyStr, floatKeyTag):
+		return json.Number(strings.TrimPrefix(keyStr, floatKeyTag))
+	case strings.HasPrefix(keyStr, boolKeyTag):
+		return strings.TrimPrefix(keyStr, boolKeyTag) == "true"
+	case strings.HasPrefix(keyStr, stringKeyTag):
+		return strings.TrimPrefix(keyStr, stringKeyTag)
+	}
+	return keyStr
+}
+
+// compareKeys compares two stored keys by the primary keys they hold, returning a negative number, zero or a positive number.
+// The keys are ordered like the values sorted by Query, so the integer 9 comes before the integer 10
+// and numbers come before strings. The components of composite keys are compared one at a time, in the order of the key fields.
+func (t *Table) compareKeys(a, b string) int {
+	if t.hasCompositeKey() {
+		aComponents, bComponents := strings.Split(a, t.keySeparator), strings.Split(b, t.keySeparator)
+		for i := 0; i < len(aComponents) && i < len(bComponents); i++ {
+			if cmp := compareSortValues(storedKeyValue(aComponents[i]), storedKeyValue(bComponents[i])); cmp != 0 {
+				return cmp
+			}
+		}
+		if len(aComponents) != len(bComponents) {
+			return len(aComponents) - len(bComponents)
+		}
+	} else if cmp := compareSortValues(storedKeyValue(a), storedKeyValue(b)); cmp != 0 {
+		return cmp
+	}
+	// Distinct keys holding equal values, such as a string and the same string tagged, keep a fixed order
+	return strings.Compare(a, b)
+}
+
+// hasKeyTag reports whether the string starts with one of the type tags of the keys, or with the prefix of blobs.
+func hasKeyTag(s string) bool {
+	for _, tag := range []string{intKeyTag, floatKeyTag, boolKeyTag, stringKeyTag, blobPrefix} {
+		if strings.HasPrefix(s, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveKey returns the key under which the record with the given primary key is stored in the records.
+// The key is first converted with keyString, so Select(1) finds the record with the integer key 1
+// and Select("1") the one with the string key "1". A string that is already a stored key,
+// such as "str:1" returned by KeysByField, is also accepted.
+// For a composite key, a string joining the components as they are written, such as "acme|5", finds the record
+// whose components are the strings or the numbers and booleans they hold, preferring strings like Select("5").
+// If no record matches, it returns the canonical key, or the string form of the key if it is invalid, for error messages.
+func (t *Table) resolveKey(records map[string]*dbdata.Record, key interface{}) string {
+	keyStr, err := keyString(key)
+	if err == nil {
+		if _, exists := records[keyStr]; exists {
+			return keyStr
+		}
+	}
+	if stored, ok := key.(string); ok {
+		if _, exists := records[stored]; exists {
+			return stored
+		}
+		// Keys given as strings, such as the keys of the HTTP API and the SQL statements, also find the records
+		// whose key is the number or boolean the string holds, so Select("5") finds the record with the integer key 5
+		// when there is no record with the string key "5"
+		if typed, ok := typedKeyOf(stored); ok {
+			if _, exists := records[typed]; exists {
+				return typed
+			}
+		}
+		if composite, ok := t.resolveCompositeKey(records, stored); ok {
+			return composite
+		}
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", key)
+	}
+	return keyStr
+}
+
+// resolveCompositeKey returns the stored composite key of the records matching the components joined in the string,
+// trying each component as a string first, then as the number or boolean it holds, and reports whether one matches.
+func (t *Table) resolveCompositeKey(records map[string]*dbdata.Record, s string) (string, bool) {
+	if !t.hasCompositeKey() {
+		return "", false
+	}
+	components := strings.Split(s, t.keySeparator)
+	if len(components) != len(t.keyFields) {
+		return "", false
+	}
+	candidates := make([][]string, len(components))
+	for i, component := range components {
+		keyStr, err := keyString(component)
+		if err != nil {
+			return "", false
+		}
+		candidates[i] = []string{keyStr}
+		if typed, ok := typedKeyOf(component); ok {
+			candidates[i] = append(candidates[i], typed)
+		}
+	}
+
+	var found string
+	var try func(i int, prefix []string) bool
+	try = func(i int, prefix []string) bool {
+		if i == len(candidates) {
+			found = strings.Join(prefix, t.keySeparator)
+			_, exists := records[found]
+			return exists
+		}
+		for _, candidate := range candidates[i] {
+			if try(i+1, append(prefix, candidate)) {
+				return true
+			}
+		}
+		return false
+	}
+	if try(0, make([]string, 0, len(candidates))) {
+		return found, true
+	}
+	return "", false
+}
+
+// typedKeyOf returns the key of a record whose primary key is the number or boolean held by the string,
+// and reports whether the string holds one.
+func typedKeyOf(s string) (string, bool) {
+	switch s {
+	case "true", "false":
+		return boolKeyTag + s, true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return "", false
+	}
+	keyStr, err := keyString(json.Number(s))
+	if err != nil {
+		return "", false
+	}
+	return keyStr, true
+}
+
+// canonicalizeKeys moves the records stored under a key other than the one primaryKeyOf returns for them,
+// such as the records written by the versions that didn't tag keys with their type, under their canonical key.
+// This way, a record with the integer key 5 stored under "5" is found by Select(5) and conflicts with the insert
+// of another record with the key 5, instead of being duplicated. A record whose canonical key is already taken,
+// or whose key can't be computed, is left where it is.
+// It returns the number of records moved, which are written under their new key by the next write of the table.
+func (t *Table) canonicalizeKeys(records *dbdata.Records) int {
+	moved := 0
+	for key, record := range records.GetRecords() {
+		canonical, err := t.canonicalKeyOf(record)
+		if err != nil || canonical == key {
+			continue
+		}
+		if _, taken := records.Records[canonical]; taken {
+			continue
+		}
+		// The stored record of a composite key carries its key, written by the versions that didn't tag the components
+		if t.hasCompositeKey() {
+			if value, err := toProtoValue(canonical); err == nil {
+				record.Fields[t.PrimaryKey] = value
+			}
+		}
+		delete(records.Records, key)
+		records.Records[canonical] = record
+		moved++
+	}
+	return moved
+}
+
+// canonicalKeyOf returns the key under which the stored record belongs, decoding only the fields of its primary key.
+func (t *Table) canonicalKeyOf(record *dbdata.Record) (string, error) {
+	fields := t.keyFields
+	if !t.hasCompositeKey() {
+		fields = []string{t.keyRoot()}
+	}
+	keyRecord := make(Record, len(fields))
+	for _, field := range fields {
+		value, ok := record.GetFields()[field]
+		if !ok {
+			continue
+		}
+		decoded, err := fromProtoValue(value)
+		if err != nil {
+			return "", err
+		}
+		keyRecord[field] = decoded
+	}
+	return t.primaryKeyOf(keyRecord)
+}
+
+// keyedRecord returns the record with its primary key field set to the given key when the table has a composite key,
+// so the stored record always carries its key. The given record is not modified.
+func (t *Table) keyedRecord(record Record, key string) Record {
+	if !t.hasCompositeKey() {
+		return record
+	}
+	keyed := make(Record, len(record)+1)
+	for field, value := range record {
+		keyed[field] = value
+	}
+	keyed[t.PrimaryKey] = key
+	return keyed
+}
+
+// checkKeyUnchanged returns ErrPrimaryKeyChange if applying the updates to the existing record stored under the key
+// would change its primary key. Updates that set the key fields to their current values are allowed.
+func (t *Table) checkKeyUnchanged(key string, existingRecord *dbdata.Record, updates Record) error {
+	touchesKey := false
+	if _, ok := updates[t.keyRoot()]; ok {
+		touchesKey = true
+	}
+	for _, field := range t.keyFields {
+		if _, ok := updates[field]; ok {
+			touchesKey = true
+		}
+	}
+	if !touchesKey {
+		return nil
+	}
+
+	updatedRecord, err := fromProtoRecord(existingRecord)
+	if err != nil {
+		return err
+	}
+	for field, value := range updates {
+		updatedRecord[field] = value
+	}
+
+	if t.hasCompositeKey() {
+		// The key field holds the stored key, which may be given as the components are written, like to Select
+		if value, ok := updates[t.PrimaryKey]; ok && t.resolveKey(map[string]*dbdata.Record{key: existingRecord}, value) != key {
+			return fmt.Errorf("%w: field '%s' of record with key %s", ErrPrimaryKeyChange, t.PrimaryKey, key)
+		}
+	}
+	newKey, err := t.primaryKeyOf(updatedRecord)
+	if err != nil || newKey != key {
+		return fmt.Errorf("%w: record with key %s", ErrPrimaryKeyChange, key)
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+func TestIntegerAndStringKeysAreDistinct(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": 1, "name": "integer"},
+		Record{"id": "1", "name": "string"},
+	)
+
+	count, err := table.Count()
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("Count = %d, want 2", count)
+	}
+
+	tests := []struct {
+		key  interface{}
+		want string
+	}{
+		{1, "integer"},
+		{int64(1), "integer"},
+		{1.0, "integer"},
+		{"1", "string"},
+	}
+	for _, tt := range tests {
+		record, err := table.Select(tt.key)
+		if err != nil {
+			t.Fatalf("Select(%#v) failed: %v", tt.key, err)
+		}
+		if record["name"] != tt.want {
+			t.Errorf("Select(%#v) name = %v, want %s", tt.key, record["name"], tt.want)
+		}
+	}
+
+	if err := table.Delete("1"); err != nil {
+		t.Fatalf("Delete(\"1\") failed: %v", err)
+	}
+	if _, err := table.Select(1); err != nil {
+		t.Fatalf("Delete(\"1\") removed the integer key: %v", err)
+	}
+}
+
+func TestStringKeyResolvesToTypedKey(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": 5, "name": "five"},
+		Record{"id": 2.5, "name": "two and a half"},
+		Record{"id": true, "name": "yes"},
+	)
+
+	for key, want := range map[string]string{"5": "five", "2.5": "two and a half", "true": "yes"} {
+		record, err := table.Select(key)
+		if err != nil {
+			t.Fatalf("Select(%q) failed: %v", key, err)
+		}
+		if record["name"] != want {
+			t.Errorf("Select(%q) name = %v, want %s", key, record["name"], want)
+		}
+	}
+
+	if err := table.Update("5", Record{"name": "updated"}); err != nil {
+		t.Fatalf("Update(\"5\") failed: %v", err)
+	}
+	record, err := table.Select(5)
+	if err != nil {
+		t.Fatalf("Select(5) failed: %v", err)
+	}
+	if record["name"] != "updated" {
+		t.Errorf("name after Update(\"5\") = %v, want updated", record["name"])
+	}
+
+	if err := table.Delete("5"); err != nil {
+		t.Fatalf("Delete(\"5\") failed: %v", err)
+	}
+	if _, err := table.Select(5); err == nil {
+		t.Error("Select(5) after Delete(\"5\") succeeded, want an error")
+	}
+}
+
+func TestKeyStringTags(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{1, "num:1"},
+		{int64(-7), "num:-7"},
+		{2.0, "num:2"},
+		{1.5, "flt:1.5"},
+		{"1", "str:1"},
+		{"num:1", "str:num:1"},
+		{"abc", "abc"},
+		{true, "bool:true"},
+	}
+	for _, tt := range tests {
+		got, err := keyString(tt.value)
+		if err != nil {
+			t.Fatalf("keyString(%#v) failed: %v", tt.value, err)
+		}
+		if got != tt.want {
+			t.Errorf("keyString(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []interface{}{nil, "", []int{1}} {
+		if _, err := keyString(value); err == nil {
+			t.Errorf("keyString(%#v) succeeded, want an error", value)
+		}
+	}
+}
+
+// writeLegacyRecords writes the records to the files of the table under the given keys, as the versions
+// that didn't tag keys with their type did.
+func writeLegacyRecords(t *testing.T, table *Table, records map[string]Record) {
+	t.Helper()
+	legacy := &dbdata.Records{Records: make(map[string]*dbdata.Record)}
+	for key, record := range records {
+		protoRecord, err := toProtoRecord(record)
+		if err != nil {
+			t.Fatalf("toProtoRecord failed: %v", err)
+		}
+		legacy.Records[key] = protoRecord
+	}
+	table.resetRecordFiles(false)
+	if err := table.writeFile(legacy); err != nil {
+		t.Fatalf("writeFile failed: %v", err)
+	}
+}
+
+func TestLegacyKeysAreMigrated(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "table.bin")
+	writeLegacyRecords(t, openTestTable(t, "id", filePath), map[string]Record{
+		"5":     {"id": 5, "name": "legacy"},
+		"other": {"id": "other", "name": "untouched"},
+	})
+
+	table := openTestTable(t, "id", filePath)
+	record, err := table.Select(5)
+	if err != nil {
+		t.Fatalf("Select(5) of a legacy key failed: %v", err)
+	}
+	if record["name"] != "legacy" {
+		t.Errorf("name = %v, want legacy", record["name"])
+	}
+	if err := table.Insert(Record{"id": 5, "name": "duplicate"}); err == nil {
+		t.Fatal("Insert of an existing legacy key succeeded, want a conflict")
+	}
+
+	mustInsert(t, table, Record{"id": 6, "name": "new"})
+	data, err := table.readData()
+	if err != nil {
+		t.Fatalf("readData failed: %v", err)
+	}
+	stored, err := table.decodeRecords(data)
+	if err != nil {
+		t.Fatalf("decodeRecords failed: %v", err)
+	}
+	for _, key := range []string{"num:5", "num:6", "other"} {
+		if _, ok := stored.Records[key]; !ok {
+			t.Errorf("file has no record under %q after the next write, keys: %v", key, keysOf(stored))
+		}
+	}
+	if _, ok := stored.Records["5"]; ok {
+		t.Error("file still holds the legacy key \"5\" after the next write")
+	}
+}
+
+func TestLegacyKeysAreMigratedFilePerRecord(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "table.bin")
+	writeLegacyRecords(t, openTestTable(t, "id", filePath, WithFilePerRecord()), map[string]Record{
+		"5": {"id": 5, "name": "legacy"},
+	})
+
+	table := openTestTable(t, "id", filePath, WithFilePerRecord())
+	mustInsert(t, table, Record{"id": 6, "name": "new"})
+
+	dir := recordsDirPath(filePath)
+	if _, err := os.Stat(filepath.Join(dir, recordFileName("5"))); !os.IsNotExist(err) {
+		t.Errorf("file of the legacy key still exists after the next write: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, recordFileName("num:5"))); err != nil {
+		t.Errorf("file of the migrated key is missing: %v", err)
+	}
+
+	reopened := openTestTable(t, "id", filePath, WithFilePerRecord())
+	count, err := reopened.Count()
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Count after reopening = %d, want 2", count)
+	}
+}
+
+// keysOf returns the keys of the records, for error messages.
+func keysOf(records *dbdata.Records) []string {
+	keys := make([]string, 0, len(records.Records))
+	for key := range records.Records {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestCompositeKeySeparator(t *testing.T) {
+	table := newTestTable(t, "pk", WithCompositeKey("tenant", "id"))
+	mustInsert(t, table, Record{"tenant": "acme", "id": "1", "name": "first"})
+
+	record, err := table.Select("acme|1")
+	if err != nil {
+		t.Fatalf("Select of the composite key failed: %v", err)
+	}
+	// The string "1" is tagged like a string primary key, so it doesn't collide with the integer 1
+	if record["pk"] != "acme|str:1" || record["name"] != "first" {
+		t.Errorf("Select = %v, want the record stored under acme|str:1", record)
+	}
+
+	// ("a|b", "c") and ("a", "b|c") would both be stored under a|b|c
+	for _, value := range []Record{{"tenant": "a|b", "id": "c"}, {"tenant": "a", "id": "b|c"}} {
+		if err := table.Insert(value); !errors.Is(err, ErrInvalidPrimaryKey) {
+			t.Errorf("Insert(%v) returned %v, want ErrInvalidPrimaryKey", value, err)
+		}
+	}
+	if err := table.Insert(Record{"tenant": "acme"}); !errors.Is(err, ErrInvalidPrimaryKey) {
+		t.Errorf("Insert without a key field returned %v, want ErrInvalidPrimaryKey", err)
+	}
+}
+
+func TestCompositeKeyComponentsKeepTheirType(t *testing.T) {
+	table := newTestTable(t, "pk", WithCompositeKey("tenant", "id"))
+	mustInsert(t, table,
+		Record{"tenant": "acme", "id": 5, "name": "integer"},
+		Record{"tenant": "acme", "id": "5", "name": "string"},
+		Record{"tenant": "acme", "id": 7, "name": "only integer"},
+	)
+	if count, err := table.Count(); err != nil || count != 3 {
+		t.Fatalf("Count = %d, %v, want the integer and string ids stored apart", count, err)
+	}
+
+	// The components given as they are written find the string first, then the number they hold
+	for key, want := range map[string]string{
+		"acme|5":     "string",
+		"acme|str:5": "string",
+		"acme|num:5": "integer",
+		"acme|7":     "only integer",
+	} {
+		record, err := table.Select(key)
+		if err != nil {
+			t.Fatalf("Select(%s) failed: %v", key, err)
+		}
+		if record["name"] != want {
+			t.Errorf("Select(%s) name = %v, want %s", key, record["name"], want)
+		}
+	}
+
+	// Setting the key field to the key of the record is not a change, in either form
+	for _, key := range []string{"acme|7", "acme|num:7"} {
+		if err := table.Update("acme|7", Record{"pk": key, "name": "updated"}); err != nil {
+			t.Errorf("Update keeping the key %s failed: %v", key, err)
+		}
+	}
+	if err := table.Update("acme|7", Record{"id": "7"}); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("Update of the integer id to a string returned %v, want ErrPrimaryKeyChange", err)
+	}
+	if err := table.Update("acme|num:5", Record{"pk": "acme|str:5"}); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("Update of the key to the one of the string id returned %v, want ErrPrimaryKeyChange", err)
+	}
+}
+
+func TestCustomKeySeparator(t *testing.T) {
+	table := newTestTable(t, "pk", WithCompositeKey("tenant", "id"), WithKeySeparator("::"))
+	mustInsert(t, table,
+		Record{"tenant": "a|b", "id": "c", "name": "first"},
+		Record{"tenant": "a", "id": "b|c", "name": "second"},
+	)
+
+	for key, want := range map[string]string{"a|b::c": "first", "a::b|c": "second"} {
+		record, err := table.Select(key)
+		if err != nil {
+			t.Fatalf("Select(%s) failed: %v", key, err)
+		}
+		if record["name"] != want {
+			t.Errorf("Select(%s) name = %v, want %s", key, record["name"], want)
+		}
+	}
+	if err := table.Insert(Record{"tenant": "a::b", "id": "c"}); !errors.Is(err, ErrInvalidPrimaryKey) {
+		t.Errorf("Insert of a value holding the separator returned %v, want ErrInvalidPrimaryKey", err)
+	}
+}
+
+func TestPrimaryKeyIsImmutable(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "name": "Ana"})
+
+	if err := table.Update("a", Record{"id": "b"}); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("Update changing the key returned %v, want ErrPrimaryKeyChange", err)
+	}
+	errs := table.UpdateMany(map[string]Record{"a": {"id": "c", "name": "changed"}})
+	if len(errs) != 1 || !errors.Is(errs[0], ErrPrimaryKeyChange) {
+		t.Errorf("UpdateMany changing the key returned %v, want ErrPrimaryKeyChange", errs)
+	}
+	if _, err := table.Increment("a", "id", 1); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("Increment of the key returned %v, want ErrPrimaryKeyChange", err)
+	}
+
+	// Setting the key to its current value is not a change
+	if err := table.Update("a", Record{"id": "a", "name": "Ana B"}); err != nil {
+		t.Fatalf("Update keeping the key failed: %v", err)
+	}
+	record, err := table.Select("a")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["name"] != "Ana B" {
+		t.Errorf("name = %v, want Ana B", record["name"])
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, err := table.Select(key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Select(%s) returned %v, want ErrNotFound", key, err)
+		}
+	}
+}
+
+func TestCompositeKeyIsImmutable(t *testing.T) {
+	table := newTestTable(t, "pk", WithCompositeKey("tenant", "id"))
+	mustInsert(t, table, Record{"tenant": "acme", "id": "1"})
+
+	if err := table.Update("acme|1", Record{"tenant": "other"}); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("Update of a key field returned %v, want ErrPrimaryKeyChange", err)
+	}
+	if err := table.Update("acme|1", Record{"pk": "other|1"}); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("Update of the key returned %v, want ErrPrimaryKeyChange", err)
+	}
+}
+
+func TestNestedPrimaryKey(t *testing.T) {
+	table := newTestTable(t, "meta.id")
+	mustInsert(t, table,
+		Record{"meta": map[string]interface{}{"id": "a1", "rev": 1}, "name": "x"},
+		Record{"meta": map[string]interface{}{"id": 7}, "name": "y"},
+	)
+
+	record, err := table.Select("a1")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["name"] != "x" {
+		t.Errorf("Select(a1) = %v, want the record named x", record)
+	}
+	if _, err := table.Select(7); err != nil {
+		t.Errorf("Select of the integer key 7 failed: %v", err)
+	}
+
+	for _, bad := range []Record{
+		{"name": "no meta"},
+		{"meta": map[string]interface{}{"rev": 2}},
+		{"meta": "not an object"},
+	} {
+		if err := table.Insert(bad); !errors.Is(err, ErrInvalidPrimaryKey) {
+			t.Errorf("Insert(%v) = %v, want ErrInvalidPrimaryKey", bad, err)
+		}
+	}
+
+	// The object holding the key may be rewritten only if it keeps the key
+	if err := table.Update("a1", Record{"name": "z"}); err != nil {
+		t.Errorf("Update of another field failed: %v", err)
+	}
+	if err := table.Update("a1", Record{"meta": map[string]interface{}{"id": "a1", "rev": 2}}); err != nil {
+		t.Errorf("Update keeping the nested key failed: %v", err)
+	}
+	if err := table.Update("a1", Record{"meta": map[string]interface{}{"id": "a2"}}); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("Update changing the nested key = %v, want ErrPrimaryKeyChange", err)
+	}
+	if err := table.Replace("a1", Record{"name": "w"}); err != nil {
+		t.Errorf("Replace without the object holding the key failed: %v", err)
+	}
+	record, err = table.Select("a1")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	meta, _ := record["meta"].(map[string]interface{})
+	if record["name"] != "w" || meta["id"] != "a1" || meta["rev"] != float64(2) {
+		t.Errorf("record after the writes = %v, want name w and the kept meta object", record)
+	}
+
+	if err := table.Delete("a1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := table.Select("a1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Select after Delete = %v, want ErrNotFound", err)
+	}
+
+	if ValidKeyPath("meta..id") || ValidKeyPath("meta/id") || !ValidKeyPath("meta.id") {
+		t.Error("ValidKeyPath accepted an invalid path or rejected meta.id")
+	}
+}
+
+func TestUUIDKeysAreSavedWithTheTable(t *testing.T) {
+	dir := t.TempDir()
+	open := func() *Server {
+		server, err := NewServerWithConfig(Config{Dir: dir, BackupDir: t.TempDir(), AESKey: testAESKey})
+		if err != nil {
+			t.Fatalf("NewServerWithConfig failed: %v", err)
+		}
+		if err := server.Initialize(); err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+		return server
+	}
+
+	server := open()
+	if err := server.CreateDatabase("shop"); err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	if err := server.Databases["shop"].CreateTable("orders", "id", WithUUIDKeys()); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	if err := server.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	server = open()
+	defer server.Close()
+	table := server.Databases["shop"].Tables["orders"]
+	first, err := table.InsertReturningKey(context.Background(), Record{"item": "book"})
+	if err != nil {
+		t.Fatalf("InsertReturningKey after reopening failed: %v", err)
+	}
+	second, err := table.InsertReturningKey(context.Background(), Record{"item": "pen"})
+	if err != nil {
+		t.Fatalf("InsertReturningKey failed: %v", err)
+	}
+	if len(first) != 36 || first == second {
+		t.Errorf("generated keys = %q and %q, want two distinct UUIDs", first, second)
+	}
+	if record, err := table.Select(first); err != nil || record["id"] != first || record["item"] != "book" {
+		t.Errorf("Select(%q) = %v, %v, want the record with its generated key", first, record, err)
+	}
+}
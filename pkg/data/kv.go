@@ -0,0 +1,125 @@
+package data
+
+import (
+	"fmt"
+)
+
+// Fields of the records of the table of a KV.
+const (
+	KVKeyField   = "key"   // Primary key field, holding the key
+	KVValueField = "value" // Field holding the value
+)
+
+// kvSchema is the schema of the tables created by Database.KV.
+var kvSchema = Schema{
+	KVKeyField:   {Type: TypeString, Required: true},
+	KVValueField: {Type: TypeString, Required: true},
+}
+
+// KV is a persistent, encrypted map of string keys to string values, stored in a table whose records
+// have two fields: the primary key field KVKeyField and the field KVValueField.
+// It is a thin wrapper over the methods of the table, which can still be used directly, for example to back it up.
+//
+// For example:
+//
+//	kv, err := db.KV("settings")
+//	if err != nil {
+//		return err
+//	}
+//	if err := kv.Set("theme", "dark"); err != nil {
+//		return err
+//	}
+//	theme, err := kv.Get("theme") // "dark"
+type KV struct {
+	table *Table // Table storing the pairs
+}
+
+// NewKV is a constructor function for the KV struct that stores the pairs in the given table.
+//
+// Parameters:
+// - table: The table storing the pairs, whose primary key must be KVKeyField.
+//
+// Returns:
+// - A pointer to a new KV instance.
+// - An error, if the primary key of the table is not KVKeyField.
+func NewKV(table *Table) (*KV, error) {
+	if table.PrimaryKey != KVKeyField || table.hasCompositeKey() {
+		return nil, fmt.Errorf("the primary key of a key-value table must be %s, not %s", KVKeyField, table.PrimaryKey)
+	}
+	return &KV{table: table}, nil
+}
+
+// KV is a method of the Database struct that returns the KV stored in the table with the given name,
+// creating the table with the primary key KVKeyField and a schema of two string fields if it does not exist.
+//
+// Parameters:
+// - name: The name of the table storing the pairs.
+//
+// Returns:
+// - A pointer to the KV.
+// - An error, if the table exists with another primary key, the name is invalid or an error occurs while creating the table.
+func (db *Database) KV(name string) (*KV, error) {
+	if !ValidFilename(name) {
+		return nil, fmt.Errorf("invalid table name: %s", name)
+	}
+
+	db.Lock()
+	defer db.Unlock()
+	table, exists := db.Tables[name]
+	if !exists {
+		var err error
+		if table, err = db.createTableLocked(name, KVKeyField, WithSchema(kvSchema)); err != nil {
+			return nil, err
+		}
+	}
+	return NewKV(table)
+}
+
+// Table is a method of the KV struct that returns the table storing the pairs.
+func (kv *KV) Table() *Table {
+	return kv.table
+}
+
+// Get is a method of the KV struct that returns the value stored under the key.
+//
+// Parameters:
+// - key: The key of the value.
+//
+// Returns:
+// - The value stored under the key.
+// - An error wrapping ErrNotFound if no value is stored under the key, or any error that occurs while reading the table.
+func (kv *KV) Get(key string) (string, error) {
+	record, err := kv.table.Select(key)
+	if err != nil {
+		return "", err
+	}
+	value, ok := record[KVValueField].(string)
+	if !ok {
+		return "", fmt.Errorf("value of key %s is a %T, not a string", key, record[KVValueField])
+	}
+	return value, nil
+}
+
+// Set is a method of the KV struct that stores the value under the key, replacing the previous value, if any.
+//
+// Parameters:
+// - key: The key of the value, which must not be empty.
+// - value: The value to store.
+//
+// Returns:
+// - An error, if the key is empty or an error occurs while writing the table.
+func (kv *KV) Set(key, value string) error {
+	_, err := kv.table.InsertWithMode(Record{KVKeyField: key, KVValueField: value}, InsertReplace)
+	return err
+}
+
+// Delete is a method of the KV struct that deletes the value stored under the key.
+//
+// Parameters:
+// - key: The key of the value.
+//
+// Returns:
+// - An error wrapping ErrNotFound if no value is stored under the key, or any error that occurs while writing the table.
+func (kv *KV) Delete(key string) error {
+	return kv.table.Delete(key)
+}
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLockTimeout is returned by the context-aware operations when the table lock could not be acquired
+// before the context was done, for example because a long write holds the lock.
+var ErrLockTimeout = errors.New("timed out waiting for the table lock")
+
+// Bounds of the wait between two attempts to acquire the table lock.
+const (
+	minLockRetryInterval = 50 * time.Microsecond
+	maxLockRetryInterval = 5 * time.Millisecond
+)
+
+// lockContext locks the table for writing, giving up when the context is done.
+// sync.RWMutex can't be canceled while waiting, so it polls TryLock with an exponential backoff until it succeeds
+// or the context is done, in which case it returns an error wrapping ErrLockTimeout.
+// It returns an error wrapping ErrTriggerReentrant without waiting if the context is the one of a trigger of a write
+// holding the lock of the table.
+func (t *Table) lockContext(ctx context.Context) error {
+	if err := t.checkTriggerWrite(ctx); err != nil {
+		return err
+	}
+	if t.TryLock() {
+		return nil
+	}
+
+	interval := minLockRetryInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			t.metrics.IncrementLockTimeouts()
+			return fmt.Errorf("%w: %v", ErrLockTimeout, ctx.Err())
+		case <-timer.C:
+		}
+		if t.TryLock() {
+			return nil
+		}
+		if interval < maxLockRetryInterval {
+			interval *= 2
+		}
+		timer.Reset(interval)
+	}
+}
+
+// InsertContext is a method of the Table struct that inserts a new record into the table like Insert,
+// but gives up waiting for the table lock when the context is done.
+// This bounds the time a caller such as an HTTP handler can be blocked by other writers.
+//
+// Parameters:
+// - ctx: A context whose deadline or cancellation bounds the wait for the table lock.
+// - record: A map representing the record to be inserted. The keys are field names and the values are the field values.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the lock could not be acquired in time, it returns an error wrapping ErrLockTimeout.
+// - If another error occurs, it returns the error.
+func (t *Table) InsertContext(ctx context.Context, record Record) error {
+	_, err := t.InsertReturningKey(ctx, record)
+	return err
+}
+
+// InsertReturningKey is a method of the Table struct that inserts a record like InsertContext
+// and returns the key it is stored under, which is the generated key for a record inserted without a primary key
+// into a table with a key generator, see WithKeyGenerator and WithUUIDKeys.
+//
+// Parameters:
+// - ctx: A context whose deadline or cancellation bounds the wait for the table lock.
+// - record: A map representing the record to be inserted.
+//
+// Returns:
+// - The key of the inserted record, in the stored form accepted by Select, such as the generated UUID.
+// - If the lock could not be acquired in time, an error wrapping ErrLockTimeout.
+// - If another error occurs, the error.
+func (t *Table) InsertReturningKey(ctx context.Context, record Record) (string, error) {
+	unlockRecord, err := t.lockInserted(ctx, record)
+	if err != nil {
+		return "", err
+	}
+	if err := t.lockContext(ctx); err != nil {
+		unlockRecord()
+		return "", err
+	}
+	var key string
+	err = t.withRecordTriggers(ctx, unlockRecord, func() (err error) {
+		defer t.withActor(ctx)()
+		key, _, err = t.insertLocked(record, InsertError)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// UpdateContext is a method of the Table struct that updates a record in the table like Update,
+// but gives up waiting for the table lock when the context is done.
+//
+// Parameters:
+// - ctx: A context whose deadline or cancellation bounds the wait for the table lock.
+// - key: An interface{} representing the key of the record to be updated.
+// - updates: A map representing the fields to be updated in the record.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the lock could not be acquired in time, it returns an error wrapping ErrLockTimeout.
+// - If another error occurs, it returns the error.
+func (t *Table) UpdateContext(ctx context.Context, key interface{}, updates Record) error {
+	unlockRecord, err := t.lockRecord(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := t.lockContext(ctx); err != nil {
+		unlockRecord()
+		return err
+	}
+	return t.withRecordTriggers(ctx, unlockRecord, func() error {
+		defer t.withActor(ctx)()
+		return t.updateLocked(key, updates)
+	})
+}
+
+// DeleteContext is a method of the Table struct that deletes a record from the table like Delete,
+// but gives up waiting for the table lock when the context is done.
+//
+// Parameters:
+// - ctx: A context whose deadline or cancellation bounds the wait for the table lock.
+// - key: An interface{} representing the key of the record to be deleted.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the lock could not be acquired in time, it returns an error wrapping ErrLockTimeout.
+// - If another error occurs, it returns the error.
+func (t *Table) DeleteContext(ctx context.Context, key interface{}) error {
+	unlockRecord, err := t.lockRecord(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := t.lockContext(ctx); err != nil {
+		unlockRecord()
+		return err
+	}
+	return t.withRecordTriggers(ctx, unlockRecord, func() error {
+		defer t.withActor(ctx)()
+		return t.deleteLocked(key)
+	})
+}
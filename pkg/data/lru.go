@@ -0,0 +1,189 @@
+package data
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// tableLRU keeps track of the tables whose records are resident in memory ("hot" tables) in least-recently-used order.
+// When more tables than its capacity are hot, the least recently used ones are evicted: their pending writes are
+// flushed and their in-memory records, cache and indexes are released. An evicted table is reloaded lazily from
+// its file on the next access, so eviction is transparent to callers apart from the cost of the reload.
+type tableLRU struct {
+	sync.Mutex                          // Mutex to ensure the LRU is thread safe
+	capacity   int                      // Maximum number of hot tables
+	order      *list.List               // Hot tables, most recently used first
+	elements   map[*Table]*list.Element // Map of hot tables to their element in order
+}
+
+// newTableLRU creates an LRU that keeps at most capacity tables hot.
+func newTableLRU(capacity int) *tableLRU {
+	return &tableLRU{
+		capacity: capacity,
+		order:    list.New(),
+		elements: make(map[*Table]*list.Element),
+	}
+}
+
+// touch marks the table as the most recently used one and evicts the least recently used tables beyond the capacity.
+// Victims are evicted before touch returns, but only if no one holds their lock: a locked table is in use,
+// so it is kept hot and tried again on the next touch. Waiting for the lock instead could deadlock
+// with a goroutine holding that lock and touching this table.
+func (l *tableLRU) touch(t *Table) {
+	l.Lock()
+	if element, exists := l.elements[t]; exists {
+		l.order.MoveToFront(element)
+	} else {
+		l.elements[t] = l.order.PushFront(t)
+	}
+
+	var victims []*Table
+	for l.order.Len() > l.capacity {
+		element := l.order.Back()
+		victim := element.Value.(*Table)
+		l.order.Remove(element)
+		delete(l.elements, victim)
+		victims = append(victims, victim)
+	}
+	l.Unlock()
+
+	for _, victim := range victims {
+		if !victim.TryLock() {
+			l.requeue(victim)
+			continue
+		}
+		// A victim touched again since it was picked is hot again, so it is left in memory
+		if !l.tracked(victim) {
+			victim.evictLocked()
+		}
+		victim.Unlock()
+	}
+}
+
+// requeue tracks again a victim that could not be evicted, as the least recently used table,
+// unless it was touched again in the meantime.
+func (l *tableLRU) requeue(t *Table) {
+	l.Lock()
+	defer l.Unlock()
+	if _, exists := l.elements[t]; !exists {
+		l.elements[t] = l.order.PushBack(t)
+	}
+}
+
+// tracked reports whether the table is counted as hot.
+func (l *tableLRU) tracked(t *Table) bool {
+	l.Lock()
+	defer l.Unlock()
+	_, exists := l.elements[t]
+	return exists
+}
+
+// remove stops tracking the table, which is neither evicted nor counted as hot anymore.
+func (l *tableLRU) remove(t *Table) {
+	l.Lock()
+	defer l.Unlock()
+	if element, exists := l.elements[t]; exists {
+		l.order.Remove(element)
+		delete(l.elements, t)
+	}
+}
+
+// touch notifies the LRU of the table, if any, that the table is being accessed.
+func (t *Table) touch() {
+	if t.lru != nil {
+		t.lru.touch(t)
+	}
+}
+
+// evictLocked flushes the pending writes of the table and releases its in-memory records, cache and indexes.
+// They are reloaded from the file on the next access. The table must be locked for writing.
+func (t *Table) evictLocked() {
+	if err := t.flushLocked(); err != nil {
+		log.Printf("Failed to flush file %s before eviction, keeping the table in memory: %v", t.FilePath, err)
+		return
+	}
+	if t.dirty.Swap(false) {
+		if err := t.syncFile(); err != nil {
+			t.dirty.Store(true)
+			log.Printf("Failed to sync file %s before eviction: %v", t.FilePath, err)
+		}
+	}
+
+	t.loaded.Store(false)
+	t.snapshot.Store(nil)
+	t.Records = make(map[string]*dbdata.Record)
+	t.Cache = make(map[string]*dbdata.Record)
+	t.resetRecordFiles(false)
+	t.rebuildIndexes(nil)
+}
+
+// rlockLoaded locks the table for reading once its records and indexes are loaded, reloading them from the file
+// if the table was evicted from memory, and returns the current snapshot of the records.
+// The table can't be evicted while the read lock is held, so the snapshot and the indexes stay consistent
+// until the caller unlocks the table. If an error is returned, the table is not locked.
+// It must be called without holding the table lock.
+func (t *Table) rlockLoaded() (*dbdata.Records, error) {
+	t.touch()
+	for {
+		t.RLock()
+		if t.loaded.Load() {
+			records, err := t.snapshotLocked()
+			if err != nil {
+				t.RUnlock()
+				return nil, err
+			}
+			return records, nil
+		}
+		t.RUnlock()
+
+		// The table may be evicted again between the reload and the next read lock, in which case it is reloaded again
+		t.Lock()
+		if !t.loaded.Load() {
+			if err := t.LoadIndexes(); err != nil {
+				t.Unlock()
+				return nil, err
+			}
+		}
+		t.Unlock()
+	}
+}
+
+// loadForWrite reads the records from the file for a write operation,
+// rebuilding the indexes from them if the table was evicted from memory.
+// The table must be locked for writing.
+func (t *Table) loadForWrite() (*dbdata.Records, error) {
+	if t.readOnly {
+		return nil, fmt.Errorf("%w: can't write table %s", ErrReadOnly, t.FilePath)
+	}
+	t.touch()
+	if t.flushTimer != nil || ((t.perRecord || t.appendMax > 0 || t.recordLocks != nil) && t.snapshot.Load() != nil) {
+		// The file is behind the records until the pending flush or group commit, so start from the latest records instead.
+		// Files per record and append logs are not read back either, since reading every file would cost more than the write saves.
+		// The records are shared with the snapshot, so writes must replace a record instead of modifying it
+		return copyRecords(t.snapshot.Load()), nil
+	}
+	records, err := t.readRecordsFromFile()
+	if err != nil {
+		return nil, err
+	}
+	if !t.loaded.Load() {
+		t.rebuildIndexes(records.GetRecords())
+		t.resetRecordFiles(true)
+		t.loaded.Store(true)
+	}
+	return records, nil
+}
+
+// copyRecords returns a new Records message with the same records as the given one, which may be nil.
+// The map is copied but the records are shared, so they must be replaced, not modified, in the copy.
+func copyRecords(records *dbdata.Records) *dbdata.Records {
+	copied := &dbdata.Records{Records: make(map[string]*dbdata.Record, len(records.GetRecords()))}
+	for key, record := range records.GetRecords() {
+		copied.Records[key] = record
+	}
+	return copied
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"sync"
+	"testing"
+)
+
+// newHotTables creates a database keeping a single table hot, with two tables "a" and "b" indexed by city.
+func newHotTables(t *testing.T) (*Table, *Table) {
+	t.Helper()
+	db := newTestDatabase(t)
+	db.lru = newTableLRU(1)
+	tables := make([]*Table, 0, 2)
+	for _, name := range []string{"a", "b"} {
+		if err := db.CreateTable(name, "id"); err != nil {
+			t.Fatalf("CreateTable(%s) failed: %v", name, err)
+		}
+		table := db.Tables[name]
+		if err := table.CreateIndex("city"); err != nil {
+			t.Fatalf("CreateIndex failed: %v", err)
+		}
+		mustInsert(t, table,
+			Record{"id": "1", "city": "Lima"},
+			Record{"id": "2", "city": "Lima"},
+			Record{"id": "3", "city": "Cusco"},
+		)
+		tables = append(tables, table)
+	}
+	return tables[0], tables[1]
+}
+
+func TestTouchEvictsSynchronously(t *testing.T) {
+	a, b := newHotTables(t)
+
+	// b was written last, so a was evicted before the write of b returned
+	if a.loaded.Load() {
+		t.Fatal("table a is still loaded after b was touched")
+	}
+	if !b.loaded.Load() {
+		t.Fatal("table b is not loaded after it was written")
+	}
+
+	records, err := a.SelectByIndex("city", "Lima")
+	if err != nil {
+		t.Fatalf("SelectByIndex failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("SelectByIndex on the evicted table returned %d records, want 2", len(records))
+	}
+	if b.loaded.Load() {
+		t.Error("table b is still loaded after a was reloaded")
+	}
+}
+
+func TestTouchKeepsLockedTables(t *testing.T) {
+	a, b := newHotTables(t)
+
+	// b is in use, so touching a can't evict it
+	b.RLock()
+	a.touch()
+	b.RUnlock()
+	if !b.loaded.Load() {
+		t.Fatal("a locked table was evicted")
+	}
+
+	// b was kept as the least recently used table, so the next touch evicts it
+	a.touch()
+	if b.loaded.Load() {
+		t.Error("table b was not evicted once it was unlocked")
+	}
+}
+
+func TestIndexReadsDuringEviction(t *testing.T) {
+	a, b := newHotTables(t)
+
+	var wg sync.WaitGroup
+	for _, table := range []*Table{a, b, a, b} {
+		wg.Add(1)
+		go func(table *Table) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				records, err := table.SelectByIndex("city", "Lima")
+				if err != nil {
+					t.Errorf("SelectByIndex failed: %v", err)
+					return
+				}
+				if len(records) != 2 {
+					t.Errorf("SelectByIndex returned %d records, want 2", len(records))
+					return
+				}
+				keys, err := table.KeysByField("city", "Cusco")
+				if err != nil {
+					t.Errorf("KeysByField failed: %v", err)
+					return
+				}
+				if len(keys) != 1 {
+					t.Errorf("KeysByField = %v, want a single key", keys)
+					return
+				}
+			}
+		}(table)
+	}
+	wg.Wait()
+}
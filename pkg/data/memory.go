@@ -0,0 +1,126 @@
+package data
+
+import (
+	"os"
+	"sync"
+)
+
+// memoryStorage holds the data and the metadata of a table created with WithMemoryStorage in place of its files.
+// The records are encoded with the codec of the table like in the data file, but they are not encrypted.
+type memoryStorage struct {
+	sync.Mutex        // Mutex to ensure the storage is thread safe
+	data       []byte // Content of the data file, header included
+	metadata   []byte // Content of the metadata file
+}
+
+// WithMemoryStorage keeps the records and the metadata of the table in memory instead of in files.
+// The table behaves like a table stored on disk, with indexes, queries, joins, eviction and write debouncing,
+// but it never touches the filesystem or the encryption key, and its content is lost when the process exits.
+// The file path given to NewTable only names the table in logs and errors. It is meant for tests.
+func WithMemoryStorage() TableOption {
+	return func(t *Table) {
+		t.memory = &memoryStorage{}
+	}
+}
+
+// NewMemoryTable creates a table stored in memory with WithMemoryStorage.
+//
+// Parameters:
+// - primaryKey: A string representing the field name to be used as the primary key for the table.
+// - name: A string naming the table in logs and errors.
+// - opts: Optional TableOption values that configure the table.
+//
+// Returns:
+// - A pointer to a new Table instance.
+func NewMemoryTable(primaryKey, name string, opts ...TableOption) *Table {
+	return NewTable(primaryKey, name, append([]TableOption{WithMemoryStorage()}, opts...)...)
+}
+
+// isMemory reports whether the table is stored in memory.
+func (t *Table) isMemory() bool {
+	return t.memory != nil
+}
+
+// readData returns the content of the data file of the table, or nil if it does not exist.
+func (t *Table) readData() ([]byte, error) {
+	if t.isMemory() {
+		t.memory.Lock()
+		defer t.memory.Unlock()
+		return append([]byte(nil), t.memory.data...), nil
+	}
+	var data []byte
+	err := t.retryIO(func() error {
+		var err error
+		data, err = t.fs().ReadFile(t.FilePath)
+		return err
+	})
+	if isNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// dataExists reports whether the data file of the table exists.
+func (t *Table) dataExists() bool {
+	if t.isMemory() {
+		t.memory.Lock()
+		defer t.memory.Unlock()
+		return t.memory.data != nil
+	}
+	if t.perRecord {
+		_, err := t.fs().Stat(recordsDirPath(t.FilePath))
+		return !isNotExist(err)
+	}
+	_, err := t.fs().Stat(t.FilePath)
+	return !isNotExist(err)
+}
+
+// dataSize returns the size of the data file of the table, plus the size of its append log if any, or 0 if it does not exist.
+func (t *Table) dataSize() (int64, error) {
+	if t.isMemory() {
+		t.memory.Lock()
+		defer t.memory.Unlock()
+		return int64(len(t.memory.data)), nil
+	}
+	if t.perRecord {
+		return t.recordFilesSize()
+	}
+	size, err := fileSize(t.fs(), t.FilePath)
+	if err != nil || !t.appendLogOnDisk() {
+		return size, err
+	}
+	logSize, err := fileSize(t.fs(), appendLogPath(t.FilePath))
+	return size + logSize, err
+}
+
+// writeMemoryData replaces the data of a table stored in memory.
+func (t *Table) writeMemoryData(data []byte) {
+	t.memory.Lock()
+	defer t.memory.Unlock()
+	t.memory.data = data
+}
+
+// readMetadataData returns the content of the metadata file of the table.
+// The error satisfies isNotExist if it does not exist.
+func (t *Table) readMetadataData() ([]byte, error) {
+	if t.isMemory() {
+		t.memory.Lock()
+		defer t.memory.Unlock()
+		if t.memory.metadata == nil {
+			return nil, os.ErrNotExist
+		}
+		return append([]byte(nil), t.memory.metadata...), nil
+	}
+	return t.fs().ReadFile(metadataFilePath(t.FilePath))
+}
+
+// writeMetadataData replaces the content of the metadata file of the table.
+func (t *Table) writeMetadataData(data []byte) error {
+	if t.isMemory() {
+		t.memory.Lock()
+		defer t.memory.Unlock()
+		t.memory.metadata = data
+		return nil
+	}
+	return writeStorageFile(t.fs(), metadataFilePath(t.FilePath), data, 0644)
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryTableNeverTouchesTheDisk(t *testing.T) {
+	t.Setenv("AES_KEY", "")
+	dir := t.TempDir()
+	users := NewMemoryTable("id", filepath.Join(dir, "users.bin"))
+	orders := NewMemoryTable("id", filepath.Join(dir, "orders.bin"))
+	defer users.Close()
+	defer orders.Close()
+
+	if err := users.CreateIndex("city"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	mustInsert(t, users,
+		Record{"id": "u1", "name": "Ana", "city": "Lima"},
+		Record{"id": "u2", "name": "Bo", "city": "Cusco"},
+	)
+	mustInsert(t, orders, Record{"id": "o1", "userId": "u1"})
+	if err := users.Update("u2", Record{"city": "Lima"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	records, err := users.SelectByIndex("city", "Lima")
+	if err != nil {
+		t.Fatalf("SelectByIndex failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("SelectByIndex returned %d records, want 2", len(records))
+	}
+	rows, err := JoinTables(users, orders, "id", "userId", InnerJoin)
+	if err != nil {
+		t.Fatalf("JoinTables failed: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["t1.name"] != "Ana" {
+		t.Errorf("JoinTables = %v, want the order of Ana", rows)
+	}
+	if err := users.Delete("u1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if count, err := users.Count(); err != nil || count != 1 {
+		t.Errorf("Count = %d, %v, want 1", count, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("the directory holds %d files, want none", len(entries))
+	}
+}
+
+func TestMemoryTablesAreIndependent(t *testing.T) {
+	first := NewMemoryTable("id", "same-name")
+	second := NewMemoryTable("id", "same-name")
+	defer first.Close()
+	defer second.Close()
+
+	mustInsert(t, first, Record{"id": "a"})
+	if count, err := second.Count(); err != nil || count != 0 {
+		t.Errorf("Count of the other table = %d, %v, want 0", count, err)
+	}
+}
@@ -0,0 +1,108 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// tableMetadata is the content of the metadata file stored next to the data file of a table.
+type tableMetadata struct {
+	PrimaryKey      string             `json:"PrimaryKey"`                // Field name used as the primary key for the table
+	Indexes         [][]string         `json:"Indexes,omitempty"`         // Fields of each secondary index declared on the table
+	ElementIndexes  []string           `json:"ElementIndexes,omitempty"`  // List fields with an element index declared on the table
+	KeyFields       []string           `json:"KeyFields,omitempty"`       // Fields whose values build a composite primary key, if any
+	KeySeparator    string             `json:"KeySeparator,omitempty"`    // Separator used to join the values of a composite primary key
+	ForeignKeys     []ForeignKey       `json:"ForeignKeys,omitempty"`     // Foreign keys declared on the table
+	Uniques         []UniqueConstraint `json:"Uniques,omitempty"`         // Unique constraints declared on the table
+	Codec           string             `json:"Codec,omitempty"`           // Name of the codec of the table, if it is not the default one
+	Schema          Schema             `json:"Schema,omitempty"`          // Schema the records are expected to match, if any
+	FilePerRecord   bool               `json:"FilePerRecord,omitempty"`   // Whether each record is stored in its own file
+	AppendLog       int                `json:"AppendLog,omitempty"`       // Number of records appended to the log before it is consolidated, see WithAppendLog
+	CompactRatio    float64            `json:"CompactRatio,omitempty"`    // Dead space ratio of the append log from which it is consolidated, see WithAutoCompact
+	KeyGenerator    string             `json:"KeyGenerator,omitempty"`    // Name of the generator of the missing primary keys, see WithUUIDKeys
+	HeaderStamps    bool               `json:"HeaderStamps,omitempty"`    // Whether the last write is recorded in the header of the data file
+	EncryptedFields []string           `json:"EncryptedFields,omitempty"` // Fields whose values are encrypted individually
+}
+
+// metadataFilePath returns the path of the metadata file of the table stored at the given file path.
+func metadataFilePath(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".meta"
+}
+
+// readMetadataFile reads and deserializes the metadata file at the given path of the storage.
+func readMetadataFile(storage Storage, metaFilePath string) (*tableMetadata, error) {
+	metaDataBytes, err := storage.ReadFile(metaFilePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadata(metaDataBytes)
+}
+
+// parseMetadata deserializes the content of a metadata file.
+func parseMetadata(metaDataBytes []byte) (*tableMetadata, error) {
+	var metaData tableMetadata
+	if err := json.Unmarshal(metaDataBytes, &metaData); err != nil {
+		return nil, fmt.Errorf("failed to deserialize metadata: %v", err)
+	}
+	return &metaData, nil
+}
+
+// loadMetadata reads the metadata file of the table.
+// It returns nil and no error if the metadata file does not exist yet.
+func (t *Table) loadMetadata() (*tableMetadata, error) {
+	metaDataBytes, err := t.readMetadataData()
+	if isNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadata(metaDataBytes)
+}
+
+// saveMetadata writes the primary key and the declared indexes of the table to its metadata file.
+func (t *Table) saveMetadata() error {
+	if t.readOnly {
+		return fmt.Errorf("%w: can't change the metadata of table %s", ErrReadOnly, t.FilePath)
+	}
+	metaData := tableMetadata{PrimaryKey: t.PrimaryKey}
+	if t.hasCompositeKey() {
+		metaData.KeyFields = t.keyFields
+		metaData.KeySeparator = t.keySeparator
+	}
+	metaData.ForeignKeys = t.foreignKeys
+	for _, unique := range t.uniques {
+		metaData.Uniques = append(metaData.Uniques, unique.UniqueConstraint)
+	}
+	metaData.Schema = t.schema
+	metaData.FilePerRecord = t.perRecord
+	metaData.AppendLog = t.appendMax
+	metaData.CompactRatio = t.compactRatio
+	metaData.KeyGenerator = t.keyGenName
+	metaData.HeaderStamps = t.headerStamps
+	metaData.EncryptedFields = t.encryptedFields
+	if t.codec != nil && t.codec != ProtobufCodec {
+		metaData.Codec = t.codec.Name()
+	}
+	for _, name := range t.sortedIndexNames() {
+		// Partial indexes hold a predicate, which can't be saved
+		if idx := t.indexes[name]; idx.Partial {
+			continue
+		} else if idx.Elements {
+			metaData.ElementIndexes = append(metaData.ElementIndexes, idx.Fields[0])
+		} else {
+			metaData.Indexes = append(metaData.Indexes, idx.Fields)
+		}
+	}
+
+	metaDataBytes, err := json.Marshal(metaData)
+	if err != nil {
+		return fmt.Errorf("failed to serialize metadata: %v", err)
+	}
+	if err := t.writeMetadataData(metaDataBytes); err != nil {
+		return fmt.Errorf("failed to write metadata file: %v", err)
+	}
+	return nil
+}
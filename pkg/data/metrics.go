@@ -9,16 +9,18 @@ import (
 // Metrics is a structure that holds various counts and timestamps related to database operations and cache usage.
 type Metrics struct {
 	sync.RWMutex
-	InsertCount int       // The number of insert operations performed.
-	UpdateCount int       // The number of update operations performed.
-	DeleteCount int       // The number of delete operations performed.
-	QueryCount  int       // The number of query operations performed.
-	CacheHits   int       // The number of successful cache retrievals.
-	CacheMisses int       // The number of unsuccessful cache retrievals.
-	LastInsert  time.Time // The timestamp of the last insert operation.
-	LastUpdate  time.Time // The timestamp of the last update operation.
-	LastDelete  time.Time // The timestamp of the last delete operation.
-	LastQuery   time.Time // The timestamp of the last query operation.
+	InsertCount  int       // The number of insert operations performed.
+	UpdateCount  int       // The number of update operations performed.
+	DeleteCount  int       // The number of delete operations performed.
+	QueryCount   int       // The number of query operations performed.
+	CacheHits    int       // The number of successful cache retrievals.
+	CacheMisses  int       // The number of unsuccessful cache retrievals.
+	LockTimeouts int       // The number of operations that gave up waiting for the table lock.
+	LastInsert   time.Time // The timestamp of the last insert operation.
+	LastUpdate   time.Time // The timestamp of the last update operation.
+	LastDelete   time.Time // The timestamp of the last delete operation.
+	LastQuery    time.Time // The timestamp of the last query operation.
+	clock        Clock     // Clock of the timestamps, SystemClock if nil
 }
 
 // NewMetrics creates and returns a new Metrics structure.
@@ -26,11 +28,19 @@ func NewMetrics() *Metrics {
 	return &Metrics{}
 }
 
+// now returns the current time of the clock of the metrics. The metrics must be locked.
+func (m *Metrics) now() time.Time {
+	if m.clock == nil {
+		return SystemClock.Now()
+	}
+	return m.clock.Now()
+}
+
 // IncrementInsertCount increases the count of insert operations and updates the timestamp of the last insert operation.
 func (m *Metrics) IncrementInsertCount() {
 	m.Lock()
 	m.InsertCount++
-	m.LastInsert = time.Now()
+	m.LastInsert = m.now()
 	m.Unlock()
 }
 
@@ -38,7 +48,7 @@ func (m *Metrics) IncrementInsertCount() {
 func (m *Metrics) IncrementUpdateCount() {
 	m.Lock()
 	m.UpdateCount++
-	m.LastUpdate = time.Now()
+	m.LastUpdate = m.now()
 	m.Unlock()
 }
 
@@ -46,7 +56,7 @@ func (m *Metrics) IncrementUpdateCount() {
 func (m *Metrics) IncrementDeleteCount() {
 	m.Lock()
 	m.DeleteCount++
-	m.LastDelete = time.Now()
+	m.LastDelete = m.now()
 	m.Unlock()
 }
 
@@ -54,7 +64,7 @@ func (m *Metrics) IncrementDeleteCount() {
 func (m *Metrics) IncrementQueryCount() {
 	m.Lock()
 	m.QueryCount++
-	m.LastQuery = time.Now()
+	m.LastQuery = m.now()
 	m.Unlock()
 }
 
@@ -72,6 +82,13 @@ func (m *Metrics) IncrementCacheMisses() {
 	m.Unlock()
 }
 
+// IncrementLockTimeouts increases the count of operations that gave up waiting for the table lock.
+func (m *Metrics) IncrementLockTimeouts() {
+	m.Lock()
+	m.LockTimeouts++
+	m.Unlock()
+}
+
 // String returns a string representation of the Metrics structure in JSON format.
 func (m *Metrics) String() string {
 	m.RLock()
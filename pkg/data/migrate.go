@@ -0,0 +1,145 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// MigrationsTable is the name of the table in which Database.Migrate records the migrations applied to a database.
+const MigrationsTable = "_migrations"
+
+// Migration is a change to the data of a database, such as renaming a field or backfilling values, applied once by Database.Migrate.
+type Migration struct {
+	ID    string                // Unique identifier of the migration, recorded once it is applied
+	Apply func(*Database) error // Function applying the migration to the database
+}
+
+// Migrate is a method of the Database struct that applies the migrations that were not applied to the database yet, in order.
+// The ID of each applied migration is recorded in the MigrationsTable table and synced to disk before the next
+// migration runs, so every migration runs once per database, even across restarts and deployments.
+// If a migration fails, the records of every table it modified are restored to their state before it ran,
+// nothing is recorded for it, and the following migrations are not run. Tables created by the failed migration are kept.
+// Concurrent calls on the same database apply the migrations one at a time.
+//
+// Parameters:
+// - migrations: The migrations to apply, in order.
+//
+// Returns:
+// - If every migration is applied or was applied before, it returns nil.
+// - If a migration has no ID, no Apply function or the same ID as another one, it returns an error before running any migration.
+// - If a migration fails, it returns its error, wrapped, after rolling it back.
+func (db *Database) Migrate(migrations []Migration) error {
+	seen := make(map[string]bool, len(migrations))
+	for i, migration := range migrations {
+		if migration.ID == "" || migration.Apply == nil {
+			return fmt.Errorf("migration %d needs an ID and an Apply function", i)
+		}
+		if seen[migration.ID] {
+			return fmt.Errorf("duplicate migration ID %s", migration.ID)
+		}
+		seen[migration.ID] = true
+	}
+
+	db.migrateMu.Lock()
+	defer db.migrateMu.Unlock()
+
+	applied, err := db.migrationsTable()
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		if _, err := applied.Select(migration.ID); err == nil {
+			continue
+		} else if !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to check migration %s: %v", migration.ID, err)
+		}
+
+		originals, err := db.snapshotTables()
+		if err != nil {
+			return fmt.Errorf("failed to save the tables before migration %s: %v", migration.ID, err)
+		}
+		if err := migration.Apply(db); err != nil {
+			if restoreErr := restoreTables(originals); restoreErr != nil {
+				return fmt.Errorf("migration %s failed: %v; %v", migration.ID, err, restoreErr)
+			}
+			return fmt.Errorf("migration %s failed, rolled back: %w", migration.ID, err)
+		}
+
+		if err := applied.Insert(Record{"id": migration.ID, "appliedAt": applied.now().UTC().Format(time.RFC3339)}); err != nil {
+			return fmt.Errorf("failed to record migration %s: %v", migration.ID, err)
+		}
+		if err := applied.Flush(); err != nil {
+			return fmt.Errorf("failed to record migration %s: %v", migration.ID, err)
+		}
+		applied.RLock()
+		err = applied.syncFile()
+		applied.RUnlock()
+		if err != nil {
+			return fmt.Errorf("failed to sync the record of migration %s: %v", migration.ID, err)
+		}
+	}
+	return nil
+}
+
+// migrationsTable returns the table recording the applied migrations of the database, creating it if needed.
+func (db *Database) migrationsTable() (*Table, error) {
+	db.Lock()
+	defer db.Unlock()
+	if table, exists := db.Tables[MigrationsTable]; exists {
+		return table, nil
+	}
+	return db.createTableLocked(MigrationsTable, "id")
+}
+
+// tableSnapshot is the records of a table saved before a migration, to restore them if it fails.
+type tableSnapshot struct {
+	table   *Table          // Table whose records were saved
+	records *dbdata.Records // Snapshot of the records of the table
+}
+
+// snapshotTables saves the current snapshot of the records of every table of the database except MigrationsTable.
+// Snapshots are never modified by the writes, so saving them copies nothing.
+func (db *Database) snapshotTables() (map[string]tableSnapshot, error) {
+	db.RLock()
+	tables := make(map[string]*Table, len(db.Tables))
+	for name, table := range db.Tables {
+		if name != MigrationsTable {
+			tables[name] = table
+		}
+	}
+	db.RUnlock()
+
+	snapshots := make(map[string]tableSnapshot, len(tables))
+	for name, table := range tables {
+		records, err := table.snapshotRecords()
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %v", name, err)
+		}
+		snapshots[name] = tableSnapshot{table: table, records: records}
+	}
+	return snapshots, nil
+}
+
+// restoreTables writes the saved records back to the tables that were written since they were saved.
+func restoreTables(snapshots map[string]tableSnapshot) error {
+	var failed []string
+	for name, snapshot := range snapshots {
+		table := snapshot.table
+		table.Lock()
+		if table.snapshot.Load() != snapshot.records {
+			if err := table.restoreLocked(snapshot.records); err != nil {
+				failed = append(failed, name)
+			}
+		}
+		table.Unlock()
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("failed to restore tables %v", failed)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// partialIndexSuffix is appended to the name of a field to name its partial index, so it doesn't clash with
+// a regular index over the same field.
+const partialIndexSuffix = "?"
+
+// newPartialIndex creates an empty partial index over the given field, holding the records matching the predicate.
+func newPartialIndex(field string, pred func(Record) bool) *Index {
+	return &Index{
+		Name:    field + partialIndexSuffix,
+		Fields:  []string{field},
+		Partial: true,
+		filter:  pred,
+		entries: make(map[string]map[string]struct{}),
+	}
+}
+
+// covers reports whether the record belongs in the index: every record for a regular index,
+// only the records matching the predicate for a partial index.
+// Records that can't be decoded for the predicate are not held by a partial index.
+func (idx *Index) covers(record *dbdata.Record) bool {
+	if idx.filter == nil {
+		return true
+	}
+	decoded, err := fromProtoRecord(record)
+	if err != nil {
+		return false
+	}
+	return idx.filter(decoded)
+}
+
+// CreatePartialIndex is a method of the Table struct that creates a secondary index over a field holding only the records
+// matching the predicate, such as the open orders of a large table of orders. The records outside the predicate are
+// neither indexed nor checked on write, which saves the memory and the write cost of indexing records that are never looked up.
+//
+// The index is named after the field followed by "?", such as "status?", and is queried with SelectByIndex, which returns
+// only the records held by the index: a record holding the value but not matching the predicate is not returned.
+// Because of this, the index is never used by Query or KeysByField, whose results must include every record; a regular index
+// created by CreateIndex over the same field can exist next to it.
+//
+// The predicate receives a copy of the stored record, without the read transforms of the table, and must not depend on
+// anything but the record. It is called on every insert and update of the table, so a record enters or leaves the index
+// as its fields change. Predicates are functions, so the index is not saved in the metadata file of the table:
+// it must be created again each time the table is opened.
+//
+// Parameters:
+// - field: The name of the field covered by the index.
+// - pred: The function reporting whether a record is held by the index.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the field is empty, the predicate is nil, the index already exists or an error occurs while reading the records, it returns an error.
+// - If the field is encrypted with WithFieldEncryption, it returns an error wrapping ErrEncryptedField.
+func (t *Table) CreatePartialIndex(field string, pred func(Record) bool) error {
+	if field == "" {
+		return fmt.Errorf("a partial index needs a field")
+	}
+	if pred == nil {
+		return fmt.Errorf("a partial index needs a predicate")
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	idx := newPartialIndex(field, pred)
+	if _, exists := t.indexes[idx.Name]; exists {
+		return fmt.Errorf("index %s already exists", idx.Name)
+	}
+	if err := t.checkIndexable(field); err != nil {
+		return err
+	}
+
+	allRecords, err := t.loadForWrite()
+	if err != nil {
+		return err
+	}
+
+	t.indexes[idx.Name] = idx
+	t.rebuildIndexes(allRecords.GetRecords())
+	return nil
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// partialKeys returns the sorted primary keys of the records the partial index over customer holds for the customer.
+func partialKeys(t *testing.T, table *Table, customer string) []string {
+	t.Helper()
+	records, err := table.SelectByIndex("customer?", customer)
+	if err != nil {
+		t.Fatalf("SelectByIndex(%q) failed: %v", customer, err)
+	}
+	keys := make([]string, 0, len(records))
+	for _, record := range records {
+		keys = append(keys, record["id"].(string))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestPartialIndex(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "o1", "customer": "alice", "status": "open"},
+		Record{"id": "o2", "customer": "alice", "status": "closed"},
+		Record{"id": "o3", "customer": "bob", "status": "open"},
+	)
+	isOpen := func(r Record) bool { return r["status"] == "open" }
+	if err := table.CreatePartialIndex("customer", isOpen); err != nil {
+		t.Fatalf("CreatePartialIndex failed: %v", err)
+	}
+
+	// The index is built from the existing records matching the predicate
+	if got := partialKeys(t, table, "alice"); !reflect.DeepEqual(got, []string{"o1"}) {
+		t.Errorf("open orders of alice = %v, want [o1]", got)
+	}
+
+	// New records enter the index only if they match
+	mustInsert(t, table,
+		Record{"id": "o4", "customer": "alice", "status": "open"},
+		Record{"id": "o5", "customer": "alice", "status": "closed"},
+	)
+	if got := partialKeys(t, table, "alice"); !reflect.DeepEqual(got, []string{"o1", "o4"}) {
+		t.Errorf("open orders of alice after the inserts = %v, want [o1 o4]", got)
+	}
+
+	// Updates move records into and out of the index
+	if err := table.Update("o1", Record{"status": "closed"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := table.Update("o2", Record{"status": "open"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := table.Update("o3", Record{"customer": "alice"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := table.Delete("o4"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got := partialKeys(t, table, "alice"); !reflect.DeepEqual(got, []string{"o2", "o3"}) {
+		t.Errorf("open orders of alice after the updates = %v, want [o2 o3]", got)
+	}
+	if got := partialKeys(t, table, "bob"); len(got) != 0 {
+		t.Errorf("open orders of bob = %v, want none", got)
+	}
+
+	// Query doesn't use the partial index, so it still returns the records outside the predicate
+	results, err := table.Query(Query{Filters: map[string]interface{}{"customer": "alice"}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 4 {
+		t.Errorf("Query of the orders of alice returned %d records, want 4", len(results))
+	}
+}
+
+func TestCreatePartialIndexErrors(t *testing.T) {
+	table := newTestTable(t, "id")
+	always := func(Record) bool { return true }
+	if err := table.CreatePartialIndex("", always); err == nil {
+		t.Error("CreatePartialIndex without a field succeeded, want an error")
+	}
+	if err := table.CreatePartialIndex("customer", nil); err == nil {
+		t.Error("CreatePartialIndex without a predicate succeeded, want an error")
+	}
+	if err := table.CreatePartialIndex("customer", always); err != nil {
+		t.Fatalf("CreatePartialIndex failed: %v", err)
+	}
+	if err := table.CreatePartialIndex("customer", always); err == nil {
+		t.Error("CreatePartialIndex of an existing index succeeded, want an error")
+	}
+	// A regular index over the same field can exist next to the partial one
+	if err := table.CreateIndex("customer"); err != nil {
+		t.Errorf("CreateIndex next to the partial index failed: %v", err)
+	}
+}
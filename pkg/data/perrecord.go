@@ -0,0 +1,215 @@
+package data
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// recordFileExt is the extension of the files holding a single record of a table created with WithFilePerRecord.
+const recordFileExt = ".rec"
+
+// WithFilePerRecord stores each record of the table in its own encrypted file, in a directory next to the data file
+// named after the table with the ".records" extension, instead of storing all the records in a single file.
+// A write then only rewrites the files of the records it inserted, updated or deleted, instead of the whole table,
+// which makes writes to large tables, or tables with large records, much cheaper.
+// In exchange, loading the table opens one file per record, which is slower than reading a single file,
+// and a write keeps an in-memory copy of the records it compares against the previous write to find what changed.
+// The mode is saved in the metadata file of the table by Database.CreateTable. It is ignored by tables stored in memory.
+func WithFilePerRecord() TableOption {
+	return func(t *Table) {
+		t.perRecord = true
+	}
+}
+
+// recordsDirPath returns the path of the directory holding the record files of the table stored at the given file path.
+func recordsDirPath(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".records"
+}
+
+// recordFileName returns the name of the file holding the record with the given key.
+// The key is base64-encoded, so any key maps to a valid and distinct file name.
+func recordFileName(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key)) + recordFileExt
+}
+
+// listRecordFiles returns the names of the record files of the table. It returns no names if the directory does not exist.
+func (t *Table) listRecordFiles() ([]string, error) {
+	entries, err := t.fs().ReadDir(recordsDirPath(t.FilePath))
+	if isNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read records directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), recordFileExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// readRecordFiles reads the records of the table from their own files.
+func (t *Table) readRecordFiles() (*dbdata.Records, error) {
+	names, err := t.listRecordFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	records := &dbdata.Records{Records: make(map[string]*dbdata.Record, len(names))}
+	dir := recordsDirPath(t.FilePath)
+	for _, name := range names {
+		var encryptedData []byte
+		err := t.retryIO(func() error {
+			var err error
+			encryptedData, err = t.fs().ReadFile(filepath.Join(dir, name))
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %v", err)
+		}
+		fileRecords, err := t.decodeRecords(encryptedData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read record file %s: %v", name, err)
+		}
+		for key, record := range fileRecords.Records {
+			records.Records[key] = record
+		}
+	}
+	return records, nil
+}
+
+// writeRecordFiles writes the records changed since the record files were last written to their own files
+// and removes the files of the records that were deleted.
+// If the record files are not known to match the records, as after a rollback, it rewrites every record
+// and removes any other record file.
+func (t *Table) writeRecordFiles(records *dbdata.Records) error {
+	dir := recordsDirPath(t.FilePath)
+	if err := t.fs().MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create records directory: %v", err)
+	}
+
+	keys := make([]string, 0, len(t.changedKeys))
+	if t.filesKnown {
+		for key := range t.changedKeys {
+			keys = append(keys, key)
+		}
+	} else {
+		for key := range records.Records {
+			keys = append(keys, key)
+		}
+	}
+	// Until this write succeeds, the files on disk are unknown
+	t.filesKnown = false
+
+	for _, key := range keys {
+		record, exists := records.Records[key]
+		if !exists {
+			if err := t.removeRecordFile(filepath.Join(dir, recordFileName(key))); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := t.encodeRecords(&dbdata.Records{Records: map[string]*dbdata.Record{key: record}})
+		if err != nil {
+			return err
+		}
+		if err := t.writeDataFile(filepath.Join(dir, recordFileName(key)), data); err != nil {
+			return err
+		}
+	}
+
+	if len(keys) == len(records.Records) {
+		// Every record was rewritten, remove the files of the records that no longer exist
+		names, err := t.listRecordFiles()
+		if err != nil {
+			return err
+		}
+		keep := make(map[string]bool, len(records.Records))
+		for key := range records.Records {
+			keep[recordFileName(key)] = true
+		}
+		for _, name := range names {
+			if !keep[name] {
+				if err := t.removeRecordFile(filepath.Join(dir, name)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	t.resetRecordFiles(true)
+	return nil
+}
+
+// markChanged records that the record with the given key changed since the record files were last written.
+func (t *Table) markChanged(key string) {
+	if !t.perRecord {
+		return
+	}
+	if t.changedKeys == nil {
+		t.changedKeys = make(map[string]struct{})
+	}
+	t.changedKeys[key] = struct{}{}
+}
+
+// resetRecordFiles forgets the records changed since the record files were last written
+// and sets whether the record files match the current records.
+func (t *Table) resetRecordFiles(known bool) {
+	t.filesKnown = known
+	t.changedKeys = nil
+}
+
+// removeRecordFile removes the record file at the given path, ignoring a file that does not exist.
+func (t *Table) removeRecordFile(filePath string) error {
+	if err := t.fs().Remove(filePath); err != nil && !isNotExist(err) {
+		return fmt.Errorf("failed to remove record file '%s': %v", filePath, err)
+	}
+	return nil
+}
+
+// recordFilesSize returns the total size of the record files of the table.
+func (t *Table) recordFilesSize() (int64, error) {
+	names, err := t.listRecordFiles()
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, name := range names {
+		fileSize, err := fileSize(t.fs(), filepath.Join(recordsDirPath(t.FilePath), name))
+		if err != nil {
+			return 0, err
+		}
+		size += fileSize
+	}
+	return size, nil
+}
+
+// syncRecordFiles flushes the record files of the table to stable storage.
+func (t *Table) syncRecordFiles() error {
+	names, err := t.listRecordFiles()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		file, err := t.fs().OpenFile(filepath.Join(recordsDirPath(t.FilePath), name), os.O_RDWR, 0644)
+		if err != nil {
+			if isNotExist(err) {
+				continue
+			}
+			return err
+		}
+		err = file.Sync()
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+)
+
+// storageModes are the storage modes compared by the benchmarks: one file for the table, and one file per record.
+var storageModes = []struct {
+	name string
+	opts []TableOption
+}{
+	{"single-file", nil},
+	{"file-per-record", []TableOption{WithFilePerRecord()}},
+}
+
+// newBenchmarkTable creates a table holding n records in the given storage mode.
+func newBenchmarkTable(b *testing.B, n int, opts ...TableOption) *Table {
+	b.Helper()
+	table := newTestTable(b, "id", opts...)
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{"id": fmt.Sprintf("r%06d", i), "name": "record", "payload": fmt.Sprintf("%0200d", i)}
+	}
+	if err := table.InsertMany(records); err != nil {
+		b.Fatalf("InsertMany failed: %v", err)
+	}
+	return table
+}
+
+// BenchmarkStorageModes compares the writes and the reads of a table of 1,000 records stored in one file
+// and with one file per record.
+func BenchmarkStorageModes(b *testing.B) {
+	const size = 1000
+	for _, mode := range storageModes {
+		b.Run(mode.name+"/Insert", func(b *testing.B) {
+			table := newBenchmarkTable(b, size, mode.opts...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := table.Insert(Record{"id": fmt.Sprintf("new%d", i), "name": "new"}); err != nil {
+					b.Fatalf("Insert failed: %v", err)
+				}
+			}
+		})
+		b.Run(mode.name+"/Update", func(b *testing.B) {
+			table := newBenchmarkTable(b, size, mode.opts...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := table.Update(fmt.Sprintf("r%06d", i%size), Record{"name": fmt.Sprint(i)}); err != nil {
+					b.Fatalf("Update failed: %v", err)
+				}
+			}
+		})
+		b.Run(mode.name+"/SelectAll", func(b *testing.B) {
+			table := newBenchmarkTable(b, size, mode.opts...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Reload the records from storage, as after opening the table
+				table.Lock()
+				table.evictLocked()
+				table.Unlock()
+				if records, err := table.SelectAll(); err != nil || len(records) != size {
+					b.Fatalf("SelectAll = %d records, %v, want %d", len(records), err, size)
+				}
+			}
+		})
+	}
+}
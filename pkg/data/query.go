@@ -1,7 +1,6 @@
 package data
 
 import (
-	"fmt"
 	"sort"
 
 	"github.com/Malpizarr/dbproto/pkg/dbdata"
@@ -15,6 +14,7 @@ type Query struct {
 	SortBy  string                 // SortBy is a Field to sort the records by
 	Limit   int                    // Limit is the Maximum number of records to return
 	Offset  int                    // Offset is the Number of records to skip (for pagination)
+	Where   *Filter                // Where is an optional filter the records must also match, for conditions other than equality
 }
 
 // ExecutionPlan represents the execution plan for a database query.
@@ -24,18 +24,25 @@ type ExecutionPlan struct {
 	SortBy     string                 // SortBy specifies the field to sort the query results by.
 	Limit      int                    // Limit specifies the maximum number of results to be returned.
 	Offset     int                    // Offset specifies the number of results to skip before returning.
+	Where      *Filter                // Where specifies an optional filter the results must also match.
 }
 
 // selectBestIndex selects the best index for a given query.
+// Only the fields with a single-field index created by CreateIndex are considered,
+// and the index with the fewest records matching the filter value is selected.
 func (t *Table) selectBestIndex(query Query) string {
 	bestIndex := ""
 	bestSelectivity := 1.0 // Worst possible selectivity
 
 	// Iterate over each filter field to find the best index
-	for field := range query.Filters {
-		if index, exists := t.Indexes[field]; exists {
-			selectivity := float64(len(index)) / float64(len(t.Records))
-			if selectivity < bestSelectivity {
+	for field, value := range query.Filters {
+		if index, exists := t.indexes[field]; exists && len(t.Records) > 0 {
+			lookupValue, err := filterLookupValue(value)
+			if err != nil {
+				continue
+			}
+			selectivity := float64(len(index.entries[lookupValue])) / float64(len(t.Records))
+			if selectivity < bestSelectivity || bestIndex == "" {
 				bestSelectivity = selectivity
 				bestIndex = field
 			}
@@ -45,6 +52,23 @@ func (t *Table) selectBestIndex(query Query) string {
 	return bestIndex
 }
 
+// filterLookupValue returns the string form of a filter value as stored in an index.
+func filterLookupValue(value interface{}) (string, error) {
+	protoValue, err := filterProtoValue(value)
+	if err != nil {
+		return "", err
+	}
+	return indexValue(protoValue), nil
+}
+
+// filterProtoValue converts a filter value to a protobuf value to compare with the values of the records.
+// The value is converted like a stored value, so integer filters, given as Go integers or as numbers decoded with
+// json.Decoder.UseNumber, match the exact integers stored in the records, strings that look like integers match
+// the same strings stored with the "str:" tag, and blobs are encoded like stored blobs.
+func filterProtoValue(value interface{}) (*structpb.Value, error) {
+	return toStoredValue(value)
+}
+
 // generateExecutionPlan generates an execution plan for a given query.
 func (t *Table) generateExecutionPlan(query Query) ExecutionPlan {
 	bestIndex := t.selectBestIndex(query)
@@ -54,44 +78,47 @@ func (t *Table) generateExecutionPlan(query Query) ExecutionPlan {
 		SortBy:     query.SortBy,
 		Limit:      query.Limit,
 		Offset:     query.Offset,
+		Where:      query.Where,
 	}
 }
 
-// executePlan executes the execution plan and returns the resulting records.
-func (t *Table) executePlan(plan ExecutionPlan) ([]Record, error) {
+// executePlan executes the execution plan and returns the resulting records, along with the number of records
+// matching its filters before the offset and limit are applied. The table must be locked for reading.
+func (t *Table) executePlan(plan ExecutionPlan) ([]Record, int, error) {
 	var results []*dbdata.Record
 
 	// If an index is used, search within the indexed records
 	if plan.IndexToUse != "" {
-		for _, record := range t.Indexes[plan.IndexToUse] {
-			if match(record, plan.Filters) {
+		lookupValue, err := filterLookupValue(plan.Filters[plan.IndexToUse])
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, key := range t.indexes[plan.IndexToUse].keys([]string{lookupValue}) {
+			if record, exists := t.Records[key]; exists && match(record, plan.Filters) && matchWhere(record, plan.Where) {
 				results = append(results, record)
 			}
 		}
 	} else {
 		// Otherwise, search within all records
 		for _, record := range t.Records {
-			if match(record, plan.Filters) {
+			if match(record, plan.Filters) && matchWhere(record, plan.Where) {
 				results = append(results, record)
 			}
 		}
 	}
 
-	// Sort the results if a sort field is specified
-	if plan.SortBy != "" {
-		sort.Slice(results, func(i, j int) bool {
-			return results[i].Fields[plan.SortBy].GetNumberValue() < results[j].Fields[plan.SortBy].GetNumberValue()
-		})
-	} else {
-		sort.Slice(results, func(i, j int) bool {
-			return results[i].Fields[t.PrimaryKey].GetStringValue() < results[j].Fields[t.PrimaryKey].GetStringValue()
-		})
+	// Sort the results by the sort field if one is specified, by primary key otherwise
+	sortField := plan.SortBy
+	if sortField == "" {
+		sortField = t.PrimaryKey
 	}
+	sortRecords(results, sortField, t.PrimaryKey)
+	total := len(results)
 
 	// Apply offset to the results
 	if plan.Offset > 0 {
 		if plan.Offset >= len(results) {
-			return []Record{}, nil
+			return []Record{}, total, nil
 		}
 		results = results[plan.Offset:]
 	}
@@ -104,27 +131,100 @@ func (t *Table) executePlan(plan ExecutionPlan) ([]Record, error) {
 	// Convert results to []Record
 	recordResults := make([]Record, len(results))
 	for i, protoRecord := range results {
-		record, err := fromProtoRecord(protoRecord)
+		record, err := t.fromStoredRecord(protoRecord)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		recordResults[i] = record
 	}
 
-	return recordResults, nil
+	return recordResults, total, nil
+}
+
+// sortRecords sorts stored records by the decoded value of a field, then by primary key.
+// Values are decoded before they are compared, so integers stored exactly as "num:" strings are compared with each other
+// and with floating-point numbers by their value, like the comparisons of a Filter.
+func sortRecords(records []*dbdata.Record, field, primaryKey string) {
+	type sortEntry struct {
+		record *dbdata.Record // Stored record
+		value  interface{}    // Decoded value of the sort field, nil if the field is missing
+		key    interface{}    // Decoded value of the primary key
+	}
+	entries := make([]sortEntry, len(records))
+	for i, record := range records {
+		entries[i] = sortEntry{record: record, value: sortValue(record, field), key: sortValue(record, primaryKey)}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if cmp := compareSortValues(entries[i].value, entries[j].value); cmp != 0 {
+			return cmp < 0
+		}
+		return compareSortValues(entries[i].key, entries[j].key) < 0
+	})
+	for i, entry := range entries {
+		records[i] = entry.record
+	}
+}
+
+// sortValue decodes a field of a stored record for sorting. It returns nil if the field is missing or can't be decoded.
+func sortValue(record *dbdata.Record, field string) interface{} {
+	protoValue, exists := record.Fields[field]
+	if !exists || protoValue == nil {
+		return nil
+	}
+	value, err := fromProtoValue(protoValue)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// compareSortValues compares two decoded values for sorting, returning a negative number, zero or a positive number.
+// Numbers, strings and booleans are compared with values of the same kind, false before true.
+// Values of different kinds are ordered numbers first, then strings, booleans, other values such as lists,
+// and missing values last.
+func compareSortValues(a, b interface{}) int {
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			}
+			return 1
+		}
+	}
+	if cmp, ok := compareFilterValues(a, b); ok {
+		return cmp
+	}
+	return sortRank(a) - sortRank(b)
+}
+
+// sortRank returns the position of the kind of a decoded value in the order of compareSortValues.
+func sortRank(value interface{}) int {
+	if _, ok := filterNumber(value); ok {
+		return 0
+	}
+	switch value.(type) {
+	case string:
+		return 1
+	case bool:
+		return 2
+	case nil:
+		return 4
+	}
+	return 3
 }
 
 // match checks if a record matches the given filters.
 func match(record *dbdata.Record, filters map[string]interface{}) bool {
 	for field, value := range filters {
-		protoValue, err := structpb.NewValue(value)
+		protoValue, err := filterProtoValue(value)
 		if err != nil {
-			fmt.Printf("Error converting filter value for field %s: %v\n", field, err)
 			return false
 		}
 		recordValue, exists := record.Fields[field]
 		if !exists {
-			fmt.Printf("Field %s does not exist in record\n", field)
 			return false
 		}
 		if !Equal(recordValue, protoValue) {
@@ -134,6 +234,18 @@ func match(record *dbdata.Record, filters map[string]interface{}) bool {
 	return true
 }
 
+// matchWhere checks if a record matches the optional Where filter of a query.
+func matchWhere(record *dbdata.Record, where *Filter) bool {
+	if where == nil {
+		return true
+	}
+	decoded, err := fromProtoRecord(record)
+	if err != nil {
+		return false
+	}
+	return where.Match(decoded)
+}
+
 // Query is a method of the Table struct that performs a query on the table and returns the resulting records.
 // It first generates an execution plan for the given query.
 // The execution plan includes the best index to use for the query, the filters to apply, the field to sort by, and the limit and offset for the results.
@@ -145,8 +257,144 @@ func match(record *dbdata.Record, filters map[string]interface{}) bool {
 //
 // Returns:
 // - A slice of Record objects, representing the records that match the query. If no records match the query, it returns an empty slice.
-// - An error, if any error occurs during the query operation. If the operation is successful, the error is nil.
+// - An error, if the Where filter is invalid or any error occurs during the query operation. If the operation is successful, the error is nil.
 func (t *Table) Query(query Query) ([]Record, error) {
+	records, _, err := t.QueryWithTotal(query)
+	return records, err
+}
+
+// QueryWithTotal is a method of the Table struct that performs a query like Query, and also returns the total number
+// of records matching its filters and Where filter, ignoring its Offset and Limit, so a paginated view can report
+// its total number of results. The page and the total are computed from the same records, under the table lock,
+// so the total always matches the page, even if a write completes in the meantime.
+//
+// Parameters:
+// - query: A Query object containing the filters, sorting, limit and offset of the query.
+//
+// Returns:
+// - A slice of Record objects, representing the page of records that match the query.
+// - The number of records matching the query before the offset and limit are applied.
+// - An error, if the Where filter is invalid or any error occurs during the query operation.
+func (t *Table) QueryWithTotal(query Query) ([]Record, int, error) {
+	if query.Where != nil {
+		if err := query.Where.Validate(); err != nil {
+			return nil, 0, err
+		}
+	}
+	if _, err := t.rlockLoaded(); err != nil {
+		return nil, 0, err
+	}
+	defer t.RUnlock()
+
 	plan := t.generateExecutionPlan(query)
 	return t.executePlan(plan)
 }
+
+// QueryRaw is a method of the Table struct that performs a query on the table like Query,
+// but returns the matching records as the underlying protobuf message, keyed by primary key,
+// with their values encoded as they are stored. This lets protobuf clients receive the records without
+// a lossy conversion to JSON. The message is a map, so the order of the results is not preserved.
+//
+// Parameters:
+// - query: A Query object containing the filters, sorting, limit and offset of the query.
+//
+// Returns:
+// - A pointer to a dbdata.Records instance holding the records that match the query.
+// - An error, if any error occurs during the query operation.
+func (t *Table) QueryRaw(query Query) (*dbdata.Records, error) {
+	records, _, err := t.QueryRawWithTotal(query)
+	return records, err
+}
+
+// QueryRawWithTotal is a method of the Table struct that performs a query like QueryRaw, and also returns the total number
+// of records matching it before its Offset and Limit are applied, computed from the same records like QueryWithTotal.
+//
+// Parameters:
+// - query: A Query object containing the filters, sorting, limit and offset of the query.
+//
+// Returns:
+// - A pointer to a dbdata.Records instance holding the page of records that match the query.
+// - The number of records matching the query before the offset and limit are applied.
+// - An error, if any error occurs during the query operation.
+func (t *Table) QueryRawWithTotal(query Query) (*dbdata.Records, int, error) {
+	records, total, err := t.QueryWithTotal(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	protoRecords, err := t.rawRecords(records)
+	if err != nil {
+		return nil, 0, err
+	}
+	return protoRecords, total, nil
+}
+
+// rawRecords returns the records as a protobuf message keyed by primary key, with their values encoded as they are stored.
+func (t *Table) rawRecords(records []Record) (*dbdata.Records, error) {
+	protoRecords := &dbdata.Records{Records: make(map[string]*dbdata.Record, len(records))}
+	for _, record := range records {
+		primaryKeyString, err := t.primaryKeyOf(record)
+		if err != nil {
+			return nil, err
+		}
+		protoRecord, err := toProtoRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		protoRecords.Records[primaryKeyString] = protoRecord
+	}
+	return protoRecords, nil
+}
+
+// CountWhere is a method of the Table struct that counts the records matching the given predicate.
+// It streams over the current snapshot of the records, converting and testing one record
+// at a time without collecting the matches. The records are decoded like the ones returned by Select,
+// read transforms included. To count the results of a paginated query, QueryWithTotal computes
+// the total from the same records as the page.
+//
+// Parameters:
+// - pred: A function that returns true for the records to be counted.
+//
+// Returns:
+// - The number of records matching the predicate.
+// - An error, if any error occurs while reading or converting the records.
+func (t *Table) CountWhere(pred func(Record) bool) (int, error) {
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, protoRecord := range allRecords.GetRecords() {
+		record, err := t.fromStoredRecord(protoRecord)
+		if err != nil {
+			return 0, err
+		}
+		if pred(record) {
+			count++
+		}
+	}
+
+	t.metrics.IncrementQueryCount()
+	return count, nil
+}
+
+// Predicate returns a predicate for CountWhere and ExportJSONWhere that matches the records selected by the filters
+// and the Where filter of the query, ignoring its sorting and pagination.
+func (q Query) Predicate() func(Record) bool {
+	filtersPredicate := FiltersPredicate(q.Filters)
+	return func(record Record) bool {
+		return filtersPredicate(record) && (q.Where == nil || q.Where.Match(record))
+	}
+}
+
+// FiltersPredicate returns a predicate for CountWhere that matches the records whose fields are equal to the given filters,
+// with the same semantics as the filters of a Query.
+func FiltersPredicate(filters map[string]interface{}) func(Record) bool {
+	return func(record Record) bool {
+		protoRecord, err := toProtoRecord(record)
+		if err != nil {
+			return false
+		}
+		return match(protoRecord, filters)
+	}
+}
@@ -0,0 +1,175 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// bigID is above 2^53, so it can't be held exactly by a float64.
+const bigID int64 = 1<<53 + 1
+
+func TestLargeIntegersStayExact(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": bigID, "ref": json.Number("9007199254740995")})
+
+	record, err := table.Select(bigID)
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["id"] != bigID {
+		t.Errorf("id = %#v, want %d", record["id"], bigID)
+	}
+	if record["ref"] != int64(9007199254740995) {
+		t.Errorf("ref = %#v, want 9007199254740995", record["ref"])
+	}
+
+	// An update merges the new fields without rounding the stored integers
+	if err := table.Update(bigID, Record{"name": "big"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	results, err := table.Query(Query{Filters: map[string]interface{}{"ref": json.Number("9007199254740995")}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 1 || results[0]["id"] != bigID || results[0]["name"] != "big" {
+		t.Errorf("Query = %v, want the updated record with id %d", results, bigID)
+	}
+
+	// The neighbouring integer rounds to the same float64 but must not match
+	results, err = table.Query(Query{Filters: map[string]interface{}{"ref": json.Number("9007199254740996")}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Query matched %d records for a different integer, want 0", len(results))
+	}
+}
+
+func TestQuerySortsByDecodedValues(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "a", "seq": bigID},
+		Record{"id": "b", "seq": bigID - 1},
+		Record{"id": "c", "seq": 10},
+		Record{"id": "d", "seq": 2.5},
+		Record{"id": "e", "seq": -3},
+		Record{"id": "f"},
+	)
+
+	results, err := table.Query(Query{SortBy: "seq"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var got []interface{}
+	for _, record := range results {
+		got = append(got, record["id"])
+	}
+	// Missing values sort last
+	want := []interface{}{"e", "d", "c", "b", "a", "f"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Query sorted by seq = %v, want %v", got, want)
+	}
+}
+
+func TestQuerySortsIntegerKeys(t *testing.T) {
+	table := newTestTable(t, "id")
+	for _, id := range []int{10, 9, 100, 1} {
+		mustInsert(t, table, Record{"id": id})
+	}
+
+	results, err := table.Query(Query{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var got []interface{}
+	for _, record := range results {
+		got = append(got, record["id"])
+	}
+	want := []interface{}{int64(1), int64(9), int64(10), int64(100)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Query = %v, want the keys in numeric order %v", got, want)
+	}
+}
+
+func TestQueryFiltersMatchStoredValues(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		table := newTestTable(t, "id")
+		if indexed {
+			for _, field := range []string{"code", "qty"} {
+				if err := table.CreateIndex(field); err != nil {
+					t.Fatalf("CreateIndex failed: %v", err)
+				}
+			}
+		}
+		mustInsert(t, table,
+			Record{"id": "a", "code": "1000", "qty": 5},
+			Record{"id": "b", "code": "num:7", "qty": 6},
+		)
+
+		// Filters are converted like the stored values, so strings that look like integers and Go integers match
+		filters := []map[string]interface{}{
+			{"code": "1000"},
+			{"qty": 5},
+			{"qty": int64(5)},
+			{"code": "1000", "qty": json.Number("5")},
+		}
+		for _, filter := range filters {
+			results, err := table.Query(Query{Filters: filter})
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if len(results) != 1 || results[0]["id"] != "a" {
+				t.Errorf("indexed %v: Query(%v) = %v, want a", indexed, filter, results)
+			}
+		}
+
+		results, err := table.Query(Query{Filters: map[string]interface{}{"code": "num:7"}})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if len(results) != 1 || results[0]["id"] != "b" {
+			t.Errorf("indexed %v: Query of a prefixed string = %v, want b", indexed, results)
+		}
+	}
+}
+
+func TestQueryWithTotal(t *testing.T) {
+	table := newTestTable(t, "id")
+	for i := 0; i < 10; i++ {
+		city := "Lima"
+		if i%3 == 0 {
+			city = "Cusco"
+		}
+		mustInsert(t, table, Record{"id": fmt.Sprintf("r%d", i), "city": city})
+	}
+	table.AddReadTransform("city", func(value interface{}) (interface{}, error) {
+		return fmt.Sprintf("%v!", value), nil
+	})
+
+	query := Query{Filters: map[string]interface{}{"city": "Lima"}, Limit: 2, Offset: 1}
+	page, total, err := table.QueryWithTotal(query)
+	if err != nil {
+		t.Fatalf("QueryWithTotal failed: %v", err)
+	}
+	if total != 6 || len(page) != 2 || page[0]["id"] != "r2" || page[0]["city"] != "Lima!" {
+		t.Errorf("QueryWithTotal = %v with a total of %d, want r2 and r4 of 6", page, total)
+	}
+	raw, total, err := table.QueryRawWithTotal(query)
+	if err != nil || total != 6 || len(raw.GetRecords()) != 2 {
+		t.Errorf("QueryRawWithTotal = %d records with a total of %d, %v, want 2 of 6", len(raw.GetRecords()), total, err)
+	}
+
+	// An offset past the results still reports the total
+	query.Offset = 10
+	if page, total, err := table.QueryWithTotal(query); err != nil || len(page) != 0 || total != 6 {
+		t.Errorf("QueryWithTotal past the results = %v with a total of %d, %v, want none of 6", page, total, err)
+	}
+
+	// CountWhere sees the records as they are read, transforms included
+	count, err := table.CountWhere(func(record Record) bool { return record["city"] == "Cusco!" })
+	if err != nil || count != 4 {
+		t.Errorf("CountWhere on the transformed city = %d, %v, want 4", count, err)
+	}
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// recordLockShards is the number of locks the record locks of a table are spread over.
+// Keys hashing to the same shard share a lock, which only costs concurrency, never correctness.
+const recordLockShards = 64
+
+// recordLocks is the sharded lock map of a table. Each shard is a channel with room for one token,
+// so waiting for a shard can be canceled with a context.
+type recordLocks [recordLockShards]chan struct{}
+
+// WithRecordLocks makes the single-record writes of the table (Insert, InsertWithMode, Update, Delete, their Context
+// variants, UpdateIfMatch and DeleteIfMatch) lock the record they write, from a map of locks sharded by primary key,
+// and share the write of the file with the concurrent writes of other records.
+//
+// Without record locks, a write holds the table lock while the whole file is encoded, encrypted and written,
+// so writes to unrelated records wait for each other's file write. With record locks, a write holds the table lock only
+// to apply its change in memory, then waits for a file write holding the change: the first waiting writer writes
+// the latest records, which include the changes of the writers that applied theirs meanwhile, so a burst of writes
+// to distinct records costs a few file writes instead of one per record. A write still returns only once its change is
+// in the file, with the fsync policy of the table applied, and writes to the same record are serialized from the lock
+// of the record to the file write.
+//
+// Readers can see a change from the moment it is applied in memory, slightly before it is in the file.
+// If the file write fails, the writers waiting for it return the error, but their changes stay in memory
+// and are written by the next file write, like the pending writes of WithWriteDebounce.
+// Writes of several records, such as UpdateMany, DeleteKeys or a transaction, lock the table only and write the file themselves,
+// so they never wait for record locks and can't deadlock with single-record writes. The triggers of a write are fired
+// under the locks of the write, before its change is published.
+//
+// The shared file write is not used by tables stored in memory, with one file per record, with an append log
+// or with a write debounce window, which already avoid rewriting the file on each write; their writes still lock the records.
+func WithRecordLocks() TableOption {
+	return func(t *Table) {
+		locks := new(recordLocks)
+		for i := range locks {
+			locks[i] = make(chan struct{}, 1)
+		}
+		t.recordLocks = locks
+	}
+}
+
+// lockRecord locks the record lock of the key, giving up when the context is done, and returns the function unlocking it.
+// A key and its stored form, such as 1 and "num:1", share a lock. It returns a function doing nothing
+// if the table has no record locks or the key is nil, and an error wrapping ErrLockTimeout if the context is done first,
+// or ErrTriggerReentrant if the context is the one of a trigger of a write holding the locks of the table.
+func (t *Table) lockRecord(ctx context.Context, key interface{}) (func(), error) {
+	if err := t.checkTriggerWrite(ctx); err != nil {
+		return nil, err
+	}
+	if t.recordLocks == nil || key == nil {
+		return func() {}, nil
+	}
+	keyStr := fmt.Sprintf("%v", key)
+	if hasKeyTag(keyStr) {
+		_, keyStr, _ = strings.Cut(keyStr, ":")
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(keyStr))
+	lock := t.recordLocks[hash.Sum32()%recordLockShards]
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		t.metrics.IncrementLockTimeouts()
+		return nil, fmt.Errorf("%w: %v", ErrLockTimeout, ctx.Err())
+	}
+}
+
+// lockInserted locks the record lock of the record to be inserted, like lockRecord.
+// A record without a valid primary key, such as a record whose key is generated, has no record to lock.
+func (t *Table) lockInserted(ctx context.Context, record Record) (func(), error) {
+	key, err := t.primaryKeyOf(record)
+	if err != nil {
+		return func() {}, nil
+	}
+	return t.lockRecord(ctx, key)
+}
+
+// groupCommit reports whether the write in progress publishes its change in memory and leaves the file write to awaitCommit.
+// The table must be locked for writing.
+func (t *Table) groupCommit() bool {
+	return t.recordLocks != nil && t.capturing && t.debounce <= 0 && !t.perRecord && !t.isMemory() && t.appendMax <= 0
+}
+
+// awaitCommit returns once the file holds the changes published up to the given sequence number,
+// writing the latest records itself unless another writer already did. It must be called without holding the table lock.
+func (t *Table) awaitCommit(seq uint64) error {
+	t.commitMu.Lock()
+	defer t.commitMu.Unlock()
+	if t.committed >= seq {
+		return nil
+	}
+	// The records loaded after the sequence number hold every change published up to it
+	latest := t.commitSeq.Load()
+	records := t.snapshot.Load()
+	if records == nil {
+		return nil
+	}
+	if err := t.storeRecords(records); err != nil {
+		return err
+	}
+	t.committed = latest
+	return nil
+}
+
+// commitPending writes the changes published in memory that are not in the file yet, if any.
+func (t *Table) commitPending() error {
+	if t.recordLocks == nil {
+		return nil
+	}
+	return t.awaitCommit(t.commitSeq.Load())
+}
@@ -0,0 +1,38 @@
+package data
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// BenchmarkConcurrentUpdates measures updates of distinct records of a table of 1,000 records by 16 goroutines per CPU,
+// with the table lock only and with record locks sharing the file writes.
+func BenchmarkConcurrentUpdates(b *testing.B) {
+	const size = 1000
+	modes := []struct {
+		name string
+		opts []TableOption
+	}{
+		{"table-lock", nil},
+		{"record-locks", []TableOption{WithRecordLocks()}},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			table := newBenchmarkTable(b, size, mode.opts...)
+			var next atomic.Int64
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					// Each update writes the next record, so concurrent updates write distinct records
+					n := next.Add(1)
+					if err := table.Update(fmt.Sprintf("r%06d", n%size), Record{"name": fmt.Sprint(n)}); err != nil {
+						b.Errorf("Update failed: %v", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package data
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// tableRegistry tracks the tables opened by a server by the path of their file, so a file is only ever
+// backed by a single Table. Two instances would each keep their own records in memory, and each write
+// would silently overwrite the writes of the other instance.
+type tableRegistry struct {
+	sync.Mutex                   // Mutex guarding tables
+	tables     map[string]*Table // Open tables by the cleaned absolute path of their file
+}
+
+// newTableRegistry returns an empty registry.
+func newTableRegistry() *tableRegistry {
+	return &tableRegistry{tables: make(map[string]*Table)}
+}
+
+// registryKey returns the key of the file at the given path in the registry.
+func registryKey(filePath string) string {
+	if absPath, err := filepath.Abs(filePath); err == nil {
+		return absPath
+	}
+	return filepath.Clean(filePath)
+}
+
+// open returns the table registered for the file at the given path and true, or creates the table with create,
+// registers it and returns it with false. A nil registry always creates the table.
+func (r *tableRegistry) open(filePath string, create func() *Table) (*Table, bool) {
+	if r == nil {
+		return create(), false
+	}
+	r.Lock()
+	defer r.Unlock()
+	key := registryKey(filePath)
+	if table, exists := r.tables[key]; exists {
+		return table, true
+	}
+	table := create()
+	r.tables[key] = table
+	return table, false
+}
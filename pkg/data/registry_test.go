@@ -0,0 +1,82 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServerReusesOpenTables(t *testing.T) {
+	server, err := NewServerWithConfig(Config{Dir: t.TempDir(), BackupDir: t.TempDir(), AESKey: testAESKey})
+	if err != nil {
+		t.Fatalf("NewServerWithConfig failed: %v", err)
+	}
+	if err := server.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer server.Close()
+
+	first, err := server.GetOrCreateTable("shop", "orders", "id")
+	if err != nil {
+		t.Fatalf("GetOrCreateTable failed: %v", err)
+	}
+	mustInsert(t, first, Record{"id": "o1"})
+	second, err := server.GetOrCreateTable("shop", "orders", "id")
+	if err != nil {
+		t.Fatalf("GetOrCreateTable failed: %v", err)
+	}
+	if second != first {
+		t.Error("GetOrCreateTable opened the same table twice")
+	}
+
+	// Loading the databases again reuses the open table instead of constructing a second one
+	if err := server.LoadDatabases(); err != nil {
+		t.Fatalf("LoadDatabases failed: %v", err)
+	}
+	reloaded, err := server.Table(TableRef{Database: "shop", Table: "orders"})
+	if err != nil {
+		t.Fatalf("Table failed: %v", err)
+	}
+	if reloaded != first {
+		t.Fatal("LoadDatabases constructed a second table for the same file")
+	}
+
+	// So the writes through the table obtained first are not lost by the other one
+	mustInsert(t, first, Record{"id": "o2"})
+	mustInsert(t, reloaded, Record{"id": "o3"})
+	if count, err := first.Count(); err != nil || count != 3 {
+		t.Errorf("Count = %d, %v, want 3", count, err)
+	}
+}
+
+func TestTableRegistryKeysByAbsolutePath(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd failed: %v", err)
+	}
+	relative, err := filepath.Rel(wd, filepath.Join(dir, "t.bin"))
+	if err != nil {
+		t.Fatalf("Rel failed: %v", err)
+	}
+
+	registry := newTableRegistry()
+	created := 0
+	create := func() *Table {
+		created++
+		return &Table{}
+	}
+	first, opened := registry.open(filepath.Join(dir, "sub", "..", "t.bin"), create)
+	if opened {
+		t.Error("open of a new file reported an open table")
+	}
+	second, opened := registry.open(relative, create)
+	if !opened || second != first || created != 1 {
+		t.Errorf("open of the same file by a relative path = %p, %v, want the table %p", second, opened, first)
+	}
+
+	var none *tableRegistry
+	if _, opened := none.open(relative, create); opened || created != 2 {
+		t.Error("open on a nil registry reused a table, want a new one")
+	}
+}
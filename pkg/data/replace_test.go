@@ -0,0 +1,135 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReplaceVersusUpdate(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "updated", "name": "a", "email": "a@example.com"},
+		Record{"id": "replaced", "name": "b", "email": "b@example.com"},
+	)
+
+	if err := table.Update("updated", Record{"name": "x"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := table.Replace("replaced", Record{"name": "y"}); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+
+	updated, err := table.Select("updated")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if updated["name"] != "x" || updated["email"] != "a@example.com" {
+		t.Errorf("Update = %v, want the name changed and the email kept", updated)
+	}
+
+	replaced, err := table.Select("replaced")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if replaced["name"] != "y" || replaced["id"] != "replaced" {
+		t.Errorf("Replace = %v, want the new name under the same key", replaced)
+	}
+	if _, ok := replaced["email"]; ok {
+		t.Errorf("Replace kept the email field: %v", replaced)
+	}
+}
+
+func TestReplaceResolvesKeys(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": 5, "name": "five"})
+
+	if err := table.Replace("5", Record{"name": "by string"}); err != nil {
+		t.Fatalf("Replace(\"5\") failed: %v", err)
+	}
+	if err := table.Replace(5, Record{"name": "by integer"}); err != nil {
+		t.Fatalf("Replace(5) failed: %v", err)
+	}
+	record, err := table.Select(5)
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["name"] != "by integer" || record["id"] != int64(5) {
+		t.Errorf("record = %v, want the last replacement under the integer key", record)
+	}
+
+	if err := table.Replace("missing", Record{"name": "x"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Replace of a missing key error = %v, want %v", err, ErrNotFound)
+	}
+	if err := table.Replace(5, Record{"id": 6}); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("Replace changing the key error = %v, want %v", err, ErrPrimaryKeyChange)
+	}
+}
+
+func TestReplaceCompositeKeepsKeyFields(t *testing.T) {
+	table := newTestTable(t, "id", WithCompositeKey("tenant", "user"))
+	mustInsert(t, table, Record{"tenant": "t1", "user": "u1", "name": "a"})
+
+	if err := table.Replace("t1|u1", Record{"name": "b"}); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	record, err := table.Select("t1|u1")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["tenant"] != "t1" || record["user"] != "u1" || record["name"] != "b" {
+		t.Errorf("record = %v, want the key fields kept", record)
+	}
+	if err := table.Replace("t1|u1", Record{"tenant": "t2"}); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("Replace changing a key field error = %v, want %v", err, ErrPrimaryKeyChange)
+	}
+}
+
+func TestReplaceFiresUpdateTriggers(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "name": "old", "extra": true})
+
+	var events []ChangeEvent
+	table.AddTrigger(OpUpdate, func(event ChangeEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err := table.Replace("a", Record{"name": "new"}); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d update events, want 1", len(events))
+	}
+	if events[0].Old["name"] != "old" || events[0].New["name"] != "new" {
+		t.Errorf("event = %+v, want the old and new records", events[0])
+	}
+
+	table.AddTrigger(OpUpdate, func(event ChangeEvent) error {
+		return errors.New("refused")
+	})
+	if err := table.Replace("a", Record{"name": "rejected"}); err == nil {
+		t.Fatal("Replace succeeded, want the error of the trigger")
+	}
+	record, err := table.Select("a")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["name"] != "new" || record["extra"] != nil {
+		t.Errorf("record = %v, want the replacement rolled back", record)
+	}
+}
+
+func TestReplaceWithRecordLocks(t *testing.T) {
+	table := newTestTable(t, "id", WithRecordLocks())
+	mustInsert(t, table, Record{"id": 1, "name": "a"})
+	if err := table.Replace(1, Record{"name": "b"}); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	reopened := openTestTable(t, "id", table.FilePath)
+	record, err := reopened.Select(1)
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["name"] != "b" {
+		t.Errorf("name in the file = %v, want b", record["name"])
+	}
+}
@@ -0,0 +1,167 @@
+package data
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// ErrReadOnly is returned by the writes on the databases and tables of a read-only replica server.
+var ErrReadOnly = errors.New("server is a read-only replica")
+
+// DefaultReplicaPollInterval is the interval at which a replica checks the table files for changes if WithReplica is given no interval.
+const DefaultReplicaPollInterval = 500 * time.Millisecond
+
+// WithReplica makes the server a read-only replica of the server writing to the same data directory.
+// The replica loads the databases like any server, but every write on them fails with an error wrapping ErrReadOnly.
+// A background goroutine started by Initialize checks the files of the tables every interval
+// and reloads a table once its file changed and then stayed unchanged for a whole interval,
+// so the burst of writes of a busy primary is coalesced into one reload. Files replaced by renaming a new file over them,
+// as tables do when they write, are detected like files written in place.
+//
+// The replica is eventually consistent: a write on the primary becomes visible on the replica between one and two
+// intervals after it reaches the file, plus the time to reload the table. Writes the primary coalesces with
+// WithWriteDebounce only reach the file when it flushes them. Tables and databases created on the primary
+// after the replica was initialized are not loaded until the replica is restarted.
+// A non-positive interval uses DefaultReplicaPollInterval. The watcher is stopped by Server.Close.
+func WithReplica(interval time.Duration) ServerOption {
+	return func(s *Server) {
+		if interval <= 0 {
+			interval = DefaultReplicaPollInterval
+		}
+		s.readOnly = true
+		s.replicaInterval = interval
+	}
+}
+
+// withReadOnly makes the table refuse every write with an error wrapping ErrReadOnly.
+func withReadOnly() TableOption {
+	return func(t *Table) {
+		t.readOnly = true
+	}
+}
+
+// fileState is the last known state of the file of a table watched by a replica.
+type fileState struct {
+	info    os.FileInfo // Information of the file when it was last checked, nil if it did not exist
+	logInfo os.FileInfo // Information of the append log of the table when it was last checked, nil if it did not exist
+	pending bool        // Whether the file changed and the table wasn't reloaded since
+}
+
+// startReplicaWatcher starts the background goroutine of a replica server that reloads the tables whose file changed.
+func (s *Server) startReplicaWatcher() {
+	if !s.readOnly || s.stopReplica != nil {
+		return
+	}
+	s.stopReplica = make(chan struct{})
+	go s.watchTables(s.replicaInterval, s.stopReplica)
+}
+
+// watchTables checks the files of the tables of the server every interval until stop is closed.
+func (s *Server) watchTables(interval time.Duration, stop chan struct{}) {
+	states := make(map[*Table]*fileState)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		for _, table := range s.allTables() {
+			state, exists := states[table]
+			if !exists {
+				// The table was loaded from the current file
+				states[table] = &fileState{info: table.watchedFileInfo(), logInfo: statOrNil(table.fs(), appendLogPath(table.FilePath))}
+				continue
+			}
+			info, logInfo := table.watchedFileInfo(), statOrNil(table.fs(), appendLogPath(table.FilePath))
+			if fileChanged(state.info, info) || fileChanged(state.logInfo, logInfo) {
+				// Wait for the file to stay unchanged for an interval before reloading it
+				state.info = info
+				state.logInfo = logInfo
+				state.pending = true
+				continue
+			}
+			if state.pending {
+				if err := table.reload(); err != nil {
+					log.Printf("Failed to reload table %s, retrying: %v", table.FilePath, err)
+					continue
+				}
+				state.pending = false
+			}
+		}
+	}
+}
+
+// allTables returns the tables of every database of the server.
+func (s *Server) allTables() []*Table {
+	s.RLock()
+	defer s.RUnlock()
+
+	var tables []*Table
+	for _, db := range s.Databases {
+		db.RLock()
+		for _, table := range db.Tables {
+			tables = append(tables, table)
+		}
+		db.RUnlock()
+	}
+	return tables
+}
+
+// watchedFileInfo returns the information of the file holding the records of the table, or of the directory of
+// the record files of a table with one file per record, whose modification time changes when a file is renamed into it.
+// It returns nil if the file does not exist.
+func (t *Table) watchedFileInfo() os.FileInfo {
+	watched := t.FilePath
+	if t.perRecord {
+		watched = recordsDirPath(t.FilePath)
+	}
+	return statOrNil(t.fs(), watched)
+}
+
+// statOrNil returns the information of the file at the given path of the storage, or nil if it does not exist.
+func statOrNil(storage Storage, filePath string) os.FileInfo {
+	info, err := storage.Stat(filePath)
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// fileChanged reports whether a file changed between two checks: it was created, removed or replaced by another file,
+// or its size or modification time changed. Whether it was replaced is only known for the files of the local disk.
+func fileChanged(before, after os.FileInfo) bool {
+	if before == nil || after == nil {
+		return before != after
+	}
+	replaced := before.Sys() != nil && !os.SameFile(before, after)
+	return replaced || before.Size() != after.Size() || !before.ModTime().Equal(after.ModTime())
+}
+
+// reload replaces the records, the indexes and the cache of the table with the records read from its file.
+// A table evicted from memory is left evicted, since it is read from the file on its next access anyway.
+func (t *Table) reload() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if !t.loaded.Load() {
+		return nil
+	}
+	records, err := t.readRecordsFromFile()
+	if err != nil {
+		return err
+	}
+	t.Records = records.GetRecords()
+	t.Cache = make(map[string]*dbdata.Record)
+	t.sizesKnown.Store(false)
+	t.publishSnapshot(records)
+	t.rebuildIndexes(records.GetRecords())
+	t.resetRecordFiles(true)
+	return nil
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// DefaultIORetryBackoff is the delay before the first retry of WithIORetry if it is given no backoff.
+const DefaultIORetryBackoff = 10 * time.Millisecond
+
+// WithIORetry makes the table retry the reads and writes of its files that fail with a transient error,
+// such as EAGAIN, EINTR, EBUSY, ETIMEDOUT or the ESTALE of an NFS server that restarted, up to attempts times in total.
+// The delay before each retry starts at backoff and doubles after every failed attempt. Other errors, such as a missing
+// permission, a full disk or a corrupted file, fail the operation at once. The table lock is held while waiting,
+// so the other operations on the table wait for the retries too. Retries are disabled by default, so the errors
+// of flaky storage are reported at once; an attempts count of one or less keeps them disabled,
+// and a non-positive backoff uses DefaultIORetryBackoff.
+func WithIORetry(attempts int, backoff time.Duration) TableOption {
+	return func(t *Table) {
+		if backoff <= 0 {
+			backoff = DefaultIORetryBackoff
+		}
+		t.ioAttempts = attempts
+		t.ioBackoff = backoff
+	}
+}
+
+// isTransientIOError reports whether the error of a file operation may go away if the operation is retried.
+func isTransientIOError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EAGAIN, syscall.EINTR, syscall.EBUSY, syscall.ETIMEDOUT, syscall.ESTALE} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// retryIO runs the file operation, retrying it with the backoff of WithIORetry while it fails with a transient error.
+// It returns the error of the last attempt.
+func (t *Table) retryIO(operation func() error) error {
+	err := operation()
+	delay := t.ioBackoff
+	for attempt := 1; attempt < t.ioAttempts && err != nil && isTransientIOError(err); attempt++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = operation()
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// keySnapshot holds the primary keys of a snapshot of the records, sorted, so they are sorted only once per snapshot.
+type keySnapshot struct {
+	records *dbdata.Records // Snapshot whose keys are sorted
+	keys    []string        // Sorted stored keys of the snapshot
+}
+
+// sortedKeysOf returns the sorted stored keys of the given snapshot of the records.
+// The keys are cached until a writer publishes a new snapshot, so consecutive scans of an unchanged table
+// don't sort them again.
+func (t *Table) sortedKeysOf(records *dbdata.Records) []string {
+	if cached := t.sortedKeys.Load(); cached != nil && cached.records == records {
+		return cached.keys
+	}
+	keys := make([]string, 0, len(records.GetRecords()))
+	for key := range records.GetRecords() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	t.sortedKeys.Store(&keySnapshot{records: records, keys: keys})
+	return keys
+}
+
+// ScanPrefix is a method of the Table struct that returns the records whose string primary key starts with the given prefix,
+// which suits hierarchical keys such as "user:123:order:456": ScanPrefix("user:123:") returns every order of the user.
+// It reads the current snapshot of the records without locking the table, and finds the matching keys by binary search
+// in the sorted keys of the snapshot, so it only visits the records that match.
+// Only string keys are matched: the integer key 12 doesn't match the prefix "1", while the string key "12" does.
+//
+// Parameters:
+// - prefix: The prefix of the primary keys. An empty prefix matches every string key.
+//
+// Returns:
+// - A slice of the matching records, sorted by primary key. It is empty, not nil, if no key matches.
+// - An error, if an error occurs while reading or converting the records.
+func (t *Table) ScanPrefix(prefix string) ([]Record, error) {
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return nil, err
+	}
+	keys := t.sortedKeysOf(allRecords)
+
+	// String keys are stored as they are, or with the string tag if they look like an integer or a tagged key,
+	// so the matching keys are in two ranges of the sorted keys
+	type match struct {
+		key    string // Primary key without its tag
+		stored string // Key under which the record is stored
+	}
+	var matches []match
+	for i := sort.SearchStrings(keys, prefix); i < len(keys) && strings.HasPrefix(keys[i], prefix); i++ {
+		if !hasKeyTag(keys[i]) {
+			matches = append(matches, match{key: keys[i], stored: keys[i]})
+		}
+	}
+	taggedPrefix := stringKeyTag + prefix
+	for i := sort.SearchStrings(keys, taggedPrefix); i < len(keys) && strings.HasPrefix(keys[i], taggedPrefix); i++ {
+		matches = append(matches, match{key: strings.TrimPrefix(keys[i], stringKeyTag), stored: keys[i]})
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].key < matches[j].key })
+
+	records := make([]Record, 0, len(matches))
+	for _, m := range matches {
+		record, err := t.fromStoredRecord(allRecords.Records[m.stored])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	t.metrics.IncrementQueryCount()
+	return records, nil
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanPrefix(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "user:1:order:2"},
+		Record{"id": "user:12:order:1"},
+		Record{"id": "user:1:order:1"},
+		Record{"id": "user:2:order:1"},
+		Record{"id": "admin"},
+		Record{"id": "123"},
+		Record{"id": "1x"},
+		Record{"id": 12},
+	)
+
+	tests := []struct {
+		prefix string
+		want   []interface{}
+	}{
+		{"user:1:", []interface{}{"user:1:order:1", "user:1:order:2"}},
+		// Keys are sorted bytewise, so "user:12" sorts before "user:1:"
+		{"user:1", []interface{}{"user:12:order:1", "user:1:order:1", "user:1:order:2"}},
+		{"user:", []interface{}{"user:12:order:1", "user:1:order:1", "user:1:order:2", "user:2:order:1"}},
+		{"user:3", []interface{}{}},
+		{"zzz", []interface{}{}},
+		// String keys that look like integers are stored tagged and still match, unlike the integer key 12
+		{"1", []interface{}{"123", "1x"}},
+		{"", []interface{}{"123", "1x", "admin", "user:12:order:1", "user:1:order:1", "user:1:order:2", "user:2:order:1"}},
+	}
+	for _, tt := range tests {
+		records, err := table.ScanPrefix(tt.prefix)
+		if err != nil {
+			t.Fatalf("ScanPrefix(%q) failed: %v", tt.prefix, err)
+		}
+		got := make([]interface{}, 0, len(records))
+		for _, record := range records {
+			got = append(got, record["id"])
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ScanPrefix(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+
+	// The sorted keys follow the writes
+	if err := table.Delete("user:1:order:1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	mustInsert(t, table, Record{"id": "user:1:order:3"})
+	records, err := table.ScanPrefix("user:1:")
+	if err != nil {
+		t.Fatalf("ScanPrefix failed: %v", err)
+	}
+	if len(records) != 2 || records[0]["id"] != "user:1:order:2" || records[1]["id"] != "user:1:order:3" {
+		t.Errorf("ScanPrefix after the writes = %v, want orders 2 and 3", records)
+	}
+}
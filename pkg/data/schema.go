@@ -0,0 +1,238 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"unicode/utf8"
+)
+
+// FieldType is the type of the values of a field declared in a Schema.
+type FieldType string
+
+const (
+	TypeAny    FieldType = "any"    // Any value
+	TypeString FieldType = "string" // String values
+	TypeInt    FieldType = "int"    // Integer values
+	TypeFloat  FieldType = "float"  // Floating point values
+	TypeNumber FieldType = "number" // Integer or floating point values
+	TypeBool   FieldType = "bool"   // Boolean values
+	TypeBlob   FieldType = "blob"   // []byte values, see SelectBlob
+	TypeList   FieldType = "list"   // List values
+	TypeObject FieldType = "object" // Nested object values
+)
+
+// FieldSchema declares a field of a Schema.
+type FieldSchema struct {
+	Type        FieldType `json:"Type"`                  // Type of the values of the field
+	Required    bool      `json:"Required,omitempty"`    // Whether every record must have the field
+	RequireUTF8 bool      `json:"RequireUTF8,omitempty"` // Whether the writes reject string values that are not valid UTF-8
+	MaxRunes    int       `json:"MaxRunes,omitempty"`    // Maximum number of runes of the string values accepted by the writes, unlimited if zero
+}
+
+// ErrInvalidString is returned by the writes when a string value breaks the RequireUTF8 or MaxRunes rule of the schema of its field.
+var ErrInvalidString = errors.New("invalid string value")
+
+// Schema declares the fields the records of a table are expected to have.
+// Apart from the RequireUTF8 and MaxRunes rules of the string fields, it is not enforced by the writes on the table; Validate checks the stored records against it,
+// which reveals the drift between a schema updated by an application and records written by older versions.
+// Fields not declared in the schema are reported as unexpected.
+type Schema map[string]FieldSchema
+
+// SchemaIssue describes a mismatch between a stored record and the schema of the table.
+type SchemaIssue struct {
+	Key   string // Primary key of the record
+	Field string // Field of the record
+	Issue string // Description of the mismatch
+}
+
+// WithSchema declares the schema of the table. It is saved in the metadata file of the table by Database.CreateTable.
+// When a table with a schema is loaded, the records are validated against it and the drift, if any, is logged.
+func WithSchema(schema Schema) TableOption {
+	return func(t *Table) {
+		t.schema = schema
+	}
+}
+
+// SetSchema is a method of the Table struct that declares or replaces the schema of the table and saves it in its metadata file.
+// Existing records are not modified; use Validate to find the records that don't match the new schema.
+//
+// Parameters:
+// - schema: The new schema of the table, or nil to remove it.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the schema uses an unknown type or an error occurs while saving the metadata, it returns an error.
+func (t *Table) SetSchema(schema Schema) error {
+	for field, fieldSchema := range schema {
+		if !fieldSchema.Type.valid() {
+			return fmt.Errorf("unknown type %q for field %s", fieldSchema.Type, field)
+		}
+		if fieldSchema.MaxRunes < 0 {
+			return fmt.Errorf("negative maximum number of runes for field %s", field)
+		}
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	previous := t.schema
+	t.schema = schema
+	if err := t.saveMetadata(); err != nil {
+		t.schema = previous
+		return err
+	}
+	return nil
+}
+
+// Validate is a method of the Table struct that checks the stored records against the schema of the table without modifying them.
+// It reports the required fields missing from a record, the fields not declared in the schema,
+// and the fields whose value doesn't have the declared type. Nil values match any type.
+// It reads the current snapshot of the records without locking the table.
+//
+// Returns:
+// - A slice of SchemaIssue, one for each mismatch, sorted by record key and field. It is empty if every record matches the schema.
+// - An error, if the table has no schema or an error occurs while reading the records.
+func (t *Table) Validate() ([]SchemaIssue, error) {
+	t.RLock()
+	schema := t.schema
+	t.RUnlock()
+	if schema == nil {
+		return nil, fmt.Errorf("table has no schema")
+	}
+
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make([]SchemaIssue, 0)
+	for key, protoRecord := range allRecords.GetRecords() {
+		record, err := fromProtoRecord(protoRecord)
+		if err != nil {
+			return nil, err
+		}
+		for field, fieldSchema := range schema {
+			if _, exists := record[field]; !exists && fieldSchema.Required {
+				issues = append(issues, SchemaIssue{Key: key, Field: field, Issue: "missing required field"})
+			}
+		}
+		for field, value := range record {
+			fieldSchema, declared := schema[field]
+			if !declared {
+				if field != t.PrimaryKey {
+					issues = append(issues, SchemaIssue{Key: key, Field: field, Issue: "field is not declared in the schema"})
+				}
+				continue
+			}
+			if value != nil && !fieldSchema.Type.matches(value) {
+				issues = append(issues, SchemaIssue{Key: key, Field: field, Issue: fmt.Sprintf("expected type %s, got %T", fieldSchema.Type, value)})
+			}
+			if err := fieldSchema.checkStrings(value); err != nil {
+				issues = append(issues, SchemaIssue{Key: key, Field: field, Issue: err.Error()})
+			}
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Key != issues[j].Key {
+			return issues[i].Key < issues[j].Key
+		}
+		return issues[i].Field < issues[j].Field
+	})
+	return issues, nil
+}
+
+// logSchemaDrift validates the records against the schema of the table, if any, and logs the number of mismatches.
+func (t *Table) logSchemaDrift() {
+	if t.schema == nil {
+		return
+	}
+	issues, err := t.Validate()
+	if err != nil {
+		log.Printf("Failed to validate %s against its schema: %v", t.FilePath, err)
+		return
+	}
+	if len(issues) > 0 {
+		log.Printf("Schema drift in %s: %d issues, the first one is record %s field %s: %s; call Validate for the full report",
+			t.FilePath, len(issues), issues[0].Key, issues[0].Field, issues[0].Issue)
+	}
+}
+
+// checkStrings returns an error wrapping ErrInvalidString for each field of the record whose string values
+// break the RequireUTF8 or MaxRunes rule of the schema of the field. The values of the strings of lists are checked too.
+// Values sent as JSON are always valid UTF-8, since the decoder replaces invalid bytes, so the UTF-8 rule
+// protects the table from the strings written by Go callers, which could otherwise not be served as JSON.
+func (s Schema) checkStrings(record Record) error {
+	for field, value := range record {
+		fieldSchema, declared := s[field]
+		if !declared {
+			continue
+		}
+		if err := fieldSchema.checkStrings(value); err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// checkStrings returns an error wrapping ErrInvalidString if the value, or an element of it if it is a list,
+// is a string breaking the RequireUTF8 or MaxRunes rule of the field.
+func (fs FieldSchema) checkStrings(value interface{}) error {
+	if !fs.RequireUTF8 && fs.MaxRunes <= 0 {
+		return nil
+	}
+	switch v := value.(type) {
+	case string:
+		if fs.RequireUTF8 && !utf8.ValidString(v) {
+			return fmt.Errorf("%w: %q is not valid UTF-8", ErrInvalidString, v)
+		}
+		if fs.MaxRunes > 0 && utf8.RuneCountInString(v) > fs.MaxRunes {
+			return fmt.Errorf("%w: string of %d runes is longer than the maximum of %d", ErrInvalidString, utf8.RuneCountInString(v), fs.MaxRunes)
+		}
+	case []string:
+		for _, element := range v {
+			if err := fs.checkStrings(element); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, element := range v {
+			if err := fs.checkStrings(element); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// valid reports whether the type is one of the known field types.
+func (ft FieldType) valid() bool {
+	switch ft {
+	case TypeAny, TypeString, TypeInt, TypeFloat, TypeNumber, TypeBool, TypeBlob, TypeList, TypeObject:
+		return true
+	}
+	return false
+}
+
+// matches reports whether a decoded value has the type.
+func (ft FieldType) matches(value interface{}) bool {
+	switch value.(type) {
+	case string:
+		return ft == TypeAny || ft == TypeString
+	case int64:
+		return ft == TypeAny || ft == TypeInt || ft == TypeNumber
+	case float64:
+		return ft == TypeAny || ft == TypeFloat || ft == TypeNumber
+	case bool:
+		return ft == TypeAny || ft == TypeBool
+	case []byte:
+		return ft == TypeAny || ft == TypeBlob
+	case []interface{}:
+		return ft == TypeAny || ft == TypeList
+	case map[string]interface{}:
+		return ft == TypeAny || ft == TypeObject
+	}
+	return ft == TypeAny
+}
@@ -0,0 +1,65 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+// invalidUTF8 holds a truncated two-byte sequence and a lone continuation byte.
+const invalidUTF8 = "caf\xc3 \x80"
+
+func TestSchemaRejectsInvalidUTF8(t *testing.T) {
+	table := newTestTable(t, "id")
+	err := table.SetSchema(Schema{
+		"name": {Type: TypeString, RequireUTF8: true},
+		"tags": {Type: TypeList, RequireUTF8: true},
+	})
+	if err != nil {
+		t.Fatalf("SetSchema failed: %v", err)
+	}
+	mustInsert(t, table, Record{"id": "a", "name": "café", "tags": []interface{}{"ok"}})
+
+	writes := map[string]func() error{
+		"Insert":     func() error { return table.Insert(Record{"id": "b", "name": invalidUTF8}) },
+		"InsertMany": func() error { return table.InsertMany([]Record{{"id": "c", "tags": []interface{}{"ok", invalidUTF8}}}) },
+		"Update":     func() error { return table.Update("a", Record{"name": invalidUTF8}) },
+		"Replace":    func() error { return table.Replace("a", Record{"id": "a", "name": invalidUTF8}) },
+		"UpdateWhere": func() error {
+			_, err := table.UpdateWhere(func(Record) bool { return true }, Record{"name": invalidUTF8})
+			return err
+		},
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrInvalidString) {
+			t.Errorf("%s of invalid UTF-8 = %v, want ErrInvalidString", name, err)
+		}
+	}
+
+	record, err := table.Select("a")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["name"] != "café" {
+		t.Errorf("name = %q, want the valid value written first", record["name"])
+	}
+	if count, err := table.Count(); err != nil || count != 1 {
+		t.Errorf("Count = %d, %v, want 1", count, err)
+	}
+}
+
+func TestSchemaMaxRunes(t *testing.T) {
+	table := newTestTable(t, "id")
+	if err := table.SetSchema(Schema{"code": {Type: TypeString, MaxRunes: 3}}); err != nil {
+		t.Fatalf("SetSchema failed: %v", err)
+	}
+
+	// Runes are counted, not bytes
+	mustInsert(t, table, Record{"id": "a", "code": "ñéü"})
+	if err := table.Insert(Record{"id": "b", "code": "abcd"}); !errors.Is(err, ErrInvalidString) {
+		t.Errorf("Insert of 4 runes = %v, want ErrInvalidString", err)
+	}
+
+	if err := table.SetSchema(Schema{"code": {Type: TypeString, MaxRunes: -1}}); err == nil {
+		t.Error("SetSchema with a negative MaxRunes succeeded, want an error")
+	}
+}
@@ -2,75 +2,239 @@ package data
 
 import (
 	"archive/zip"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Server struct {
-	sync.RWMutex                      // Mutex to ensure the server is thread safe
-	Databases    map[string]*Database // Map of Databases in the server
+	sync.RWMutex                         // Mutex to ensure the server is thread safe
+	Databases       map[string]*Database // Map of Databases in the server
+	lru             *tableLRU            // LRU of hot tables shared by all databases, if the number of hot tables is capped
+	auditLog        bool                 // Whether the audit log of every database is enabled
+	maxDatabases    int                  // Maximum number of databases, unlimited if zero
+	maxTables       int                  // Maximum number of tables per database, unlimited if zero
+	maxSelectAll    int                  // Maximum number of records of a selectAll request, DefaultMaxSelectAll if zero, unlimited if negative
+	readOnly        bool                 // Whether the server is a read-only replica, see WithReplica
+	replicaInterval time.Duration        // Interval at which a replica checks the table files for changes
+	stopReplica     chan struct{}        // Channel closed to stop the watcher of a replica
+	registry        *tableRegistry       // Tables opened by the server by the path of their file, so each file has a single Table
+	dir             string               // Directory of the databases, the default server directory if empty, see Config
+	backupDir       string               // Directory of the backups, the default backup directory if empty, see Config
+	aesKey          []byte               // AES key of the files, the AES_KEY environment variable if nil, see Config
+	adminToken      string               // Token of the admin endpoints of the HTTP API, if set by Config
+	storage         Storage              // Storage of the files of the server, LocalStorage if nil, see WithServerStorage
+	debounce        time.Duration        // Write debounce window of the tables of the server, none if zero, see WithServerWriteDebounce
+}
+
+// ErrLimitReached is returned when creating a database or a table would exceed a cap set by WithMaxDatabases or WithMaxTablesPerDatabase.
+var ErrLimitReached = errors.New("limit reached")
+
+// ServerOption is a function that configures optional settings of a Server when it is created.
+type ServerOption func(*Server)
+
+// WithMaxHotTables caps how many tables of the server keep their records and indexes resident in memory.
+// When the cap is exceeded, the least recently used tables are flushed and evicted from memory,
+// and reloaded lazily from their files on their next access. This bounds the memory used by servers with many tables.
+// A table is not evicted while a read or a write holds its lock, so the cap can be exceeded until that table is touched again.
+// A non-positive cap means unlimited, which is the default.
+func WithMaxHotTables(maxTables int) ServerOption {
+	return func(s *Server) {
+		if maxTables > 0 {
+			s.lru = newTableLRU(maxTables)
+		} else {
+			s.lru = nil
+		}
+	}
+}
+
+// WithMaxDatabases caps the number of databases of the server, so a shared deployment can't be exhausted
+// by clients creating databases. CreateDatabase fails with an error wrapping ErrLimitReached once the cap is reached.
+// Databases loaded from the server directory count towards the cap but are always loaded.
+// A non-positive cap means unlimited, which is the default.
+func WithMaxDatabases(maxDatabases int) ServerOption {
+	return func(s *Server) {
+		s.maxDatabases = max(maxDatabases, 0)
+	}
+}
+
+// WithMaxTablesPerDatabase caps the number of tables of each database of the server.
+// CreateTable fails with an error wrapping ErrLimitReached once a database has that many tables.
+// Tables loaded from the database directory count towards the cap but are always loaded.
+// A non-positive cap means unlimited, which is the default.
+func WithMaxTablesPerDatabase(maxTables int) ServerOption {
+	return func(s *Server) {
+		s.maxTables = max(maxTables, 0)
+	}
+}
+
+// DefaultMaxSelectAll is the maximum number of records returned by a selectAll request of the HTTP API,
+// unless the server is created with WithMaxSelectAll.
+const DefaultMaxSelectAll = 100000
+
+// WithMaxSelectAll caps the number of records returned by a selectAll request of the HTTP API, which returns every record
+// of a table at once, so a client can't dump a huge table by accident. A selectAll on a table holding more records fails
+// with 413 Request Entity Too Large, and the records must be read in pages with the query action and its limit and offset.
+// Zero keeps DefaultMaxSelectAll and a negative cap means unlimited. The Go methods of the tables are not capped.
+func WithMaxSelectAll(maxRecords int) ServerOption {
+	return func(s *Server) {
+		s.maxSelectAll = maxRecords
+	}
+}
+
+// MaxSelectAll is a method of the Server struct that returns the maximum number of records returned by a selectAll
+// request of the HTTP API, set by WithMaxSelectAll, or 0 if it is unlimited.
+func (s *Server) MaxSelectAll() int {
+	switch {
+	case s.maxSelectAll < 0:
+		return 0
+	case s.maxSelectAll == 0:
+		return DefaultMaxSelectAll
+	}
+	return s.maxSelectAll
 }
 
 // NewServer creates a new Server instance.
 // It initializes the Databases field as an empty map where the key is a string representing the database name
 // and the value is a pointer to a Database instance.
+// It applies the given ServerOption values to the server.
 // It returns a pointer to the newly created Server instance.
-func NewServer() *Server {
-	return &Server{
+func NewServer(opts ...ServerOption) *Server {
+	server := &Server{
 		Databases: make(map[string]*Database),
+		registry:  newTableRegistry(),
+	}
+	for _, opt := range opts {
+		opt(server)
 	}
+	return server
 }
 
 // Initialize is a method of the Server struct that initializes the server.
 // It creates the server directory and loads the databases.
-// The server directory is determined by the getDefaultServerDir function.
+// The server directory is set by Config or determined by the getDefaultServerDir function.
 // If the server directory does not exist, it is created with read, write, and execute permissions for the user only.
 // If there is an error creating the server directory, the error is returned.
+// Unless the server is a read-only replica, a file is then created and removed in the server directory, so a directory
+// the server can't write to, for example because of its permissions or a read-only mount, fails at startup
+// instead of at the first write.
 // After the server directory is successfully created or if it already exists, the databases are loaded using the LoadDatabases method.
 // If there is an error loading the databases, the error is returned.
 // If the server directory is successfully created and the databases are successfully loaded, the method returns nil.
 func (s *Server) Initialize() error {
-	serverDir := getDefaultServerDir()
-	if err := os.MkdirAll(serverDir, 0755); err != nil {
+	serverDir := s.serverDir()
+	if err := s.fs().MkdirAll(serverDir, 0755); err != nil {
 		return fmt.Errorf("failed to create or access server directory: %v", err)
 	}
+	if !s.readOnly {
+		if err := s.checkWritable(serverDir); err != nil {
+			return err
+		}
+	}
 
-	return s.LoadDatabases()
+	if err := s.LoadDatabases(); err != nil {
+		return err
+	}
+	s.startReplicaWatcher()
+	return nil
+}
+
+// writeProbeName is the name of the file checkWritable creates in the server directory.
+// It is not a directory, so LoadDatabases ignores it if it is left behind.
+const writeProbeName = ".protodb-write-probe"
+
+// checkWritable returns an error if a file can't be created and removed in the directory.
+func (s *Server) checkWritable(dir string) error {
+	probe := filepath.Join(dir, writeProbeName+"-"+processID)
+	file, err := s.fs().OpenFile(probe, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("server directory %s is not writable: %v", dir, err)
+	}
+	if err := file.Close(); err != nil {
+		s.fs().Remove(probe)
+		return fmt.Errorf("server directory %s is not writable: %v", dir, err)
+	}
+	if err := s.fs().Remove(probe); err != nil {
+		return fmt.Errorf("server directory %s is not writable: failed to remove %s: %v", dir, probe, err)
+	}
+	return nil
 }
 
 // LoadDatabases is a method of the Server struct that loads the databases from the server directory.
-// It reads the server directory using the os.ReadDir function and the getDefaultServerDir function.
+// It reads the server directory, set by Config or determined by the getDefaultServerDir function, using the os.ReadDir function.
 // If there is an error reading the server directory, the error is returned.
 // For each directory in the server directory, it creates a new Database instance with the directory name as the database name.
 // It then loads the tables from the database directory using the LoadTables method of the Database struct.
 // If there is an error loading the tables, the error is returned.
 // If the tables are successfully loaded, the database is added to the Databases field of the Server struct.
+// A table whose file was already opened by the server is not constructed again: the existing *Table is reloaded
+// from its file and reused, so callers holding it never write through a stale copy of the table.
 // If all databases are successfully loaded, the method returns nil.
 func (s *Server) LoadDatabases() error {
-	dbs, err := os.ReadDir(getDefaultServerDir())
+	dbs, err := s.fs().ReadDir(s.serverDir())
 	if err != nil {
 		return fmt.Errorf("failed to read server directory: %v", err)
 	}
 
 	for _, dbInfo := range dbs {
 		if dbInfo.IsDir() {
-			dbDir := filepath.Join(getDefaultServerDir(), dbInfo.Name())
-			db := NewDatabase(dbInfo.Name())
+			dbDir := filepath.Join(s.serverDir(), dbInfo.Name())
+			db := s.newDatabase(dbInfo.Name())
 			if err := db.LoadTables(dbDir); err != nil {
 				return err
 			}
+			if s.auditLog {
+				if err := db.EnableAuditLog(); err != nil {
+					return err
+				}
+			}
 			s.Databases[dbInfo.Name()] = db
 		}
 	}
 	return nil
 }
 
+// newDatabase returns a new database of the server, which shares the settings of the server, without adding it to the server.
+func (s *Server) newDatabase(name string) *Database {
+	db := NewDatabase(name)
+	db.registry = s.registry
+	db.lru = s.lru
+	db.maxTables = s.maxTables
+	db.readOnly = s.readOnly
+	db.serverDir = s.serverDir()
+	db.aesKey = s.aesKey
+	db.storage = s.storage
+	db.debounce = s.debounce
+	return db
+}
+
+// serverDir returns the directory of the databases of the server, set by Config or the default server directory.
+func (s *Server) serverDir() string {
+	if s.dir != "" {
+		return s.dir
+	}
+	return getDefaultServerDir()
+}
+
+// backupBaseDir returns the directory holding the backups directory of the server, set by Config or the default backup directory.
+func (s *Server) backupBaseDir() string {
+	if s.backupDir != "" {
+		return s.backupDir
+	}
+	return getDefaultBackUpDir()
+}
+
 // getDefaultServerDir returns the default server directory based on the operating system.
 func getDefaultServerDir() string {
 	var baseDir string
@@ -108,14 +272,81 @@ func getDefaultBackUpDir() string {
 }
 
 // CreateDatabase creates a new database in the server.
+// If the server already has the maximum number of databases set by WithMaxDatabases, it returns an error wrapping ErrLimitReached.
 func (s *Server) CreateDatabase(name string) error {
 	s.Lock()
 	defer s.Unlock()
 	if _, exists := s.Databases[name]; exists {
 		return fmt.Errorf("Database %s already exists", name)
 	}
-	s.Databases[name] = NewDatabase(name)
-	return nil
+	_, err := s.createDatabaseLocked(name)
+	return err
+}
+
+// createDatabaseLocked creates the database like CreateDatabase once it was checked not to exist, and returns it.
+// The server must be locked for writing.
+func (s *Server) createDatabaseLocked(name string) (*Database, error) {
+	if s.readOnly {
+		return nil, fmt.Errorf("%w: can't create database %s", ErrReadOnly, name)
+	}
+	if s.maxDatabases > 0 && len(s.Databases) >= s.maxDatabases {
+		return nil, fmt.Errorf("%w: the server already has the maximum of %d databases", ErrLimitReached, s.maxDatabases)
+	}
+	db := s.newDatabase(name)
+	if s.auditLog {
+		if err := db.EnableAuditLog(); err != nil {
+			return nil, err
+		}
+	}
+	s.Databases[name] = db
+	return db, nil
+}
+
+// GetOrCreateTable is a method of the Server struct that returns a table, creating it and its database first if they don't exist.
+// It saves bootstrap code from checking the existence of the database and the table before creating them,
+// and is safe to call concurrently: concurrent calls for the same table create it once and all return it.
+// The options only apply if the table is created.
+//
+// Parameters:
+// - database: The name of the database of the table.
+// - table: The name of the table.
+// - primaryKey: The primary key of the table, used if it is created.
+// - opts: The TableOption values applied to the table if it is created.
+//
+// Returns:
+// - A pointer to the existing or new table.
+// - An error, if the table exists with another primary key, a name is invalid or an error occurs while creating the database or the table.
+func (s *Server) GetOrCreateTable(database, table, primaryKey string, opts ...TableOption) (*Table, error) {
+	if !ValidFilename(database) {
+		return nil, fmt.Errorf("invalid database name: %s", database)
+	}
+	if !ValidFilename(table) {
+		return nil, fmt.Errorf("invalid table name: %s", table)
+	}
+	if !ValidKeyPath(primaryKey) {
+		return nil, fmt.Errorf("invalid primary key: %s", primaryKey)
+	}
+
+	s.Lock()
+	db, exists := s.Databases[database]
+	if !exists {
+		var err error
+		if db, err = s.createDatabaseLocked(database); err != nil {
+			s.Unlock()
+			return nil, err
+		}
+	}
+	s.Unlock()
+
+	db.Lock()
+	defer db.Unlock()
+	if existing, exists := db.Tables[table]; exists {
+		if existing.PrimaryKey != primaryKey {
+			return nil, fmt.Errorf("table %s exists with primary key %s, not %s", table, existing.PrimaryKey, primaryKey)
+		}
+		return existing, nil
+	}
+	return db.createTableLocked(table, primaryKey, opts...)
 }
 
 // ListDatabases returns a list of databases in the server.
@@ -134,31 +365,31 @@ func (s *Server) ListDatabases() []string {
 //
 // The method works as follows:
 //  1. It acquires a read lock on the Server struct and defers the unlocking of the lock.
-//  2. It creates a backup directory in the default backup directory. The default backup directory is determined by the getDefaultBackUpDir function.
+//  2. It creates a backup directory in the backup directory of the server, set by Config or determined by the getDefaultBackUpDir function.
 //     If there is an error creating the backup directory, the error is returned.
 //  3. It creates a backup file in the backup directory. The backup file is a zip file named "backup.zip".
 //     If there is an error creating the backup file, the error is returned.
 //  4. It creates a new zip writer for the backup file and defers the closing of the zip writer.
 //  5. It iterates over each database in the Databases field of the Server struct.
-//     For each database, it walks the database directory and adds each file to the zip file.
-//     The database directory is determined by the getDefaultServerDir function and the database name.
+//     For each database, it flushes the pending coalesced writes of its tables, then walks the database directory and adds each file to the zip file.
+//     The database directory is determined by the directory of the server and the database name.
 //     If there is an error walking the database directory or adding a file to the zip file, the error is returned.
 //  6. If all databases are successfully backed up, the method returns the path to the backup file and nil.
 func (s *Server) BackupDatabases() (string, error) {
 	s.RLock()
 	defer s.RUnlock()
 
-	backupDir := filepath.Join(getDefaultBackUpDir(), "backups")
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
+	backupDir := filepath.Join(s.backupBaseDir(), "backups")
+	if err := s.fs().MkdirAll(backupDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create backup directory: %v", err)
 	}
 
 	backupPath := filepath.Join(backupDir, "backup.zip")
-	backupFile, err := os.Create(backupPath)
+	backupFile, err := s.fs().OpenFile(backupPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return "", fmt.Errorf("failed to create backup file: %v", err)
 	}
-	defer func(backupFile *os.File) {
+	defer func(backupFile File) {
 		err := backupFile.Close()
 		if err != nil {
 			fmt.Printf("failed to close backup file: %v\n", err)
@@ -173,17 +404,14 @@ func (s *Server) BackupDatabases() (string, error) {
 		}
 	}(zipWriter)
 
-	for dbName := range s.Databases {
-		dbDir := filepath.Join(getDefaultServerDir(), dbName)
-		err := filepath.Walk(dbDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if !info.Mode().IsRegular() {
-				return nil
-			}
-
-			relativePath, err := filepath.Rel(getDefaultServerDir(), path)
+	for dbName, db := range s.Databases {
+		// Write the coalesced writes first, so the backup holds every write that returned
+		if err := db.flushTables(); err != nil {
+			return "", fmt.Errorf("failed to backup database %s: %v", dbName, err)
+		}
+		dbDir := filepath.Join(s.serverDir(), dbName)
+		err := walkStorageFiles(s.fs(), dbDir, func(path string) error {
+			relativePath, err := filepath.Rel(s.serverDir(), path)
 			if err != nil {
 				return err
 			}
@@ -193,11 +421,11 @@ func (s *Server) BackupDatabases() (string, error) {
 				return err
 			}
 
-			file, err := os.Open(path)
+			file, err := s.fs().OpenFile(path, os.O_RDONLY, 0)
 			if err != nil {
 				return err
 			}
-			defer func(file *os.File) {
+			defer func(file File) {
 				err := file.Close()
 				if err != nil {
 					fmt.Printf("failed to close file: %v\n", err)
@@ -221,14 +449,14 @@ func (s *Server) BackupDatabases() (string, error) {
 
 // RestoreDatabases is a method of the Server struct that restores databases from the latest backup file.
 // It acquires a lock on the Server struct and defers the unlocking of the lock.
-// It opens the latest backup file in the default backup directory. The default backup directory is determined by the getDefaultBackUpDir if
+// It opens the latest backup file in the backup directory of the server, set by Config or determined by the getDefaultBackUpDir function, if
 // the backup Path is empty, if there's not, the route will be checked.
 // If there is an error opening the backup file, the error is returned.
 // It gets the file stat of the backup file. If there is an error getting the file stat, the error is returned.
 // It creates a new zip reader for the backup file. If there is an error creating the zip reader, the error is returned.
 // It iterates over each file in the zip file.
-// For each file, it creates the file path by joining the default server directory and the file name.
-// The default server directory is determined by the getDefaultServerDir function.
+// For each file, it creates the file path by joining the directory of the server and the file name.
+// The directory of the server is set by Config or determined by the getDefaultServerDir function.
 // If the file is a directory, it creates the directory with read, write, and execute permissions for the user only.
 // If the file is a regular file, it creates the file with the same permissions as in the zip file.
 // It opens the file for writing. If there is an error opening the file, the error is returned.
@@ -246,47 +474,36 @@ func (s *Server) RestoreDatabases(backupPath ...string) error {
 	if len(backupPath) > 0 {
 		path = backupPath[0]
 	} else {
-		path = filepath.Join(getDefaultBackUpDir(), "backups", "backup.zip")
+		path = filepath.Join(s.backupBaseDir(), "backups", "backup.zip")
 	}
 
-	backupFile, err := os.Open(path)
+	backup, err := s.fs().ReadFile(path)
 	if err != nil {
 		return fmt.Errorf("failed to open backup file: %v", err)
 	}
-	defer func(backupFile *os.File) {
-		err := backupFile.Close()
-		if err != nil {
-			fmt.Printf("failed to close backup file: %v\n", err)
-		}
-	}(backupFile)
-
-	stat, err := backupFile.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get backup file stat: %v", err)
-	}
 
-	zipReader, err := zip.NewReader(backupFile, stat.Size())
+	zipReader, err := zip.NewReader(bytes.NewReader(backup), int64(len(backup)))
 	if err != nil {
 		return fmt.Errorf("failed to create zip reader: %v", err)
 	}
 
 	for _, file := range zipReader.File {
-		filePath := filepath.Join(getDefaultServerDir(), file.Name)
+		filePath := filepath.Join(s.serverDir(), file.Name)
 
 		if file.FileInfo().IsDir() {
-			err := os.MkdirAll(filePath, 0755)
+			err := s.fs().MkdirAll(filePath, 0755)
 			if err != nil {
 				return err
 			}
 			continue
 		}
 
-		err := os.MkdirAll(filepath.Dir(filePath), 0755)
+		err := s.fs().MkdirAll(filepath.Dir(filePath), 0755)
 		if err != nil {
 			return err
 		}
 
-		outFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
+		outFile, err := s.fs().OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
 		if err != nil {
 			return fmt.Errorf("failed to open file for writing: %v", err)
 		}
@@ -314,39 +531,96 @@ func (s *Server) RestoreDatabases(backupPath ...string) error {
 	return s.LoadDatabases()
 }
 
+// Close is a method of the Server struct that closes every database of the server with Database.Close,
+// flushing the pending writes of all the tables and releasing their background resources.
+// The databases are closed in name order, and every database is closed even if closing another one fails.
+//
+// Returns:
+// - If every database is closed successfully, it returns nil.
+// - Otherwise, it returns the errors of the databases that failed to close joined with errors.Join, in name order,
+// so the error of every table that failed to close is reported.
+func (s *Server) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.stopReplica != nil {
+		close(s.stopReplica)
+		s.stopReplica = nil
+	}
+
+	names := make([]string, 0, len(s.Databases))
+	for name := range s.Databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := s.Databases[name].Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close database %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// serverRoutes maps the paths served by ServeHTTP to the methods each of them allows, in the order listed in the Allow header.
+// OPTIONS is allowed on every path.
+var serverRoutes = map[string][]string{
+	"/createDatabase": {http.MethodPost, http.MethodOptions},
+	"/listDatabases":  {http.MethodGet, http.MethodHead, http.MethodOptions},
+}
+
 // ServeHTTP implements the http.Handler interface for the server.
+// Unknown paths return 404 Not Found. A method the path doesn't allow returns 405 Method Not Allowed
+// with an Allow header listing the allowed methods, and OPTIONS returns that header with 204 No Content.
+// HEAD on /listDatabases returns the headers of a GET without its body.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		if r.URL.Path == "/createDatabase" {
-			var data struct {
-				Name string
-			}
-			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			if err := s.CreateDatabase(data.Name); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			fmt.Fprintf(w, "Database '%s' created successfully", data.Name)
+	methods, exists := serverRoutes[r.URL.Path]
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	allowed := false
+	for _, method := range methods {
+		allowed = allowed || r.Method == method
+	}
+	if !allowed || r.Method == http.MethodOptions {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-	case "GET":
-		if r.URL.Path == "/listDatabases" {
-			databases := s.ListDatabases()
-			resp, err := json.Marshal(databases)
-			if err != nil {
-				http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(resp)
+		http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/createDatabase":
+		var data struct {
+			Name string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-	default:
-		http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+		if err := s.CreateDatabase(data.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "Database '%s' created successfully", data.Name)
+	case "/listDatabases":
+		databases := s.ListDatabases()
+		resp, err := json.Marshal(databases)
+		if err != nil {
+			http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(resp)))
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(resp)
 	}
 }
 
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerServeHTTP(t *testing.T) {
+	server, err := NewServerWithConfig(Config{Dir: t.TempDir(), BackupDir: t.TempDir(), AESKey: testAESKey})
+	if err != nil {
+		t.Fatalf("NewServerWithConfig failed: %v", err)
+	}
+	if err := server.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer server.Close()
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	if w := serve("POST", "/createDatabase", `{"Name": "shop"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /createDatabase status = %d, body %q", w.Code, w.Body.String())
+	}
+	w := serve("GET", "/listDatabases", "")
+	var names []string
+	if err := json.Unmarshal(w.Body.Bytes(), &names); err != nil || len(names) != 1 || names[0] != "shop" {
+		t.Errorf("GET /listDatabases = %q, %v, want [\"shop\"]", w.Body.String(), err)
+	}
+	w = serve("HEAD", "/listDatabases", "")
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") == "" {
+		t.Errorf("HEAD /listDatabases = %d with %d bytes and Content-Length %q, want the headers only",
+			w.Code, w.Body.Len(), w.Header().Get("Content-Length"))
+	}
+
+	tests := []struct {
+		method, target string
+		wantCode       int
+		wantAllow      string
+	}{
+		{"GET", "/createDatabase", http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{"DELETE", "/listDatabases", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/createDatabase", http.StatusNoContent, "POST, OPTIONS"},
+		{"GET", "/unknown", http.StatusNotFound, ""},
+		{"POST", "/", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := serve(tt.method, tt.target, "")
+		if w.Code != tt.wantCode || w.Header().Get("Allow") != tt.wantAllow {
+			t.Errorf("%s %s = %d with Allow %q, want %d with Allow %q",
+				tt.method, tt.target, w.Code, w.Header().Get("Allow"), tt.wantCode, tt.wantAllow)
+		}
+	}
+}
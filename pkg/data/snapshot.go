@@ -0,0 +1,80 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// Snapshot isolation
+//
+// Every write builds a new set of records (decoded fresh from the file, never shared with readers),
+// writes it to the file and then atomically swaps the table snapshot pointer to it.
+// Readers load the snapshot pointer once and work on that set of records until they finish,
+// so a read that started before a write keeps seeing the records as they were before the write,
+// and a read that started after a write returned sees all of that write. A reader never observes a partially applied write.
+// Records in a snapshot are never mutated once published, which makes them safe to read without holding the table lock.
+//
+// Every read is served from the snapshot, never from the file, so a read started after a write returned sees the write
+// even when the file is written later, by a write debounce window or a group commit. The snapshot is only dropped
+// by an eviction, which writes the pending writes first.
+
+// snapshotRecords returns the current snapshot of the records of the table.
+// The returned records must not be modified. If no snapshot was published yet, the records are read from the file
+// under the read lock, so it must be called without holding the table lock.
+func (t *Table) snapshotRecords() (*dbdata.Records, error) {
+	t.touch()
+	if records := t.snapshot.Load(); records != nil {
+		return records, nil
+	}
+	t.RLock()
+	defer t.RUnlock()
+	return t.snapshotLocked()
+}
+
+// snapshotLocked returns the current snapshot of the records like snapshotRecords, reading it from the file if there is none yet.
+// The table must be locked, for reading or writing.
+func (t *Table) snapshotLocked() (*dbdata.Records, error) {
+	if records := t.snapshot.Load(); records != nil {
+		return records, nil
+	}
+	records, err := t.readRecordsFromFile()
+	if err != nil {
+		return nil, err
+	}
+	if t.snapshot.CompareAndSwap(nil, records) {
+		t.version.Add(1)
+	}
+	return t.snapshot.Load(), nil
+}
+
+// publishSnapshot atomically replaces the snapshot of the table with the given records.
+// The records must not be modified after they are published.
+func (t *Table) publishSnapshot(records *dbdata.Records) {
+	t.snapshot.Store(records)
+	// Incremented after the store, so a reader that sees the new version also sees the new records
+	t.version.Add(1)
+}
+
+// processID distinguishes the versions of the tables of this process from the versions of a previous process,
+// whose counters started from zero too.
+var processID = func() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}()
+
+// Version is a method of the Table struct that returns an opaque string that changes whenever the records of the table change,
+// for example to build the ETag of a response holding many records. Every write publishing new records changes it,
+// including the writes not flushed to the file yet, and so do reloading the records from the file and adding a read transform.
+// Versions are only comparable for the same table: two tables may have the same version, and a version
+// is never reused by another process. When the version is read before the records, the records are at least as recent
+// as the version, so a response labeled with it may be refreshed needlessly, but is never served stale.
+//
+// Returns:
+// - The version of the records of the table.
+func (t *Table) Version() string {
+	return processID + "-" + strconv.FormatUint(t.version.Load(), 10)
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestReadsSeeWholeWrites checks under -race that concurrent readers never observe part of a write:
+// each write sets the same value on two records at once, so every snapshot holds equal values.
+func TestReadsSeeWholeWrites(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "v": 0}, Record{"id": "b", "v": 0})
+
+	var done atomic.Bool
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !done.Load() {
+				records, err := table.SelectAll()
+				if err != nil {
+					t.Errorf("SelectAll failed: %v", err)
+					return
+				}
+				if len(records) != 2 {
+					t.Errorf("SelectAll returned %d records, want 2", len(records))
+					return
+				}
+				if records[0]["v"] != records[1]["v"] {
+					t.Errorf("SelectAll observed a partial write: %v", records)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= 50; i++ {
+		if errs := table.UpdateMany(map[string]Record{"a": {"v": i}, "b": {"v": i}}); len(errs) != 0 {
+			t.Fatalf("UpdateMany failed: %v", errs)
+		}
+	}
+	done.Store(true)
+	wg.Wait()
+
+	record, err := table.Select("a")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["v"] != int64(50) {
+		t.Errorf("v = %v, want 50", record["v"])
+	}
+}
+
+// TestSnapshotIsNotModifiedByWrites checks that a snapshot taken before a write keeps the records it held.
+func TestSnapshotIsNotModifiedByWrites(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "v": 1})
+
+	before, err := table.snapshotRecords()
+	if err != nil {
+		t.Fatalf("snapshotRecords failed: %v", err)
+	}
+	if err := table.Update("a", Record{"v": 2}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	mustInsert(t, table, Record{"id": "b", "v": 3})
+
+	if len(before.GetRecords()) != 1 {
+		t.Errorf("the old snapshot holds %d records, want 1", len(before.GetRecords()))
+	}
+	record, err := fromProtoRecord(before.GetRecords()["a"])
+	if err != nil {
+		t.Fatalf("fromProtoRecord failed: %v", err)
+	}
+	if record["v"] != int64(1) {
+		t.Errorf("the old snapshot holds v = %v, want 1", record["v"])
+	}
+}
+
+func TestVersionChangesOnWrites(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "name": "Ana"})
+	before := table.Version()
+
+	if _, err := table.SelectAll(); err != nil {
+		t.Fatalf("SelectAll failed: %v", err)
+	}
+	if _, err := table.Select("a"); err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if got := table.Version(); got != before {
+		t.Errorf("Version after reads = %q, want %q", got, before)
+	}
+
+	writes := []struct {
+		name  string
+		write func() error
+	}{
+		{"Insert", func() error { return table.Insert(Record{"id": "b"}) }},
+		{"Update", func() error { return table.Update("a", Record{"name": "Anna"}) }},
+		{"Delete", func() error { return table.Delete("b") }},
+	}
+	for _, tt := range writes {
+		previous := table.Version()
+		if err := tt.write(); err != nil {
+			t.Fatalf("%s failed: %v", tt.name, err)
+		}
+		if table.Version() == previous {
+			t.Errorf("Version after %s = %q, want a new version", tt.name, previous)
+		}
+	}
+}
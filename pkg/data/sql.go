@@ -0,0 +1,458 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidSQL is returned, wrapped, by ParseSQL when a statement is not in the supported SQL subset.
+var ErrInvalidSQL = errors.New("invalid SQL")
+
+// SQLQuery is a statement of the SQL subset parsed by ParseSQL:
+//
+//	SELECT field, ... | * FROM table [WHERE condition] [ORDER BY field [ASC|DESC]] [LIMIT n]
+//
+// The condition compares fields with values using =, != (or <>), <, <=, >, >= and CONTAINS,
+// combined with AND, OR and parentheses. AND binds tighter than OR.
+// The values are single-quoted strings, in which a quote is doubled, numbers, TRUE and FALSE.
+type SQLQuery struct {
+	Fields  []string // Fields returned, every field if empty
+	Table   string   // Name of the table queried
+	Where   *Filter  // Filter of the records returned, nil to return every record
+	OrderBy string   // Field the records are sorted by, the primary key if empty
+	Desc    bool     // Whether the records are sorted in descending order
+	Limit   int      // Maximum number of records returned, unlimited if zero
+}
+
+// sqlTokenKind is the kind of a token of a SQL statement.
+type sqlTokenKind int
+
+const (
+	sqlEOF    sqlTokenKind = iota // End of the statement
+	sqlWord                       // Keyword or identifier
+	sqlString                     // Single-quoted string
+	sqlNumber                     // Number
+	sqlSymbol                     // Operator, comma, star or parenthesis
+)
+
+// sqlToken is a token of a SQL statement.
+type sqlToken struct {
+	kind sqlTokenKind // Kind of the token
+	text string       // Text of the token, unquoted for a string
+	pos  int          // Position of the token in the statement, for the error messages
+}
+
+// String describes the token in the error messages.
+func (t sqlToken) String() string {
+	switch t.kind {
+	case sqlEOF:
+		return "end of statement"
+	case sqlString:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// sqlSymbols are the operators and punctuation of the SQL subset.
+var sqlSymbols = map[string]bool{
+	"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true, "(": true, ")": true, ",": true, "*": true,
+}
+
+// tokenizeSQL splits a statement into tokens, ending with a sqlEOF token.
+func tokenizeSQL(statement string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	runes := []rune(statement)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlWord, text: string(runes[start:i]), pos: start})
+		case r == '\'':
+			start := i
+			var text strings.Builder
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("%w: unterminated string at position %d", ErrInvalidSQL, start)
+				}
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						text.WriteRune('\'')
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				text.WriteRune(runes[i])
+			}
+			tokens = append(tokens, sqlToken{kind: sqlString, text: text.String(), pos: start})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.')) || r == '.':
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+				((runes[i] == '+' || runes[i] == '-') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i++
+			}
+			text := string(runes[start:i])
+			if _, err := strconv.ParseFloat(text, 64); err != nil {
+				return nil, fmt.Errorf("%w: invalid number %q at position %d", ErrInvalidSQL, text, start)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlNumber, text: text, pos: start})
+		default:
+			start := i
+			text := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "!=", "<>", "<=", ">=":
+					text = two
+				}
+			}
+			if !sqlSymbols[text] {
+				return nil, fmt.Errorf("%w: unexpected character %q at position %d", ErrInvalidSQL, r, start)
+			}
+			i += len([]rune(text))
+			tokens = append(tokens, sqlToken{kind: sqlSymbol, text: text, pos: start})
+		}
+	}
+	return append(tokens, sqlToken{kind: sqlEOF, pos: len(runes)}), nil
+}
+
+// sqlParser is a recursive descent parser of the SQL subset of ParseSQL.
+type sqlParser struct {
+	tokens []sqlToken // Tokens of the statement, ending with a sqlEOF token
+	next   int        // Index of the next token
+}
+
+// peek returns the next token without consuming it.
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.next]
+}
+
+// advance consumes and returns the next token.
+func (p *sqlParser) advance() sqlToken {
+	token := p.tokens[p.next]
+	if token.kind != sqlEOF {
+		p.next++
+	}
+	return token
+}
+
+// isKeyword reports whether the next token is the given keyword, in any case.
+func (p *sqlParser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.kind == sqlWord && strings.EqualFold(token.text, keyword)
+}
+
+// isSymbol reports whether the next token is the given symbol.
+func (p *sqlParser) isSymbol(symbol string) bool {
+	token := p.peek()
+	return token.kind == sqlSymbol && token.text == symbol
+}
+
+// unexpected returns the error of an unexpected token.
+func (p *sqlParser) unexpected(expected string) error {
+	token := p.peek()
+	return fmt.Errorf("%w: expected %s at position %d, found %s", ErrInvalidSQL, expected, token.pos, token)
+}
+
+// expectKeyword consumes the given keyword or returns an error.
+func (p *sqlParser) expectKeyword(keyword string) error {
+	if !p.isKeyword(keyword) {
+		return p.unexpected(keyword)
+	}
+	p.advance()
+	return nil
+}
+
+// sqlKeywords are the reserved words of the SQL subset, which can't be used as field or table names.
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "ORDER": true, "BY": true, "ASC": true, "DESC": true, "LIMIT": true,
+	"AND": true, "OR": true, "NOT": true, "CONTAINS": true, "TRUE": true, "FALSE": true, "NULL": true,
+}
+
+// identifier consumes a field or table name.
+func (p *sqlParser) identifier(what string) (string, error) {
+	token := p.peek()
+	if token.kind != sqlWord || sqlKeywords[strings.ToUpper(token.text)] {
+		return "", p.unexpected(what)
+	}
+	p.advance()
+	return token.text, nil
+}
+
+// parseSelect parses a whole statement.
+func (p *sqlParser) parseSelect() (*SQLQuery, error) {
+	query := &SQLQuery{}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	if p.isSymbol("*") {
+		p.advance()
+	} else {
+		for {
+			field, err := p.identifier("a field name or *")
+			if err != nil {
+				return nil, err
+			}
+			query.Fields = append(query.Fields, field)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.advance()
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	table, err := p.identifier("a table name")
+	if err != nil {
+		return nil, err
+	}
+	query.Table = table
+
+	if p.isKeyword("WHERE") {
+		p.advance()
+		where, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		query.Where = &where
+	}
+
+	if p.isKeyword("ORDER") {
+		p.advance()
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if query.OrderBy, err = p.identifier("a field name"); err != nil {
+			return nil, err
+		}
+		if p.isKeyword("DESC") {
+			p.advance()
+			query.Desc = true
+		} else if p.isKeyword("ASC") {
+			p.advance()
+		}
+	}
+
+	if p.isKeyword("LIMIT") {
+		p.advance()
+		token := p.peek()
+		limit, err := strconv.Atoi(token.text)
+		if token.kind != sqlNumber || err != nil || limit <= 0 {
+			return nil, p.unexpected("a positive integer")
+		}
+		p.advance()
+		query.Limit = limit
+	}
+
+	if p.peek().kind != sqlEOF {
+		return nil, p.unexpected("end of statement")
+	}
+	return query, nil
+}
+
+// parseOr parses conditions separated by OR.
+func (p *sqlParser) parseOr() (Filter, error) {
+	var terms []Filter
+	for {
+		term, err := p.parseAnd()
+		if err != nil {
+			return Filter{}, err
+		}
+		terms = append(terms, term)
+		if !p.isKeyword("OR") {
+			break
+		}
+		p.advance()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return Filter{Or: terms}, nil
+}
+
+// parseAnd parses conditions separated by AND.
+func (p *sqlParser) parseAnd() (Filter, error) {
+	var terms []Filter
+	for {
+		term, err := p.parseCondition()
+		if err != nil {
+			return Filter{}, err
+		}
+		terms = append(terms, term)
+		if !p.isKeyword("AND") {
+			break
+		}
+		p.advance()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return Filter{And: terms}, nil
+}
+
+// parseCondition parses a comparison or a parenthesized condition.
+func (p *sqlParser) parseCondition() (Filter, error) {
+	if p.isSymbol("(") {
+		p.advance()
+		filter, err := p.parseOr()
+		if err != nil {
+			return Filter{}, err
+		}
+		if !p.isSymbol(")") {
+			return Filter{}, p.unexpected(")")
+		}
+		p.advance()
+		return filter, nil
+	}
+
+	field, err := p.identifier("a field name")
+	if err != nil {
+		return Filter{}, err
+	}
+	var op string
+	switch token := p.peek(); {
+	case p.isKeyword("CONTAINS"):
+		op = "contains"
+	case token.kind == sqlSymbol && token.text == "<>":
+		op = "!="
+	case token.kind == sqlSymbol && filterOperators[token.text]:
+		op = token.text
+	default:
+		return Filter{}, p.unexpected("a comparison operator")
+	}
+	p.advance()
+
+	value, err := p.parseValue()
+	if err != nil {
+		return Filter{}, err
+	}
+	return Filter{Field: field, Op: op, Value: value}, nil
+}
+
+// parseValue parses the value of a comparison.
+func (p *sqlParser) parseValue() (interface{}, error) {
+	token := p.peek()
+	switch {
+	case token.kind == sqlString:
+		p.advance()
+		return token.text, nil
+	case token.kind == sqlNumber:
+		p.advance()
+		return json.Number(token.text), nil
+	case p.isKeyword("TRUE"), p.isKeyword("FALSE"):
+		p.advance()
+		return strings.EqualFold(token.text, "TRUE"), nil
+	case p.isKeyword("NULL"):
+		return nil, fmt.Errorf("%w: NULL comparisons are not supported at position %d", ErrInvalidSQL, token.pos)
+	}
+	return nil, p.unexpected("a string, a number, TRUE or FALSE")
+}
+
+// ParseSQL parses a statement of the SQL subset described by SQLQuery, such as
+//
+//	SELECT name, age FROM users WHERE age >= 18 AND (city = 'Paris' OR city = 'Lyon') ORDER BY age DESC LIMIT 10
+//
+// Keywords are case-insensitive, field and table names are not. Any other syntax, such as joins, functions,
+// several tables or statements other than SELECT, is rejected with an error naming the position of the problem.
+//
+// Parameters:
+// - statement: The SQL statement to parse.
+//
+// Returns:
+// - The parsed query.
+// - An error wrapping ErrInvalidSQL, if the statement is not in the supported subset.
+func ParseSQL(statement string) (*SQLQuery, error) {
+	tokens, err := tokenizeSQL(statement)
+	if err != nil {
+		return nil, err
+	}
+	parser := &sqlParser{tokens: tokens}
+	return parser.parseSelect()
+}
+
+// QuerySQL is a method of the Table struct that runs a parsed SQL query on the table, ignoring its table name.
+// The records matching the Where filter of the query are sorted by the OrderBy field, limited,
+// and projected on the selected fields. Records without the OrderBy field sort last,
+// and records with equal values are kept in primary key order.
+//
+// Parameters:
+// - query: The SQL query to run.
+//
+// Returns:
+// - A slice of the resulting records. It is empty, not nil, if no record matches.
+// - An error, if the Where filter is invalid or an error occurs while querying the table.
+func (t *Table) QuerySQL(query *SQLQuery) ([]Record, error) {
+	records, err := t.Query(Query{Where: query.Where})
+	if err != nil {
+		return nil, err
+	}
+
+	if query.OrderBy != "" {
+		sort.SliceStable(records, func(i, j int) bool {
+			a, aExists := records[i][query.OrderBy]
+			b, bExists := records[j][query.OrderBy]
+			if !aExists || a == nil || !bExists || b == nil {
+				return aExists && a != nil && (!bExists || b == nil)
+			}
+			cmp, _ := compareFilterValues(a, b)
+			if query.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+	}
+	if query.Limit > 0 && query.Limit < len(records) {
+		records = records[:query.Limit]
+	}
+
+	if len(query.Fields) > 0 {
+		for i, record := range records {
+			projected := make(Record, len(query.Fields))
+			for _, field := range query.Fields {
+				if value, exists := record[field]; exists {
+					projected[field] = value
+				}
+			}
+			records[i] = projected
+		}
+	}
+	return records, nil
+}
+
+// QuerySQL is a method of the Database struct that parses a statement of the SQL subset described by SQLQuery
+// and runs it on the table of the database it selects.
+//
+// Parameters:
+// - statement: The SQL statement to run.
+//
+// Returns:
+// - A slice of the resulting records.
+// - An error wrapping ErrInvalidSQL if the statement is invalid, an error wrapping ErrNotFound if the table does not exist,
+// or any error of the query.
+func (db *Database) QuerySQL(statement string) ([]Record, error) {
+	query, err := ParseSQL(statement)
+	if err != nil {
+		return nil, err
+	}
+	db.RLock()
+	table, exists := db.Tables[query.Table]
+	db.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("table %s %w", query.Table, ErrNotFound)
+	}
+	return table.QuerySQL(query)
+}
@@ -0,0 +1,127 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSQL(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      SQLQuery
+	}{
+		{"SELECT * FROM users", SQLQuery{Table: "users"}},
+		{"select name, age from users limit 5", SQLQuery{Fields: []string{"name", "age"}, Table: "users", Limit: 5}},
+		{
+			"SELECT name FROM users WHERE age >= 18 ORDER BY age DESC",
+			SQLQuery{Fields: []string{"name"}, Table: "users", Where: &Filter{Field: "age", Op: ">=", Value: json.Number("18")}, OrderBy: "age", Desc: true},
+		},
+		{
+			"SELECT * FROM users WHERE city = 'O''Brien' ORDER BY name ASC",
+			SQLQuery{Table: "users", Where: &Filter{Field: "city", Op: "=", Value: "O'Brien"}, OrderBy: "name"},
+		},
+		{
+			"SELECT * FROM users WHERE a <> -1.5 AND b = TRUE OR tags CONTAINS 'go'",
+			SQLQuery{Table: "users", Where: &Filter{Or: []Filter{
+				{And: []Filter{{Field: "a", Op: "!=", Value: json.Number("-1.5")}, {Field: "b", Op: "=", Value: true}}},
+				{Field: "tags", Op: "contains", Value: "go"},
+			}}},
+		},
+		{
+			"SELECT * FROM users WHERE a = 1 AND (b = 2 OR c < 3e2)",
+			SQLQuery{Table: "users", Where: &Filter{And: []Filter{
+				{Field: "a", Op: "=", Value: json.Number("1")},
+				{Or: []Filter{{Field: "b", Op: "=", Value: json.Number("2")}, {Field: "c", Op: "<", Value: json.Number("3e2")}}},
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseSQL(tt.statement)
+		if err != nil {
+			t.Errorf("ParseSQL(%q) failed: %v", tt.statement, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("ParseSQL(%q) = %+v, want %+v", tt.statement, *got, tt.want)
+		}
+	}
+}
+
+func TestParseSQLRejectsUnsupportedSyntax(t *testing.T) {
+	for _, statement := range []string{
+		"",
+		"DELETE FROM users",
+		"SELECT FROM users",
+		"SELECT name, FROM users",
+		"SELECT * users",
+		"SELECT * FROM users, orders",
+		"SELECT * FROM users JOIN orders",
+		"SELECT COUNT(*) FROM users",
+		"SELECT * FROM users WHERE",
+		"SELECT * FROM users WHERE age",
+		"SELECT * FROM users WHERE age LIKE 'a%'",
+		"SELECT * FROM users WHERE age = NULL",
+		"SELECT * FROM users WHERE (age = 1",
+		"SELECT * FROM users WHERE name = 'unterminated",
+		"SELECT * FROM users WHERE age = 1.2.3",
+		"SELECT * FROM users ORDER age",
+		"SELECT * FROM users LIMIT 0",
+		"SELECT * FROM users LIMIT 2.5",
+		"SELECT * FROM users LIMIT 1 OFFSET 2",
+		"SELECT * FROM users; DROP TABLE users",
+	} {
+		if query, err := ParseSQL(statement); !errors.Is(err, ErrInvalidSQL) {
+			t.Errorf("ParseSQL(%q) = %+v, %v, want ErrInvalidSQL", statement, query, err)
+		}
+	}
+}
+
+func TestDatabaseQuerySQL(t *testing.T) {
+	db := newTestDatabase(t, "users")
+	mustInsert(t, db.Tables["users"],
+		Record{"id": "a", "name": "Ana", "age": 30, "city": "Lima"},
+		Record{"id": "b", "name": "Bo", "age": 17, "city": "Lima"},
+		Record{"id": "c", "name": "Cy", "age": 45, "city": "Cusco"},
+		Record{"id": "d", "name": "Di", "city": "Lima"},
+		Record{"id": "e", "name": "Ed", "age": 30, "city": "Puno"},
+	)
+
+	tests := []struct {
+		statement string
+		want      []Record
+	}{
+		{
+			"SELECT name FROM users WHERE age >= 18 ORDER BY age DESC LIMIT 2",
+			[]Record{{"name": "Cy"}, {"name": "Ana"}},
+		},
+		{
+			// Equal values keep the primary key order, and missing values sort last
+			"SELECT id FROM users WHERE city = 'Lima' OR age = 30 ORDER BY age",
+			[]Record{{"id": "b"}, {"id": "a"}, {"id": "e"}, {"id": "d"}},
+		},
+		{
+			"SELECT id, missing FROM users WHERE city != 'Lima' AND (age < 40 OR name = 'Cy')",
+			[]Record{{"id": "c"}, {"id": "e"}},
+		},
+		{"SELECT * FROM users WHERE age > 100", []Record{}},
+	}
+	for _, tt := range tests {
+		got, err := db.QuerySQL(tt.statement)
+		if err != nil {
+			t.Errorf("QuerySQL(%q) failed: %v", tt.statement, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("QuerySQL(%q) = %v, want %v", tt.statement, got, tt.want)
+		}
+	}
+
+	if _, err := db.QuerySQL("SELECT * FROM orders"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("QuerySQL on a missing table = %v, want ErrNotFound", err)
+	}
+	if _, err := db.QuerySQL("SELECT * FROM users WHERE"); !errors.Is(err, ErrInvalidSQL) {
+		t.Errorf("QuerySQL of an invalid statement = %v, want ErrInvalidSQL", err)
+	}
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flags of the file header recording the last write of the file, see WithHeaderTimestamps.
+const (
+	writtenFlag = "written=" // Followed by the time of the write, in nanoseconds since the Unix epoch
+	writesFlag  = "writes="  // Followed by the number of writes of the file
+)
+
+// maxFileHeaderSize is the number of bytes ReadFileStamp reads at most looking for the end of the header line.
+const maxFileHeaderSize = 512
+
+// FileStamp is the last write of a table file, recorded in its header by WithHeaderTimestamps.
+type FileStamp struct {
+	Written time.Time // Time of the write, from the clock of the table
+	Writes  uint64    // Number of writes of the file with timestamps, including this one
+}
+
+// WithHeaderTimestamps makes the table record in the plain text header line of its data file the time of the write
+// and a counter of the writes of the file, so they can be read without decrypting the records, for example
+// to check whether a replica or a cache is fresh. The header is written with the records, in the same atomic replacement
+// of the file, so it always describes the records that follow it:
+//
+//	protodb:protobuf;written=1718000000000000000;writes=42
+//
+// The counter starts from the value of the file when the table is loaded, so it keeps increasing across restarts.
+// Only the writes of the data file are recorded: the inserts appended to the log of WithAppendLog are recorded
+// once the log is consolidated, and the writes coalesced by WithWriteDebounce once they are flushed.
+// Table.FileStamp returns the last write of the table and ReadFileStamp reads it from a file.
+// Files with timestamps can't be read by versions of protodb that predate this option.
+// The mode is saved in the metadata file of the table by Database.CreateTable. It is ignored by tables with one file per record.
+func WithHeaderTimestamps() TableOption {
+	return func(t *Table) {
+		t.headerStamps = true
+	}
+}
+
+// FileStamp is a method of the Table struct that returns the last write of the data file recorded in its header,
+// as written by the table or read when the file was loaded, without reading the file.
+//
+// Returns:
+// - The last write of the file.
+// - Whether the file has a stamp, which is false until the table with WithHeaderTimestamps first writes it.
+func (t *Table) FileStamp() (FileStamp, bool) {
+	stamp := t.stamp.Load()
+	if stamp == nil {
+		return FileStamp{}, false
+	}
+	return *stamp, true
+}
+
+// ReadFileStamp reads the last write recorded in the header of the table file at the given path of the storage,
+// reading only the header line, not the encrypted records.
+//
+// Parameters:
+// - storage: The storage of the file, such as LocalStorage.
+// - path: The path of the data file of the table.
+//
+// Returns:
+// - The last write of the file.
+// - Whether the file has a stamp.
+// - An error, if the file can't be read or its header is invalid.
+func ReadFileStamp(storage Storage, path string) (FileStamp, bool, error) {
+	file, err := storage.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return FileStamp{}, false, err
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReaderSize(io.LimitReader(file, maxFileHeaderSize), maxFileHeaderSize).ReadSlice('\n')
+	if err != nil && err != io.EOF {
+		return FileStamp{}, false, fmt.Errorf("failed to read file header: %v", err)
+	}
+	return parseFileStamp(line)
+}
+
+// parseFileStamp returns the stamp recorded in the flags of the header line at the start of the content of a table file.
+func parseFileStamp(content []byte) (FileStamp, bool, error) {
+	if !bytes.HasPrefix(content, []byte(fileHeaderPrefix)) {
+		return FileStamp{}, false, nil
+	}
+	line, _, _ := bytes.Cut(content, []byte("\n"))
+	var stamp FileStamp
+	found := false
+	for _, flag := range strings.Split(string(line), ";")[1:] {
+		switch {
+		case strings.HasPrefix(flag, writtenFlag):
+			nanos, err := strconv.ParseInt(flag[len(writtenFlag):], 10, 64)
+			if err != nil {
+				return FileStamp{}, false, fmt.Errorf("invalid file header flag %q", flag)
+			}
+			stamp.Written = time.Unix(0, nanos)
+			found = true
+		case strings.HasPrefix(flag, writesFlag):
+			writes, err := strconv.ParseUint(flag[len(writesFlag):], 10, 64)
+			if err != nil {
+				return FileStamp{}, false, fmt.Errorf("invalid file header flag %q", flag)
+			}
+			stamp.Writes = writes
+			found = true
+		}
+	}
+	return stamp, found, nil
+}
+
+// isStampFlag reports whether the flag of a file header is a flag of the stamp.
+func isStampFlag(flag string) bool {
+	return strings.HasPrefix(flag, writtenFlag) || strings.HasPrefix(flag, writesFlag)
+}
+
+// stampData returns the content of a data file with the next stamp of the table added to its header line, and the stamp.
+// The table keeps its previous stamp until storeRecords wrote the content.
+func (t *Table) stampData(data []byte) ([]byte, FileStamp) {
+	// Drop the monotonic clock reading, so the stamp equals the one read back from the header
+	stamp := FileStamp{Written: t.now().Round(0), Writes: 1}
+	if previous := t.stamp.Load(); previous != nil {
+		stamp.Writes = previous.Writes + 1
+	}
+	end := bytes.IndexByte(data, '\n')
+	flags := ";" + writtenFlag + strconv.FormatInt(stamp.Written.UnixNano(), 10) + ";" + writesFlag + strconv.FormatUint(stamp.Writes, 10)
+	stamped := make([]byte, 0, len(data)+len(flags))
+	stamped = append(stamped, data[:end]...)
+	stamped = append(stamped, flags...)
+	return append(stamped, data[end:]...), stamp
+}
+
+// loadStamp records the stamp of the data file with the given content, read by the table.
+func (t *Table) loadStamp(data []byte) {
+	if stamp, found, err := parseFileStamp(data); err == nil && found {
+		t.stamp.Store(&stamp)
+	}
+}
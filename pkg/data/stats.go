@@ -0,0 +1,90 @@
+package data
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// TableStats is an overview of the content of a table, returned by Table.Stats.
+// SizeBytes compared with PlaintextBytes shows the overhead of the encryption and the file header,
+// or the savings of a compressing codec.
+type TableStats struct {
+	Records        int        `json:"records"`             // Number of records of the table
+	SizeBytes      int64      `json:"sizeBytes"`           // Size of the data of the table as stored, encrypted, in bytes
+	PlaintextBytes int64      `json:"plaintextBytes"`      // Size of the records marshaled as protobuf, before encryption, in bytes
+	Indexes        int        `json:"indexes"`             // Number of indexes of the table, including the primary key
+	DeadBytes      int64      `json:"deadBytes"`           // Part of SizeBytes that compacting the table would reclaim, see Table.Fragmentation
+	Writes         uint64     `json:"writes,omitempty"`    // Number of writes recorded in the header of the file, see WithHeaderTimestamps
+	LastWrite      *time.Time `json:"lastWrite,omitempty"` // Time of the last write recorded in the header of the file, see WithHeaderTimestamps
+}
+
+// Stats is a method of the Table struct that returns an overview of the table:
+// its number of records, the size of its stored data, the size of its records before encryption, its number of indexes
+// the dead space of its append log, and its last write if the table records it with WithHeaderTimestamps.
+// The records are counted on the current snapshot. The sizes are the ones of the last write to storage,
+// cached by the write so Stats doesn't read the file, and computed again only when they are unknown,
+// for example after loading the table or for a table with one file per record.
+// They don't include the writes not flushed yet.
+//
+// Returns:
+// - A TableStats with the stats of the table.
+// - An error, if an error occurs while reading the records or the size of the file.
+func (t *Table) Stats() (TableStats, error) {
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return TableStats{}, err
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+
+	if !t.sizesKnown.Load() {
+		size, err := t.dataSize()
+		if err != nil {
+			return TableStats{}, err
+		}
+		t.cacheSizes(size, int64(proto.Size(allRecords)))
+	}
+	dead, err := t.deadBytes()
+	if err != nil {
+		return TableStats{}, err
+	}
+	stats := TableStats{
+		Records:        len(allRecords.GetRecords()),
+		SizeBytes:      t.storedSize.Load(),
+		PlaintextBytes: t.plainSize.Load(),
+		Indexes:        len(t.indexes) + 1,
+		DeadBytes:      dead,
+	}
+	if stamp, ok := t.FileStamp(); ok {
+		stats.Writes = stamp.Writes
+		stats.LastWrite = &stamp.Written
+	}
+	return stats, nil
+}
+
+// cacheSizes records the sizes of the stored data and of the marshaled records of the table, returned by Stats.
+func (t *Table) cacheSizes(stored, plain int64) {
+	t.storedSize.Store(stored)
+	t.plainSize.Store(plain)
+	t.sizesKnown.Store(true)
+}
+
+// Add adds the stats of another table to the stats, to total the stats of several tables.
+// The last write of the total is the latest of the two.
+func (s TableStats) Add(other TableStats) TableStats {
+	total := TableStats{
+		Records:        s.Records + other.Records,
+		SizeBytes:      s.SizeBytes + other.SizeBytes,
+		PlaintextBytes: s.PlaintextBytes + other.PlaintextBytes,
+		Indexes:        s.Indexes + other.Indexes,
+		DeadBytes:      s.DeadBytes + other.DeadBytes,
+		Writes:         s.Writes + other.Writes,
+		LastWrite:      s.LastWrite,
+	}
+	if other.LastWrite != nil && (s.LastWrite == nil || other.LastWrite.After(*s.LastWrite)) {
+		total.LastWrite = other.LastWrite
+	}
+	return total
+}
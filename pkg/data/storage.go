@@ -0,0 +1,164 @@
+package data
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Storage is the file system the tables, the databases and the server store their files in.
+// Every read and write of the package goes through a Storage, so tables can be backed by something other than
+// the local disk, such as an in-memory file system in tests or an object store for a cloud deployment.
+// The paths are the paths of the local disk implementation, built with the path/filepath package.
+// An implementation must return errors satisfying errors.Is(err, fs.ErrNotExist) for missing files and directories,
+// and be safe for concurrent use.
+type Storage interface {
+	ReadFile(name string) ([]byte, error)                           // Returns the content of the file
+	OpenFile(name string, flag int, perm os.FileMode) (File, error) // Opens the file with the os.OpenFile flags, O_RDONLY for a directory that is only synced
+	MkdirAll(path string, perm os.FileMode) error                   // Creates the directory and its missing parents
+	Rename(oldPath, newPath string) error                           // Replaces the file at newPath with the file at oldPath
+	Remove(name string) error                                       // Removes the file or the empty directory
+	Stat(name string) (os.FileInfo, error)                          // Returns the information of the file or directory
+	ReadDir(name string) ([]os.DirEntry, error)                     // Returns the entries of the directory, sorted by name
+}
+
+// File is a file opened by a Storage.
+type File interface {
+	io.Reader
+	io.Writer
+	io.WriterAt
+	io.Closer
+	Sync() error               // Flushes the file to stable storage
+	Truncate(size int64) error // Changes the size of the file
+}
+
+// LocalStorage is the Storage of the tables and servers created without WithStorage or WithServerStorage,
+// which stores the files on the local disk with the os package.
+var LocalStorage Storage = localStorage{}
+
+// localStorage is a Storage on the local disk.
+type localStorage struct{}
+
+// ReadFile returns the content of the file with os.ReadFile.
+func (localStorage) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// OpenFile opens the file with os.OpenFile.
+func (localStorage) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// MkdirAll creates the directory with os.MkdirAll.
+func (localStorage) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// Rename renames the file with os.Rename.
+func (localStorage) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+// Remove removes the file with os.Remove.
+func (localStorage) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// Stat returns the information of the file with os.Stat.
+func (localStorage) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// ReadDir returns the entries of the directory with os.ReadDir.
+func (localStorage) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// WithStorage makes the table store its files in the given storage instead of LocalStorage.
+// A nil storage keeps LocalStorage. It has no effect on tables stored in memory with WithMemoryStorage.
+func WithStorage(storage Storage) TableOption {
+	return func(t *Table) {
+		if storage != nil {
+			t.storage = storage
+		}
+	}
+}
+
+// WithServerStorage makes the server store its databases, its tables, their audit logs and its backups in the given storage
+// instead of LocalStorage. A nil storage keeps LocalStorage.
+func WithServerStorage(storage Storage) ServerOption {
+	return func(s *Server) {
+		if storage != nil {
+			s.storage = storage
+		}
+	}
+}
+
+// fs returns the storage of the table.
+func (t *Table) fs() Storage {
+	if t.storage == nil {
+		return LocalStorage
+	}
+	return t.storage
+}
+
+// fs returns the storage of the database.
+func (db *Database) fs() Storage {
+	if db.storage == nil {
+		return LocalStorage
+	}
+	return db.storage
+}
+
+// fs returns the storage of the server.
+func (s *Server) fs() Storage {
+	if s.storage == nil {
+		return LocalStorage
+	}
+	return s.storage
+}
+
+// isNotExist reports whether the error of a Storage reports a missing file or directory.
+func isNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// writeStorageFile replaces the content of the file at the given path, like os.WriteFile.
+func writeStorageFile(storage Storage, name string, data []byte, perm os.FileMode) error {
+	file, err := storage.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// walkStorageFiles calls fn with the path of every regular file under the given directory, recursively, in lexical order.
+func walkStorageFiles(storage Storage, dir string, fn func(path string) error) error {
+	entries, err := storage.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if err := walkStorageFiles(storage, path, fn); err != nil {
+				return err
+			}
+		} else if entry.Type().IsRegular() {
+			if err := fn(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package data
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// memStorage is a Storage keeping the files in memory, in a fstest.MapFS keyed by the paths without their leading slash.
+type memStorage struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{files: make(fstest.MapFS)}
+}
+
+// memKey returns the key of the path in the MapFS.
+func memKey(name string) string {
+	key := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(name)), "/")
+	if key == "" {
+		return "."
+	}
+	return key
+}
+
+func (s *memStorage) ReadFile(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, exists := s.files[memKey(name)]
+	if !exists || file.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), file.Data...), nil
+}
+
+func (s *memStorage) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memKey(name)
+	if info, err := fs.Stat(s.files, key); err == nil && info.IsDir() {
+		return &memFile{storage: s, file: &fstest.MapFile{}}, nil
+	}
+	if info, err := fs.Stat(s.files, memKey(filepath.Dir(name))); err != nil || !info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	file, exists := s.files[key]
+	if !exists {
+		if flag&os.O_CREATE == 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		file = &fstest.MapFile{Mode: perm}
+		s.files[key] = file
+	}
+	if flag&os.O_TRUNC != 0 {
+		file.Data = nil
+	}
+	file.ModTime = time.Now()
+	return &memFile{storage: s, file: file, append: flag&os.O_APPEND != 0}, nil
+}
+
+func (s *memStorage) MkdirAll(path string, perm os.FileMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fs.Stat(s.files, memKey(path)); err != nil {
+		s.files[memKey(path)] = &fstest.MapFile{Mode: fs.ModeDir | perm}
+	}
+	return nil
+}
+
+func (s *memStorage) Rename(oldPath, newPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldKey, newKey := memKey(oldPath), memKey(newPath)
+	if _, err := fs.Stat(s.files, oldKey); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrNotExist}
+	}
+	for key, file := range s.files {
+		if key == oldKey || strings.HasPrefix(key, oldKey+"/") {
+			delete(s.files, key)
+			s.files[newKey+strings.TrimPrefix(key, oldKey)] = file
+		}
+	}
+	return nil
+}
+
+func (s *memStorage) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memKey(name)
+	if _, err := fs.Stat(s.files, key); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(s.files, key)
+	return nil
+}
+
+func (s *memStorage) Stat(name string) (os.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fs.Stat(s.files, memKey(name))
+}
+
+func (s *memStorage) ReadDir(name string) ([]os.DirEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fs.ReadDir(s.files, memKey(name))
+}
+
+// memFile is a file or a directory opened by a memStorage. Like an open file on disk, it follows the renames
+// of its file, and stays usable once its file is removed.
+type memFile struct {
+	storage *memStorage
+	file    *fstest.MapFile // File of the MapFS, guarded by the mutex of the storage
+	append  bool
+	offset  int64
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.storage.mu.Lock()
+	defer f.storage.mu.Unlock()
+	data := f.file.Data
+	if f.offset >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.storage.mu.Lock()
+	file := f.file
+	if f.append {
+		f.offset = int64(len(file.Data))
+	}
+	f.storage.mu.Unlock()
+	n, err := f.WriteAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.storage.mu.Lock()
+	defer f.storage.mu.Unlock()
+	file := f.file
+	if end := off + int64(len(p)); end > int64(len(file.Data)) {
+		file.Data = append(file.Data, make([]byte, end-int64(len(file.Data)))...)
+	}
+	copy(file.Data[off:], p)
+	return len(p), nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.storage.mu.Lock()
+	defer f.storage.mu.Unlock()
+	file := f.file
+	if size <= int64(len(file.Data)) {
+		file.Data = file.Data[:size]
+	} else {
+		file.Data = append(file.Data, make([]byte, size-int64(len(file.Data)))...)
+	}
+	return nil
+}
+
+func (f *memFile) Sync() error  { return nil }
+func (f *memFile) Close() error { return nil }
+
+func TestServerWithStorage(t *testing.T) {
+	storage := newMemStorage()
+	// The directories only exist in the storage, so the test fails if a file is written to the local disk
+	dir := filepath.Join(t.TempDir(), "missing")
+	open := func() *Server {
+		server, err := NewServerWithConfig(Config{
+			Dir:       filepath.Join(dir, "databases"),
+			BackupDir: filepath.Join(dir, "backups"),
+			AESKey:    testAESKey,
+			AuditLog:  true,
+			Storage:   storage,
+		})
+		if err != nil {
+			t.Fatalf("NewServerWithConfig failed: %v", err)
+		}
+		if err := server.Initialize(); err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+		return server
+	}
+
+	server := open()
+	users, err := server.GetOrCreateTable("shop", "users", "id")
+	if err != nil {
+		t.Fatalf("GetOrCreateTable failed: %v", err)
+	}
+	if err := users.CreateIndex("email"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	mustInsert(t, users, Record{"id": "u1", "email": "a@x.com"}, Record{"id": "u2", "email": "b@x.com"})
+	if err := users.Delete("u2"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := server.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("the server wrote to the local disk: %v", err)
+	}
+	if len(storage.files) == 0 {
+		t.Fatal("the server wrote no file to its storage")
+	}
+
+	server = open()
+	defer server.Close()
+	users, err = server.Table(TableRef{Database: "shop", Table: "users"})
+	if err != nil {
+		t.Fatalf("Table failed: %v", err)
+	}
+	records, err := users.SelectByIndex("email", "a@x.com")
+	if err != nil {
+		t.Fatalf("SelectByIndex failed: %v", err)
+	}
+	if len(records) != 1 || records[0]["id"] != "u1" {
+		t.Errorf("SelectByIndex after reopening = %v, want u1", records)
+	}
+	if count, err := users.Count(); err != nil || count != 1 {
+		t.Errorf("Count after reopening = %d, %v, want 1", count, err)
+	}
+	entries, err := server.Databases["shop"].AuditLog()
+	if err != nil || len(entries) != 3 {
+		t.Errorf("AuditLog = %v, %v, want the 2 inserts and the delete", entries, err)
+	}
+}
+
+func TestTableWithStorage(t *testing.T) {
+	storage := newMemStorage()
+	if err := storage.MkdirAll("/tables", 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	table := NewTable("id", "/tables/users.bin", withAESKey(testAESKey), WithStorage(storage))
+	mustInsert(t, table, Record{"id": "a", "name": "Ana"})
+	if err := table.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := storage.Stat("/tables/users.bin"); err != nil {
+		t.Fatalf("the table file is not in the storage: %v", err)
+	}
+
+	reopened := NewTable("id", "/tables/users.bin", withAESKey(testAESKey), WithStorage(storage))
+	defer reopened.Close()
+	if record, err := reopened.Select("a"); err != nil || record["name"] != "Ana" {
+		t.Errorf("Select after reopening = %v, %v, want the record of Ana", record, err)
+	}
+}
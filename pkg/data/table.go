@@ -2,12 +2,24 @@ package data
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Malpizarr/dbproto/pkg/dbdata"
 	"github.com/Malpizarr/dbproto/pkg/utils"
@@ -16,26 +28,116 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// Record is a record of a table, mapping field names to values.
+//
+// Integer values (int, int8 to int64, uint8 to uint32, and uint and uint64 up to math.MaxInt64) and json.Number values
+// holding an integer are stored as exact decimal strings and read back as int64, so large IDs such as 2^53+1 keep
+// their exact value. Every other number is stored as a float64, which represents integers exactly only up to 2^53
+// in absolute value: larger integers decoded into float64 (for example by encoding/json without UseNumber)
+// are rounded before they reach the table.
+//
+// A field set to nil holds an explicit null, which is stored and read back as a nil value in the record,
+// while a missing field is absent from the record: record["field"] is nil in both cases, but only
+// the null field is found by `_, ok := record["field"]`. Encoded as JSON, a null field is written as null
+// and a missing field is left out.
 type Record map[string]interface{}
 
+// ErrNotFound is returned when no record is stored under the requested primary key.
+// Callers can test for it with errors.Is.
+var ErrNotFound = errors.New("not found")
+
+// TableReader is the read-only view of a table.
+type TableReader interface {
+	Select(key interface{}) (Record, error)                            // Returns the record stored under the key, or ErrNotFound
+	SelectMany(keys []string) ([]Record, error)                        // Returns the records stored under the keys, nil for missing keys
+	SelectAll() ([]Record, error)                                      // Returns all the records
+	SelectWithFilter(filters map[string]interface{}) ([]Record, error) // Returns the records matching the filters
+	Query(query Query) ([]Record, error)                               // Returns the records matching the query
+}
+
+// Table implements TableReader.
+var _ TableReader = (*Table)(nil)
+
 // Table is a struct that represents a table in the database.
 // It includes a mutex for read-write locking to ensure thread safety during operations.
 // FilePath is the path to the file where the table data is stored.
 // PrimaryKey is the field name that is used as the primary key for the table.
 // utils is a utility object used for various helper functions.
-// Indexes is a map where the keys are field names and the values are slices of records that have that field.
+// Indexes is deprecated and no longer maintained: the secondary indexes are queried with SelectByIndex and KeysByField,
+// and IndexedRecords builds the same map of field names to records on demand.
 // Records is a map where the keys are primary key values and the values are the corresponding records.
 type Table struct {
-	sync.RWMutex                             // Mutex for read-write locking
-	FilePath     string                      // Path to the file where the table data is stored
-	PrimaryKey   string                      // Field name used as the primary key for the table
-	utils        *utils.Utils                // Utility object used for various helper functions
-	Indexes      map[string][]*dbdata.Record // Map of field names to slices of records that have that field
-	Records      map[string]*dbdata.Record   // Map of primary key values to the corresponding records
-	Cache        map[string]*dbdata.Record   // Cache for recently accessed records
-	metrics      *Metrics                    // Metrics for monitoring
+	sync.RWMutex                                         // Mutex for read-write locking
+	FilePath        string                               // Path to the file where the table data is stored
+	PrimaryKey      string                               // Field name used as the primary key for the table
+	utils           *utils.Utils                         // Utility object used for various helper functions
+	Indexes         map[string][]*dbdata.Record          // Deprecated: always empty, use IndexedRecords
+	Records         map[string]*dbdata.Record            // Map of primary key values to the corresponding records
+	Cache           map[string]*dbdata.Record            // Cache for recently accessed records
+	indexes         map[string]*Index                    // Map of index names to the secondary indexes declared on the table
+	keyFields       []string                             // Fields whose values build a composite primary key, if any
+	keySeparator    string                               // Separator used to join the values of a composite primary key
+	keyGenerator    KeyGenerator                         // Function generating the primary key of records inserted without one, if any
+	keyGenName      string                               // Name of the key generator saved in the metadata, empty for a custom generator
+	indexWorkers    int                                  // Number of goroutines rebuilding the indexes, runtime.GOMAXPROCS(0) if zero
+	foreignKeys     []ForeignKey                         // Foreign keys declared on the table, checked by Database.CheckIntegrity
+	codec           Codec                                // Codec used to encode the records written to the file
+	compressMin     int                                  // Size of the encoded records from which they are compressed, never if zero, see WithCompression
+	memory          *memoryStorage                       // In-memory storage used instead of the files, if any
+	storage         Storage                              // Storage of the files of the table, LocalStorage if nil, see WithStorage
+	perRecord       bool                                 // Whether each record is stored in its own file, see WithFilePerRecord
+	filesKnown      bool                                 // Whether the record files match the records apart from changedKeys
+	changedKeys     map[string]struct{}                  // Keys of the records changed since the record files were last written
+	legacyKeys      atomic.Bool                          // Whether records were read from files named after keys of an older format, see canonicalizeKeys
+	appendMax       int                                  // Number of records appended to the log before it is consolidated, never if zero, see WithAppendLog
+	appendLog       atomic.Pointer[appendLogState]       // State of the append log, nil if the table has none and never had one
+	compactRatio    float64                              // Dead space ratio of the append log from which it is consolidated, never if zero, see WithAutoCompact
+	audit           *auditLog                            // Audit log of the database the mutations are recorded in, if enabled
+	actor           string                               // Actor of the mutation in progress, recorded in the audit log
+	holdAudit       bool                                 // Whether the audit entries are held until a DBTxn commits
+	heldAudit       []AuditEntry                         // Audit entries held until a DBTxn commits
+	uniques         []*uniqueIndex                       // Unique constraints declared on the table
+	readOnly        bool                                 // Whether every write fails with ErrReadOnly, for the tables of a replica
+	schema          Schema                               // Schema the records are expected to match, if any
+	encryptedFields []string                             // Fields whose values are encrypted individually, see WithFieldEncryption
+	triggers        map[OpType][]func(ChangeEvent) error // Triggers of the table by operation, see AddTrigger
+	capturing       bool                                 // Whether the changes of the write in progress are recorded for the triggers
+	changes         []pendingChange                      // Changes of the write in progress whose triggers have not been fired
+	triggerCtx      context.Context                      // Context of the write in progress, passed on to its triggers
+	fieldCipher     cipher.AEAD                          // Cipher of the encrypted fields, nil if the table was opened without the key
+	transforms      atomic.Pointer[transformSet]         // Transforms of the written and read values, nil if the table has none
+	debounce        time.Duration                        // Window during which writes are coalesced into a single file write, if positive
+	flushTimer      *time.Timer                          // Timer of the pending coalesced file write, if any
+	recordLocks     *recordLocks                         // Sharded locks of the records, nil unless WithRecordLocks is set
+	commitMu        sync.Mutex                           // Mutex serializing the writes of the file
+	commitSeq       atomic.Uint64                        // Number of changes published in memory before their file write, see WithRecordLocks
+	committed       uint64                               // Number of those changes the file holds, guarded by commitMu
+	pendingSeq      uint64                               // Sequence number of the change published by the write in progress, if any
+	metrics         *Metrics                             // Metrics for monitoring
+	clock           Clock                                // Clock of the timestamps of the table, SystemClock if nil
+	snapshot        atomic.Pointer[dbdata.Records]       // Latest committed records, swapped atomically by writers
+	version         atomic.Uint64                        // Number of snapshots published, incremented after each one, see Version
+	headerStamps    bool                                 // Whether the last write is recorded in the header of the data file, see WithHeaderTimestamps
+	stamp           atomic.Pointer[FileStamp]            // Last write recorded in the header of the data file, nil if none
+	sortedKeys      atomic.Pointer[keySnapshot]          // Sorted keys of the latest snapshot scanned, see ScanPrefix
+	loaded          atomic.Bool                          // Whether the records and indexes are resident in memory
+	lru             *tableLRU                            // LRU of hot tables the table belongs to, if any
+	fsyncPolicy     FsyncPolicy                          // Policy that controls when the file is synced to stable storage
+	syncWrites      bool                                 // Whether the file is opened with O_SYNC, see WithSyncWrites
+	writeBufferSize int                                  // Size of the buffer the file is written through, the bufio default if zero
+	ioAttempts      int                                  // Number of attempts of the file operations failing with a transient error, see WithIORetry
+	ioBackoff       time.Duration                        // Delay before the first retry of a file operation, see WithIORetry
+	dirty           atomic.Bool                          // Whether the file was written since the last sync
+	sizesKnown      atomic.Bool                          // Whether storedSize and plainSize are up to date
+	storedSize      atomic.Int64                         // Size of the stored data after the last write, see Stats
+	plainSize       atomic.Int64                         // Size of the records marshaled as protobuf at the last write, see Stats
+	stopFsync       chan struct{}                        // Channel closed to stop the background fsync goroutine
+	closeOnce       sync.Once                            // Ensures the table is closed only once
 }
 
+// TableOption is a function that configures optional settings of a Table when it is created.
+type TableOption func(*Table)
+
 // NewTable is a constructor function for the Table struct.
 // It takes a primary key and a file path as arguments and returns a pointer to a new Table instance.
 //
@@ -52,82 +154,123 @@ type Table struct {
 // Parameters:
 // - primaryKey: A string representing the field name to be used as the primary key for the table.
 // - filePath: A string representing the path to the file where the table data is stored.
+// - opts: Optional TableOption values that configure the table, applied before the file is initialized.
 //
 // Returns:
 // - A pointer to a new Table instance.
-func NewTable(primaryKey, filePath string) *Table {
-	dir := path.Dir(filePath)
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Fatalf("Failed to create directory %s: %v", dir, err)
-		}
+func NewTable(primaryKey, filePath string, opts ...TableOption) *Table {
+	table := &Table{
+		FilePath:     filePath,
+		PrimaryKey:   primaryKey,
+		Records:      make(map[string]*dbdata.Record),
+		Cache:        make(map[string]*dbdata.Record),
+		indexes:      make(map[string]*Index),
+		keySeparator: DefaultKeySeparator,
+		metrics:      NewMetrics(),
+	}
+	for _, opt := range opts {
+		opt(table)
 	}
+	if !table.isMemory() {
+		dir := path.Dir(filePath)
+		if _, err := table.fs().Stat(dir); isNotExist(err) {
+			if err := table.fs().MkdirAll(dir, 0755); err != nil {
+				log.Fatalf("Failed to create directory %s: %v", dir, err)
+			}
+		}
 
-	utils, err := utils.NewUtils()
+		if table.utils == nil {
+			utils, err := utils.NewUtils()
+			if err != nil {
+				log.Fatalf("Failed to create utils: %v", err)
+			}
+			table.utils = utils
+		}
+	}
+	metaData, err := table.loadMetadata()
 	if err != nil {
-		log.Fatalf("Failed to create utils: %v", err)
+		log.Fatalf("Failed to load metadata for %s: %v", filePath, err)
 	}
-	table := &Table{
-		FilePath:   filePath,
-		PrimaryKey: primaryKey,
-		utils:      utils,
-		Records:    make(map[string]*dbdata.Record),
-		Indexes:    make(map[string][]*dbdata.Record),
-		Cache:      make(map[string]*dbdata.Record),
-		metrics:    NewMetrics(),
+	if metaData != nil {
+		for _, fields := range metaData.Indexes {
+			idx := newIndex(fields)
+			table.indexes[idx.Name] = idx
+		}
+		for _, field := range metaData.ElementIndexes {
+			idx := newElementIndex(field)
+			table.indexes[idx.Name] = idx
+		}
+		table.foreignKeys = metaData.ForeignKeys
+		for _, constraint := range metaData.Uniques {
+			table.uniques = append(table.uniques, &uniqueIndex{UniqueConstraint: constraint, owners: make(map[string]string)})
+		}
+		table.perRecord = table.perRecord || metaData.FilePerRecord
+		if table.appendMax == 0 {
+			table.appendMax = metaData.AppendLog
+		}
+		if table.compactRatio == 0 {
+			table.compactRatio = metaData.CompactRatio
+		}
+		table.headerStamps = table.headerStamps || metaData.HeaderStamps
+		if table.keyGenerator == nil && metaData.KeyGenerator == UUIDKeyGenerator {
+			WithUUIDKeys()(table)
+		}
+		if table.schema == nil {
+			table.schema = metaData.Schema
+		}
+		if table.codec == nil && metaData.Codec != "" {
+			if table.codec, err = lookupCodec(metaData.Codec); err != nil {
+				log.Fatalf("Failed to load codec for %s: %v", filePath, err)
+			}
+		}
+		if len(table.keyFields) == 0 && len(metaData.KeyFields) > 0 {
+			table.keyFields = metaData.KeyFields
+			table.keySeparator = metaData.KeySeparator
+		}
+		table.encryptedFields = mergeFields(metaData.EncryptedFields, table.encryptedFields)
+	}
+	if err := table.checkEncryptedFields(); err != nil {
+		log.Fatalf("Invalid encrypted fields for %s: %v", filePath, err)
 	}
-	if err := table.initializeFileIfNotExists(); err != nil {
-		log.Fatalf("Failed to initialize file %s: %v", filePath, err)
+	if table.codec == nil {
+		table.codec = ProtobufCodec
+	}
+	if table.isMemory() {
+		table.perRecord = false
+	}
+	// A replica never writes, so it doesn't create a missing file
+	if !table.readOnly {
+		if err := table.initializeFileIfNotExists(); err != nil {
+			log.Fatalf("Failed to initialize file %s: %v", filePath, err)
+		}
 	}
 	err = table.LoadIndexes()
 	if err != nil {
 		log.Fatalf("Failed to load indexes: %v", err)
 	}
+	table.logSchemaDrift()
+	table.startFsyncLoop()
 	return table
 }
 
-// LoadIndexes loads the indexes from the file
+// LoadIndexes loads the records and the indexes from the file
 func (t *Table) LoadIndexes() error {
 	records, err := t.readRecordsFromFile()
 	if err != nil {
 		return err
 	}
 
-	if t.Indexes == nil {
-		t.Indexes = make(map[string][]*dbdata.Record)
-	}
-
-	for _, record := range records.GetRecords() {
-		for key, value := range record.Fields {
-			if value != nil && value.GetStringValue() != "" {
-				t.Indexes[key] = append(t.Indexes[key], record)
-			}
-		}
-	}
+	t.Records = records.GetRecords()
+	t.publishSnapshot(records)
+	t.rebuildIndexes(records.GetRecords())
+	t.resetRecordFiles(true)
+	t.loaded.Store(true)
 	return nil
 }
 
-// ResetAndLoadIndexes resets the indexes and reloads them from the file
+// ResetAndLoadIndexes resets the indexes and reloads them from the file, like RebuildIndexes.
 func (t *Table) ResetAndLoadIndexes() error {
-	t.Lock()
-	defer t.Unlock()
-
-	t.Indexes = make(map[string][]*dbdata.Record)
-
-	records, err := t.readRecordsFromFile()
-	if err != nil {
-		return fmt.Errorf("failed to read records from file: %v", err)
-	}
-
-	for _, record := range records.GetRecords() {
-		for key, value := range record.Fields {
-			if value != nil && value.GetStringValue() != "" {
-				t.Indexes[key] = append(t.Indexes[key], record)
-			}
-		}
-	}
-
-	return nil
+	return t.RebuildIndexes()
 }
 
 // initializeFileIfNotExists is a method of the Table struct that initializes the file if it doesn't exist.
@@ -140,7 +283,7 @@ func (t *Table) ResetAndLoadIndexes() error {
 // - If the operation is successful, it returns nil.
 // - If an error occurs while writing to the file, it returns the error.
 func (t *Table) initializeFileIfNotExists() error {
-	if _, err := os.Stat(t.FilePath); os.IsNotExist(err) {
+	if !t.dataExists() {
 		records := &dbdata.Records{
 			Records: make(map[string]*dbdata.Record),
 		}
@@ -172,60 +315,131 @@ func (t *Table) initializeFileIfNotExists() error {
 // - If an error occurs, it returns the error.
 
 func (t *Table) Insert(record Record) error {
+	_, err := t.InsertWithMode(record, InsertError)
+	return err
+}
+
+// InsertMode defines what an insert does when a record with the same primary key already exists.
+type InsertMode int
+
+const (
+	InsertError   InsertMode = iota // Fail with an error, the default behavior of Insert
+	InsertIgnore                    // Keep the existing record and skip the new one silently
+	InsertReplace                   // Overwrite the existing record with the new one
+)
+
+// InsertResult reports what an insert did with the record.
+type InsertResult int
+
+const (
+	Inserted InsertResult = iota // The record was inserted as a new record
+	Ignored                      // The record was skipped because its primary key already exists
+	Replaced                     // The record overwrote an existing record with the same primary key
+)
+
+// InsertWithMode is a method of the Table struct that inserts a new record into the table,
+// handling a duplicate primary key according to the given mode.
+// It behaves like Insert, except that when a record with the same primary key already exists,
+// InsertIgnore leaves the table untouched and InsertReplace overwrites the existing record entirely.
+// If the table has a key generator and the record has no primary key, a new key is generated and written into the stored record.
+// This is useful for idempotent ingestion pipelines that may deliver the same record more than once.
+//
+// Parameters:
+// - record: A map representing the record to be inserted. The keys are field names and the values are the field values.
+// - mode: An InsertMode that defines how a duplicate primary key is handled.
+//
+// Returns:
+// - An InsertResult that reports whether the record was inserted, ignored or replaced the existing one.
+// - If an error occurs, it returns the error.
+func (t *Table) InsertWithMode(record Record, mode InsertMode) (InsertResult, error) {
+	unlockRecord, _ := t.lockInserted(context.Background(), record)
 	t.Lock()
-	defer t.Unlock()
+	var result InsertResult
+	err := t.withRecordTriggers(context.Background(), unlockRecord, func() (err error) {
+		_, result, err = t.insertLocked(record, mode)
+		return err
+	})
+	return result, err
+}
 
-	allRecords, err := t.readRecordsFromFile()
+// insertLocked inserts the record like InsertWithMode and returns its stored key. The table must be locked for writing.
+func (t *Table) insertLocked(record Record, mode InsertMode) (string, InsertResult, error) {
+	record, err := t.transformWrite(record)
 	if err != nil {
-		return err
+		return "", Inserted, err
 	}
-
-	primaryKeyValue, ok := record[t.PrimaryKey]
-	if !ok {
-		return fmt.Errorf("primary key '%s' not found in record", t.PrimaryKey)
+	if err := t.schema.checkStrings(record); err != nil {
+		return "", Inserted, err
+	}
+	allRecords, err := t.loadForWrite()
+	if err != nil {
+		return "", Inserted, err
 	}
 
-	// Validate the primary key value before calling toProtoValue
-	if strValue, ok := primaryKeyValue.(string); ok {
-		if _, err := strconv.ParseInt(strValue, 10, 64); err == nil {
-			primaryKeyValue = "str:" + strValue
-		}
+	record, err = t.withGeneratedKey(record, func(key string) bool {
+		_, exists := allRecords.Records[key]
+		return exists
+	})
+	if err != nil {
+		return "", Inserted, err
 	}
 
-	primaryKeyProtoValue, err := toProtoValue(primaryKeyValue)
+	primaryKeyString, err := t.primaryKeyOf(record)
 	if err != nil {
-		return err
+		return "", Inserted, err
 	}
-	primaryKeyString := primaryKeyProtoValue.GetStringValue()
 
-	if primaryKeyString == "<nil>" || primaryKeyString == "" {
-		return fmt.Errorf("primary key '%s' is nil or empty", t.PrimaryKey)
+	protoRecord, err := toProtoRecord(t.keyedRecord(record, primaryKeyString))
+	if err != nil {
+		return "", Inserted, err
 	}
 
-	protoRecord := &dbdata.Record{Fields: make(map[string]*structpb.Value)}
-	for key, value := range record {
-		// Validate each value before calling toProtoValue
-		if strValue, ok := value.(string); ok {
-			if _, err := strconv.ParseInt(strValue, 10, 64); err == nil {
-				value = "str:" + strValue
-			}
+	result := Inserted
+	existingRecord, exists := allRecords.Records[primaryKeyString]
+	if exists {
+		switch mode {
+		case InsertIgnore:
+			return primaryKeyString, Ignored, nil
+		case InsertReplace:
+			t.unindexRecord(primaryKeyString, existingRecord)
+			result = Replaced
+		default:
+			return "", Inserted, fmt.Errorf("record with primary key '%s' already exists", primaryKeyString)
 		}
-		protoValue, err := toProtoValue(value)
-		if err != nil {
-			return fmt.Errorf("invalid value type for field '%s': %v", key, err)
-		}
-		protoRecord.Fields[key] = protoValue
 	}
-
-	if _, exists := allRecords.Records[primaryKeyString]; exists {
-		return fmt.Errorf("record with primary key '%s' already exists", primaryKeyString)
+	if err := t.checkUnique(primaryKeyString, protoRecord); err != nil {
+		if result == Replaced {
+			t.indexRecord(primaryKeyString, existingRecord)
+		}
+		return "", Inserted, err
 	}
 
 	allRecords.Records[primaryKeyString] = protoRecord
+	t.indexRecord(primaryKeyString, protoRecord)
+
+	if result == Replaced {
+		t.recordChange(OpUpdate, primaryKeyString, existingRecord, protoRecord)
+		err = t.writeChanges(allRecords)
+	} else {
+		t.recordChange(OpInsert, primaryKeyString, nil, protoRecord)
+		err = t.writeInserted(allRecords, primaryKeyString, protoRecord)
+	}
+	if err != nil {
+		// The record is not stored, so the indexes get back their entries
+		t.unindexRecord(primaryKeyString, protoRecord)
+		if result == Replaced {
+			t.indexRecord(primaryKeyString, existingRecord)
+		}
+		return "", result, err
+	}
 	t.Cache[primaryKeyString] = protoRecord
-
 	t.metrics.IncrementInsertCount()
-	return t.writeRecordsToFile(allRecords)
+	if result == Replaced {
+		t.recordAudit(AuditReplace, primaryKeyString)
+	} else {
+		t.recordAudit(AuditInsert, primaryKeyString)
+	}
+	return primaryKeyString, result, nil
 }
 
 // InsertMany is a method of the Table struct that inserts multiple new records into the table.
@@ -240,78 +454,109 @@ func (t *Table) Insert(record Record) error {
 // - A slice of errors for records that failed to insert. If all records are inserted successfully, the slice ismpty.
 func (t *Table) InsertMany(records []Record) error {
 	t.Lock()
-	defer t.Unlock()
+	return t.withTriggers(context.Background(), func() error {
+		return t.insertManyLocked(records)
+	})
+}
 
-	allRecords, err := t.readRecordsFromFile()
+// insertManyLocked inserts the records like InsertMany. The table must be locked for writing.
+func (t *Table) insertManyLocked(records []Record) error {
+	allRecords, err := t.loadForWrite()
 	if err != nil {
 		return err
 	}
 
+	inserted := make(map[string]*dbdata.Record, len(records))
+	written := false
+	defer func() {
+		if !written {
+			// Leave the indexes as they were if the batch is not written
+			for primaryKeyString, protoRecord := range inserted {
+				t.unindexRecord(primaryKeyString, protoRecord)
+			}
+		}
+	}()
 	for _, record := range records {
-		primaryKeyValue, ok := record[t.PrimaryKey]
-		if !ok {
-			return fmt.Errorf("primary key '%s' not found in record", t.PrimaryKey)
+		record, err := t.transformWrite(record)
+		if err != nil {
+			return err
 		}
-
-		primaryKeyProtoValue, err := toProtoValue(primaryKeyValue)
+		if err := t.schema.checkStrings(record); err != nil {
+			return err
+		}
+		record, err = t.withGeneratedKey(record, func(key string) bool {
+			_, exists := allRecords.Records[key]
+			return exists
+		})
 		if err != nil {
 			return err
 		}
-		primaryKeyString := primaryKeyProtoValue.GetStringValue()
 
-		if primaryKeyString == "<nil>" || primaryKeyString == "" {
-			return fmt.Errorf("primary key '%s' is nil or empty", t.PrimaryKey)
+		primaryKeyString, err := t.primaryKeyOf(record)
+		if err != nil {
+			return err
 		}
 
-		protoRecord := &dbdata.Record{Fields: make(map[string]*structpb.Value)}
-		for key, value := range record {
-			protoValue, err := toProtoValue(value)
-			if err != nil {
-				return fmt.Errorf("invalid value type for field '%s': %v", key, err)
-			}
-			protoRecord.Fields[key] = protoValue
+		protoRecord, err := toProtoRecord(t.keyedRecord(record, primaryKeyString))
+		if err != nil {
+			return err
 		}
 
 		if _, exists := allRecords.Records[primaryKeyString]; exists {
 			return fmt.Errorf("record with primary key '%s' already exists", primaryKeyString)
 		}
+		// The records of the batch indexed so far are checked too
+		if err := t.checkUnique(primaryKeyString, protoRecord); err != nil {
+			return err
+		}
 
 		allRecords.Records[primaryKeyString] = protoRecord
-		t.Cache[primaryKeyString] = protoRecord
+		inserted[primaryKeyString] = protoRecord
+		t.indexRecord(primaryKeyString, protoRecord)
+		t.recordChange(OpInsert, primaryKeyString, nil, protoRecord)
 	}
 
-	if err := t.writeRecordsToFile(allRecords); err != nil {
+	if err := t.writeChanges(allRecords); err != nil {
 		return err
 	}
+	written = true
 
+	insertedKeys := make([]string, 0, len(inserted))
+	for primaryKeyString, protoRecord := range inserted {
+		t.Cache[primaryKeyString] = protoRecord
+		insertedKeys = append(insertedKeys, primaryKeyString)
+	}
+
+	t.recordAudit(AuditInsert, insertedKeys...)
 	return nil
 }
 
 //SELECT
 
 // SelectAll is a method of the Table struct that selects all records from the table.
-// It locks the table for reading, ensuring that no other goroutines can modify the table while the selection is happening.
-// It then reads all existing records from the file where the table data is stored.
+// It reads the current snapshot of the records without locking the table, so it is never blocked by writers
+// and sees the table as it was when the selection started, even if a write completes in the meantime.
 // It iterates over the records, appending each one to a slice of records.
 // If any error occurs during these operations, it returns the error and a nil slice.
 // If the operation is successful, it returns the slice of all records and a nil error.
 //
+// The values are decoded from their protobuf representation into the Record map type used by the rest of the API.
+// SelectAllProto returns the records as protobuf messages instead.
+//
 // Returns:
-// - A slice of pointers to dbdata.Record instances representing all records in the table.
+// - A slice of Record objects representing all records in the table, empty but not nil if the table has no records.
 // - If an error occurs, it returns the error and a nil slice.
 // - If the operation is successful, it returns the slice of all records and a nil error.
 func (t *Table) SelectAll() ([]Record, error) {
-	t.RLock()
-	defer t.RUnlock()
-
-	allRecordsProto, err := t.readRecordsFromFile()
+	allRecordsProto, err := t.snapshotRecords()
 	if err != nil {
 		return nil, err
 	}
 
-	var allRecords []Record
+	// An empty table yields an empty slice, not nil, so it is encoded as [] rather than null
+	allRecords := make([]Record, 0, len(allRecordsProto.GetRecords()))
 	for _, recordProto := range allRecordsProto.GetRecords() {
-		record, err := fromProtoRecord(recordProto)
+		record, err := t.fromStoredRecord(recordProto)
 		if err != nil {
 			return nil, err
 		}
@@ -321,9 +566,72 @@ func (t *Table) SelectAll() ([]Record, error) {
 	return allRecords, nil
 }
 
+// Count is a method of the Table struct that returns the number of records of the table.
+// It reads the current snapshot of the records without locking the table or converting the records.
+// An empty table, whether its file is empty or holds no records after deleting them all, has a count of 0.
+//
+// Returns:
+// - The number of records of the table.
+// - An error, if an error occurs while reading the records from the file.
+func (t *Table) Count() (int, error) {
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return 0, err
+	}
+	return len(allRecords.GetRecords()), nil
+}
+
+// Raw is a method of the Table struct that returns the records of the table as the underlying protobuf message,
+// without converting them to the Record map type.
+// It reads the current snapshot of the records without locking the table.
+// The returned message is a deep copy of the decoded records, so mutating it has no effect on the table or its internal state.
+// This avoids a double conversion when the caller already works with protobuf.
+//
+// Returns:
+// - A pointer to a dbdata.Records instance holding a copy of all records in the table, keyed by primary key.
+// - If an error occurs while reading the records from the file, it returns the error and a nil pointer.
+func (t *Table) Raw() (*dbdata.Records, error) {
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	t.metrics.IncrementQueryCount()
+	return proto.Clone(allRecords).(*dbdata.Records), nil
+}
+
+// SelectAllProto is a method of the Table struct that selects all records from the table as protobuf messages, sorted by primary key.
+// It is a lower-level variant of SelectAll for callers working with the dbdata package, such as the exporters:
+// the values keep their stored encoding, for example integers are strings with the "num:" prefix.
+// Most callers should use SelectAll, which returns the decoded Record map type.
+// The returned records are deep copies, so mutating them has no effect on the table.
+//
+// Returns:
+// - A slice of pointers to dbdata.Record instances representing all records in the table, sorted by primary key.
+// - If an error occurs while reading the records from the file, it returns the error and a nil slice.
+func (t *Table) SelectAllProto() ([]*dbdata.Record, error) {
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(allRecords.GetRecords()))
+	for key := range allRecords.GetRecords() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	records := make([]*dbdata.Record, len(keys))
+	for i, key := range keys {
+		records[i] = CloneRecord(allRecords.Records[key])
+	}
+	t.metrics.IncrementQueryCount()
+	return records, nil
+}
+
 // SelectWithFilter is a method of the Table struct that selects records from the table based on the given filters.
-// It locks the table for reading, ensuring that no other goroutines can modify the table while the selection is happening.
-// It then reads all existing records from the file where the table data is stored.
+// It reads the current snapshot of the records without locking the table, so it is never blocked by writers
+// and sees the table as it was when the selection started, even if a write completes in the meantime.
 // It iterates over the records, checking each one against the filters.
 // For each record, it iterates over the filters. For each filter, it converts the filter value to a proto Value.
 // If an error occurs during this conversion, it returns the error and a nil slice.
@@ -340,10 +648,7 @@ func (t *Table) SelectAll() ([]Record, error) {
 // - If an error occurs, it returns the error and a nil slice.
 // - If the operation is successful, it returns the slice of matched records and a nil error.
 func (t *Table) SelectWithFilter(filters map[string]interface{}) ([]Record, error) {
-	t.RLock()
-	defer t.RUnlock()
-
-	allRecords, err := t.readRecordsFromFile()
+	allRecords, err := t.snapshotRecords()
 	if err != nil {
 		return nil, err
 	}
@@ -353,7 +658,7 @@ func (t *Table) SelectWithFilter(filters map[string]interface{}) ([]Record, erro
 RecordsLoop:
 	for _, record := range allRecords.GetRecords() {
 		for field, filterValue := range filters {
-			protoValue, err := structpb.NewValue(filterValue)
+			protoValue, err := filterProtoValue(filterValue)
 			if err != nil {
 				return nil, fmt.Errorf("error converting filter value for field %s: %v", field, err)
 			}
@@ -369,7 +674,7 @@ RecordsLoop:
 	// Convert matchedRecords to []Record
 	recordResults := make([]Record, len(matchedRecords))
 	for i, protoRecord := range matchedRecords {
-		record, err := fromProtoRecord(protoRecord)
+		record, err := t.fromStoredRecord(protoRecord)
 		if err != nil {
 			return nil, err
 		}
@@ -380,45 +685,108 @@ RecordsLoop:
 }
 
 // Select is a method of the Table struct that selects a record from the table based on the given key.
-// It locks the table for reading, ensuring that no other goroutines can modify the table while the selection is happening.
-// It then reads all existing records from the file where the table data is stored.
+// It locks the table for reading to look up the key in the cache of recently written records,
+// and otherwise looks it up in the current snapshot of the records.
 // It converts the key to a string and checks if a record with that key exists in the table.
 // If a record with that key does not exist, it returns an error and a nil record.
 // If a record with that key exists, it returns the record and a nil error.
 //
 // Parameters:
-// - key: An interface{} representing the key of the record to be selected. The key is converted to a string before the selection is performed.
+// - key: An interface{} representing the key of the record to be selected. It is matched like the primary key of an inserted record, so the integer 1 and the string "1" are distinct keys.
 //
 // Returns:
 // - A pointer to a dbdata.Record instance representing the record with the given key.
-// - If a record with the given key does not exist, it returns an error and a nil record.
+// - If a record with the given key does not exist, it returns an error wrapping ErrNotFound and a nil record.
 // - If an error occurs while reading the records from the file, it returns the error and a nil record.
 // - If the operation is successful, it returns the record with the given key and a nil error.
 func (t *Table) Select(key interface{}) (Record, error) {
+	records, err := t.snapshotRecords()
+	if err != nil {
+		return nil, err
+	}
+
 	t.RLock()
 	defer t.RUnlock()
 
-	keyStr := fmt.Sprintf("%v", key)
+	keyStr := t.resolveKey(records.Records, key)
 
 	if record, exists := t.Cache[keyStr]; exists {
 		t.metrics.IncrementCacheHits()
-		return fromProtoRecord(record)
+		return t.fromStoredRecord(record)
 	}
 
-	records, err := t.readRecordsFromFile()
+	record, exists := records.Records[keyStr]
+	if !exists {
+		return nil, fmt.Errorf("record with key %s %w", keyStr, ErrNotFound)
+	}
+
+	t.metrics.IncrementCacheMisses()
+	t.metrics.IncrementQueryCount()
+	return t.fromStoredRecord(record)
+}
+
+// SelectFields is a method of the Table struct that selects a record like Select but returns only the requested fields,
+// which keeps responses small when records are wide and only a few of their fields are needed.
+// Requested fields the record doesn't have are omitted from the result. Without fields, it returns the whole record.
+//
+// Parameters:
+// - key: A string representing the key of the record to be selected.
+// - fields: The names of the fields to be returned.
+//
+// Returns:
+// - A Record holding only the requested fields of the record with the given key.
+// - If a record with the given key does not exist, it returns an error wrapping ErrNotFound and a nil record.
+// - If an error occurs while reading the records from the file, it returns the error and a nil record.
+func (t *Table) SelectFields(key string, fields ...string) (Record, error) {
+	record, err := t.Select(key)
 	if err != nil {
 		return nil, err
 	}
+	if len(fields) == 0 {
+		return record, nil
+	}
 
-	record, exists := records.Records[keyStr]
-	if !exists {
-		return nil, fmt.Errorf("record with key %s not found", keyStr)
+	projected := make(Record, len(fields))
+	for _, field := range fields {
+		if value, exists := record[field]; exists {
+			projected[field] = value
+		}
+	}
+	return projected, nil
+}
+
+// SelectMany is a method of the Table struct that selects the records for a batch of primary keys in a single read.
+// It reads the current snapshot of the records once and looks up every key in it, instead of calling Select for each key.
+// The results are in the same order as the keys. A key without a record yields a nil Record at its position,
+// so callers can tell which keys are missing by checking for nil entries.
+//
+// Parameters:
+// - keys: A slice of strings representing the primary keys of the records to be selected.
+//
+// Returns:
+// - A slice of Record objects with one entry per key, in the same order as the keys. Missing keys have a nil entry.
+// - An error, if any error occurs while reading or converting the records.
+func (t *Table) SelectMany(keys []string) ([]Record, error) {
+	allRecords, err := t.snapshotRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Record, len(keys))
+	for i, key := range keys {
+		protoRecord, exists := allRecords.Records[key]
+		if !exists {
+			continue
+		}
+		record, err := t.fromStoredRecord(protoRecord)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = record
 	}
 
-	t.Cache[keyStr] = record
-	t.metrics.IncrementCacheMisses()
 	t.metrics.IncrementQueryCount()
-	return fromProtoRecord(record)
+	return results, nil
 }
 
 //UPDATE
@@ -427,6 +795,8 @@ func (t *Table) Select(key interface{}) (Record, error) {
 // It locks the table for writing, ensuring that no other goroutines can modify the table while the update is happening.
 // It first reads all existing records from the file where the table data is stored.
 // If the primary key of the record to be updated does not exist in the table, it returns an error.
+// The primary key is immutable: if the updates would change it, it returns an error wrapping ErrPrimaryKeyChange
+// and leaves the record untouched. Setting the primary key field to its current value is allowed and has no effect.
 // It then iterates over the fields in the updates map, updating each field in the existing record.
 // For each field, it checks if the field exists in the existing record.
 // If the field exists, it removes the existing record from the index for that field.
@@ -438,55 +808,84 @@ func (t *Table) Select(key interface{}) (Record, error) {
 // If any error occurs during these operations, it returns the error.
 //
 // Parameters:
-// - key: An interface{} representing the key of the record to be updated. The key is converted to a string before the update is performed.
+// - key: An interface{} representing the key of the record to be updated. It is matched like the primary key of an inserted record, so the integer 1 and the string "1" are distinct keys.
 // - updates: A map representing the fields to be updated in the record. The keys are field names and the values are the new field values.
+// A nil value sets the field to an explicit null rather than removing it; Replace removes fields.
 //
 // Returns:
 // - If the operation is successful, it returns nil.
 // - If an error occurs, it returns the error.
 func (t *Table) Update(key interface{}, updates Record) error {
+	unlockRecord, _ := t.lockRecord(context.Background(), key)
 	t.Lock()
-	defer t.Unlock()
+	return t.withRecordTriggers(context.Background(), unlockRecord, func() error {
+		return t.updateLocked(key, updates)
+	})
+}
 
-	keyStr := fmt.Sprintf("%v", key)
-	allRecords, err := t.readRecordsFromFile()
+// updateLocked updates the record like Update. The table must be locked for writing.
+func (t *Table) updateLocked(key interface{}, updates Record) error {
+	updates, err := t.transformWrite(updates)
 	if err != nil {
 		return err
 	}
+	if err := t.schema.checkStrings(updates); err != nil {
+		return err
+	}
+	allRecords, err := t.loadForWrite()
+	if err != nil {
+		return err
+	}
+	keyStr := t.resolveKey(allRecords.Records, key)
 	existingRecord, exists := allRecords.Records[keyStr]
 	if !exists {
-		return fmt.Errorf("record with key %s not found", keyStr)
+		return fmt.Errorf("record with key %s %w", keyStr, ErrNotFound)
+	}
+	if err := t.checkKeyUnchanged(keyStr, existingRecord, updates); err != nil {
+		return err
 	}
 
+	oldRecord := existingRecord
+	t.unindexRecord(keyStr, existingRecord)
+	// The record may be shared with the snapshot read concurrently, so update a copy of it
+	existingRecord = CloneRecord(existingRecord)
 	for field, newValue := range updates {
-		oldVal := existingRecord.Fields[field]
-		if oldVal != nil {
-			newIdxMap := make([]*dbdata.Record, 0)
-			for _, r := range t.Indexes[field] {
-				if r.Fields[field] != oldVal {
-					newIdxMap = append(newIdxMap, r)
-				}
-			}
-			t.Indexes[field] = newIdxMap
+		if field == t.PrimaryKey {
+			// The primary key is unchanged, keep its stored representation
+			continue
 		}
-		newVal, err := structpb.NewValue(newValue)
+		newVal, err := toStoredValue(newValue)
 		if err != nil {
+			t.indexRecord(keyStr, allRecords.Records[keyStr])
 			return fmt.Errorf("error converting newValue for field %s: %v", field, err)
 		}
 		existingRecord.Fields[field] = newVal
-		t.Indexes[field] = append(t.Indexes[field], existingRecord)
 	}
-
+	if err := t.checkUnique(keyStr, existingRecord); err != nil {
+		t.indexRecord(keyStr, allRecords.Records[keyStr])
+		return err
+	}
+	allRecords.Records[keyStr] = existingRecord
+	t.indexRecord(keyStr, existingRecord)
+
+	t.recordChange(OpUpdate, keyStr, oldRecord, existingRecord)
+	if err := t.writeChanges(allRecords); err != nil {
+		// The record is unchanged, so the indexes get back its entries
+		t.unindexRecord(keyStr, existingRecord)
+		t.indexRecord(keyStr, oldRecord)
+		return err
+	}
 	t.Cache[keyStr] = existingRecord
-
 	t.metrics.IncrementUpdateCount()
-	return t.writeRecordsToFile(allRecords)
+	t.recordAudit(AuditUpdate, keyStr)
+	return nil
 }
 
 // UpdateMany is a method of the Table struct that updates multiple records in the table based on the given keys and updates.
 // It locks the table for writing, ensuring that no other goroutines can modify the table while the updates are happening.
 // It first reads all existing records from the file where the table data is stored.
 // For each key, if the primary key of the record to be updated does not exist in the table, it returns an error for that key but continues with the rest.
+// Updates that would change the primary key of a record are rejected with an error wrapping ErrPrimaryKeyChange for that record.
 // It then iterates over the fields in the updates map, updating each field in the existing record.
 // For each field, it checks if the field exists in the existing record.
 // If the field exists, it removes the existing record from the index for that field.
@@ -503,54 +902,189 @@ func (t *Table) Update(key interface{}, updates Record) error {
 // Returns:
 // - A slice of errors for records that failed to update. If all records are updated successfully, the slice is empty.
 func (t *Table) UpdateMany(updates map[string]Record) []error {
+	var errors []error
 	t.Lock()
-	defer t.Unlock()
+	err := t.withTriggers(context.Background(), func() error {
+		errors = t.updateManyLocked(updates)
+		return nil
+	})
+	if err != nil {
+		// The file write shared with the writes holding record locks failed
+		return append(errors, err)
+	}
+	return errors
+}
 
-	allRecords, err := t.readRecordsFromFile()
+// updateManyLocked applies the updates like UpdateMany. The table must be locked for writing.
+func (t *Table) updateManyLocked(updates map[string]Record) []error {
+	allRecords, err := t.loadForWrite()
 	if err != nil {
 		return []error{fmt.Errorf("failed to read records from file: %w", err)}
 	}
 
 	var errors []error
+	var updatedKeys []string
+	var oldRecords []*dbdata.Record
 
 	for keyStr, updateFields := range updates {
 		existingRecord, exists := allRecords.Records[keyStr]
 		if !exists {
-			errors = append(errors, fmt.Errorf("record with key %s not found", keyStr))
+			errors = append(errors, fmt.Errorf("record with key %s %w", keyStr, ErrNotFound))
+			continue
+		}
+		updateFields, err := t.transformWrite(updateFields)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("record with key %s: %w", keyStr, err))
+			continue
+		}
+		if err := t.checkKeyUnchanged(keyStr, existingRecord, updateFields); err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		if err := t.schema.checkStrings(updateFields); err != nil {
+			errors = append(errors, fmt.Errorf("record with key %s: %w", keyStr, err))
 			continue
 		}
 
+		t.unindexRecord(keyStr, existingRecord)
+		updatedRecord := CloneRecord(existingRecord)
 		for field, newValue := range updateFields {
-			oldVal := existingRecord.Fields[field]
-			if oldVal != nil {
-				newIdxMap := make([]*dbdata.Record, 0)
-				for _, r := range t.Indexes[field] {
-					if r.Fields[field] != oldVal {
-						newIdxMap = append(newIdxMap, r)
-					}
-				}
-				t.Indexes[field] = newIdxMap
+			if field == t.PrimaryKey {
+				continue
 			}
-			newVal, err := structpb.NewValue(newValue)
+			newVal, err := toStoredValue(newValue)
 			if err != nil {
 				errors = append(errors, fmt.Errorf("error converting newValue for field %s in record with key %s: %v", field, keyStr, err))
 				continue
 			}
-			existingRecord.Fields[field] = newVal
-			t.Indexes[field] = append(t.Indexes[field], existingRecord)
+			updatedRecord.Fields[field] = newVal
 		}
+		if err := t.checkUnique(keyStr, updatedRecord); err != nil {
+			t.indexRecord(keyStr, existingRecord)
+			errors = append(errors, err)
+			continue
+		}
+		allRecords.Records[keyStr] = updatedRecord
+		t.indexRecord(keyStr, updatedRecord)
 
-		t.Cache[keyStr] = existingRecord
-		t.metrics.IncrementUpdateCount()
+		updatedKeys = append(updatedKeys, keyStr)
+		oldRecords = append(oldRecords, existingRecord)
+		t.recordChange(OpUpdate, keyStr, existingRecord, updatedRecord)
 	}
 
+	// The records are unchanged if the updates are rejected by a trigger or not written, so the indexes get back their entries
+	restoreIndexes := func() {
+		for i, keyStr := range updatedKeys {
+			t.unindexRecord(keyStr, allRecords.Records[keyStr])
+			t.indexRecord(keyStr, oldRecords[i])
+		}
+	}
+	if err := t.fireChanges(); err != nil {
+		restoreIndexes()
+		return append(errors, err)
+	}
 	if writeErr := t.writeRecordsToFile(allRecords); writeErr != nil {
+		restoreIndexes()
 		return append(errors, fmt.Errorf("failed to write records to file: %w", writeErr))
 	}
 
+	for _, keyStr := range updatedKeys {
+		t.Cache[keyStr] = allRecords.Records[keyStr]
+		t.metrics.IncrementUpdateCount()
+	}
+	t.recordAudit(AuditUpdate, updatedKeys...)
 	return errors
 }
 
+// Replace is a method of the Table struct that overwrites a record in the table based on the given key.
+// Unlike Update, which merges the given fields into the existing record and leaves the unspecified fields untouched,
+// Replace discards every field of the existing record and stores only the fields of the given record.
+// The primary key of the existing record is always kept, so the record is still stored under the same key:
+// the key fields missing from the new record are kept, and the key fields it holds must hold the same key,
+// or it returns an error wrapping ErrPrimaryKeyChange. For a primary key nested in an object, the object holding it
+// is kept if the new record doesn't have it.
+// Like Update, it locks the record with WithRecordLocks, then the table, and fires the update triggers of the table
+// before the replacement is published; if one of them fails, the record is left unchanged and its error returned.
+// It removes the existing record from the indexes of all its fields, so fields dropped by the replacement
+// do not leave stale index entries behind, and adds the new record to the indexes of its fields.
+// It then writes the updated records back to the file.
+// If any error occurs during these operations, it returns the error.
+//
+// Parameters:
+// - key: An interface{} representing the key of the record to be replaced. It is matched like the primary key of an inserted record, so the integer 1 and the string "1" are distinct keys.
+// - record: A map representing the new contents of the record. The keys are field names and the values are the field values.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If no record has the key, it returns an error wrapping ErrNotFound.
+// - If an error occurs, it returns the error.
+func (t *Table) Replace(key interface{}, record Record) error {
+	unlockRecord, _ := t.lockRecord(context.Background(), key)
+	t.Lock()
+	return t.withRecordTriggers(context.Background(), unlockRecord, func() error {
+		return t.replaceLocked(key, record)
+	})
+}
+
+// replaceLocked replaces the record like Replace. The table must be locked for writing.
+func (t *Table) replaceLocked(key interface{}, record Record) error {
+	record, err := t.transformWrite(record)
+	if err != nil {
+		return err
+	}
+	if err := t.schema.checkStrings(record); err != nil {
+		return err
+	}
+	allRecords, err := t.loadForWrite()
+	if err != nil {
+		return err
+	}
+	keyStr := t.resolveKey(allRecords.Records, key)
+	existingRecord, exists := allRecords.Records[keyStr]
+	if !exists {
+		return fmt.Errorf("record with key %s %w", keyStr, ErrNotFound)
+	}
+	if err := t.checkKeyUnchanged(keyStr, existingRecord, record); err != nil {
+		return err
+	}
+
+	protoRecord, err := toProtoRecord(record)
+	if err != nil {
+		return err
+	}
+	// The primary key can't be changed by a replacement, so the key fields keep their stored values
+	for _, field := range append([]string{t.keyRoot()}, t.keyFields...) {
+		if _, ok := record[field]; !ok {
+			if value, ok := existingRecord.Fields[field]; ok {
+				protoRecord.Fields[field] = value
+			}
+		}
+	}
+	if t.keyRoot() == t.PrimaryKey {
+		protoRecord.Fields[t.PrimaryKey] = existingRecord.Fields[t.PrimaryKey]
+	}
+
+	t.unindexRecord(keyStr, existingRecord)
+	if err := t.checkUnique(keyStr, protoRecord); err != nil {
+		t.indexRecord(keyStr, existingRecord)
+		return err
+	}
+	t.indexRecord(keyStr, protoRecord)
+
+	allRecords.Records[keyStr] = protoRecord
+	t.recordChange(OpUpdate, keyStr, existingRecord, protoRecord)
+	if err := t.writeChanges(allRecords); err != nil {
+		// The record is unchanged, so the indexes get back its entries
+		t.unindexRecord(keyStr, protoRecord)
+		t.indexRecord(keyStr, existingRecord)
+		return err
+	}
+	t.Cache[keyStr] = protoRecord
+	t.metrics.IncrementUpdateCount()
+	t.recordAudit(AuditReplace, keyStr)
+	return nil
+}
+
 //DELETE
 
 // Delete is a method of the Table struct that deletes a record from the table based on the given key.
@@ -564,45 +1098,45 @@ func (t *Table) UpdateMany(updates map[string]Record) []error {
 // If any error occurs during these operations, it returns the error.
 //
 // Parameters:
-// - key: An interface{} representing the key of the record to be deleted. The key is converted to a string before the deletion is performed.
+// - key: An interface{} representing the key of the record to be deleted. It is matched like the primary key of an inserted record, so the integer 1 and the string "1" are distinct keys.
 //
 // Returns:
 // - If the operation is successful, it returns nil.
 // - If an error occurs, it returns the error.
 func (t *Table) Delete(key interface{}) error {
+	unlockRecord, _ := t.lockRecord(context.Background(), key)
 	t.Lock()
-	defer t.Unlock()
-
-	keyStr := fmt.Sprintf("%v", key)
+	return t.withRecordTriggers(context.Background(), unlockRecord, func() error {
+		return t.deleteLocked(key)
+	})
+}
 
-	allRecords, err := t.readRecordsFromFile()
+// deleteLocked deletes the record like Delete. The table must be locked for writing.
+func (t *Table) deleteLocked(key interface{}) error {
+	allRecords, err := t.loadForWrite()
 	if err != nil {
 		return err
 	}
 
+	keyStr := t.resolveKey(allRecords.Records, key)
 	record, exists := allRecords.Records[keyStr]
 	if !exists {
-		return fmt.Errorf("record with key %s not found", keyStr)
+		return fmt.Errorf("record with key %s %w", keyStr, ErrNotFound)
 	}
 
 	delete(allRecords.Records, keyStr)
-	delete(t.Cache, keyStr)
+	t.unindexRecord(keyStr, record)
 
-	for field := range record.Fields {
-		idxSlice := t.Indexes[field]
-		for i, rec := range idxSlice {
-			if recKeyValue, ok := rec.Fields[t.PrimaryKey]; ok && recKeyValue.GetStringValue() == keyStr {
-				t.Indexes[field] = append(idxSlice[:i], idxSlice[i+1:]...)
-				break
-			}
-		}
-		if len(t.Indexes[field]) == 0 {
-			delete(t.Indexes, field)
-		}
+	t.recordChange(OpDelete, keyStr, record, nil)
+	if err := t.writeChanges(allRecords); err != nil {
+		// The record is still there, so the indexes get back its entries
+		t.indexRecord(keyStr, record)
+		return err
 	}
-
+	delete(t.Cache, keyStr)
 	t.metrics.IncrementDeleteCount()
-	return t.writeRecordsToFile(allRecords)
+	t.recordAudit(AuditDelete, keyStr)
+	return nil
 }
 
 // DeleteMany is a method of the Table struct that deletes multiple records from the table based on the given keys.
@@ -621,80 +1155,198 @@ func (t *Table) Delete(key interface{}) error {
 // Returns:
 // - A slice of errors for keys that failed to delete. If all records are deleted successfully, the slice is empty.
 func (t *Table) DeleteMany(keys []interface{}) []error {
+	var errors []error
 	t.Lock()
-	defer t.Unlock()
+	err := t.withTriggers(context.Background(), func() error {
+		errors = t.deleteManyLocked(keys)
+		return nil
+	})
+	if err != nil {
+		// The file write shared with the writes holding record locks failed
+		return append(errors, err)
+	}
+	return errors
+}
 
-	allRecords, err := t.readRecordsFromFile()
+// deleteManyLocked deletes the records like DeleteMany. The table must be locked for writing.
+func (t *Table) deleteManyLocked(keys []interface{}) []error {
+	allRecords, err := t.loadForWrite()
 	if err != nil {
 		return []error{fmt.Errorf("failed to read records from file: %w", err)}
 	}
 
 	var errors []error
+	var deletedKeys []string
+	var deletedRecords []*dbdata.Record
 
 	for _, key := range keys {
-		keyProtoValue, err := toProtoValue(key)
-		if err != nil {
-			errors = append(errors, err)
-			continue
-		}
-		keyStr := keyProtoValue.GetStringValue()
-
+		keyStr := t.resolveKey(allRecords.Records, key)
 		record, exists := allRecords.Records[keyStr]
 		if !exists {
-			errors = append(errors, fmt.Errorf("record with key %s not found", keyStr))
+			errors = append(errors, fmt.Errorf("record with key %s %w", keyStr, ErrNotFound))
 			continue
 		}
 
 		delete(allRecords.Records, keyStr)
-		delete(t.Cache, keyStr)
+		t.unindexRecord(keyStr, record)
 
-		for field := range record.Fields {
-			idxSlice := t.Indexes[field]
-			for i, rec := range idxSlice {
-				if recKeyValue, ok := rec.Fields[t.PrimaryKey]; ok && recKeyValue.GetStringValue() == keyStr {
-					t.Indexes[field] = append(idxSlice[:i], idxSlice[i+1:]...)
-					break
-				}
-			}
-			if len(t.Indexes[field]) == 0 {
-				delete(t.Indexes, field)
-			}
-		}
-
-		t.metrics.IncrementDeleteCount()
+		deletedKeys = append(deletedKeys, keyStr)
+		deletedRecords = append(deletedRecords, record)
+		t.recordChange(OpDelete, keyStr, record, nil)
 	}
 
+	// The records are still there if the deletions are rejected by a trigger or not written, so the indexes get back their entries
+	restoreIndexes := func() {
+		for i, keyStr := range deletedKeys {
+			t.indexRecord(keyStr, deletedRecords[i])
+		}
+	}
+	if err := t.fireChanges(); err != nil {
+		restoreIndexes()
+		return append(errors, err)
+	}
 	if writeErr := t.writeRecordsToFile(allRecords); writeErr != nil {
-		errors = append(errors, fmt.Errorf("failed to write records to file: %w", writeErr))
+		restoreIndexes()
+		return append(errors, fmt.Errorf("failed to write records to file: %w", writeErr))
 	}
 
+	for _, keyStr := range deletedKeys {
+		delete(t.Cache, keyStr)
+		t.metrics.IncrementDeleteCount()
+	}
+	t.recordAudit(AuditDelete, deletedKeys...)
 	return errors
 }
 
+// DeleteKeys is a method of the Table struct that deletes the records with the given string keys in a single write,
+// and returns how many of them existed and were deleted. Unlike DeleteMany, keys without a record are not an error:
+// the caller can compare the count with the number of keys to detect them.
+// The indexes and unique constraints are updated for every deleted record, and the triggers fire like for Delete.
+// Either all the records are deleted or none: if a trigger fails, no record is deleted,
+// including the records whose triggers already ran. The file is not written if none of the keys has a record.
+//
+// Parameters:
+// - keys: The keys of the records to delete, matched like the primary key of an inserted string record. Repeated keys are deleted once.
+//
+// Returns:
+// - The number of records deleted.
+// - An error, if an error occurs while reading or writing the records or a trigger fails, in which case no record is deleted and the count is 0.
+func (t *Table) DeleteKeys(keys []string) (int, error) {
+	deleted := 0
+	t.Lock()
+	err := t.withTriggers(context.Background(), func() error {
+		allRecords, err := t.loadForWrite()
+		if err != nil {
+			return err
+		}
+
+		var deletedKeys []string
+		var deletedRecords []*dbdata.Record
+		for _, key := range keys {
+			keyStr := t.resolveKey(allRecords.Records, key)
+			record, exists := allRecords.Records[keyStr]
+			if !exists {
+				continue
+			}
+			delete(allRecords.Records, keyStr)
+			t.unindexRecord(keyStr, record)
+			deletedKeys = append(deletedKeys, keyStr)
+			deletedRecords = append(deletedRecords, record)
+			t.recordChange(OpDelete, keyStr, record, nil)
+		}
+		if len(deletedKeys) == 0 {
+			return nil
+		}
+
+		if err := t.writeChanges(allRecords); err != nil {
+			// The records are still there, so the indexes get back their entries
+			for i, keyStr := range deletedKeys {
+				t.indexRecord(keyStr, deletedRecords[i])
+			}
+			return err
+		}
+		for _, keyStr := range deletedKeys {
+			delete(t.Cache, keyStr)
+			t.metrics.IncrementDeleteCount()
+		}
+		t.recordAudit(AuditDelete, deletedKeys...)
+		deleted = len(deletedKeys)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
 //READER AND WRITER
 
 // readRecordsFromFile reads the records from the file
 func (t *Table) readRecordsFromFile() (*dbdata.Records, error) {
-	encryptedData, err := os.ReadFile(t.FilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return &dbdata.Records{Records: make(map[string]*dbdata.Record)}, nil
+	if t.perRecord {
+		records, err := t.readRecordFiles()
+		if err != nil {
+			return nil, err
+		}
+		if t.canonicalizeKeys(records) > 0 {
+			// The files are named after the keys, so they are all written again under the new keys
+			t.legacyKeys.Store(true)
 		}
+		return records, nil
+	}
+	encryptedData, err := t.readData()
+	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %v", err)
 	}
+	records, err := t.decodeRecords(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+	t.loadStamp(encryptedData)
+	// The keys of the file are fixed before the append log is replayed, since the log is written with the new keys
+	t.canonicalizeKeys(records)
+	if err := t.replayAppendLog(records, encryptedData); err != nil {
+		return nil, err
+	}
+	t.canonicalizeKeys(records)
+	return records, nil
+}
 
+// decodeRecords decrypts and decodes the content of a data file, header included.
+// An empty table has two representations: a zero-length file, as created by CreateTable, and an encrypted empty set
+// of records, as written after deleting the last record. Both decode to the same empty, non-nil map of records.
+func (t *Table) decodeRecords(encryptedData []byte) (*dbdata.Records, error) {
 	if len(encryptedData) == 0 {
 		return &dbdata.Records{Records: make(map[string]*dbdata.Record)}, nil
 	}
 
-	decryptedData, err := t.utils.Decrypt(string(encryptedData))
+	legacy := !bytes.HasPrefix(encryptedData, []byte(fileHeaderPrefix))
+	codec, compressed, encryptedData, err := decodeFileHeader(encryptedData)
 	if err != nil {
-		return nil, fmt.Errorf("decryption failed: %v", err)
+		return nil, fmt.Errorf("failed to read file header: %v", err)
+	}
+
+	decryptedData := encryptedData
+	if !t.isMemory() {
+		if decryptedData, err = t.utils.Decrypt(string(encryptedData)); err != nil {
+			return nil, fmt.Errorf("decryption failed: %v", err)
+		}
+	}
+	if compressed {
+		if decryptedData, err = decompressRecords(decryptedData); err != nil {
+			return nil, err
+		}
 	}
 
 	var records dbdata.Records
-	if err := proto.Unmarshal(decryptedData, &records); err != nil {
-		return nil, fmt.Errorf("proto unmarshal failed: %v", err)
+	if err := codec.Unmarshal(decryptedData, &records); err != nil {
+		return nil, fmt.Errorf("%s unmarshal failed: %v", codec.Name(), err)
+	}
+	if legacy {
+		escapeLegacyValues(&records)
+	}
+	if err := t.decryptFields(&records); err != nil {
+		return nil, err
 	}
 
 	if records.Records == nil {
@@ -704,66 +1356,284 @@ func (t *Table) readRecordsFromFile() (*dbdata.Records, error) {
 	return &records, nil
 }
 
-// writeRecordsToFile writes the records to the file
+// writeRecordsToFile writes the records to the file and publishes them as the current records of the table.
+// With a write debounce window, the records are published right away but the file is written later by flush.
 func (t *Table) writeRecordsToFile(records *dbdata.Records) error {
-	data, err := proto.Marshal(records)
+	if t.debounce > 0 {
+		t.Records = records.Records
+		t.publishSnapshot(records)
+		t.scheduleFlush()
+		return nil
+	}
+	if t.groupCommit() {
+		// withTriggers waits for a file write holding the change once the table is unlocked
+		t.Records = records.Records
+		t.publishSnapshot(records)
+		t.pendingSeq = t.commitSeq.Add(1)
+		return nil
+	}
+
+	if err := t.writeFile(records); err != nil {
+		return err
+	}
+
+	t.Records = records.Records
+	t.publishSnapshot(records)
+
+	return nil
+}
+
+// writeFile encodes, encrypts and writes the records to the file, applying the fsync policy of the table.
+// The records must hold every change published in memory, which is the case of the records of a write holding the table lock.
+func (t *Table) writeFile(records *dbdata.Records) error {
+	t.commitMu.Lock()
+	defer t.commitMu.Unlock()
+	latest := t.commitSeq.Load()
+	if err := t.storeRecords(records); err != nil {
+		return err
+	}
+	t.committed = latest
+	return nil
+}
+
+// storeRecords writes the records like writeFile. The caller must hold commitMu.
+func (t *Table) storeRecords(records *dbdata.Records) error {
+	if t.perRecord {
+		// Only the changed records are written, so the total sizes are computed again by Stats
+		t.sizesKnown.Store(false)
+		legacy := t.legacyKeys.Load()
+		if legacy {
+			t.resetRecordFiles(false)
+		}
+		if err := t.writeRecordFiles(records); err != nil {
+			return err
+		}
+		if legacy {
+			t.legacyKeys.Store(false)
+		}
+		return nil
+	}
+	data, err := t.encodeRecords(records)
 	if err != nil {
-		return fmt.Errorf("error marshaling records: %v", err)
+		return err
+	}
+	var stamp FileStamp
+	if t.headerStamps {
+		data, stamp = t.stampData(data)
+	}
+	if t.isMemory() {
+		t.writeMemoryData(data)
+	} else if err := t.writeDataFile(t.FilePath, data); err != nil {
+		t.sizesKnown.Store(false)
+		return err
+	} else {
+		t.resetAppendLog(data)
+	}
+	if t.headerStamps {
+		t.stamp.Store(&stamp)
+	}
+	t.cacheSizes(int64(len(data)), int64(proto.Size(records)))
+	return nil
+}
+
+// encodeRecords encodes, compresses if needed, and encrypts the records as the content of a data file, header included.
+func (t *Table) encodeRecords(records *dbdata.Records) ([]byte, error) {
+	records, err := t.encryptFields(records)
+	if err != nil {
+		return nil, err
+	}
+	data, err := t.codec.Marshal(records)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling records: %v", err)
+	}
+	data, compressed, err := t.compressRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	if t.isMemory() {
+		return append(encodeFileHeader(t.codec, compressed), data...), nil
 	}
 	encryptedData, err := t.utils.Encrypt(data)
 	if err != nil {
-		return fmt.Errorf("error encrypting data: %v", err)
+		return nil, fmt.Errorf("error encrypting data: %v", err)
 	}
+	return append(encodeFileHeader(t.codec, compressed), encryptedData...), nil
+}
+
+// writeDataFile replaces the content of the file at the given path, applying the fsync policy of the table.
+// The data is written to a temporary file next to it, which is then renamed over the file,
+// so a failed or interrupted write leaves the previous content intact instead of a truncated file.
+// A write failing with a transient error is retried as configured by WithIORetry.
+func (t *Table) writeDataFile(filePath string, data []byte) error {
+	return t.retryIO(func() error {
+		return t.writeDataFileOnce(filePath, data)
+	})
+}
 
-	// Use batch writing with buffer
-	file, err := os.OpenFile(t.FilePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+// writeDataFileOnce makes a single attempt of writeDataFile.
+func (t *Table) writeDataFileOnce(filePath string, data []byte) error {
+	tempPath := filePath + tempFileSuffix
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if t.syncWrites {
+		flags |= os.O_SYNC
+	}
+	file, err := t.fs().OpenFile(tempPath, flags, 0644)
 	if err != nil {
-		return fmt.Errorf("error opening file '%s': %v", t.FilePath, err)
+		return fmt.Errorf("error opening file '%s': %w", tempPath, err)
 	}
-	defer file.Close()
+	renamed := false
+	defer func() {
+		if !renamed {
+			file.Close()
+			t.fs().Remove(tempPath)
+		}
+	}()
 
-	writer := bufio.NewWriter(file)
-	_, err = writer.Write([]byte(encryptedData))
-	if err != nil {
-		return fmt.Errorf("error writing to file '%s': %v", t.FilePath, err)
+	if err := t.writeBuffered(file, data); err != nil {
+		return fmt.Errorf("error writing to file '%s': %w", filePath, err)
 	}
-	if err := writer.Flush(); err != nil {
-		return fmt.Errorf("error flushing writer: %v", err)
+	if t.fsyncPolicy.mode == fsyncAlways {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("error syncing file '%s': %w", filePath, err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing file '%s': %w", tempPath, err)
+	}
+	if err := t.fs().Rename(tempPath, filePath); err != nil {
+		return fmt.Errorf("error replacing file '%s': %w", filePath, err)
 	}
+	renamed = true
 
-	t.Records = records.Records
+	if t.fsyncPolicy.mode == fsyncAlways {
+		// The rename is only durable once the directory entry is synced too
+		if err := syncDir(t.fs(), filepath.Dir(filePath)); err != nil {
+			return fmt.Errorf("error syncing directory of file '%s': %w", filePath, err)
+		}
+	}
+	if t.fsyncPolicy.mode == fsyncInterval {
+		t.dirty.Store(true)
+	}
+	return nil
+}
+
+// tempFileSuffix is appended to the path of a file to get the temporary file it is written to before being renamed.
+const tempFileSuffix = ".tmp"
 
+// writeBuffered writes the data to the writer through a buffer of the write buffer size of the table,
+// one buffer at a time so the writer receives chunks of its size.
+// It returns an error wrapping io.ErrShortWrite if the writer accepts fewer bytes than it was given.
+func (t *Table) writeBuffered(w io.Writer, data []byte) error {
+	writer := bufio.NewWriter(w)
+	if t.writeBufferSize > 0 {
+		writer = bufio.NewWriterSize(w, t.writeBufferSize)
+	}
+	written := 0
+	for written < len(data) {
+		chunk := data[written:min(len(data), written+writer.Size())]
+		n, err := writer.Write(chunk)
+		written += n
+		if err != nil {
+			return fmt.Errorf("wrote %d of %d bytes: %w", written, len(data), err)
+		}
+		if n != len(chunk) {
+			return fmt.Errorf("wrote %d of %d bytes: %w", written, len(data), io.ErrShortWrite)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("error flushing writer: %w", err)
+	}
 	return nil
 }
 
 //Utils
 
-// Equal checks if two structpb.Value are equal
+// Equal checks if two structpb.Value are equal.
+// Values of different kinds are never equal, so the number 1, the string "1" and the boolean true are all distinct,
+// and integers, which are stored as "num:" strings, are only equal to the same integer.
+// Nulls are equal to nulls, numbers are compared by value (NaN is not equal to itself), and lists and structs
+// are equal if they have the same length or fields and their elements or fields are equal.
+// A nil value or a value without a kind is not equal to anything.
 func Equal(value1, value2 *structpb.Value) bool {
 	if value1.GetKind() == nil || value2.GetKind() == nil {
 		return false
 	}
 
-	switch value1.GetKind().(type) {
+	switch v1 := value1.GetKind().(type) {
+	case *structpb.Value_NullValue:
+		_, ok := value2.GetKind().(*structpb.Value_NullValue)
+		return ok
 	case *structpb.Value_NumberValue:
-		return value1.GetNumberValue() == value2.GetNumberValue()
+		v2, ok := value2.GetKind().(*structpb.Value_NumberValue)
+		return ok && v1.NumberValue == v2.NumberValue
 	case *structpb.Value_StringValue:
-		return value1.GetStringValue() == value2.GetStringValue()
+		v2, ok := value2.GetKind().(*structpb.Value_StringValue)
+		return ok && v1.StringValue == v2.StringValue
 	case *structpb.Value_BoolValue:
-		return value1.GetBoolValue() == value2.GetBoolValue()
+		v2, ok := value2.GetKind().(*structpb.Value_BoolValue)
+		return ok && v1.BoolValue == v2.BoolValue
 	case *structpb.Value_StructValue:
-		return false
+		v2, ok := value2.GetKind().(*structpb.Value_StructValue)
+		if !ok || len(v1.StructValue.GetFields()) != len(v2.StructValue.GetFields()) {
+			return false
+		}
+		for field, fieldValue1 := range v1.StructValue.GetFields() {
+			fieldValue2, exists := v2.StructValue.GetFields()[field]
+			if !exists || !Equal(fieldValue1, fieldValue2) {
+				return false
+			}
+		}
+		return true
 	case *structpb.Value_ListValue:
-
-		return false
+		v2, ok := value2.GetKind().(*structpb.Value_ListValue)
+		if !ok || len(v1.ListValue.GetValues()) != len(v2.ListValue.GetValues()) {
+			return false
+		}
+		for i, element1 := range v1.ListValue.GetValues() {
+			if !Equal(element1, v2.ListValue.GetValues()[i]) {
+				return false
+			}
+		}
+		return true
 	default:
 		return false
 	}
 }
 
+// toProtoRecord converts a map record to a protobuf record.
+// String values that can be parsed as integers are prefixed with "str:" so they are not confused with
+// integer values, which are stored with the "num:" prefix by toProtoValue.
+// It returns the converted protobuf record and an error if the conversion of any value fails.
+func toProtoRecord(record Record) (*dbdata.Record, error) {
+	protoRecord := &dbdata.Record{Fields: make(map[string]*structpb.Value)}
+	for key, value := range record {
+		protoValue, err := toStoredValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type for field '%s': %v", key, err)
+		}
+		protoRecord.Fields[key] = protoValue
+	}
+	return protoRecord, nil
+}
+
+// toStoredValue converts a field value to the protobuf value stored in a record.
+// String values that can be parsed as integers or that start with the "b64:" prefix of blobs or the "num:" and "str:"
+// prefixes of stored values are prefixed with "str:", so they are read back as strings, and the rest is converted by toProtoValue.
+func toStoredValue(value interface{}) (*structpb.Value, error) {
+	if strValue, ok := value.(string); ok {
+		if _, err := strconv.ParseInt(strValue, 10, 64); err == nil || strings.HasPrefix(strValue, blobPrefix) ||
+			strings.HasPrefix(strValue, "num:") || strings.HasPrefix(strValue, "str:") || strings.HasPrefix(strValue, encryptedPrefix) {
+			value = "str:" + strValue
+		}
+	}
+	return toProtoValue(value)
+}
+
 // toProtoValue converts a given value to a protobuf value.
 // It supports conversion for int, int32, int64, float32, float64 and other types that can be directly converted to a protobuf value.
 // For int, int32 and int64, it converts the value to a string and then to a protobuf string value.
+// For []byte, it converts the value to a base64 string with the "b64:" prefix, see SelectBlob.
+// For []string, it converts the value to a protobuf list of strings, see SelectContains.
 // For float32 and float64, it converts the value to a protobuf number value.
 // For other types, it directly converts the value to a protobuf value.
 // It returns the converted protobuf value and an error if the conversion fails.
@@ -775,14 +1645,46 @@ func toProtoValue(value interface{}) (*structpb.Value, error) {
 		return structpb.NewStringValue("num:" + strconv.FormatInt(int64(v), 10)), nil
 	case int64:
 		return structpb.NewStringValue("num:" + strconv.FormatInt(v, 10)), nil
+	case int8:
+		return structpb.NewStringValue("num:" + strconv.FormatInt(int64(v), 10)), nil
+	case int16:
+		return structpb.NewStringValue("num:" + strconv.FormatInt(int64(v), 10)), nil
+	case uint8:
+		return structpb.NewStringValue("num:" + strconv.FormatUint(uint64(v), 10)), nil
+	case uint16:
+		return structpb.NewStringValue("num:" + strconv.FormatUint(uint64(v), 10)), nil
+	case uint32:
+		return structpb.NewStringValue("num:" + strconv.FormatUint(uint64(v), 10)), nil
+	case uint:
+		return toProtoValue(uint64(v))
+	case uint64:
+		// Integers are read back as int64, so larger values can't be stored exactly
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("integer value %d overflows int64", v)
+		}
+		return structpb.NewStringValue("num:" + strconv.FormatUint(v, 10)), nil
+	case json.Number:
+		// Numbers decoded with json.Decoder.UseNumber keep their exact value if they are integers
+		if intValue, err := v.Int64(); err == nil {
+			return structpb.NewStringValue("num:" + strconv.FormatInt(intValue, 10)), nil
+		}
+		floatValue, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q: %v", v, err)
+		}
+		return structpb.NewNumberValue(floatValue), nil
 	case float32:
 		return structpb.NewNumberValue(float64(v)), nil
 	case float64:
 		return structpb.NewNumberValue(v), nil
 	case string:
 		return structpb.NewStringValue(v), nil
+	case []byte:
+		return structpb.NewStringValue(encodeBlob(v)), nil
 	case bool:
 		return structpb.NewBoolValue(v), nil
+	case []string:
+		return stringListValue(v), nil
 	default:
 		return structpb.NewValue(value)
 	}
@@ -808,6 +1710,7 @@ func fromProtoRecord(protoRecord *dbdata.Record) (Record, error) {
 // It supports conversion for protobuf string value and protobuf number value.
 // For protobuf string value, it attempts to parse the string as an int and returns the int value if the parsing is successful.
 // If the parsing fails, it returns the string value.
+// Strings with the "b64:" prefix are blobs, which are decoded into a []byte.
 // For protobuf number value, it returns the number value.
 // For other types, it directly returns the value as interface{}.
 // It returns the converted Go value and an error if the conversion fails.
@@ -825,6 +1728,9 @@ func fromProtoValue(protoValue *structpb.Value) (interface{}, error) {
 		if len(v.StringValue) > 4 && v.StringValue[:4] == "str:" {
 			return v.StringValue[4:], nil
 		}
+		if strings.HasPrefix(v.StringValue, blobPrefix) {
+			return decodeBlob(v.StringValue)
+		}
 		return v.StringValue, nil
 	case *structpb.Value_NumberValue:
 		return v.NumberValue, nil
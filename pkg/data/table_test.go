@@ -0,0 +1,373 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"github.com/Malpizarr/dbproto/pkg/utils"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestTableReader(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "a", "name": "Ana", "city": "Lima"},
+		Record{"id": "b", "name": "Bo", "city": "Cusco"},
+	)
+	var reader TableReader = table
+
+	record, err := reader.Select("a")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["id"] != "a" || record["name"] != "Ana" {
+		t.Errorf("Select = %v, want the record of Ana", record)
+	}
+	if record, err := reader.Select("missing"); !errors.Is(err, ErrNotFound) || record != nil {
+		t.Errorf("Select of a missing key = %v, %v, want nil and ErrNotFound", record, err)
+	}
+
+	records, err := reader.SelectMany([]string{"b", "missing", "a"})
+	if err != nil {
+		t.Fatalf("SelectMany failed: %v", err)
+	}
+	if len(records) != 3 || records[0]["name"] != "Bo" || records[1] != nil || records[2]["name"] != "Ana" {
+		t.Errorf("SelectMany = %v, want Bo, nil and Ana", records)
+	}
+
+	all, err := reader.SelectAll()
+	if err != nil {
+		t.Fatalf("SelectAll failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("SelectAll returned %d records, want 2", len(all))
+	}
+
+	filtered, err := reader.SelectWithFilter(map[string]interface{}{"city": "Cusco"})
+	if err != nil {
+		t.Fatalf("SelectWithFilter failed: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0]["id"] != "b" {
+		t.Errorf("SelectWithFilter = %v, want record b", filtered)
+	}
+}
+
+func TestSelectReturnsACopy(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "name": "Ana"})
+
+	record, err := table.Select("a")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	record["name"] = "changed"
+
+	record, err = table.Select("a")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["name"] != "Ana" {
+		t.Errorf("name = %v after the returned record was modified, want Ana", record["name"])
+	}
+}
+
+func TestEmptyTableRoundTrip(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "table.bin")
+	if err := os.WriteFile(filePath, nil, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// A zero-length file, as created by CreateTable, is an empty table
+	table := openTestTable(t, "id", filePath)
+	if err := table.LoadIndexes(); err != nil {
+		t.Fatalf("LoadIndexes of a zero-length file failed: %v", err)
+	}
+	if count, err := table.Count(); err != nil || count != 0 {
+		t.Errorf("Count of a zero-length file = %d, %v, want 0", count, err)
+	}
+
+	// So is a file written after deleting the last record
+	mustInsert(t, table, Record{"id": "a"}, Record{"id": "b"})
+	for _, key := range []string{"a", "b"} {
+		if err := table.Delete(key); err != nil {
+			t.Fatalf("Delete(%s) failed: %v", key, err)
+		}
+	}
+	if err := table.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened := openTestTable(t, "id", filePath)
+	if err := reopened.LoadIndexes(); err != nil {
+		t.Fatalf("LoadIndexes after deleting every record failed: %v", err)
+	}
+	if count, err := reopened.Count(); err != nil || count != 0 {
+		t.Errorf("Count after deleting every record = %d, %v, want 0", count, err)
+	}
+	all, err := reopened.SelectAll()
+	if err != nil || all == nil || len(all) != 0 {
+		t.Errorf("SelectAll = %#v, %v, want an empty, non-nil slice", all, err)
+	}
+	mustInsert(t, reopened, Record{"id": "c"})
+	if count, err := reopened.Count(); err != nil || count != 1 {
+		t.Errorf("Count after inserting into the emptied table = %d, %v, want 1", count, err)
+	}
+}
+
+func TestNullAbsentAndEmptyFields(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "table.bin")
+	table := openTestTable(t, "id", filePath)
+	mustInsert(t, table,
+		Record{"id": "null", "note": nil},
+		Record{"id": "absent"},
+		Record{"id": "empty", "note": ""},
+	)
+
+	check := func(table *Table, stage string) {
+		t.Helper()
+		for key, want := range map[string]struct {
+			value  interface{}
+			exists bool
+		}{"null": {nil, true}, "absent": {nil, false}, "empty": {"", true}} {
+			record, err := table.Select(key)
+			if err != nil {
+				t.Fatalf("%s: Select(%s) failed: %v", stage, key, err)
+			}
+			value, exists := record["note"]
+			if value != want.value || exists != want.exists {
+				t.Errorf("%s: note of %s = %#v, present %v, want %#v, present %v", stage, key, value, exists, want.value, want.exists)
+			}
+		}
+	}
+	check(table, "after insert")
+
+	results, err := table.Query(Query{Filters: map[string]interface{}{"note": nil}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 1 || results[0]["id"] != "null" {
+		t.Errorf("Query for null notes = %v, want only the null field", results)
+	}
+
+	record, err := table.Select("null")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	encoded, err := json.Marshal(record)
+	if err != nil || string(encoded) != `{"id":"null","note":null}` {
+		t.Errorf("JSON of the null field = %s, %v", encoded, err)
+	}
+
+	// The nulls survive reopening the table
+	if err := table.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	table = openTestTable(t, "id", filePath)
+	check(table, "after reopening")
+
+	// Update sets a field to null, Replace removes it
+	if err := table.Update("empty", Record{"note": nil}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := table.Replace("null", Record{"id": "null"}); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	all, err := table.SelectAll()
+	if err != nil {
+		t.Fatalf("SelectAll failed: %v", err)
+	}
+	for _, record := range all {
+		_, exists := record["note"]
+		if wantExists := record["id"] == "empty"; exists != wantExists || record["note"] != nil {
+			t.Errorf("after Update and Replace, record %v has note present %v, want %v", record, exists, wantExists)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	list := func(values ...*structpb.Value) *structpb.Value {
+		return structpb.NewListValue(&structpb.ListValue{Values: values})
+	}
+	object := func(fields map[string]*structpb.Value) *structpb.Value {
+		return structpb.NewStructValue(&structpb.Struct{Fields: fields})
+	}
+	// One value of each kind, then values of the same kinds differing from the first ones
+	values := []*structpb.Value{
+		structpb.NewNullValue(),
+		structpb.NewNumberValue(1),
+		structpb.NewStringValue("1"),
+		structpb.NewBoolValue(true),
+		list(structpb.NewStringValue("a")),
+		object(map[string]*structpb.Value{"a": structpb.NewNumberValue(1)}),
+	}
+	others := []*structpb.Value{
+		nil,
+		structpb.NewNumberValue(2),
+		structpb.NewStringValue("num:1"),
+		structpb.NewBoolValue(false),
+		list(structpb.NewStringValue("a"), structpb.NewStringValue("b")),
+		object(map[string]*structpb.Value{"a": structpb.NewNumberValue(2)}),
+	}
+	for i, value1 := range values {
+		for j, value2 := range values {
+			// Values of different kinds are never equal, values of the same kind are equal to a copy
+			want := i == j
+			if got := Equal(value1, proto.Clone(value2).(*structpb.Value)); got != want {
+				t.Errorf("Equal(%v, %v) = %v, want %v", value1, value2, got, want)
+			}
+		}
+		if other := others[i]; other != nil && (Equal(value1, other) || Equal(other, value1)) {
+			t.Errorf("Equal(%v, %v) = true, want false", value1, other)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		value1, value2 *structpb.Value
+		want           bool
+	}{
+		{"nil values", nil, nil, false},
+		{"value without a kind", &structpb.Value{}, &structpb.Value{}, false},
+		{"NaN", structpb.NewNumberValue(math.NaN()), structpb.NewNumberValue(math.NaN()), false},
+		{"stored integer and number", structpb.NewStringValue("num:1"), structpb.NewNumberValue(1), false},
+		{"stored integers", structpb.NewStringValue("num:1"), structpb.NewStringValue("num:1"), true},
+		{"list order", list(structpb.NewNumberValue(1), structpb.NewNumberValue(2)), list(structpb.NewNumberValue(2), structpb.NewNumberValue(1)), false},
+		{"object with an extra field", object(map[string]*structpb.Value{"a": structpb.NewNullValue()}),
+			object(map[string]*structpb.Value{"a": structpb.NewNullValue(), "b": structpb.NewNullValue()}), false},
+		{"nested values", list(object(map[string]*structpb.Value{"a": list(structpb.NewBoolValue(true))})),
+			list(object(map[string]*structpb.Value{"a": list(structpb.NewBoolValue(true))})), true},
+	}
+	for _, tt := range tests {
+		if got := Equal(tt.value1, tt.value2); got != tt.want {
+			t.Errorf("%s: Equal = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFailedWriteKeepsIndexes(t *testing.T) {
+	writes := []struct {
+		name  string
+		write func(table *Table) error
+	}{
+		{"Insert", func(table *Table) error {
+			return table.Insert(Record{"id": "c", "status": "new", "email": "c@example.com"})
+		}},
+		{"InsertReplace", func(table *Table) error {
+			_, err := table.InsertWithMode(Record{"id": "a", "status": "new", "email": "c@example.com"}, InsertReplace)
+			return err
+		}},
+		{"Update", func(table *Table) error { return table.Update("a", Record{"status": "new", "email": "c@example.com"}) }},
+		{"Replace", func(table *Table) error { return table.Replace("a", Record{"status": "new", "email": "c@example.com"}) }},
+		{"Delete", func(table *Table) error { return table.Delete("a") }},
+		{"UpdateMany", func(table *Table) error {
+			return errors.Join(table.UpdateMany(map[string]Record{"a": {"status": "new", "email": "c@example.com"}})...)
+		}},
+		{"DeleteMany", func(table *Table) error { return errors.Join(table.DeleteMany([]interface{}{"a", "b"})...) }},
+		{"DeleteKeys", func(table *Table) error {
+			_, err := table.DeleteKeys([]string{"a", "b"})
+			return err
+		}},
+	}
+	for _, tt := range writes {
+		storage := &failingStorage{}
+		table := newTestTable(t, "id", WithStorage(storage))
+		if err := table.CreateIndex("status"); err != nil {
+			t.Fatalf("CreateIndex failed: %v", err)
+		}
+		if err := table.AddUniqueConstraint("email", false); err != nil {
+			t.Fatalf("AddUniqueConstraint failed: %v", err)
+		}
+		mustInsert(t, table,
+			Record{"id": "a", "status": "open", "email": "a@example.com"},
+			Record{"id": "b", "status": "open", "email": "b@example.com"},
+		)
+
+		storage.enabled = true
+		if err := tt.write(table); !errors.Is(err, errWriteFailed) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, errWriteFailed)
+			continue
+		}
+		storage.enabled = false
+
+		if open, err := table.SelectByIndex("status", "open"); err != nil || len(open) != 2 {
+			t.Errorf("%s: index holds %d open records after the failed write, %v, want 2", tt.name, len(open), err)
+		}
+		if records, err := table.SelectByIndex("status", "new"); err != nil || len(records) != 0 {
+			t.Errorf("%s: index holds %d new records after the failed write, %v, want 0", tt.name, len(records), err)
+		}
+		// The unique constraint still holds the emails of the stored records, and not the one of the failed write
+		if err := table.Insert(Record{"id": "d", "email": "a@example.com"}); !errors.Is(err, ErrUniqueViolation) {
+			t.Errorf("%s: Insert of a stored email = %v, want %v", tt.name, err, ErrUniqueViolation)
+		}
+		if err := table.Insert(Record{"id": "d", "email": "c@example.com"}); err != nil {
+			t.Errorf("%s: Insert of the email of the failed write failed: %v", tt.name, err)
+		}
+		if record, err := table.Select("a"); err != nil || record["status"] != "open" {
+			t.Errorf("%s: Select(a) = %v, %v, want the stored record", tt.name, record, err)
+		}
+	}
+}
+
+func TestReadBaselineFileKeepsPrefixedStrings(t *testing.T) {
+	// A file written before the file header, blobs and encrypted fields: the encrypted protobuf records only,
+	// with the strings stored as they were given
+	records := &dbdata.Records{Records: map[string]*dbdata.Record{
+		"a": {Fields: map[string]*structpb.Value{
+			"id":     structpb.NewStringValue("a"),
+			"note":   structpb.NewStringValue("b64:abc"),
+			"secret": structpb.NewStringValue("enc:xyz"),
+			"count":  structpb.NewStringValue("num:5"),
+			"code":   structpb.NewStringValue("str:5"),
+		}},
+	}}
+	data, err := proto.Marshal(records)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	u, err := utils.NewUtilsWithKey(testAESKey)
+	if err != nil {
+		t.Fatalf("NewUtilsWithKey failed: %v", err)
+	}
+	encrypted, err := u.Encrypt(data)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	filePath := filepath.Join(t.TempDir(), "table.bin")
+	if err := os.WriteFile(filePath, []byte(encrypted), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	want := Record{"id": "a", "note": "b64:abc", "secret": "enc:xyz", "count": int64(5), "code": "5"}
+	check := func(table *Table) {
+		t.Helper()
+		record, err := table.Select("a")
+		if err != nil {
+			t.Fatalf("Select failed: %v", err)
+		}
+		for field, value := range want {
+			if record[field] != value {
+				t.Errorf("%s = %#v, want %#v", field, record[field], value)
+			}
+		}
+		if _, err := table.SelectBlob("a", "note"); err == nil {
+			t.Error("SelectBlob of a string starting with b64: succeeded, want an error")
+		}
+	}
+	table := openTestTable(t, "id", filePath)
+	check(table)
+
+	// The next write stores the strings escaped, so they are still strings once the file has a header
+	if err := table.Update("a", Record{"other": "x"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := table.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	check(openTestTable(t, "id", filePath))
+}
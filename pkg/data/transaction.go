@@ -4,7 +4,6 @@ import (
 	"sync"
 
 	"github.com/Malpizarr/dbproto/pkg/dbdata"
-	"google.golang.org/protobuf/proto"
 )
 
 // This srtuct holds the transaction data for managing the transaction
@@ -26,15 +25,15 @@ func NewTransaction(table *Table) *Transaction {
 func (t *Transaction) Start() error {
 	t.Lock() // Thi is the lock for the transaction to prevent other transactions from happening
 
-	// Read the records from the file
-	records, err := t.Table.readRecordsFromFile()
+	// Take the current records of the table, which may not be written to the file yet with a write debounce window
+	records, err := t.Table.snapshotRecords()
 	if err != nil {
 		t.Unlock()
 		return err
 	}
 	// This is the loop to clone the records and store them in the original records
 	for key, record := range records.Records {
-		t.OriginalRecords[key] = proto.Clone(record).(*dbdata.Record)
+		t.OriginalRecords[key] = CloneRecord(record)
 	}
 	return nil
 }
@@ -51,7 +50,12 @@ func (t *Transaction) Rollback() error {
 	defer t.Table.Unlock()
 	defer t.Unlock()
 
-	return t.Table.writeRecordsToFile(&dbdata.Records{Records: t.OriginalRecords})
+	t.Table.resetRecordFiles(false)
+	if err := t.Table.writeRecordsToFile(&dbdata.Records{Records: t.OriginalRecords}); err != nil {
+		return err
+	}
+	t.Table.rebuildIndexes(t.OriginalRecords)
+	return nil
 }
 
 // InsertWithTransaction is a method of the Table struct that performs an insert operation within a transaction context.
@@ -92,7 +96,7 @@ func (t *Table) InsertWithTransaction(record Record) error {
 // If the update operation is successful, it commits the transaction and returns nil.
 //
 // Parameters:
-// - key: An interface{} representing the key of the record to be updated. The key is converted to a string before the update is performed.
+// - key: An interface{} representing the key of the record to be updated. It is matched like the primary key of an inserted record, so the integer 1 and the string "1" are distinct keys.
 // - updates: A Record representing the fields to be updated in the record. The keys are field names and the values are the new field values.
 //
 // Returns:
@@ -122,7 +126,7 @@ func (t *Table) UpdateWithTransaction(key interface{}, updates Record) error {
 // If the delete operation is successful, it commits the transaction and returns nil.
 //
 // Parameters:
-// - key: An interface{} representing the key of the record to be deleted. The key is converted to a string before the deletion is performed.
+// - key: An interface{} representing the key of the record to be deleted. It is matched like the primary key of an inserted record, so the integer 1 and the string "1" are distinct keys.
 //
 // Returns:
 // - If the operation is successful, it returns nil.
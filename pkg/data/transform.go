@@ -0,0 +1,158 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// Transform transforms the value of a field. It returns the transformed value, or an error to reject a written value.
+// A transform is called with the Go value of the field, as given to a write or as returned by a read,
+// and must not modify it in place.
+type Transform func(value interface{}) (interface{}, error)
+
+// TrimSpace is a Transform removing the leading and trailing white space of string values. Other values are kept.
+func TrimSpace(value interface{}) (interface{}, error) {
+	if s, ok := value.(string); ok {
+		return strings.TrimSpace(s), nil
+	}
+	return value, nil
+}
+
+// Lowercase is a Transform lowercasing string values, such as email addresses. Other values are kept.
+func Lowercase(value interface{}) (interface{}, error) {
+	if s, ok := value.(string); ok {
+		return strings.ToLower(s), nil
+	}
+	return value, nil
+}
+
+// transformSet holds the transforms of the fields of a table. It is replaced as a whole when a transform is added,
+// so the reads can use it without the table lock.
+type transformSet struct {
+	write map[string][]Transform // Transforms applied to the written values, by field, in the order they were added
+	read  map[string][]Transform // Transforms applied to the values returned by the reads, by field, in the order they were added
+}
+
+// WithWriteTransform adds a transform applied to the values of the field written to the table, such as Lowercase for emails.
+// Write transforms run before the record is validated, keyed and indexed, so the indexes, the unique constraints
+// and the primary key see the stored, transformed values. They apply to the records of the inserts and replacements
+// and to the updates of every write method. Lookups, such as SelectByIndex or a Query filter, match the stored values,
+// so their values must be given in the transformed form.
+// Transforms of the same field run in the order they were added. Transforms are not saved in the metadata of the table,
+// so they must be given each time the table is opened, or added with AddWriteTransform to the tables loaded by a Server.
+func WithWriteTransform(field string, transform Transform) TableOption {
+	return func(t *Table) {
+		t.addTransform(field, transform, true)
+	}
+}
+
+// WithReadTransform adds a transform applied to the values of the field returned by the reads of the table,
+// such as formatting a stored value for display. The stored value is unchanged, and the filters of the queries
+// are matched against it, not against the transformed value. Like write transforms, read transforms are not saved
+// in the metadata of the table.
+func WithReadTransform(field string, transform Transform) TableOption {
+	return func(t *Table) {
+		t.addTransform(field, transform, false)
+	}
+}
+
+// AddWriteTransform is a method of the Table struct that adds a write transform to the field, like WithWriteTransform,
+// to a table that is already open. It applies to the writes made after it returns; stored values are not transformed again.
+//
+// Parameters:
+// - field: The field whose written values are transformed.
+// - transform: The transform to apply.
+func (t *Table) AddWriteTransform(field string, transform Transform) {
+	t.Lock()
+	defer t.Unlock()
+	t.addTransform(field, transform, true)
+}
+
+// AddReadTransform is a method of the Table struct that adds a read transform to the field, like WithReadTransform,
+// to a table that is already open.
+//
+// Parameters:
+// - field: The field whose returned values are transformed.
+// - transform: The transform to apply.
+func (t *Table) AddReadTransform(field string, transform Transform) {
+	t.Lock()
+	defer t.Unlock()
+	t.addTransform(field, transform, false)
+}
+
+// addTransform adds the transform to a copy of the transforms of the table and publishes it.
+func (t *Table) addTransform(field string, transform Transform, write bool) {
+	current := t.transforms.Load()
+	next := &transformSet{write: make(map[string][]Transform), read: make(map[string][]Transform)}
+	if current != nil {
+		for name, transforms := range current.write {
+			next.write[name] = transforms
+		}
+		for name, transforms := range current.read {
+			next.read[name] = transforms
+		}
+	}
+	target := next.read
+	if write {
+		target = next.write
+	}
+	// Copy the slice, so the slices of the previous set are never modified
+	target[field] = append(append([]Transform(nil), target[field]...), transform)
+	t.transforms.Store(next)
+	if !write {
+		// The records returned by the reads change
+		t.version.Add(1)
+	}
+}
+
+// applyTransforms returns a copy of the record with the transforms applied to their fields,
+// or the record itself if none of its fields has transforms.
+func applyTransforms(record Record, transforms map[string][]Transform) (Record, error) {
+	var transformed Record
+	for field, value := range record {
+		if len(transforms[field]) == 0 {
+			continue
+		}
+		if transformed == nil {
+			transformed = make(Record, len(record))
+			for name, v := range record {
+				transformed[name] = v
+			}
+		}
+		for _, transform := range transforms[field] {
+			var err error
+			if value, err = transform(value); err != nil {
+				return nil, fmt.Errorf("transform of field '%s' failed: %w", field, err)
+			}
+		}
+		transformed[field] = value
+	}
+	if transformed == nil {
+		return record, nil
+	}
+	return transformed, nil
+}
+
+// transformWrite returns the record, or the updates, with the write transforms of the table applied.
+func (t *Table) transformWrite(record Record) (Record, error) {
+	transforms := t.transforms.Load()
+	if transforms == nil {
+		return record, nil
+	}
+	return applyTransforms(record, transforms.write)
+}
+
+// fromStoredRecord converts a stored record to the Record returned by a read, with the read transforms of the table applied.
+func (t *Table) fromStoredRecord(protoRecord *dbdata.Record) (Record, error) {
+	record, err := fromProtoRecord(protoRecord)
+	if err != nil {
+		return nil, err
+	}
+	transforms := t.transforms.Load()
+	if transforms == nil {
+		return record, nil
+	}
+	return applyTransforms(record, transforms.read)
+}
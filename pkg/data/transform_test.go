@@ -0,0 +1,104 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWriteTransformsAffectIndexLookups(t *testing.T) {
+	table := newTestTable(t, "id", WithWriteTransform("email", TrimSpace), WithWriteTransform("email", Lowercase))
+	if err := table.CreateIndex("email"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	if err := table.AddUniqueConstraint("email", false); err != nil {
+		t.Fatalf("AddUniqueConstraint failed: %v", err)
+	}
+
+	written := Record{"id": "u1", "email": "  Alice@X.com "}
+	mustInsert(t, table, written)
+	if written["email"] != "  Alice@X.com " {
+		t.Errorf("the written record was modified: %v", written)
+	}
+
+	// The index holds the transformed value, so lookups give it in that form
+	records, err := table.SelectByIndex("email", "alice@x.com")
+	if err != nil {
+		t.Fatalf("SelectByIndex failed: %v", err)
+	}
+	if len(records) != 1 || records[0]["email"] != "alice@x.com" {
+		t.Errorf("SelectByIndex of the transformed email = %v, want u1 with the stored email", records)
+	}
+	if records, err := table.SelectByIndex("email", "  Alice@X.com "); err != nil || len(records) != 0 {
+		t.Errorf("SelectByIndex of the written email = %v, %v, want none", records, err)
+	}
+
+	// The unique constraint sees the transformed values too
+	if err := table.Insert(Record{"id": "u2", "email": "ALICE@x.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Insert of the same email in another form = %v, want ErrUniqueViolation", err)
+	}
+
+	// Updates are transformed before they are indexed
+	if err := table.Update("u1", Record{"email": " Bob@X.com"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	records, err = table.SelectByIndex("email", "bob@x.com")
+	if err != nil || len(records) != 1 || records[0]["id"] != "u1" {
+		t.Errorf("SelectByIndex after the update = %v, %v, want u1", records, err)
+	}
+	if records, err := table.SelectByIndex("email", "alice@x.com"); err != nil || len(records) != 0 {
+		t.Errorf("SelectByIndex of the old email = %v, %v, want none", records, err)
+	}
+}
+
+func TestWriteTransformOfPrimaryKeyAndErrors(t *testing.T) {
+	reject := func(value interface{}) (interface{}, error) {
+		if value == "" {
+			return nil, fmt.Errorf("empty code")
+		}
+		return value, nil
+	}
+	table := newTestTable(t, "id", WithWriteTransform("id", Lowercase), WithWriteTransform("code", reject))
+	mustInsert(t, table, Record{"id": "ABC", "code": "x"})
+	if _, err := table.Select("abc"); err != nil {
+		t.Errorf("Select of the transformed key failed: %v", err)
+	}
+	if err := table.Insert(Record{"id": "def", "code": ""}); err == nil {
+		t.Error("Insert of a value rejected by a transform succeeded, want its error")
+	}
+	if count, err := table.Count(); err != nil || count != 1 {
+		t.Errorf("Count = %d, %v, want the rejected record left out", count, err)
+	}
+}
+
+func TestReadTransforms(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "price": "1000"})
+	table.AddReadTransform("price", func(value interface{}) (interface{}, error) {
+		return fmt.Sprintf("$%v", value), nil
+	})
+
+	record, err := table.Select("a")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["price"] != "$1000" {
+		t.Errorf("price = %v, want the transformed value $1000", record["price"])
+	}
+
+	// Filters match the stored value, not the transformed one
+	results, err := table.Query(Query{Filters: map[string]interface{}{"price": "1000"}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 1 || results[0]["price"] != "$1000" {
+		t.Errorf("Query on the stored value = %v, want the record with the transformed price", results)
+	}
+	raw, err := table.Raw()
+	if err != nil {
+		t.Fatalf("Raw failed: %v", err)
+	}
+	if got, err := fromProtoValue(raw.Records["a"].Fields["price"]); err != nil || got != "1000" {
+		t.Errorf("stored price = %v, %v, want 1000", got, err)
+	}
+}
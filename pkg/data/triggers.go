@@ -0,0 +1,226 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// OpType is the type of a write that fires the triggers of a table.
+type OpType int
+
+const (
+	OpInsert OpType = iota // A record was inserted
+	OpUpdate               // A record was updated, or replaced by an insert with InsertReplace
+	OpDelete               // A record was deleted
+)
+
+// String returns the name of the operation.
+func (op OpType) String() string {
+	switch op {
+	case OpInsert:
+		return "insert"
+	case OpUpdate:
+		return "update"
+	case OpDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("OpType(%d)", int(op))
+}
+
+// MaxTriggerDepth is the number of nested writes fired by triggers after which a write fails with ErrTriggerDepth,
+// so triggers writing to each other's tables can't loop forever.
+const MaxTriggerDepth = 8
+
+// ErrTriggerDepth is returned by a write whose triggers would exceed MaxTriggerDepth nested writes.
+var ErrTriggerDepth = errors.New("trigger depth limit exceeded")
+
+// ErrTriggerReentrant is returned by a write made by a trigger, with the context of its event, to a table locked
+// by the write that fired it, which would otherwise wait forever for the lock.
+var ErrTriggerReentrant = errors.New("trigger writes to a table locked by the write that fired it")
+
+// ChangeEvent describes a change of a record, passed to the triggers of the table.
+type ChangeEvent struct {
+	Op      OpType          // Operation that changed the record
+	Table   string          // Name of the table of the record
+	Key     string          // Primary key of the record
+	Old     Record          // Record before the change, nil for an insert
+	New     Record          // Record after the change, nil for a delete
+	Context context.Context // Context the writes of the trigger must be performed with, so nested triggers are counted
+}
+
+// triggerDepthKey is the context key of the number of nested writes fired by triggers.
+type triggerDepthKey struct{}
+
+// triggerDepth returns the number of nested writes fired by triggers that led to the write performed with the context.
+func triggerDepth(ctx context.Context) int {
+	depth, _ := ctx.Value(triggerDepthKey{}).(int)
+	return depth
+}
+
+// triggerTablesKey is the context key of the tables locked by the writes whose triggers led to the write performed with the context.
+type triggerTablesKey struct{}
+
+// withTriggerTables returns a copy of the context holding the given tables as locked, in addition to the ones it already holds.
+func withTriggerTables(ctx context.Context, tables ...*Table) context.Context {
+	locked, _ := ctx.Value(triggerTablesKey{}).([]*Table)
+	return context.WithValue(ctx, triggerTablesKey{}, append(append([]*Table(nil), locked...), tables...))
+}
+
+// checkTriggerWrite returns an error wrapping ErrTriggerReentrant if the write performed with the context
+// is made by a trigger of a write holding the lock of the table.
+func (t *Table) checkTriggerWrite(ctx context.Context) error {
+	locked, _ := ctx.Value(triggerTablesKey{}).([]*Table)
+	for _, table := range locked {
+		if table == t {
+			return fmt.Errorf("%w: table %s", ErrTriggerReentrant, t.tableName())
+		}
+	}
+	return nil
+}
+
+// pendingChange is a change of a record whose triggers have not been fired yet.
+type pendingChange struct {
+	event    ChangeEvent               // Event passed to the triggers, without its records
+	old      *dbdata.Record            // Stored record before the change, nil for an insert
+	new      *dbdata.Record            // Stored record after the change, nil for a delete
+	triggers []func(ChangeEvent) error // Triggers of the operation when the change was made
+}
+
+// AddTrigger is a method of the Table struct that registers a function called on each write of the given operation.
+// Triggers are called synchronously, in the order they were added, by Insert, InsertWithMode, InsertContext, InsertMany,
+// Update, UpdateContext, UpdateMany, UpdateWhere, Replace, CompareAndSwap, Increment, Delete, DeleteContext, DeleteMany, DeleteKeys, DeleteWhere,
+// UpsertBatch, DBTxn.Commit and the methods calling them, such as UpdateIfExists.
+// They are called inside the write, under the table lock, once the change is applied in memory but before it is
+// published to readers or written to the file. If a trigger returns an error, the remaining triggers are not called,
+// and the write returns the error without publishing or writing anything, so readers never see the rejected change.
+// The changes of a write of several records, such as DeleteKeys, are rejected together.
+// The writes of a Transaction, and the restores of the records after a failed write, don't fire triggers.
+//
+// A trigger can write to other tables, for example to maintain a denormalized table. Writes made with the context
+// of the event, such as other.InsertContext(event.Context, record), fire their own triggers, up to MaxTriggerDepth nested writes.
+// Those writes are their own writes: they are not undone if a later trigger rejects the change.
+// A trigger must not call the methods of its own table, which is locked while it runs: a write with the context
+// of the event returns an error wrapping ErrTriggerReentrant, and any other call taking the lock would wait forever.
+// The event holds the record before and after the change instead. Two tables whose triggers write to each other
+// can deadlock under concurrent writes, so triggers should write to tables in a single direction.
+//
+// Parameters:
+// - op: The operation whose writes call the trigger.
+// - fn: The function called with the change of each written record.
+func (t *Table) AddTrigger(op OpType, fn func(ChangeEvent) error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.triggers == nil {
+		t.triggers = make(map[OpType][]func(ChangeEvent) error)
+	}
+	// Copy the triggers, so the slices taken by the writes are never modified
+	triggers := append([]func(ChangeEvent) error(nil), t.triggers[op]...)
+	t.triggers[op] = append(triggers, fn)
+}
+
+// recordChange records the change of the record stored under the key, if the triggers of the table are captured
+// by withTriggers, so fireChanges calls its triggers before the change is published. The table must be locked for writing.
+func (t *Table) recordChange(op OpType, key string, oldRecord, newRecord *dbdata.Record) {
+	if !t.capturing || len(t.triggers[op]) == 0 {
+		return
+	}
+	t.changes = append(t.changes, pendingChange{
+		event:    ChangeEvent{Op: op, Table: t.tableName(), Key: key},
+		old:      oldRecord,
+		new:      newRecord,
+		triggers: t.triggers[op],
+	})
+}
+
+// withTriggers runs the write, capturing the changes it makes so their triggers fire before they are published.
+// The table must be locked for writing; it is unlocked once the write returns.
+func (t *Table) withTriggers(ctx context.Context, write func() error) error {
+	return t.withRecordTriggers(ctx, nil, write)
+}
+
+// withRecordTriggers runs the write like withTriggers, for a write holding the record lock released by unlockRecord, if not nil.
+// If the write published its change for a group commit, it waits for the file write holding it once the table is unlocked,
+// then unlocks the record.
+func (t *Table) withRecordTriggers(ctx context.Context, unlockRecord func(), write func() error) error {
+	seq, err := func() (uint64, error) {
+		defer t.Unlock()
+		t.capturing, t.triggerCtx = true, ctx
+		defer func() {
+			t.capturing, t.triggerCtx, t.changes, t.pendingSeq = false, nil, nil, 0
+		}()
+		err := write()
+		return t.pendingSeq, err
+	}()
+	if seq > 0 {
+		if commitErr := t.awaitCommit(seq); commitErr != nil && err == nil {
+			err = commitErr
+		}
+	}
+	if unlockRecord != nil {
+		unlockRecord()
+	}
+	return err
+}
+
+// fireChanges calls the triggers of the changes recorded by the write in progress since the last call.
+// It is called under the table lock, before the write publishes the changes; if a trigger fails, it returns its error,
+// and the write must return it without publishing or writing its records.
+func (t *Table) fireChanges() error {
+	changes := t.changes
+	t.changes = nil
+	ctx := t.triggerCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, change := range changes {
+		if err := t.fireTriggers(ctx, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChanges fires the triggers of the changes recorded by the write in progress, then writes the records like writeRecordsToFile.
+// If a trigger fails, the records are neither published nor written.
+func (t *Table) writeChanges(records *dbdata.Records) error {
+	if err := t.fireChanges(); err != nil {
+		return err
+	}
+	return t.writeRecordsToFile(records)
+}
+
+// fireTriggers calls the triggers of the change, and returns the error of the first one that fails.
+func (t *Table) fireTriggers(ctx context.Context, change pendingChange) error {
+	if len(change.triggers) == 0 {
+		return nil
+	}
+	depth := triggerDepth(ctx)
+	if depth >= MaxTriggerDepth {
+		return fmt.Errorf("%w: write of record %s in table %s is nested %d times", ErrTriggerDepth, change.event.Key, change.event.Table, depth)
+	}
+	// The stored records are never modified once written, so they can be decoded and passed to the triggers
+	var err error
+	if change.old != nil {
+		if change.event.Old, err = fromProtoRecord(change.old); err != nil {
+			return err
+		}
+	}
+	if change.new != nil {
+		if change.event.New, err = fromProtoRecord(change.new); err != nil {
+			return err
+		}
+	}
+	change.event.Context = withTriggerTables(context.WithValue(ctx, triggerDepthKey{}, depth+1), t)
+	for _, trigger := range change.triggers {
+		// Each trigger gets its own copy of the records, so a trigger modifying them doesn't change what the next one sees
+		event := change.event
+		event.Old, event.New = change.event.Old.Clone(), change.event.New.Clone()
+		if err := trigger(event); err != nil {
+			return fmt.Errorf("%s trigger of record %s in table %s failed: %w", change.event.Op, change.event.Key, change.event.Table, err)
+		}
+	}
+	return nil
+}
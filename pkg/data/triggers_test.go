@@ -0,0 +1,278 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestDeleteKeysRollsBackWholeBatch(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "a", "name": "first"},
+		Record{"id": "b", "name": "second"},
+		Record{"id": "c", "name": "third"},
+	)
+
+	errRefused := errors.New("refused")
+	calls := 0
+	table.AddTrigger(OpDelete, func(event ChangeEvent) error {
+		calls++
+		if calls == 2 {
+			return errRefused
+		}
+		return nil
+	})
+
+	deleted, err := table.DeleteKeys([]string{"a", "b", "c"})
+	if !errors.Is(err, errRefused) {
+		t.Fatalf("DeleteKeys error = %v, want %v", err, errRefused)
+	}
+	if deleted != 0 {
+		t.Errorf("DeleteKeys count = %d, want 0", deleted)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := table.Select(key); err != nil {
+			t.Errorf("record %s was not restored: %v", key, err)
+		}
+	}
+
+	reopened := openTestTable(t, "id", table.FilePath)
+	count, err := reopened.Count()
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Count of the file after the rollback = %d, want 3", count)
+	}
+}
+
+func TestDeleteKeysWithTriggers(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a"}, Record{"id": "b"})
+
+	var deletedKeys []string
+	table.AddTrigger(OpDelete, func(event ChangeEvent) error {
+		deletedKeys = append(deletedKeys, event.Key)
+		return nil
+	})
+
+	deleted, err := table.DeleteKeys([]string{"a", "b", "missing", "a"})
+	if err != nil {
+		t.Fatalf("DeleteKeys failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("DeleteKeys count = %d, want 2", deleted)
+	}
+	if len(deletedKeys) != 2 {
+		t.Errorf("triggers fired for %v, want a and b", deletedKeys)
+	}
+}
+
+// recordTriggers adds a trigger of each operation to the table, recording the operation and key of the events.
+func recordTriggers(table *Table) *[]string {
+	var events []string
+	for _, op := range []OpType{OpInsert, OpUpdate, OpDelete} {
+		table.AddTrigger(op, func(event ChangeEvent) error {
+			events = append(events, event.Op.String()+" "+event.Key)
+			return nil
+		})
+	}
+	return &events
+}
+
+func TestBatchWritesFireTriggers(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(*Table) error
+		want  []string
+	}{
+		{"InsertMany", func(table *Table) error {
+			return table.InsertMany([]Record{{"id": "c"}})
+		}, []string{"insert c"}},
+		{"UpdateMany", func(table *Table) error {
+			return errors.Join(table.UpdateMany(map[string]Record{"a": {"n": 1}})...)
+		}, []string{"update a"}},
+		{"DeleteMany", func(table *Table) error {
+			return errors.Join(table.DeleteMany([]interface{}{"b"})...)
+		}, []string{"delete b"}},
+		{"UpdateWhere", func(table *Table) error {
+			_, err := table.UpdateWhere(func(r Record) bool { return r["id"] == "a" }, Record{"n": 2})
+			return err
+		}, []string{"update a"}},
+		{"DeleteWhere", func(table *Table) error {
+			_, err := table.DeleteWhere(func(r Record) bool { return r["id"] == "a" })
+			return err
+		}, []string{"delete a"}},
+		{"CompareAndSwap", func(table *Table) error {
+			_, err := table.CompareAndSwap("a", "state", "new", "done")
+			return err
+		}, []string{"update a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := newTestTable(t, "id")
+			mustInsert(t, table, Record{"id": "a", "state": "new"}, Record{"id": "b"})
+			events := recordTriggers(table)
+			if err := tt.write(table); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			if len(*events) != len(tt.want) || (*events)[0] != tt.want[0] {
+				t.Errorf("events = %v, want %v", *events, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateWhereRollsBackOnTriggerFailure(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "n": 0}, Record{"id": "b", "n": 0})
+	table.AddTrigger(OpUpdate, func(event ChangeEvent) error {
+		return errors.New("refused")
+	})
+
+	if _, err := table.UpdateWhere(func(Record) bool { return true }, Record{"n": 1}); err == nil {
+		t.Fatal("UpdateWhere succeeded, want the error of the trigger")
+	}
+	records, err := table.SelectAll()
+	if err != nil {
+		t.Fatalf("SelectAll failed: %v", err)
+	}
+	for _, record := range records {
+		if record["n"] != int64(0) {
+			t.Errorf("record %v was not rolled back", record)
+		}
+	}
+}
+
+func TestDBTxnCommitFiresTriggers(t *testing.T) {
+	db := newTestDatabase(t, "orders", "totals")
+	orders, totals := db.Tables["orders"], db.Tables["totals"]
+	mustInsert(t, totals, Record{"id": "t1", "count": 0})
+	events := recordTriggers(orders)
+
+	tx := db.Begin()
+	tx.Insert("orders", Record{"id": "o1"})
+	tx.Update("totals", "t1", Record{"count": 1})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if len(*events) != 1 || (*events)[0] != "insert o1" {
+		t.Errorf("events = %v, want [insert o1]", *events)
+	}
+
+	// A failing trigger rolls back the writes of every table of the transaction
+	orders.AddTrigger(OpInsert, func(event ChangeEvent) error {
+		return errors.New("refused")
+	})
+	tx = db.Begin()
+	tx.Update("totals", "t1", Record{"count": 2})
+	tx.Insert("orders", Record{"id": "o2"})
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Commit succeeded, want the error of the trigger")
+	}
+	if _, err := orders.Select("o2"); err == nil {
+		t.Error("insert of the failed transaction was not rolled back")
+	}
+	total, err := totals.Select("t1")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if total["count"] != int64(1) {
+		t.Errorf("count = %v, want 1 after the rollback", total["count"])
+	}
+}
+
+func TestRejectedChangeIsNeverPublished(t *testing.T) {
+	for _, opts := range [][]TableOption{nil, {WithRecordLocks()}, {WithAppendLog(10)}} {
+		table := newTestTable(t, "id", opts...)
+		mustInsert(t, table, Record{"id": "a", "n": 0})
+		fileBefore, err := os.ReadFile(table.FilePath)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		versionBefore := table.Version()
+
+		var seen []interface{}
+		refuse := func(event ChangeEvent) error {
+			// Readers don't see the change before it is accepted
+			if table.Version() != versionBefore {
+				t.Errorf("%s trigger: Version changed before the change was accepted", event.Op)
+			}
+			record, err := fromProtoRecord(table.snapshot.Load().Records["a"])
+			if err != nil {
+				return err
+			}
+			seen = append(seen, record["n"])
+			return errors.New("refused")
+		}
+		table.AddTrigger(OpInsert, refuse)
+		table.AddTrigger(OpUpdate, refuse)
+		table.AddTrigger(OpDelete, refuse)
+
+		if err := table.Update("a", Record{"n": 1}); err == nil {
+			t.Error("Update succeeded, want the error of the trigger")
+		}
+		if err := table.Delete("a"); err == nil {
+			t.Error("Delete succeeded, want the error of the trigger")
+		}
+		if err := table.Insert(Record{"id": "b"}); err == nil {
+			t.Error("Insert succeeded, want the error of the trigger")
+		}
+		if len(seen) != 3 {
+			t.Errorf("triggers fired %d times, want 3", len(seen))
+		}
+		for i, n := range seen {
+			if n != int64(0) {
+				t.Errorf("trigger %d saw n = %v, want the unchanged 0", i, n)
+			}
+		}
+
+		if table.Version() != versionBefore {
+			t.Error("Version changed, want the rejected changes never published")
+		}
+		if fileAfter, err := os.ReadFile(table.FilePath); err != nil || !bytes.Equal(fileAfter, fileBefore) {
+			t.Errorf("the table file changed, %v, want the rejected changes never written", err)
+		}
+		if record, err := table.Select("a"); err != nil || record["n"] != int64(0) {
+			t.Errorf("Select(a) = %v, %v, want the unchanged record", record, err)
+		}
+		if _, err := table.Select("b"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Select(b) error = %v, want %v", err, ErrNotFound)
+		}
+	}
+}
+
+func TestTriggerWritesAnotherTable(t *testing.T) {
+	db := newTestDatabase(t, "orders", "totals")
+	orders, totals := db.Tables["orders"], db.Tables["totals"]
+	mustInsert(t, totals, Record{"id": "all", "count": 0})
+	orders.AddTrigger(OpInsert, func(event ChangeEvent) error {
+		total, err := totals.Select("all")
+		if err != nil {
+			return err
+		}
+		return totals.UpdateContext(event.Context, "all", Record{"count": total["count"].(int64) + 1})
+	})
+
+	mustInsert(t, orders, Record{"id": "o1"}, Record{"id": "o2"})
+	if total, err := totals.Select("all"); err != nil || total["count"] != int64(2) {
+		t.Errorf("Select(all) = %v, %v, want a count of 2", total, err)
+	}
+
+	// The table of the trigger is locked by the write, so writing it back fails instead of waiting forever
+	totals.AddTrigger(OpUpdate, func(event ChangeEvent) error {
+		return orders.DeleteContext(event.Context, "o1")
+	})
+	if err := orders.Insert(Record{"id": "o3"}); !errors.Is(err, ErrTriggerReentrant) {
+		t.Errorf("Insert with a trigger writing back to the table = %v, want %v", err, ErrTriggerReentrant)
+	}
+	if _, err := orders.Select("o3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Select(o3) error = %v, want the rejected insert not stored", err)
+	}
+	if err := orders.UpdateContext(withTriggerTables(context.Background(), orders), "o1", Record{"n": 1}); !errors.Is(err, ErrTriggerReentrant) {
+		t.Errorf("UpdateContext of a locked table = %v, want %v", err, ErrTriggerReentrant)
+	}
+}
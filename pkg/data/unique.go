@@ -0,0 +1,168 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// ErrUniqueViolation is returned by the writes that would give two records the same value for a field with a unique constraint.
+var ErrUniqueViolation = errors.New("unique constraint violated")
+
+// UniqueConstraint declares that no two records of a table can have the same value for a field.
+// Records without the field, or with a nil value, are not constrained.
+type UniqueConstraint struct {
+	Field           string `json:"Field"`                     // Field whose values must be unique
+	CaseInsensitive bool   `json:"CaseInsensitive,omitempty"` // Whether string values differing only in case conflict
+}
+
+// uniqueIndex enforces a unique constraint, mapping the normalized values of its field to the primary key holding them.
+type uniqueIndex struct {
+	UniqueConstraint
+	owners map[string]string // Map of normalized values to the primary key of the record holding them
+}
+
+// normalize returns the value of the constrained field of the record as compared by the constraint.
+// String values of case-insensitive constraints are lowercased; the stored value keeps its case.
+// It returns false if the record doesn't have the field.
+func (u *uniqueIndex) normalize(record *dbdata.Record) (string, bool) {
+	value, exists := record.Fields[u.Field]
+	if !exists || value == nil {
+		return "", false
+	}
+	decoded, err := fromProtoValue(value)
+	if err != nil || decoded == nil {
+		return "", false
+	}
+	if s, ok := decoded.(string); ok {
+		if u.CaseInsensitive {
+			s = strings.ToLower(s)
+		}
+		return "s:" + s, true
+	}
+	// Keep values of other types apart from strings with the same text
+	return fmt.Sprintf("%T:%v", decoded, decoded), true
+}
+
+// add records the value of the record stored under the given primary key.
+func (u *uniqueIndex) add(key string, record *dbdata.Record) {
+	if value, ok := u.normalize(record); ok {
+		u.owners[value] = key
+	}
+}
+
+// remove forgets the value of the record stored under the given primary key.
+func (u *uniqueIndex) remove(key string, record *dbdata.Record) {
+	if value, ok := u.normalize(record); ok && u.owners[value] == key {
+		delete(u.owners, value)
+	}
+}
+
+// conflict returns an error wrapping ErrUniqueViolation if another record than the one with the given primary key
+// holds the value of the record.
+func (u *uniqueIndex) conflict(key string, record *dbdata.Record) error {
+	value, ok := u.normalize(record)
+	if !ok {
+		return nil
+	}
+	if owner, exists := u.owners[value]; exists && owner != key {
+		return fmt.Errorf("%w: value %v of field %s is already used by the record with key %s",
+			ErrUniqueViolation, indexValue(record.Fields[u.Field]), u.Field, owner)
+	}
+	return nil
+}
+
+// AddUniqueConstraint is a method of the Table struct that declares that no two records of the table can have
+// the same value for a field. With caseInsensitive, string values that differ only in case, such as
+// "Alice@x.com" and "alice@x.com", conflict too, while the records keep the values as they were written.
+// The existing records are checked first, and the declaration is saved in the metadata file of the table.
+// Inserts, updates and replacements that would violate the constraint then fail with an error wrapping ErrUniqueViolation.
+//
+// Parameters:
+// - field: The field whose values must be unique.
+// - caseInsensitive: Whether string values are compared ignoring case.
+//
+// Returns:
+// - If the operation is successful, it returns nil.
+// - If the field already has a unique constraint, existing records violate it, or an error occurs while
+// reading the records or saving the metadata, it returns an error.
+func (t *Table) AddUniqueConstraint(field string, caseInsensitive bool) error {
+	if field == "" {
+		return fmt.Errorf("a unique constraint needs a field")
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	for _, existing := range t.uniques {
+		if existing.Field == field {
+			return fmt.Errorf("unique constraint on field %s already exists", field)
+		}
+	}
+	if err := t.checkIndexable(field); err != nil {
+		return err
+	}
+
+	allRecords, err := t.loadForWrite()
+	if err != nil {
+		return err
+	}
+	unique := &uniqueIndex{
+		UniqueConstraint: UniqueConstraint{Field: field, CaseInsensitive: caseInsensitive},
+		owners:           make(map[string]string),
+	}
+	keys := make([]string, 0, len(allRecords.Records))
+	for key := range allRecords.Records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := unique.conflict(key, allRecords.Records[key]); err != nil {
+			return fmt.Errorf("record with key %s: %w", key, err)
+		}
+		unique.add(key, allRecords.Records[key])
+	}
+
+	t.uniques = append(t.uniques, unique)
+	if err := t.saveMetadata(); err != nil {
+		t.uniques = t.uniques[:len(t.uniques)-1]
+		return err
+	}
+	return nil
+}
+
+// UniqueConstraints is a method of the Table struct that returns the unique constraints declared on the table.
+func (t *Table) UniqueConstraints() []UniqueConstraint {
+	t.RLock()
+	defer t.RUnlock()
+
+	constraints := make([]UniqueConstraint, len(t.uniques))
+	for i, unique := range t.uniques {
+		constraints[i] = unique.UniqueConstraint
+	}
+	return constraints
+}
+
+// checkUnique returns an error wrapping ErrUniqueViolation if storing the record under the given primary key
+// would violate a unique constraint of the table. The previous version of the record, if any, must be unindexed first.
+func (t *Table) checkUnique(key string, record *dbdata.Record) error {
+	for _, unique := range t.uniques {
+		if err := unique.conflict(key, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildUniques fills the unique constraints of the table again from the given records.
+func (t *Table) rebuildUniques(records map[string]*dbdata.Record) {
+	for _, unique := range t.uniques {
+		unique.owners = make(map[string]string, len(records))
+		for key, record := range records {
+			unique.add(key, record)
+		}
+	}
+}
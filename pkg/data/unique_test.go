@@ -0,0 +1,78 @@
+package data
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestCaseInsensitiveUniqueConstraint(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "users.bin")
+	table := openTestTable(t, "id", filePath)
+	if err := table.AddUniqueConstraint("email", true); err != nil {
+		t.Fatalf("AddUniqueConstraint failed: %v", err)
+	}
+	mustInsert(t, table, Record{"id": "u1", "email": "Alice@x.com"})
+
+	err := table.Insert(Record{"id": "u2", "email": "alice@x.com"})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Insert of an email differing only in case = %v, want ErrUniqueViolation", err)
+	}
+	err = table.Update("u1", Record{"email": "ALICE@X.COM"})
+	if err != nil {
+		t.Errorf("Update of the record holding the email failed: %v", err)
+	}
+
+	record, err := table.Select("u1")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if record["email"] != "ALICE@X.COM" {
+		t.Errorf("email = %v, want the value as written", record["email"])
+	}
+
+	// The constraint is saved with the table and enforced after reopening it
+	if err := table.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	reopened := openTestTable(t, "id", filePath)
+	if err := reopened.LoadIndexes(); err != nil {
+		t.Fatalf("LoadIndexes failed: %v", err)
+	}
+	want := []UniqueConstraint{{Field: "email", CaseInsensitive: true}}
+	if got := reopened.UniqueConstraints(); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("UniqueConstraints = %v, want %v", got, want)
+	}
+	err = reopened.Insert(Record{"id": "u3", "email": "alice@X.com"})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Insert after reopening = %v, want ErrUniqueViolation", err)
+	}
+}
+
+func TestCaseSensitiveUniqueConstraint(t *testing.T) {
+	table := newTestTable(t, "id")
+	if err := table.AddUniqueConstraint("email", false); err != nil {
+		t.Fatalf("AddUniqueConstraint failed: %v", err)
+	}
+	mustInsert(t, table,
+		Record{"id": "u1", "email": "Alice@x.com"},
+		Record{"id": "u2", "email": "alice@x.com"},
+	)
+	if err := table.Insert(Record{"id": "u3", "email": "alice@x.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Insert of a duplicate email = %v, want ErrUniqueViolation", err)
+	}
+}
+
+func TestAddUniqueConstraintChecksExistingRecords(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "u1", "email": "Bo@x.com"},
+		Record{"id": "u2", "email": "bo@x.com"},
+	)
+	if err := table.AddUniqueConstraint("email", true); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("AddUniqueConstraint over conflicting records = %v, want ErrUniqueViolation", err)
+	}
+	if got := table.UniqueConstraints(); len(got) != 0 {
+		t.Errorf("UniqueConstraints = %v, want none", got)
+	}
+}
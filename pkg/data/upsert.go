@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+)
+
+// UpsertBatch is a method of the Table struct that inserts or merges a batch of records in a single file write.
+// A record whose primary key is not in the table is inserted. A record whose primary key is already used, by a stored record
+// or by a previous record of the batch, is merged with it by resolve, and the record returned by resolve replaces it.
+// This supports ingestion pipelines that see the same entity more than once, for example keeping the newest version
+// of a record or merging field by field.
+//
+// The resolver receives the existing record and the incoming one, after the write transforms of the table, and may
+// return either of them, a merged record, or nil to keep the existing record unchanged. The record it returns must keep
+// the primary key of the existing record. A nil resolve overwrites the existing record with the incoming one, like
+// InsertWithMode with InsertReplace. Records without a primary key get a generated key if the table has a key generator.
+//
+// The batch is atomic: if a record is invalid, a resolver result changes a primary key, or a unique constraint is violated,
+// nothing is written. The triggers fire for every inserted or merged record, as inserts and updates.
+//
+// Parameters:
+// - records: The records to insert or merge, in order.
+// - resolve: The function merging an incoming record with the existing record with the same primary key, or nil to overwrite.
+//
+// Returns:
+// - The number of records inserted or merged. Records kept unchanged by the resolver are not counted.
+// - An error, if a record can't be written, in which case no record is written and the count is 0.
+func (t *Table) UpsertBatch(records []Record, resolve func(existing, incoming Record) Record) (int, error) {
+	written := 0
+	t.Lock()
+	err := t.withTriggers(context.Background(), func() error {
+		allRecords, err := t.loadForWrite()
+		if err != nil {
+			return err
+		}
+
+		// The version of each written key before the batch, nil for the inserted keys, restored if the batch fails
+		originals := make(map[string]*dbdata.Record)
+		var order []string
+		committed := false
+		defer func() {
+			if committed {
+				return
+			}
+			// Leave the indexes as they were if the batch is not written
+			for _, key := range order {
+				t.unindexRecord(key, allRecords.Records[key])
+				if original := originals[key]; original != nil {
+					t.indexRecord(key, original)
+				}
+			}
+		}()
+
+		for i, record := range records {
+			prepared, err := t.prepareUpsert(allRecords, record, resolve)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", i, err)
+			}
+			if prepared == nil {
+				continue
+			}
+			key := prepared.key
+			existing, exists := allRecords.Records[key]
+			if exists {
+				t.unindexRecord(key, existing)
+			}
+			// The records of the batch indexed so far are checked too
+			if err := t.checkUnique(key, prepared.stored); err != nil {
+				if exists {
+					t.indexRecord(key, existing)
+				}
+				return fmt.Errorf("record %d: %w", i, err)
+			}
+			if _, seen := originals[key]; !seen {
+				originals[key] = existing
+				order = append(order, key)
+			}
+			allRecords.Records[key] = prepared.stored
+			t.indexRecord(key, prepared.stored)
+		}
+		if len(order) == 0 {
+			return nil
+		}
+
+		for _, key := range order {
+			if original := originals[key]; original != nil {
+				t.recordChange(OpUpdate, key, original, allRecords.Records[key])
+			} else {
+				t.recordChange(OpInsert, key, nil, allRecords.Records[key])
+			}
+		}
+		if err := t.writeChanges(allRecords); err != nil {
+			return err
+		}
+		committed = true
+
+		var insertedKeys, replacedKeys []string
+		for _, key := range order {
+			t.Cache[key] = allRecords.Records[key]
+			if originals[key] != nil {
+				t.metrics.IncrementUpdateCount()
+				replacedKeys = append(replacedKeys, key)
+			} else {
+				t.metrics.IncrementInsertCount()
+				insertedKeys = append(insertedKeys, key)
+			}
+		}
+		sort.Strings(insertedKeys)
+		sort.Strings(replacedKeys)
+		t.recordAudit(AuditInsert, insertedKeys...)
+		t.recordAudit(AuditReplace, replacedKeys...)
+		written = len(order)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// upsertRecord is a record of UpsertBatch ready to be stored.
+type upsertRecord struct {
+	key    string         // Primary key of the record
+	stored *dbdata.Record // Record as stored
+}
+
+// prepareUpsert returns the record to store for the incoming record of UpsertBatch, merged with the record with the same key
+// in the records if any, or nil if the resolver keeps the existing record. The table must be locked for writing.
+func (t *Table) prepareUpsert(allRecords *dbdata.Records, incoming Record, resolve func(existing, incoming Record) Record) (*upsertRecord, error) {
+	incoming, err := t.transformWrite(incoming)
+	if err != nil {
+		return nil, err
+	}
+	incoming, err = t.withGeneratedKey(incoming, func(key string) bool {
+		_, exists := allRecords.Records[key]
+		return exists
+	})
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.primaryKeyOf(incoming)
+	if err != nil {
+		return nil, err
+	}
+
+	record := incoming
+	if existingRecord, exists := allRecords.Records[key]; exists && resolve != nil {
+		existing, err := fromProtoRecord(existingRecord)
+		if err != nil {
+			return nil, err
+		}
+		record = resolve(existing, incoming)
+		if record == nil {
+			return nil, nil
+		}
+		mergedKey, err := t.primaryKeyOf(record)
+		if err != nil {
+			return nil, err
+		}
+		if mergedKey != key {
+			return nil, fmt.Errorf("%w: resolver changed key %s to %s", ErrPrimaryKeyChange, key, mergedKey)
+		}
+	}
+	if err := t.schema.checkStrings(record); err != nil {
+		return nil, err
+	}
+	stored, err := toProtoRecord(t.keyedRecord(record, key))
+	if err != nil {
+		return nil, err
+	}
+	return &upsertRecord{key: key, stored: stored}, nil
+}
@@ -0,0 +1,144 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+// keepNewest is a resolver keeping the record with the highest version, merging the fields missing from it.
+// The existing records hold their decoded integers as int64, and the incoming records are passed as written.
+func keepNewest(existing, incoming Record) Record {
+	newest, oldest := incoming, existing
+	if existing["version"].(int64) > incoming["version"].(int64) {
+		newest, oldest = existing, incoming
+	}
+	merged := Record{}
+	for field, value := range oldest {
+		merged[field] = value
+	}
+	for field, value := range newest {
+		merged[field] = value
+	}
+	return merged
+}
+
+func TestUpsertBatchWithResolver(t *testing.T) {
+	table := newTestTable(t, "id")
+	if err := table.CreateIndex("city"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	mustInsert(t, table,
+		Record{"id": "a", "version": 2, "city": "Lima", "phone": "111"},
+		Record{"id": "b", "version": 5, "city": "Puno"},
+	)
+
+	written, err := table.UpsertBatch([]Record{
+		{"id": "a", "version": int64(3), "city": "Cusco"},
+		{"id": "b", "version": int64(4), "city": "Tacna"},
+		{"id": "c", "version": int64(1), "city": "Lima"},
+		// A key repeated in the batch is merged with the record written before it
+		{"id": "c", "version": int64(2), "name": "Cy"},
+	}, keepNewest)
+	if err != nil {
+		t.Fatalf("UpsertBatch failed: %v", err)
+	}
+	// The repeated key is written once
+	if written != 3 {
+		t.Errorf("UpsertBatch wrote %d records, want 3", written)
+	}
+
+	want := map[string]Record{
+		"a": {"id": "a", "version": int64(3), "city": "Cusco", "phone": "111"},
+		"b": {"id": "b", "version": int64(5), "city": "Puno"},
+		"c": {"id": "c", "version": int64(2), "city": "Lima", "name": "Cy"},
+	}
+	for key, wantRecord := range want {
+		record, err := table.Select(key)
+		if err != nil {
+			t.Fatalf("Select(%q) failed: %v", key, err)
+		}
+		if len(record) != len(wantRecord) {
+			t.Errorf("record %s = %v, want %v", key, record, wantRecord)
+			continue
+		}
+		for field, value := range wantRecord {
+			if record[field] != value {
+				t.Errorf("record %s = %v, want %v", key, record, wantRecord)
+				break
+			}
+		}
+	}
+
+	// The indexes follow the merged records
+	if records, err := table.SelectByIndex("city", "Lima"); err != nil || len(records) != 1 || records[0]["id"] != "c" {
+		t.Errorf("SelectByIndex(city, Lima) = %v, %v, want c", records, err)
+	}
+	if records, err := table.SelectByIndex("city", "Tacna"); err != nil || len(records) != 0 {
+		t.Errorf("SelectByIndex(city, Tacna) = %v, %v, want none", records, err)
+	}
+}
+
+func TestUpsertBatchDefaultResolverOverwrites(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "name": "Ana", "phone": "111"})
+
+	written, err := table.UpsertBatch([]Record{{"id": "a", "name": "Anna"}, {"id": "b", "name": "Bo"}}, nil)
+	if err != nil || written != 2 {
+		t.Fatalf("UpsertBatch = %d, %v, want 2", written, err)
+	}
+	record, err := table.Select("a")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if _, exists := record["phone"]; exists || record["name"] != "Anna" {
+		t.Errorf("record a = %v, want the incoming record only", record)
+	}
+}
+
+func TestUpsertBatchResolverKeepsExisting(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table, Record{"id": "a", "name": "Ana"})
+
+	skip := func(existing, incoming Record) Record { return nil }
+	written, err := table.UpsertBatch([]Record{{"id": "a", "name": "Anna"}}, skip)
+	if err != nil || written != 0 {
+		t.Errorf("UpsertBatch = %d, %v, want 0 records written", written, err)
+	}
+	if record, err := table.Select("a"); err != nil || record["name"] != "Ana" {
+		t.Errorf("Select = %v, %v, want the existing record", record, err)
+	}
+}
+
+func TestUpsertBatchIsAtomic(t *testing.T) {
+	table := newTestTable(t, "id")
+	if err := table.AddUniqueConstraint("email", false); err != nil {
+		t.Fatalf("AddUniqueConstraint failed: %v", err)
+	}
+	mustInsert(t, table, Record{"id": "a", "email": "a@x.com"}, Record{"id": "b", "email": "b@x.com"})
+
+	// The resolver can't change the primary key of the existing record
+	changeKey := func(existing, incoming Record) Record { return Record{"id": "z", "email": "z@x.com"} }
+	_, err := table.UpsertBatch([]Record{{"id": "c", "email": "c@x.com"}, {"id": "a", "email": "new@x.com"}}, changeKey)
+	if !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("UpsertBatch with a resolver changing the key = %v, want ErrPrimaryKeyChange", err)
+	}
+
+	// A unique violation late in the batch leaves the whole batch unwritten
+	_, err = table.UpsertBatch([]Record{
+		{"id": "a", "email": "a2@x.com"},
+		{"id": "c", "email": "c@x.com"},
+		{"id": "d", "email": "b@x.com"},
+	}, nil)
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("UpsertBatch with a duplicate email = %v, want ErrUniqueViolation", err)
+	}
+
+	if count, err := table.Count(); err != nil || count != 2 {
+		t.Errorf("Count = %d, %v, want the 2 records inserted first", count, err)
+	}
+	if record, err := table.Select("a"); err != nil || record["email"] != "a@x.com" {
+		t.Errorf("Select(a) = %v, %v, want the record unchanged", record, err)
+	}
+	// The values of the failed batches are not left in the unique constraint
+	mustInsert(t, table, Record{"id": "e", "email": "c@x.com"}, Record{"id": "f", "email": "a2@x.com"})
+}
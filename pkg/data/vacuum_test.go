@@ -0,0 +1,71 @@
+package data
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVacuumPreservesRecords(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "users.bin")
+	table := openTestTable(t, "id", filePath, WithAppendLog(100))
+	mustInsert(t, table,
+		Record{"id": "a", "name": "Ana", "age": 30, "tags": []interface{}{"x", "y"}},
+		Record{"id": "b", "name": "Bo", "meta": map[string]interface{}{"city": "Lima"}},
+		Record{"id": 7, "score": 1.5, "active": true, "note": nil},
+	)
+	if err := table.Delete("b"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	// Appended inserts and the temporary file of an interrupted write
+	mustInsert(t, table, Record{"id": "c", "name": "Cy"}, Record{"id": "d", "name": "Di"})
+	if err := os.WriteFile(filePath+tempFileSuffix, []byte("interrupted write"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	// Query returns the records in primary key order, so the results can be compared
+	want, err := table.Query(Query{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	result, err := table.Vacuum()
+	if err != nil {
+		t.Fatalf("Vacuum failed: %v", err)
+	}
+	if result.Records != 4 || result.BytesAfter <= 0 || result.BytesBefore <= result.BytesAfter {
+		t.Errorf("Vacuum = %+v, want 4 records and fewer bytes after", result)
+	}
+	for _, leftover := range []string{filePath + tempFileSuffix, appendLogPath(filePath)} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("%s is left after Vacuum: %v", leftover, err)
+		}
+	}
+	if info, err := os.Stat(filePath); err != nil || info.Size() != result.BytesAfter {
+		t.Errorf("size of the data file = %v, %v, want %d", info, err, result.BytesAfter)
+	}
+	if got, err := table.Query(Query{}); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Query after Vacuum = %v, %v, want %v", got, err, want)
+	}
+
+	// A second vacuum encrypts the same records again with fresh nonces
+	before, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if _, err := table.Vacuum(); err != nil {
+		t.Fatalf("Vacuum failed: %v", err)
+	}
+	if after, err := os.ReadFile(filePath); err != nil || bytes.Equal(after, before) {
+		t.Errorf("the data file is unchanged by a second Vacuum (%v), want it encrypted again", err)
+	}
+	if err := table.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened := openTestTable(t, "id", filePath)
+	if got, err := reopened.Query(Query{}); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Query after reopening = %v, %v, want %v", got, err, want)
+	}
+}
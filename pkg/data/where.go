@@ -0,0 +1,243 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Malpizarr/dbproto/pkg/dbdata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// The write operations report what they matched as follows:
+//   - Update and Delete affect exactly one record and fail with an error wrapping ErrNotFound if the key does not exist.
+//   - UpdateIfExists and DeleteIfExists affect at most one record and return whether the key matched one,
+//     so a missing key is not an error.
+//   - UpdateWhere and DeleteWhere affect every record matching a predicate and return the number of records affected,
+//     which is zero, without an error, when no record matches.
+// An update counts a matched record as affected even if the new values are equal to the stored ones.
+
+// UpdateIfExists is a method of the Table struct that updates the record with the given key like Update,
+// but reports a missing key as not matched instead of as an error.
+//
+// Parameters:
+// - key: An interface{} representing the key of the record to be updated. It is matched like the primary key of an inserted record, so the integer 1 and the string "1" are distinct keys.
+// - updates: A map representing the fields to be updated in the record.
+//
+// Returns:
+// - true if a record with the key exists and was updated, false if no record has the key.
+// - An error, if the update fails for any other reason.
+func (t *Table) UpdateIfExists(key interface{}, updates Record) (bool, error) {
+	if err := t.Update(key, updates); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteIfExists is a method of the Table struct that deletes the record with the given key like Delete,
+// but reports a missing key as not matched instead of as an error.
+//
+// Parameters:
+// - key: An interface{} representing the key of the record to be deleted. It is matched like the primary key of an inserted record, so the integer 1 and the string "1" are distinct keys.
+//
+// Returns:
+// - true if a record with the key existed and was deleted, false if no record has the key.
+// - An error, if the deletion fails for any other reason.
+func (t *Table) DeleteIfExists(key interface{}) (bool, error) {
+	if err := t.Delete(key); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateWhere is a method of the Table struct that applies the same updates to every record matching the predicate.
+// It locks the table for writing and checks every matching record before modifying any of them,
+// so if the updates can't be converted or would change the primary key of a matching record, no record is updated.
+// The file is written once, and only if at least one record matched.
+//
+// Parameters:
+// - pred: A function that returns true for the records to be updated.
+// - updates: A map representing the fields to be updated in the matching records.
+//
+// Returns:
+// - The number of records updated.
+// - An error, if any error occurs while reading, checking or writing the records, or an update trigger fails. No record is updated in that case.
+func (t *Table) UpdateWhere(pred func(Record) bool, updates Record) (int, error) {
+	updated := 0
+	t.Lock()
+	err := t.withTriggers(context.Background(), func() (err error) {
+		updated, err = t.updateWhereLocked(pred, updates)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// updateWhereLocked updates the matching records like UpdateWhere. The table must be locked for writing.
+func (t *Table) updateWhereLocked(pred func(Record) bool, updates Record) (int, error) {
+	updates, err := t.transformWrite(updates)
+	if err != nil {
+		return 0, err
+	}
+	if err := t.schema.checkStrings(updates); err != nil {
+		return 0, err
+	}
+	allRecords, err := t.loadForWrite()
+	if err != nil {
+		return 0, err
+	}
+
+	storedUpdates := make(map[string]*structpb.Value, len(updates))
+	for field, newValue := range updates {
+		if field == t.PrimaryKey {
+			continue
+		}
+		storedValue, err := toStoredValue(newValue)
+		if err != nil {
+			return 0, fmt.Errorf("error converting newValue for field %s: %v", field, err)
+		}
+		storedUpdates[field] = storedValue
+	}
+
+	matches, err := t.matchingKeys(allRecords, pred)
+	if err != nil {
+		return 0, err
+	}
+	for _, keyStr := range matches {
+		if err := t.checkKeyUnchanged(keyStr, allRecords.Records[keyStr], updates); err != nil {
+			return 0, err
+		}
+	}
+	if len(matches) == 0 {
+		return 0, nil
+	}
+
+	// Unindex every match first, so records swapping values between them don't conflict
+	for _, keyStr := range matches {
+		t.unindexRecord(keyStr, allRecords.Records[keyStr])
+	}
+	updatedRecords := make([]*dbdata.Record, 0, len(matches))
+	for _, keyStr := range matches {
+		updatedRecord := CloneRecord(allRecords.Records[keyStr])
+		for field, storedValue := range storedUpdates {
+			updatedRecord.Fields[field] = storedValue
+		}
+		if err := t.checkUnique(keyStr, updatedRecord); err != nil {
+			for i, updated := range updatedRecords {
+				t.unindexRecord(matches[i], updated)
+			}
+			for _, key := range matches {
+				t.indexRecord(key, allRecords.Records[key])
+			}
+			return 0, err
+		}
+		t.indexRecord(keyStr, updatedRecord)
+		updatedRecords = append(updatedRecords, updatedRecord)
+	}
+	oldRecords := make([]*dbdata.Record, len(matches))
+	for i, keyStr := range matches {
+		oldRecords[i] = allRecords.Records[keyStr]
+		allRecords.Records[keyStr] = updatedRecords[i]
+		t.recordChange(OpUpdate, keyStr, oldRecords[i], updatedRecords[i])
+	}
+
+	if err := t.writeChanges(allRecords); err != nil {
+		// The records are unchanged, so the indexes get back their entries
+		for i, keyStr := range matches {
+			t.unindexRecord(keyStr, updatedRecords[i])
+		}
+		for i, keyStr := range matches {
+			t.indexRecord(keyStr, oldRecords[i])
+		}
+		return 0, err
+	}
+	for i, keyStr := range matches {
+		t.Cache[keyStr] = updatedRecords[i]
+		t.metrics.IncrementUpdateCount()
+	}
+	t.recordAudit(AuditUpdate, matches...)
+	return len(matches), nil
+}
+
+// DeleteWhere is a method of the Table struct that deletes every record matching the predicate.
+// It locks the table for writing and writes the file once, only if at least one record matched.
+//
+// Parameters:
+// - pred: A function that returns true for the records to be deleted.
+//
+// Returns:
+// - The number of records deleted.
+// - An error, if any error occurs while reading or writing the records, or a delete trigger fails. No record is deleted in that case.
+func (t *Table) DeleteWhere(pred func(Record) bool) (int, error) {
+	deleted := 0
+	t.Lock()
+	err := t.withTriggers(context.Background(), func() (err error) {
+		deleted, err = t.deleteWhereLocked(pred)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// deleteWhereLocked deletes the matching records like DeleteWhere. The table must be locked for writing.
+func (t *Table) deleteWhereLocked(pred func(Record) bool) (int, error) {
+	allRecords, err := t.loadForWrite()
+	if err != nil {
+		return 0, err
+	}
+
+	matches, err := t.matchingKeys(allRecords, pred)
+	if err != nil {
+		return 0, err
+	}
+	if len(matches) == 0 {
+		return 0, nil
+	}
+
+	deletedRecords := make([]*dbdata.Record, len(matches))
+	for i, keyStr := range matches {
+		deletedRecords[i] = allRecords.Records[keyStr]
+		t.unindexRecord(keyStr, deletedRecords[i])
+		delete(allRecords.Records, keyStr)
+		t.recordChange(OpDelete, keyStr, deletedRecords[i], nil)
+	}
+
+	if err := t.writeChanges(allRecords); err != nil {
+		// The records are still there, so the indexes get back their entries
+		for i, keyStr := range matches {
+			t.indexRecord(keyStr, deletedRecords[i])
+		}
+		return 0, err
+	}
+	for _, keyStr := range matches {
+		delete(t.Cache, keyStr)
+		t.metrics.IncrementDeleteCount()
+	}
+	t.recordAudit(AuditDelete, matches...)
+	return len(matches), nil
+}
+
+// matchingKeys returns the keys of the records matching the predicate.
+func (t *Table) matchingKeys(allRecords *dbdata.Records, pred func(Record) bool) ([]string, error) {
+	var matches []string
+	for keyStr, protoRecord := range allRecords.Records {
+		record, err := fromProtoRecord(protoRecord)
+		if err != nil {
+			return nil, err
+		}
+		if pred(record) {
+			matches = append(matches, keyStr)
+		}
+	}
+	return matches, nil
+}
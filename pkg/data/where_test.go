@@ -0,0 +1,123 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+// errWriteFailed is the error of the renames of a failingStorage.
+var errWriteFailed = errors.New("write failed")
+
+// failingStorage is a Storage on the local disk whose renames fail once enabled, so no write of a table reaches its file.
+type failingStorage struct {
+	localStorage
+	enabled bool
+}
+
+func (s *failingStorage) Rename(oldPath, newPath string) error {
+	if s.enabled {
+		return errWriteFailed
+	}
+	return s.localStorage.Rename(oldPath, newPath)
+}
+
+func TestUpdateWhere(t *testing.T) {
+	table := newTestTable(t, "id")
+	mustInsert(t, table,
+		Record{"id": "a", "status": "open"},
+		Record{"id": "b", "status": "open"},
+		Record{"id": "c", "status": "closed"},
+	)
+
+	updated, err := table.UpdateWhere(func(r Record) bool { return r["status"] == "open" }, Record{"status": "done"})
+	if err != nil {
+		t.Fatalf("UpdateWhere failed: %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("UpdateWhere = %d, want 2", updated)
+	}
+	keys, err := table.KeysByField("status", "done")
+	if err != nil {
+		t.Fatalf("KeysByField failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("records done = %v, want a and b", keys)
+	}
+
+	if updated, err := table.UpdateWhere(func(Record) bool { return false }, Record{"status": "x"}); err != nil || updated != 0 {
+		t.Errorf("UpdateWhere without matches = %d, %v, want 0", updated, err)
+	}
+	if _, err := table.UpdateWhere(func(Record) bool { return true }, Record{"id": "z"}); !errors.Is(err, ErrPrimaryKeyChange) {
+		t.Errorf("UpdateWhere changing the key error = %v, want %v", err, ErrPrimaryKeyChange)
+	}
+}
+
+func TestUpdateWhereFailedWriteKeepsIndexes(t *testing.T) {
+	storage := &failingStorage{}
+	table := newTestTable(t, "id", WithStorage(storage))
+	if err := table.CreateIndex("status"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	if err := table.AddUniqueConstraint("email", false); err != nil {
+		t.Fatalf("AddUniqueConstraint failed: %v", err)
+	}
+	mustInsert(t, table, Record{"id": "a", "status": "open", "email": "a@example.com"})
+
+	storage.enabled = true
+	if _, err := table.UpdateWhere(func(Record) bool { return true }, Record{"status": "done", "email": "x@example.com"}); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("UpdateWhere error = %v, want %v", err, errWriteFailed)
+	}
+	storage.enabled = false
+
+	open, err := table.SelectByIndex("status", "open")
+	if err != nil {
+		t.Fatalf("SelectByIndex failed: %v", err)
+	}
+	if len(open) != 1 {
+		t.Errorf("index holds %d open records after the failed write, want 1", len(open))
+	}
+	done, err := table.SelectByIndex("status", "done")
+	if err != nil {
+		t.Fatalf("SelectByIndex failed: %v", err)
+	}
+	if len(done) != 0 {
+		t.Errorf("index holds %d done records after the failed write, want 0", len(done))
+	}
+	// The unique constraint still knows the email of the record, and not the one of the failed update
+	if err := table.Insert(Record{"id": "b", "email": "a@example.com"}); err == nil {
+		t.Error("Insert of a taken email succeeded after the failed write")
+	}
+	mustInsert(t, table, Record{"id": "c", "email": "x@example.com"})
+}
+
+func TestDeleteWhereFailedWriteKeepsIndexes(t *testing.T) {
+	storage := &failingStorage{}
+	table := newTestTable(t, "id", WithStorage(storage))
+	if err := table.CreateIndex("status"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	mustInsert(t, table, Record{"id": "a", "status": "open"}, Record{"id": "b", "status": "open"})
+
+	storage.enabled = true
+	if _, err := table.DeleteWhere(func(Record) bool { return true }); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("DeleteWhere error = %v, want %v", err, errWriteFailed)
+	}
+	storage.enabled = false
+
+	open, err := table.SelectByIndex("status", "open")
+	if err != nil {
+		t.Fatalf("SelectByIndex failed: %v", err)
+	}
+	if len(open) != 2 {
+		t.Errorf("index holds %d open records after the failed write, want 2", len(open))
+	}
+
+	deleted, err := table.DeleteWhere(func(r Record) bool { return r["id"] == "a" })
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteWhere = %d, %v, want 1", deleted, err)
+	}
+	count, err := table.Count()
+	if err != nil || count != 1 {
+		t.Errorf("Count = %d, %v, want 1", count, err)
+	}
+}
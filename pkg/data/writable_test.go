@@ -0,0 +1,72 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestInitializeFailsOnReadOnlyDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "databases")
+	if err := os.Mkdir(dir, 0555); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	defer os.Chmod(dir, 0755)
+	if file, err := os.Create(filepath.Join(dir, "probe")); err == nil {
+		// Permissions don't apply, for example to root, so the directory is writable anyway
+		file.Close()
+		t.Skip("the read-only directory is writable by this user")
+	}
+
+	server, err := NewServerWithConfig(Config{Dir: dir, BackupDir: t.TempDir(), AESKey: testAESKey})
+	if err != nil {
+		t.Fatalf("NewServerWithConfig failed: %v", err)
+	}
+	err = server.Initialize()
+	if err == nil || !strings.Contains(err.Error(), dir) || !strings.Contains(err.Error(), "not writable") {
+		t.Errorf("Initialize on a read-only directory = %v, want an error naming the directory", err)
+	}
+}
+
+// readOnlyStorage is a memStorage on which files can't be created, like a read-only mount.
+type readOnlyStorage struct {
+	*memStorage
+}
+
+func (s readOnlyStorage) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EROFS}
+	}
+	return s.memStorage.OpenFile(name, flag, perm)
+}
+
+func TestInitializeChecksTheStorageIsWritable(t *testing.T) {
+	open := func(storage Storage, replica bool) error {
+		server, err := NewServerWithConfig(Config{Dir: "/databases", BackupDir: "/backups", AESKey: testAESKey, Storage: storage, Replica: replica})
+		if err != nil {
+			t.Fatalf("NewServerWithConfig failed: %v", err)
+		}
+		defer server.Close()
+		return server.Initialize()
+	}
+
+	readOnly := readOnlyStorage{newMemStorage()}
+	if err := open(readOnly, false); err == nil || !strings.Contains(err.Error(), "/databases is not writable") {
+		t.Errorf("Initialize on a read-only storage = %v, want an error naming the directory", err)
+	}
+	// Replicas don't write, so they start on a read-only storage
+	if err := open(readOnly, true); err != nil {
+		t.Errorf("Initialize of a replica on a read-only storage failed: %v", err)
+	}
+	// The probe is removed from a writable directory
+	storage := newMemStorage()
+	if err := open(storage, false); err != nil {
+		t.Fatalf("Initialize on a writable storage failed: %v", err)
+	}
+	entries, err := storage.ReadDir("/databases")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("ReadDir = %v, %v, want an empty directory", entries, err)
+	}
+}
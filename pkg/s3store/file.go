@@ -0,0 +1,131 @@
+package s3store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// objectFile is a file held in an object, buffered in memory between its download and its upload.
+type objectFile struct {
+	store  *Store // Store of the object
+	name   string // Path of the file
+	key    string // Key of the object
+	flag   int    // Flags the file was opened with
+	data   []byte // Content of the file, once loaded
+	pos    int64  // Offset of the next read or write
+	loaded bool   // Whether data holds the content of the file
+	dirty  bool   // Whether data was changed since the file was last uploaded
+	dir    bool   // Whether the file is a directory opened to be synced
+	closed bool   // Whether the file was closed
+}
+
+// load downloads the content of the object, if it wasn't yet.
+func (f *objectFile) load() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	if f.loaded {
+		return nil
+	}
+	content, err := f.store.get(f.key)
+	if errors.Is(err, fs.ErrNotExist) && f.flag&os.O_CREATE != 0 {
+		content, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	f.data = content
+	f.loaded = true
+	return nil
+}
+
+// Read reads from the content of the file.
+func (f *objectFile) Read(p []byte) (int, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	if f.pos >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[f.pos:])
+	f.pos += int64(n)
+	return n, nil
+}
+
+// Write writes at the current offset, or at the end of the file if it was opened for appending,
+// in which case the object is uploaded at once.
+func (f *objectFile) Write(p []byte) (int, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.pos = int64(len(f.data))
+	}
+	n, err := f.WriteAt(p, f.pos)
+	f.pos += int64(n)
+	if err == nil && f.flag&os.O_APPEND != 0 {
+		err = f.Sync()
+	}
+	return n, err
+}
+
+// WriteAt writes at the given offset, extending the file with zeros if the offset is past its end.
+func (f *objectFile) WriteAt(p []byte, off int64) (int, error) {
+	if f.dir || f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	if end := off + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	copy(f.data[off:], p)
+	f.dirty = true
+	return len(p), nil
+}
+
+// Truncate changes the size of the file.
+func (f *objectFile) Truncate(size int64) error {
+	if f.dir || f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrPermission}
+	}
+	if err := f.load(); err != nil {
+		return err
+	}
+	if size < int64(len(f.data)) {
+		f.data = f.data[:size]
+	} else {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	f.dirty = true
+	return nil
+}
+
+// Sync uploads the content of the file if it changed since it was last uploaded.
+func (f *objectFile) Sync() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	if !f.dirty {
+		return nil
+	}
+	if err := f.store.put(f.key, f.data); err != nil {
+		return fmt.Errorf("error uploading '%s': %w", f.name, err)
+	}
+	f.dirty = false
+	return nil
+}
+
+// Close uploads the content of the file if it changed, and closes it.
+func (f *objectFile) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	err := f.Sync()
+	f.closed = true
+	return err
+}
@@ -0,0 +1,479 @@
+// Package s3store provides a data.Storage backed by an S3 bucket, or any object store speaking the S3 API,
+// so protodb can keep its tables in cloud storage instead of on a local disk.
+package s3store
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Malpizarr/dbproto/pkg/data"
+)
+
+// DefaultConsistencyRetries is the number of times a read of an object this store wrote is retried
+// while the object store still returns an older version of the object, if Config.ConsistencyRetries is zero.
+const DefaultConsistencyRetries = 5
+
+// DefaultConsistencyBackoff is the delay before the first retry of a stale read, if Config.ConsistencyBackoff is zero.
+const DefaultConsistencyBackoff = 100 * time.Millisecond
+
+// Config holds the settings of a Store.
+type Config struct {
+	Bucket             string        // Name of the bucket
+	Region             string        // Region of the bucket, such as "us-east-1"
+	Endpoint           string        // URL of the S3 API, https://s3.<region>.amazonaws.com if empty
+	PathStyle          bool          // Whether the bucket is addressed in the path of the URLs instead of the host name, as most S3-compatible stores require
+	AccessKeyID        string        // Access key ID of the credentials
+	SecretAccessKey    string        // Secret access key of the credentials
+	SessionToken       string        // Session token of temporary credentials, if any
+	Prefix             string        // Prefix of the keys of the objects, such as "protodb/", to share a bucket
+	HTTPClient         *http.Client  // Client sending the requests, http.DefaultClient if nil
+	ConsistencyRetries int           // Number of retries of a stale read, DefaultConsistencyRetries if zero, none if negative
+	ConsistencyBackoff time.Duration // Delay before the first retry of a stale read, doubled after each retry, DefaultConsistencyBackoff if zero
+}
+
+// Store is a data.Storage keeping each file in an object of an S3 bucket, under the key made of the prefix
+// of the store followed by the path of the file without its leading slash.
+//
+// Objects are replaced atomically by a put, so a reader sees either the previous or the new content of a file.
+// Renaming a file copies the object on the server side, then deletes the source. Directories don't exist in S3:
+// creating one does nothing, and a directory exists as long as an object has its path as a prefix.
+// A file opened for writing is held in memory and uploaded when it is synced or closed; a file opened for appending,
+// such as an audit log, is uploaded on each write instead, since objects can't be appended to.
+//
+// Object stores that are only eventually consistent can return the previous version of an object just after it was written.
+// The store remembers the ETag of the objects it wrote, and retries a read returning another version, or no object,
+// with the backoff of Config.ConsistencyBackoff. Listings may still lag behind the writes of other processes on such stores,
+// so a server should only be initialized on a bucket once the writes of the previous server are visible.
+type Store struct {
+	config   Config            // Settings of the store
+	endpoint *url.URL          // Parsed endpoint
+	mu       sync.Mutex        // Mutex guarding written
+	written  map[string]string // ETags of the objects written by the store, by key
+}
+
+// New creates a Store with the given settings.
+//
+// Parameters:
+// - config: The settings of the store. The bucket, the region and the credentials are required.
+//
+// Returns:
+// - A pointer to the new Store.
+// - An error, if a required setting is missing or the endpoint is not a valid URL.
+func New(config Config) (*Store, error) {
+	if config.Bucket == "" || config.Region == "" {
+		return nil, fmt.Errorf("the bucket and the region are required")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("the access key ID and the secret access key are required")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", config.Endpoint)
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.ConsistencyRetries == 0 {
+		config.ConsistencyRetries = DefaultConsistencyRetries
+	}
+	if config.ConsistencyBackoff <= 0 {
+		config.ConsistencyBackoff = DefaultConsistencyBackoff
+	}
+	return &Store{config: config, endpoint: endpoint, written: make(map[string]string)}, nil
+}
+
+// Error is the error of a request the object store rejected.
+type Error struct {
+	Op         string // Operation of the request, such as "get" or "put"
+	Key        string // Key of the object, or prefix of the listing
+	StatusCode int    // HTTP status code of the response
+	Code       string // Error code returned by the store, such as "AccessDenied", if any
+	Message    string // Error message returned by the store, if any
+}
+
+// Error describes the error.
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 %s %s: status %d", e.Op, e.Key, e.StatusCode)
+	}
+	return fmt.Sprintf("s3 %s %s: %s: %s (status %d)", e.Op, e.Key, e.Code, e.Message, e.StatusCode)
+}
+
+// Timeout reports whether the store was unavailable or throttled the request, so it can be retried,
+// for example by the data.WithIORetry option of the tables.
+func (e *Error) Timeout() bool {
+	return e.StatusCode == http.StatusInternalServerError || e.StatusCode == http.StatusServiceUnavailable
+}
+
+// key returns the key of the object of the file at the given path.
+func (s *Store) key(name string) string {
+	return s.config.Prefix + strings.TrimPrefix(filepath.ToSlash(name), "/")
+}
+
+// notExist returns the error of a missing file.
+func notExist(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// request sends a signed request on the object with the given key, or on the bucket if the key is empty.
+// It returns the response if its status is 2xx, and an *Error otherwise, or a wrapped fs.ErrNotExist for a 404.
+func (s *Store) request(op, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	escapedKey := uriEncode(key, false)
+	if s.config.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.config.Bucket + "/" + key
+		u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + uriEncode(s.config.Bucket, true) + "/" + escapedKey
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escapedKey
+	}
+	if key == "" {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", op, key, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = hexSHA256(body)
+	}
+	s.signRequest(req, payloadHash, time.Now())
+
+	resp, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", op, key, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, notExist(op, key)
+	}
+	return nil, responseError(op, key, resp)
+}
+
+// responseError returns the error of a response rejected by the store, with the code and the message of its body.
+func responseError(op, key string, resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	xml.Unmarshal(content, &body)
+	return &Error{Op: op, Key: key, StatusCode: resp.StatusCode, Code: body.Code, Message: body.Message}
+}
+
+// consistent runs the request of an object, retrying it with backoff while the store returns a version of the object
+// other than the last one the store wrote, or no object at all. The request gets the ETag to expect, if any.
+func (s *Store) consistent(key string, request func(etag string) error) error {
+	s.mu.Lock()
+	etag, known := s.written[key]
+	s.mu.Unlock()
+	err := request(etag)
+	delay := s.config.ConsistencyBackoff
+	for retry := 0; known && retry < s.config.ConsistencyRetries && err != nil && isStale(err); retry++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = request(etag)
+	}
+	return err
+}
+
+// isStale reports whether the error of a request expecting an ETag may come from a store returning an older version of the object.
+func isStale(err error) bool {
+	var storeErr *Error
+	return errors.Is(err, fs.ErrNotExist) || (errors.As(err, &storeErr) && storeErr.StatusCode == http.StatusPreconditionFailed)
+}
+
+// remember records the ETag of an object written by the store, or forgets the object if the ETag is empty.
+func (s *Store) remember(key, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if etag == "" {
+		delete(s.written, key)
+	} else {
+		s.written[key] = etag
+	}
+}
+
+// get returns the content of the object with the given key.
+func (s *Store) get(key string) ([]byte, error) {
+	var content []byte
+	err := s.consistent(key, func(etag string) error {
+		header := http.Header{}
+		if etag != "" {
+			header.Set("If-Match", etag)
+		}
+		resp, err := s.request("get", http.MethodGet, key, nil, header, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		content, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("s3 get %s: %w", key, err)
+		}
+		return nil
+	})
+	return content, err
+}
+
+// put replaces the object with the given key with the content.
+func (s *Store) put(key string, content []byte) error {
+	resp, err := s.request("put", http.MethodPut, key, nil, nil, content)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	s.remember(key, resp.Header.Get("ETag"))
+	return nil
+}
+
+// ReadFile returns the content of the object of the file.
+func (s *Store) ReadFile(name string) ([]byte, error) {
+	content, err := s.get(s.key(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, notExist("open", name)
+	}
+	return content, err
+}
+
+// OpenFile opens the file held in the object at the given path, with the flags of os.OpenFile.
+// The content of the object is only downloaded once the file is read or written, and not at all if the file is truncated.
+// A directory can be opened read-only, to be synced, which does nothing.
+func (s *Store) OpenFile(name string, flag int, perm os.FileMode) (data.File, error) {
+	file := &objectFile{store: s, name: name, key: s.key(name), flag: flag}
+	if flag&os.O_TRUNC != 0 && flag&os.O_CREATE != 0 {
+		file.loaded = true
+		file.dirty = true
+		return file, nil
+	}
+	info, err := s.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0 {
+		file.loaded = true
+		file.dirty = true
+		return file, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+		}
+		file.dir = true
+		file.loaded = true
+		return file, nil
+	}
+	if flag&os.O_TRUNC != 0 {
+		file.loaded = true
+		file.dirty = true
+	}
+	return file, nil
+}
+
+// MkdirAll does nothing, since directories only exist as the prefixes of the keys of the objects.
+func (s *Store) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+// Rename copies the object of the file to the object of the new path on the server side, which replaces it atomically,
+// then deletes the object of the old path.
+func (s *Store) Rename(oldPath, newPath string) error {
+	oldKey, newKey := s.key(oldPath), s.key(newPath)
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", "/"+uriEncode(s.config.Bucket, true)+"/"+uriEncode(oldKey, false))
+	resp, err := s.request("copy", http.MethodPut, newKey, nil, header, nil)
+	if errors.Is(err, fs.ErrNotExist) {
+		return notExist("rename", oldPath)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// A copy can fail after the response status was sent, in which case the body holds the error
+	var result struct {
+		XMLName xml.Name
+		ETag    string `xml:"ETag"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("s3 copy %s: %w", newKey, err)
+	}
+	if err := xml.Unmarshal(content, &result); err == nil && result.XMLName.Local == "Error" {
+		return &Error{Op: "copy", Key: newKey, StatusCode: resp.StatusCode, Code: result.Code, Message: result.Message}
+	}
+	s.remember(newKey, result.ETag)
+	return s.Remove(oldPath)
+}
+
+// Remove deletes the object of the file. Deleting a missing object succeeds, as with S3.
+func (s *Store) Remove(name string) error {
+	key := s.key(name)
+	resp, err := s.request("delete", http.MethodDelete, key, nil, nil, nil)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	s.remember(key, "")
+	return nil
+}
+
+// objectInfo is the information of an object, or of a directory made of the objects sharing a prefix.
+type objectInfo struct {
+	name    string    // Base name of the file
+	size    int64     // Size of the object
+	modTime time.Time // Time the object was last modified
+	dir     bool      // Whether the information is the one of a directory
+}
+
+func (i objectInfo) Name() string       { return i.name }
+func (i objectInfo) Size() int64        { return i.size }
+func (i objectInfo) ModTime() time.Time { return i.modTime }
+func (i objectInfo) IsDir() bool        { return i.dir }
+func (i objectInfo) Sys() interface{}   { return nil }
+
+func (i objectInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// Stat returns the information of the object of the file, or of the directory if objects have its path as a prefix.
+func (s *Store) Stat(name string) (os.FileInfo, error) {
+	key := s.key(name)
+	var info os.FileInfo
+	err := s.consistent(key, func(etag string) error {
+		header := http.Header{}
+		if etag != "" {
+			header.Set("If-Match", etag)
+		}
+		resp, err := s.request("head", http.MethodHead, key, nil, header, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		info = objectInfo{name: path.Base(key), size: resp.ContentLength, modTime: modTime}
+		return nil
+	})
+	if !errors.Is(err, fs.ErrNotExist) {
+		return info, err
+	}
+
+	listing, err := s.list(strings.TrimSuffix(key, "/")+"/", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(listing.Contents) == 0 && len(listing.CommonPrefixes) == 0 {
+		return nil, notExist("stat", name)
+	}
+	return objectInfo{name: path.Base(key), dir: true}, nil
+}
+
+// listResult is a page of the result of a ListObjectsV2 request.
+type listResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// list returns the objects and the common prefixes directly under the given prefix, up to maxKeys of them if positive,
+// following the continuation tokens otherwise.
+func (s *Store) list(prefix string, maxKeys int) (*listResult, error) {
+	all := &listResult{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+		if maxKeys > 0 {
+			query.Set("max-keys", strconv.Itoa(maxKeys))
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.request("list", http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list %s: %w", prefix, err)
+		}
+		all.Contents = append(all.Contents, page.Contents...)
+		all.CommonPrefixes = append(all.CommonPrefixes, page.CommonPrefixes...)
+		if maxKeys > 0 || !page.IsTruncated || page.NextContinuationToken == "" {
+			return all, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// ReadDir returns the objects and the directories directly under the directory, sorted by name.
+// Since MkdirAll creates nothing, a directory no object has as a prefix is read as an empty directory.
+func (s *Store) ReadDir(name string) ([]os.DirEntry, error) {
+	prefix := strings.TrimSuffix(s.key(name), "/") + "/"
+	if prefix == "/" {
+		prefix = s.config.Prefix
+	}
+	listing, err := s.list(prefix, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []os.DirEntry
+	for _, object := range listing.Contents {
+		base := strings.TrimPrefix(object.Key, prefix)
+		if base == "" {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(objectInfo{name: base, size: object.Size, modTime: object.LastModified}))
+	}
+	for _, common := range listing.CommonPrefixes {
+		base := strings.TrimSuffix(strings.TrimPrefix(common.Prefix, prefix), "/")
+		entries = append(entries, fs.FileInfoToDirEntry(objectInfo{name: base, dir: true}))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
@@ -18,12 +18,17 @@ type Utils struct {
 // NewUtils creates a new Utils instance with the AES key from the environment variable.
 // The AES key must be exactly 32 bytes (256 bits) long.
 func NewUtils() (*Utils, error) {
-	key := os.Getenv("AES_KEY")
+	return NewUtilsWithKey([]byte(os.Getenv("AES_KEY")))
+}
+
+// NewUtilsWithKey creates a new Utils instance with the given AES key instead of the one of the environment variable.
+// The AES key must be exactly 32 bytes (256 bits) long.
+func NewUtilsWithKey(key []byte) (*Utils, error) {
 	if len(key) != 32 {
 		return nil, errors.New("AES key must be exactly 32 bytes (256 bits) long")
 	}
 	return &Utils{
-		aesKey: []byte(key),
+		aesKey: append([]byte(nil), key...),
 	}, nil
 }
 